@@ -0,0 +1,315 @@
+package cl
+
+import (
+	"go/types"
+	"strconv"
+	"strings"
+
+	"github.com/goplus/c2go/clang/ast"
+
+	ctypes "github.com/goplus/c2go/clang/types"
+)
+
+// -----------------------------------------------------------------------------
+// Attributes of C functions are merged across the declarations of a function,
+// and the ones of defined and used functions are kept in PkgInfo.FuncAttrs.
+// Clang doesn't dump their arguments, which are read from the source. They map
+// to Go as follows:
+//
+//	deprecated           a "Deprecated:" paragraph of the doc comment
+//	nonnull              checked.NonNull of parameters in checked pointers mode
+//	format               checks of format strings at call sites
+//	noreturn, _Noreturn  no zero return after a call ending a function
+
+type formatAttr struct {
+	archetype string // such as printf
+	fmtIdx    int    // index of the format parameter, from 1
+	firstArg  int    // index of the first argument to check, or 0 (va_list)
+}
+
+type funcAttrs struct {
+	spellings  []string // such as nonnull(1, 3)
+	deprecated *string  // message of deprecated
+	nonnull    []int    // indexes of parameters which mustn't be NULL, from 1
+	nonnullAll bool     // nonnull without arguments: all pointer parameters
+	format     *formatAttr
+	noreturn   bool
+	keep       bool // the function is defined or used
+}
+
+const noreturnType = "__attribute__((noreturn))"
+
+// initFuncAttrs merges the attributes of the declaration fn of a function.
+func (p *blockCtx) initFuncAttrs(fn *ast.Node, body *ast.Node) *funcAttrs {
+	a, ok := p.fnattrs[fn.Name]
+	if !ok {
+		a = new(funcAttrs)
+		p.fnattrs[fn.Name] = a
+	}
+	a.keep = a.keep || body != nil || fn.IsUsed
+	if strings.HasSuffix(fn.Type.QualType, noreturnType) {
+		a.add("noreturn")
+		a.noreturn = true
+	}
+	iparam := 0
+	for _, item := range fn.Inner {
+		switch item.Kind {
+		case ast.ParmVarDecl:
+			iparam++
+			for _, attr := range item.Inner {
+				if attr.Kind == ast.NonNullAttr {
+					a.add("nonnull(" + strconv.Itoa(iparam) + ")")
+					a.nonnull = append(a.nonnull, iparam)
+				}
+			}
+		case ast.DeprecatedAttr:
+			_, args := parseAttr(a.add(p.attrSpelling(item, "deprecated")))
+			msg := ""
+			if len(args) > 0 {
+				if msg, ok = unquoteAttr(args[0]); !ok {
+					msg = args[0]
+				}
+			}
+			a.deprecated = &msg
+		case ast.NonNullAttr:
+			_, args := parseAttr(a.add(p.attrSpelling(item, "nonnull")))
+			if len(args) == 0 {
+				a.nonnullAll = true
+			}
+			for _, arg := range args {
+				if idx, err := strconv.Atoi(arg); err == nil {
+					a.nonnull = append(a.nonnull, idx)
+				}
+			}
+		case ast.FormatAttr:
+			spelling := p.attrSpelling(item, "format")
+			if _, args := parseAttr(spelling); len(args) == 3 {
+				args[0] = trimUnderscores(args[0]) // such as __printf__ of glibc
+				fmtIdx, err1 := strconv.Atoi(args[1])
+				firstArg, err2 := strconv.Atoi(args[2])
+				if err1 == nil && err2 == nil {
+					a.format = &formatAttr{archetype: args[0], fmtIdx: fmtIdx, firstArg: firstArg}
+				}
+				spelling = "format(" + strings.Join(args, ", ") + ")"
+			}
+			a.add(spelling)
+		case ast.C11NoReturnAttr:
+			a.add("_Noreturn")
+			a.noreturn = true
+		case ast.WarnUnusedResultAttr:
+			a.add(p.attrSpelling(item, "warn_unused_result"))
+		case ast.AllocSizeAttr:
+			a.add(p.attrSpelling(item, "alloc_size"))
+		}
+	}
+	return a
+}
+
+func (p *funcAttrs) add(spelling string) string {
+	for _, s := range p.spellings {
+		if s == spelling {
+			return spelling
+		}
+	}
+	p.spellings = append(p.spellings, spelling)
+	return spelling
+}
+
+// isNonNull reports whether the i-th parameter (from 0) of type typ mustn't be
+// NULL.
+func (p *funcAttrs) isNonNull(i int, typ types.Type) bool {
+	if _, ok := typ.(*types.Pointer); !ok && typ != ctypes.UnsafePointer {
+		return false
+	}
+	if p.nonnullAll {
+		return true
+	}
+	for _, idx := range p.nonnull {
+		if idx == i+1 {
+			return true
+		}
+	}
+	return false
+}
+
+// attrSpelling returns the source of attr without __attribute__((...)), such
+// as nonnull(1, 3), or name if the source is unknown.
+func (p *blockCtx) attrSpelling(attr *ast.Node, name string) string {
+	r := attr.Range
+	if r == nil || r.Begin.SpellingLoc != nil || r.End.SpellingLoc != nil || (p.src == nil && p.srcfile == "") {
+		return name
+	}
+	src := p.getSource()
+	begin, end := int(r.Begin.Offset), int(r.End.Offset)+r.End.TokLen
+	if begin >= end || end > len(src) {
+		return name
+	}
+	s := strings.Join(strings.Fields(string(src[begin:end])), " ")
+	if pos := strings.IndexByte(s, '('); pos > 0 {
+		return trimUnderscores(strings.TrimSpace(s[:pos])) + s[pos:]
+	}
+	return trimUnderscores(s)
+}
+
+// trimUnderscores trims the underscores of reserved spellings, such as
+// __nonnull__ and __printf__.
+func trimUnderscores(name string) string {
+	if strings.HasPrefix(name, "__") && strings.HasSuffix(name, "__") && len(name) > 4 {
+		return name[2 : len(name)-2]
+	}
+	return name
+}
+
+// parseAttr returns the name and arguments of an attribute spelling.
+func parseAttr(spelling string) (name string, args []string) {
+	pos := strings.IndexByte(spelling, '(')
+	end := strings.LastIndexByte(spelling, ')')
+	if pos < 0 || end < pos {
+		return spelling, nil
+	}
+	name = strings.TrimSpace(spelling[:pos])
+	depth, quoted, start := 0, false, pos+1
+	for i := start; i < end; i++ {
+		switch c := spelling[i]; {
+		case quoted:
+			if c == '\\' {
+				i++
+			} else if c == '"' {
+				quoted = false
+			}
+		case c == '"':
+			quoted = true
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+		case c == ',' && depth == 0:
+			args = append(args, strings.TrimSpace(spelling[start:i]))
+			start = i + 1
+		}
+	}
+	if arg := strings.TrimSpace(spelling[start:end]); arg != "" || len(args) > 0 {
+		args = append(args, arg)
+	}
+	return
+}
+
+// unquoteAttr returns the value of a string argument, which may consist of
+// adjacent string literals.
+func unquoteAttr(arg string) (string, bool) {
+	var b strings.Builder
+	for arg = strings.TrimSpace(arg); arg != ""; arg = strings.TrimSpace(arg) {
+		if arg[0] != '"' {
+			return "", false
+		}
+		lit, err := strconv.QuotedPrefix(arg)
+		if err != nil {
+			return "", false
+		}
+		s, err := strconv.Unquote(lit)
+		if err != nil {
+			return "", false
+		}
+		b.WriteString(s)
+		arg = arg[len(lit):]
+	}
+	return b.String(), true
+}
+
+// attrsOfFuncs returns the attributes of the defined and used functions.
+func (p *blockCtx) attrsOfFuncs() map[string][]string {
+	ret := make(map[string][]string)
+	for name, a := range p.fnattrs {
+		if a.keep && len(a.spellings) > 0 {
+			ret[name] = a.spellings
+		}
+	}
+	return ret
+}
+
+// deprecations returns the messages of deprecated functions by Go names.
+func (p *blockCtx) deprecations() map[string]string {
+	ret := make(map[string]string)
+	for name, a := range p.fnattrs {
+		if a.keep && a.deprecated != nil {
+			ret[p.ident(name)] = *a.deprecated
+		}
+	}
+	return ret
+}
+
+// -----------------------------------------------------------------------------
+
+// checkNonNull checks the parameters of fn which mustn't be NULL (see
+// Config.NonNullChecks). Failures report the positions of the parameters.
+func checkNonNull(ctx *blockCtx, fn *ast.Node, attrs *funcAttrs, params []*types.Var) {
+	cb := ctx.cb
+	i := 0
+	for _, item := range fn.Inner {
+		if item.Kind != ast.ParmVarDecl {
+			continue
+		}
+		if param := params[i]; param.Name() != "" && param.Name() != "_" && attrs.isNonNull(i, param.Type()) {
+			cb.Val(ctx.checkedRef("NonNull")).
+				Typ(ctypes.UnsafePointer).Val(param).Call(1).Val(param.Name()).Val(ctx.srcPos(item)).
+				Call(3).EndStmt()
+		}
+		i++
+	}
+}
+
+// calleeDecl returns the declaration of the function which the call v calls
+// directly, or nil if it is called by a pointer.
+func calleeDecl(v *ast.Node) *ast.Node {
+	if v.Kind != ast.CallExpr || len(v.Inner) == 0 {
+		return nil
+	}
+	fn := unparen(v.Inner[0])
+	if fn.Kind != ast.DeclRefExpr {
+		return nil
+	}
+	return fn.ReferencedDecl
+}
+
+// unparen strips implicit casts and parentheses of v.
+func unparen(v *ast.Node) *ast.Node {
+	for (v.Kind == ast.ImplicitCastExpr || v.Kind == ast.ParenExpr) && len(v.Inner) > 0 {
+		v = v.Inner[0]
+	}
+	return v
+}
+
+// isNoReturnCall reports whether v calls a function which doesn't return, such
+// as abort or exit.
+func (p *blockCtx) isNoReturnCall(v *ast.Node) bool {
+	decl := calleeDecl(v)
+	if decl == nil {
+		return false
+	}
+	if decl.Type != nil && strings.HasSuffix(decl.Type.QualType, noreturnType) {
+		return true
+	}
+	a, ok := p.fnattrs[decl.Name]
+	return ok && a.noreturn
+}
+
+// fallsThrough reports whether execution may continue after stmt.
+func (p *blockCtx) fallsThrough(stmt *ast.Node) bool {
+	switch stmt.Kind {
+	case ast.ReturnStmt:
+		return false
+	case ast.CallExpr:
+		return !p.isNoReturnCall(stmt)
+	case ast.CompoundStmt:
+		if n := len(stmt.Inner); n > 0 {
+			return p.fallsThrough(stmt.Inner[n-1])
+		}
+	case ast.IfStmt:
+		if stmt.HasElse && len(stmt.Inner) == 3 {
+			return p.fallsThrough(stmt.Inner[1]) || p.fallsThrough(stmt.Inner[2])
+		}
+	}
+	return true
+}
+
+// -----------------------------------------------------------------------------
@@ -0,0 +1,58 @@
+package cl
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/goplus/c2go/clang/parser"
+)
+
+// -----------------------------------------------------------------------------
+
+func TestFuncAttrs(t *testing.T) {
+	doc, src := parseWith(`
+int printf(const char *fmt, ...) __attribute__((__format__(__printf__, 1, 2)));
+void unused(void *p) __attribute__((nonnull));
+
+/* old_add is replaced by add. */
+__attribute__((deprecated("use add instead"), warn_unused_result))
+int old_add(int a, int b) { return a + b; }
+
+__attribute__((deprecated, nonnull(1, 2)))
+void copy(int *dst, const int *src) { *dst = *src; }
+
+void test(void) {
+	printf("%d\n", old_add(1, 2));
+}
+`, parser.ParseComments, nil)
+	pkg, err := NewPackage("", "main", doc, &Config{Src: src})
+	if err != nil {
+		t.Fatal("NewPackage:", err)
+	}
+	expected := map[string][]string{
+		"printf":  {"format(printf, 1, 2)"},
+		"old_add": {"deprecated(\"use add instead\")", "warn_unused_result"},
+		"copy":    {"deprecated", "nonnull(1, 2)"},
+	}
+	if !reflect.DeepEqual(pkg.FuncAttrs, expected) {
+		t.Fatal("FuncAttrs:", pkg.FuncAttrs)
+	}
+	var out bytes.Buffer
+	if err := pkg.WritePkgTo(&out); err != nil {
+		t.Fatal("WritePkgTo:", err)
+	}
+	code := out.String()
+	for _, want := range []string{`// old_add is replaced by add.
+//
+// Deprecated: use add instead
+func old_add(`, `// Deprecated: this function is deprecated.
+func copy_(`} {
+		if !strings.Contains(code, want) {
+			t.Fatalf("WritePkgTo:\n%s\n", code)
+		}
+	}
+}
+
+// -----------------------------------------------------------------------------
@@ -0,0 +1,121 @@
+package cl
+
+import (
+	"go/types"
+	"log"
+	"os"
+	"strings"
+
+	goast "go/ast"
+
+	"github.com/goplus/c2go/clang/ast"
+	"github.com/goplus/gox"
+)
+
+// -----------------------------------------------------------------------------
+// In bind mode (Config.Bind) only declarations are generated. Types, struct
+// layouts and enum constants are converted as usual, while functions become
+// stubs (see StubKind) and variables are declared without initializers.
+
+// StubKind specifies how functions are generated in bind mode.
+type StubKind int
+
+const (
+	// StubNone skips functions.
+	StubNone StubKind = iota
+
+	// StubPanic generates functions whose bodies panic, so that the output
+	// links without an implementation.
+	StubPanic
+
+	// StubLinkname generates bodyless functions with `//go:linkname` directives
+	// that pull the implementations from BindConfig.LinkPkg, which is imported
+	// for its side effects. Package.WritePkgFile writes an empty assembly file
+	// next to the output, so that the go tool doesn't compile the package with
+	// -complete, which rejects bodyless functions.
+	// Since Go 1.23 the implementations should be marked by push-side
+	// directives in LinkPkg, such as `//go:linkname area`.
+	StubLinkname
+)
+
+// BindConfig is the configuration of bind mode.
+type BindConfig struct {
+	// Filter selects functions, variables and macros to be generated by their
+	// C names. All of them are selected if Filter is nil. Types and enum
+	// constants are always generated.
+	Filter func(name string) bool
+
+	// Stubs specifies how functions are generated.
+	Stubs StubKind
+
+	// LinkPkg is the import path of the package implementing the functions if
+	// Stubs is StubLinkname.
+	LinkPkg string
+}
+
+func (p *BindConfig) selected(name string) bool {
+	return p.Filter == nil || p.Filter(name)
+}
+
+func bindFunc(ctx *blockCtx, fn *ast.Node, params []*types.Var, results *types.Tuple, variadic, hasName bool) {
+	conf := ctx.bind
+	if conf.Stubs == StubNone || !conf.selected(fn.Name) {
+		return
+	}
+	pkg, name := ctx.pkg, ctx.ident(fn.Name)
+	if pkg.Types.Scope().Lookup(name) != nil { // redeclaration
+		return
+	}
+	if hasName { // Go doesn't allow mixing named and unnamed parameters
+		for i, param := range params {
+			if param.Name() == "" {
+				params[i] = types.NewParam(param.Pos(), pkg.Types, "_", param.Type())
+			}
+		}
+	}
+	sig := gox.NewCSignature(types.NewTuple(params...), results, variadic)
+	pos := goNodePos(fn)
+	ctx.declare(pkg.Types.Scope(), name)
+	switch conf.Stubs {
+	case StubPanic:
+		f, err := pkg.NewFuncWith(pos, name, sig, nil)
+		if err != nil {
+			log.Panicln("bindFunc:", err)
+		}
+		f.BodyStart(pkg).
+			Val(types.Universe.Lookup("panic")).Val("notimpl").Call(1).EndStmt().
+			End()
+	case StubLinkname:
+		if conf.LinkPkg == "" {
+			log.Panicln("bindFunc: LinkPkg is required by StubLinkname")
+		}
+		pkg.Import("unsafe").MarkForceUsed()
+		pkg.Import(conf.LinkPkg).MarkForceUsed()
+		pkg.NewFuncDecl(pos, name, sig).SetComments(&goast.CommentGroup{
+			List: []*goast.Comment{{Text: "//go:linkname " + name + " " + conf.LinkPkg + "." + name}},
+		})
+	default:
+		log.Panicln("bindFunc: unknown stub kind =", conf.Stubs)
+	}
+}
+
+// writeStubAsm writes an empty assembly file next to file if functions are
+// generated by StubLinkname.
+func (p Package) writeStubAsm(file string) error {
+	if p.bind == nil || p.bind.Stubs != StubLinkname {
+		return nil
+	}
+	asm := strings.TrimSuffix(file, ".go") + ".s"
+	return os.WriteFile(asm, []byte("// Functions of go:linkname have no bodies in Go.\n"), 0666)
+}
+
+func bindVar(ctx *blockCtx, scope *types.Scope, typ types.Type, decl *ast.Node) {
+	name := ctx.ident(decl.Name)
+	if !ctx.bind.selected(decl.Name) || scope.Lookup(name) != nil {
+		return
+	}
+	ctx.pkg.NewVarDefs(scope).New(goNodePos(decl), typ, name)
+	ctx.declare(scope, name)
+}
+
+// -----------------------------------------------------------------------------
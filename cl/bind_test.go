@@ -0,0 +1,72 @@
+package cl
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+// -----------------------------------------------------------------------------
+
+func writeTestFile(t *testing.T, file, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(file, []byte(content), 0666); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBindLinknameBuild(t *testing.T) {
+	gocmd, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("go not found:", err)
+	}
+	doc, src := parse(`
+int Add(int a, int b);
+`, nil)
+	pkg, err := NewPackage("", "bind", doc, &Config{
+		Src:  src,
+		Bind: &BindConfig{Stubs: StubLinkname, LinkPkg: "example.com/m/impl"},
+	})
+	if err != nil {
+		t.Fatal("NewPackage:", err)
+	}
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "go.mod"), "module example.com/m\n\ngo 1.16\n")
+	writeTestFile(t, filepath.Join(dir, "impl", "impl.go"), `package impl
+
+import _ "unsafe"
+
+//go:linkname Add
+func Add(a, b int32) int32 {
+	return a + b
+}
+`)
+	writeTestFile(t, filepath.Join(dir, "main.go"), `package main
+
+import "example.com/m/bind"
+
+func main() {
+	if bind.Add(1, 2) != 3 {
+		panic("Add")
+	}
+}
+`)
+	if err = os.MkdirAll(filepath.Join(dir, "bind"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err = pkg.WritePkgFile(filepath.Join(dir, "bind", "bind.go")); err != nil {
+		t.Fatal("WritePkgFile:", err)
+	}
+	cmd := exec.Command(gocmd, "run", ".")
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GOWORK=off", "GOFLAGS=", "GO111MODULE=on")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("go run: %v\n%s", err, out)
+	}
+}
+
+// -----------------------------------------------------------------------------
@@ -3,10 +3,12 @@ package cl
 import (
 	"bytes"
 	"fmt"
+	goast "go/ast"
 	"go/token"
 	"go/types"
 	"log"
 	"os"
+	"sort"
 	"strconv"
 	"strings"
 
@@ -25,21 +27,40 @@ const (
 
 type funcCtx struct {
 	labels map[string]*gox.Label
+	flows  map[*ast.Node]*gox.Label // labels of loop/switch stmts
+	info   *flowInfo
 	vdefs  *gox.VarDefs
 	basel  int
 	basev  int
+	baset  int
+
+	// flat memory mode only
+	fp     types.Object    // frame of variables which live in the arena
+	flit   *goast.BasicLit // frame size
+	fsize  int
+	arenas map[ast.ID]int // offsets of variables in the frame
 }
 
-func newFuncCtx(pkg *gox.Package, complicated bool) *funcCtx {
+func newFuncCtx(pkg *gox.Package, info *flowInfo) *funcCtx {
 	ctx := &funcCtx{
 		labels: make(map[string]*gox.Label),
+		flows:  make(map[*ast.Node]*gox.Label),
+		info:   info,
 	}
-	if complicated {
+	if info.needGoto {
 		ctx.vdefs = pkg.NewVarDefs(pkg.CB().Scope())
 	}
 	return ctx
 }
 
+// labelFlow labels a loop/switch stmt if it is the target of a labeled
+// break/continue.
+func (p *funcCtx) labelFlow(cb *gox.CodeBuilder, stmt *ast.Node) {
+	if _, ok := p.info.flows[stmt]; ok {
+		p.flows[stmt] = p.label(cb)
+	}
+}
+
 func (p *funcCtx) newLabel(cb *gox.CodeBuilder) *gox.Label {
 	p.basel++
 	name := "_cgol_" + strconv.Itoa(p.basel)
@@ -59,6 +80,41 @@ func (p *funcCtx) newAutoVar(pos token.Pos, typ types.Type, name string) (*gox.V
 	return ret, ret.Ref(realName)
 }
 
+func (p *funcCtx) tempName() string {
+	p.baset++
+	return "_cgo_t" + strconv.Itoa(p.baset)
+}
+
+// dropEmptyVarDefs drops the var declarations of hoisted variables (see
+// funcCtx.vdefs) of functions which turn out to declare none.
+func dropEmptyVarDefs(pkg *gox.Package) {
+	for _, decl := range gox.ASTFile(pkg, false).Decls {
+		fn, ok := decl.(*goast.FuncDecl)
+		if !ok || fn.Body == nil {
+			continue
+		}
+		stmts := fn.Body.List[:0]
+		for _, stmt := range fn.Body.List {
+			if v, ok := stmt.(*goast.DeclStmt); ok {
+				if d := v.Decl.(*goast.GenDecl); d.Tok == token.VAR && len(d.Specs) == 0 {
+					continue
+				}
+			}
+			stmts = append(stmts, stmt)
+		}
+		fn.Body.List = stmts
+	}
+}
+
+// -----------------------------------------------------------------------------
+
+// liftCtx records whether side effects of the expression being compiled can be
+// lifted into statements emitted before the current statement.
+type liftCtx struct {
+	on   bool
+	base int // stack length at the start of the current statement
+}
+
 // -----------------------------------------------------------------------------
 
 type flowCtx interface { // switch, for
@@ -184,21 +240,115 @@ func (p *loopCtx) labelStart(ctx *blockCtx) {
 // -----------------------------------------------------------------------------
 
 type blockCtx struct {
-	pkg      *gox.Package
-	cb       *gox.CodeBuilder
-	fset     *token.FileSet
-	tyValist types.Type
-	tyI128   types.Type
-	tyU128   types.Type
-	unnameds map[ast.ID]*types.Named
-	typdecls map[string]*gox.TypeDecl
-	gblvars  map[string]*gox.VarDefs
-	extfns   map[string]none // external functions which are used
-	srcfile  string
-	src      []byte
-	curfn    *funcCtx
-	curflow  flowCtx
-	base     int // anonymous struct/union
+	pkg       *gox.Package
+	cb        *gox.CodeBuilder
+	fset      *token.FileSet
+	tyValist  types.Type
+	tyI128    types.Type
+	tyU128    types.Type
+	unnameds  map[ast.ID]*types.Named
+	typdecls  map[string]*gox.TypeDecl
+	gblvars   map[string]*gox.VarDefs
+	extfns    map[string]none       // external functions which are used
+	extvars   map[string]none       // extern variables which aren't defined
+	builtins  map[string]none       // compiler builtins which are used
+	headers   map[string]none       // system headers which declare used functions and variables
+	uses      map[string]string     // C source positions of the first uses of package-level symbols
+	localfns  map[string]none       // functions which aren't bound to runtime packages
+	overrides map[string]none       // functions which are implemented in Go by other files
+	fnattrs   map[string]*funcAttrs // attributes of functions by C names (see initFuncAttrs)
+	cidents   map[string]none       // identifiers of the translation unit
+	idents    map[string]string     // C identifiers which are renamed in Go
+	typedefs  map[string]none       // typedef names which are renamed in Go
+	declfiles map[string]string     // C source files of package-level declarations (see Config.Split)
+	curfile   string                // C source file of the current top-level declaration
+	comments  map[ast.ID]*ast.Node  // comments of declarations
+	docs      map[string]string     // doc comments of Go declarations (see blockCtx.doc)
+	gotofns   []string              // functions which still need gotos
+	skipped   []string              // macros which aren't converted to Go consts
+	diags     []string              // warnings with C source positions (see blockCtx.warn)
+	srcfile   string
+	src       []byte
+	addrs     map[ast.ID]none    // variables whose address is taken
+	gaddrs    map[ast.ID]none    // first declarations of variables whose address is taken
+	firsts    map[ast.ID]ast.ID  // first declarations of redeclared variables
+	garenas   map[string]none    // global variables which live in the arena
+	tlsvars   map[string]*tlsVar // thread-local variables by name, or by ID if declared in a function
+	unsafeAdd bool               // use unsafe.Add for pointer arithmetic
+	flat      bool               // flat memory mode
+	checked   bool               // checked pointers mode
+	nonnull   bool               // check nonnull parameters
+	memcheck  bool               // memory checking mode
+	bind      *BindConfig        // declarations only mode
+	lines     []int              // offsets of line starts in src
+	markers   []lineMarker       // `# N "file"` line markers in src
+	curfn     *funcCtx
+	curflow   flowCtx
+	lift      liftCtx
+	base      int // anonymous struct/union
+}
+
+func (p *blockCtx) setLift(on bool) (old liftCtx) {
+	old = p.lift
+	p.lift = liftCtx{on: on, base: p.cb.InternalStack().Len()}
+	return
+}
+
+func (p *blockCtx) restoreLift(old liftCtx) {
+	p.lift = old
+}
+
+// canLift checks if an expression that modifies lhs can be lifted into
+// statements, that is, lhs can be evaluated more than once.
+func (p *blockCtx) canLift(lhs *ast.Node) bool {
+	return p.lift.on && isPureExpr(lhs)
+}
+
+// liftStmt emits values pushed since stack length `from` as an expression
+// statement, keeping pending operands of the enclosing expression.
+func (p *blockCtx) liftStmt(from int) {
+	cb := p.cb
+	stk := cb.InternalStack()
+	if stk.Len() == from {
+		return
+	}
+	n := from - p.lift.base
+	pending := make([]*gox.Element, n)
+	copy(pending, stk.GetArgs(n+1))
+	top := stk.Pop()
+	stk.PopN(n)
+	stk.Push(top)
+	cb.EndStmt()
+	for _, v := range pending {
+		stk.Push(v)
+	}
+}
+
+// liftTemp moves the top of stack into a temporary variable.
+func (p *blockCtx) liftTemp() {
+	cb := p.cb
+	v := cb.InternalStack().Pop()
+	if cb.InVBlock() || p.curfn.info.needGoto {
+		tmp := p.newTempVar(v.Type)
+		cb.VarRef(tmp).Val(v).Assign(1).Val(tmp)
+		return
+	}
+	name := p.curfn.tempName()
+	cb.DefineVarStart(token.NoPos, name).Val(v).EndInit(1)
+	cb.Val(gox.Lookup(cb.Scope(), name))
+}
+
+// newTempVar declares an uninitialized temporary variable. Temporary variables
+// of functions with goto statements are declared at the beginning of the
+// function, as goto can't jump over declarations.
+func (p *blockCtx) newTempVar(typ types.Type) types.Object {
+	name := p.curfn.tempName()
+	if f := p.curfn; f.info.needGoto && !p.cb.InVBlock() {
+		return f.vdefs.New(token.NoPos, typ, name).Ref(name)
+	}
+	scope := p.cb.Scope()
+	p.newVar(scope, token.NoPos, typ, name)
+	return gox.Lookup(scope, name)
 }
 
 func (p *blockCtx) lookupParent(name string) types.Object {
@@ -226,6 +376,7 @@ func (p *blockCtx) newVar(scope *types.Scope, pos token.Pos, typ types.Type, nam
 		ret = defs.New(pos, typ, name)
 		if inGlobal {
 			p.gblvars[name] = defs
+			p.declare(scope, name)
 		}
 	}
 	return
@@ -286,6 +437,87 @@ func (p *blockCtx) getSource() []byte {
 	return b
 }
 
+// srcPos returns the C source position (file:line:col) of v, or "" if unknown.
+func (p *blockCtx) srcPos(v *ast.Node) string {
+	if v.Range == nil {
+		return ""
+	}
+	file, lineNo, col, _ := p.srcLoc(int(v.Range.Begin.Offset))
+	return file + ":" + strconv.Itoa(lineNo) + ":" + strconv.Itoa(col)
+}
+
+// warn reports a problem of the C code at v, such as a format mismatch.
+func (p *blockCtx) warn(v *ast.Node, msg string) {
+	if pos := p.srcPos(v); pos != "" {
+		msg = pos + ": " + msg
+	}
+	p.diags = append(p.diags, msg)
+}
+
+// srcLoc returns the C source file, line and column of the offset off in the
+// preprocessed source, and whether the file is a system header.
+func (p *blockCtx) srcLoc(off int) (file string, lineNo, col int, system bool) {
+	src := p.getSource()
+	if p.lines == nil {
+		p.initLines(src)
+	}
+	line := sort.SearchInts(p.lines, off+1) - 1 // index of the line containing off
+	col = off - p.lines[line] + 1
+	file, lineNo = p.srcfile, line+1
+	if i := sort.Search(len(p.markers), func(i int) bool {
+		return p.markers[i].line > line
+	}); i > 0 {
+		m := p.markers[i-1]
+		file, lineNo, system = m.file, m.lineNo+line-m.line-1, m.system
+	}
+	return
+}
+
+type lineMarker struct {
+	line   int // index of the line of the marker
+	lineNo int // line number of the next line
+	file   string
+	system bool // flag 3: the file is a system header
+}
+
+func (p *blockCtx) initLines(src []byte) {
+	p.lines = append(p.lines, 0)
+	for i, c := range src {
+		if c == '\n' {
+			p.lines = append(p.lines, i+1)
+		}
+	}
+	for i, start := range p.lines {
+		if start >= len(src) || src[start] != '#' {
+			continue
+		}
+		end := len(src)
+		if i+1 < len(p.lines) {
+			end = p.lines[i+1]
+		}
+		line := strings.TrimSpace(string(src[start+1 : end]))
+		pos := strings.IndexByte(line, ' ')
+		if pos < 0 {
+			continue
+		}
+		lineNo, err := strconv.Atoi(line[:pos])
+		if err != nil {
+			continue
+		}
+		file, flags := strings.TrimSpace(line[pos+1:]), ""
+		if strings.HasPrefix(file, "\"") {
+			if n := strings.IndexByte(file[1:], '"'); n >= 0 {
+				file, flags = file[1:n+1], file[n+2:]
+			}
+		}
+		system := false
+		for _, flag := range strings.Fields(flags) {
+			system = system || flag == "3"
+		}
+		p.markers = append(p.markers, lineMarker{line: i, lineNo: lineNo, file: file, system: system})
+	}
+}
+
 func (p *blockCtx) getLabel(pos token.Pos, name string) *gox.Label {
 	if fn := p.curfn; fn != nil {
 		l, ok := fn.labels[name]
@@ -477,7 +709,7 @@ func (p *blockCtx) initCTypes() {
 func (p *blockCtx) initCTypes() {
 	pkg := p.pkg.Types
 	scope := pkg.Scope()
-	p.tyValist = initValist(scope, pkg)
+	p.tyValist = initValist(scope, pkg, p.pkg.Import(clangPkgPath))
 	p.tyI128 = ctypes.NotImpl
 	p.tyU128 = ctypes.NotImpl
 
@@ -496,10 +728,10 @@ func (p *blockCtx) isValistType(t types.Type) bool {
 	return ctypes.Identical(t, p.tyValist)
 }
 
-func initValist(scope *types.Scope, pkg *types.Package) types.Type {
-	valist := types.NewTypeName(token.NoPos, pkg, ctypes.MangledName("struct", "__va_list_tag"), nil)
-	t := types.NewNamed(valist, types.Typ[types.Int8], nil)
-	scope.Insert(valist)
+// initValist maps va_list (struct __va_list_tag*) to *clang.VaList.
+func initValist(scope *types.Scope, pkg *types.Package, c *gox.PkgRef) types.Type {
+	t := c.Ref("VaList").Type()
+	aliasType(scope, pkg, ctypes.MangledName("struct", "__va_list_tag"), t)
 	tyValist := types.NewPointer(t)
 	aliasType(scope, pkg, "__builtin_va_list", tyValist)
 	return tyValist
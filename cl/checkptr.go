@@ -0,0 +1,88 @@
+package cl
+
+import (
+	"go/types"
+
+	"github.com/goplus/c2go/clang/ast"
+	"github.com/goplus/gox"
+
+	ctypes "github.com/goplus/c2go/clang/types"
+)
+
+// -----------------------------------------------------------------------------
+// In checked pointers mode (Config.CheckedPointers) pointer arithmetic goes
+// through checked.Add, dereferences through checked.Deref and indexes of Go
+// arrays through checked.Index. Memory returned by malloc and friends comes
+// from package clang/checked, which tracks its bounds and whether it is freed.
+
+const (
+	checkedPkgPath = "github.com/goplus/c2go/clang/checked"
+)
+
+var (
+	checkedLibcFns = map[string]string{
+		"malloc":  "Malloc",
+		"calloc":  "Calloc",
+		"realloc": "Realloc",
+		"free":    "Free",
+	}
+)
+
+func (p *blockCtx) checkedRef(name string) types.Object {
+	return p.pkg.Import(checkedPkgPath).Ref(name)
+}
+
+// usePtrAdd reports whether pointer arithmetic is compiled by ptrAdd.
+func (p *blockCtx) usePtrAdd() bool {
+	return p.unsafeAdd || p.checked
+}
+
+// checkDeref: ptr => (*T)(checked.Deref(unsafe.Pointer(ptr), sizeof(T), pos))
+func checkDeref(ctx *blockCtx, v *ast.Node) {
+	cb := ctx.cb
+	t, ok := cb.Get(-1).Type.(*types.Pointer)
+	if !ok || ctx.isValistType(t) {
+		return
+	}
+	ptr := cb.InternalStack().Pop()
+	cb.Typ(t).Val(ctx.checkedRef("Deref")).
+		Typ(ctypes.UnsafePointer).Val(ptr).Call(1).
+		Val(ctx.sizeof(t.Elem())).Val(ctx.srcPos(v)).Call(3).Call(1)
+}
+
+// compileCheckedIndex compiles arr[i] as arr[checked.Index(int(i), len(arr), pos)]
+// if arr is a Go array. It returns false if v isn't an array subscript.
+func compileCheckedIndex(ctx *blockCtx, v *ast.Node, lhs bool) bool {
+	arr := v.Inner[0]
+	if arr.Kind != ast.ImplicitCastExpr || arr.CastKind != ast.ArrayToPointerDecay {
+		return false
+	}
+	cb := ctx.cb
+	compileExpr(ctx, arr.Inner[0])
+	t, _ := gox.DerefType(cb.Get(-1).Type)
+	if at, ok := t.(*types.Array); ok && at.Len() > 0 && !isEllipsis(ctx, cb) {
+		cb.Val(ctx.checkedRef("Index"))
+		compileExpr(ctx, v.Inner[1])
+		idx := cb.InternalStack().Pop()
+		if e, ok := gox.CastFromBool(cb, types.Typ[types.Int], idx); ok {
+			idx = e
+		} else {
+			typeCast(ctx, types.Typ[types.Int], idx)
+		}
+		cb.Val(idx).Val(int(at.Len())).Val(ctx.srcPos(v)).Call(3)
+		if lhs {
+			cb.IndexRef(1)
+		} else {
+			cb.Index(1, false)
+		}
+		return true
+	}
+	if !isEllipsis(ctx, cb) {
+		arrayToElemPtr(cb)
+	}
+	compileExpr(ctx, v.Inner[1])
+	typeCastIndex(ctx, v, lhs)
+	return true
+}
+
+// -----------------------------------------------------------------------------
@@ -77,6 +77,9 @@ func decl_builtin(ctx *blockCtx) {
 	pkg := ctx.pkg.Types
 	scope := pkg.Scope()
 	for fn, proto := range fns {
+		if _, name := ctx.libcFnName(fn); name != "" { // bound to a runtime function, such as __builtin_fabs
+			continue
+		}
 		t := toType(ctx, &cast.Type{QualType: strings.ReplaceAll(proto, "size_t", "unsigned long")}, 0)
 		scope.Insert(types.NewFunc(token.NoPos, pkg, fn, t.(*types.Signature)))
 	}
@@ -251,7 +254,8 @@ func assign(ctx *blockCtx, src ast.Node) {
 	cb.AssignWith(1, 1, src)
 }
 
-func assignOp(ctx *blockCtx, op token.Token, src ast.Node) {
+func assignOp(ctx *blockCtx, op token.Token, v *cast.Node) {
+	src := goNode(v.Inner[1])
 	cb := ctx.cb
 	stk := cb.InternalStack()
 	arg1 := stk.Get(-2)
@@ -259,6 +263,18 @@ func assignOp(ctx *blockCtx, op token.Token, src ast.Node) {
 	switch op {
 	case token.ADD_ASSIGN, token.SUB_ASSIGN: // ptr+=n, ptr-=n
 		if t1, ok := arg1Type.(*types.Pointer); ok {
+			if ctx.usePtrAdd() && isSimpleRef(arg1.Val) { // ptr = ptr+n
+				arg2 := stk.Pop()
+				stk.Push(&gox.Element{Val: arg1.Val, Type: t1})
+				stk.Push(arg2)
+				ptrAdd(ctx, t1, op-(token.ADD_ASSIGN-token.ADD), v)
+				cb.AssignWith(1, 1, src)
+				return
+			}
+			if ctx.usePtrAdd() {
+				ptrAddAssign(ctx, t1, op-(token.ADD_ASSIGN-token.ADD), v)
+				return
+			}
 			elemSize := ctx.sizeof(t1.Elem())
 			arg2 := stk.Pop()
 
@@ -334,8 +350,12 @@ func binaryOp(ctx *blockCtx, op token.Token, v *cast.Node) {
 			}
 		}
 		if t1, ok := arg1.Type.(*types.Pointer); ok {
-			elemSize := ctx.sizeof(t1.Elem())
 			arg2 := stk.Get(-1)
+			if ctx.usePtrAdd() && isIntegerOrBool(arg2.Type) {
+				ptrAdd(ctx, t1, op, v)
+				return
+			}
+			elemSize := ctx.sizeof(t1.Elem())
 			if isNegConst(arg2) { // fix: can't convert -1 to uintptr
 				cb.UnaryOp(token.SUB)
 				arg2 = stk.Get(-1)
@@ -448,6 +468,8 @@ func castToBoolExpr(cb *gox.CodeBuilder) {
 	}
 }
 
+// valOfAddr pushes *addr, or (*uintptr)(unsafe.Pointer(addr)) if *addr is a
+// pointer, which is only the case if !ctx.usePtrAdd().
 func valOfAddr(cb *gox.CodeBuilder, addr types.Object, ctx *blockCtx) (elemSize int) {
 	typ := addr.Type()
 	if t, ok := typ.(*types.Pointer); ok {
@@ -461,6 +483,111 @@ func valOfAddr(cb *gox.CodeBuilder, addr types.Object, ctx *blockCtx) (elemSize
 	return 1
 }
 
+// ptrAdd: ptr, n => (*T)(unsafe.Add(unsafe.Pointer(ptr), n*sizeof(T)))
+//
+// In checked pointers mode it emits checked.Add(unsafe.Pointer(ptr), int(n)*sizeof(T), pos)
+// instead of unsafe.Add.
+func ptrAdd(ctx *blockCtx, t *types.Pointer, op token.Token, v *cast.Node) {
+	cb := ctx.cb
+	stk := cb.InternalStack()
+	n := stk.Pop()
+	ptr := stk.Pop()
+	nargs := 2
+	if ctx.checked {
+		cb.Typ(t).Val(ctx.checkedRef("Add"))
+		nargs = 3
+	} else {
+		cb.Typ(t).Val(ctx.pkg.Builtin().Ref("Add"))
+	}
+	cb.Typ(ctypes.UnsafePointer).Val(ptr).Call(1)
+	elemSize := ctx.sizeof(t.Elem())
+	if n.CVal != nil && n.CVal.Kind() == constant.Int {
+		if v, ok := constant.Int64Val(n.CVal); ok {
+			if op == token.SUB {
+				v = -v
+			}
+			cb.Val(int(v) * elemSize)
+			goto done
+		}
+	}
+	if v, ok := gox.CastFromBool(cb, types.Typ[types.Int], n); ok {
+		n = v
+	} else { // n*elemSize mustn't overflow the type of n, and unsigned n can't be negated
+		typeCast(ctx, types.Typ[types.Int], n)
+	}
+	stk.Push(n)
+	if elemSize != 1 {
+		cb.Val(elemSize).BinaryOp(token.MUL)
+	}
+	if op == token.SUB {
+		cb.UnaryOp(token.SUB)
+	}
+done:
+	if ctx.checked {
+		cb.Val(ctx.srcPos(v))
+	}
+	cb.Call(nargs).Call(1)
+}
+
+// ptrAddAssign: lhs, n => p := &lhs; *p = (*T)(unsafe.Add(unsafe.Pointer(*p), n*sizeof(T)))
+//
+// It is for lhs which can't be evaluated twice. The address of lhs is lifted
+// into a temporary variable if possible, or else passed to a closure.
+func ptrAddAssign(ctx *blockCtx, t *types.Pointer, op token.Token, v *cast.Node) {
+	cb := ctx.cb
+	stk := cb.InternalStack()
+	n := stk.Pop()
+	cb.UnaryOp(token.AND)
+	if ctx.lift.on {
+		ctx.liftTemp()
+		addr := stk.Pop()
+		stk.Push(addr)
+		cb.ElemRef()
+		stk.Push(addr)
+		cb.Elem()
+		stk.Push(n)
+		ptrAdd(ctx, t, op, v)
+		cb.Assign(1)
+		return
+	}
+	pkg := ctx.pkg
+	addr := stk.Pop()
+	p := pkg.NewParam(token.NoPos, ctx.curfn.tempName(), addr.Type)
+	cb.NewClosure(types.NewTuple(p), nil, false).BodyStart(pkg).
+		Val(p).ElemRef().Val(p).Elem()
+	stk.Push(n)
+	ptrAdd(ctx, t, op, v)
+	cb.Assign(1).End()
+	stk.Push(addr)
+	cb.Call(1).EndStmt()
+}
+
+// intToPtr: n => unsafe.Add(unsafe.Pointer(nil), n)
+func intToPtr(ctx *blockCtx, v *gox.Element) {
+	if v.CVal != nil {
+		typeCast(ctx, tyUintptr, v)
+	}
+	ctx.cb.Val(ctx.pkg.Builtin().Ref("Add")).
+		Typ(ctypes.UnsafePointer).Val(nil).Call(1).Val(v).Call(2)
+}
+
+// isSimpleRef checks if an lvalue can be evaluated twice without side effects.
+func isSimpleRef(v ast.Node) bool {
+	switch e := v.(type) {
+	case *ast.Ident, *ast.BasicLit:
+		return true
+	case *ast.SelectorExpr:
+		return isSimpleRef(e.X)
+	case *ast.StarExpr:
+		return isSimpleRef(e.X)
+	case *ast.ParenExpr:
+		return isSimpleRef(e.X)
+	case *ast.IndexExpr:
+		return isSimpleRef(e.X) && isSimpleRef(e.Index)
+	}
+	return false
+}
+
 func adjustIntConst(ctx *blockCtx, v *gox.Element, typ types.Type) {
 	if v.CVal == nil {
 		return
@@ -530,10 +657,19 @@ func typeCastCall(ctx *blockCtx, typ types.Type) {
 		switch tt := typ.(type) {
 		case *types.Pointer:
 			stk.Pop()
+			if ctx.unsafeAdd {
+				intToPtr(ctx, v)
+				break
+			}
 			adjustIntConst(ctx, v, tyUintptr)
 			cb.Typ(ctypes.UnsafePointer).Typ(tyUintptr).Val(v).Call(1).Call(1)
 		case *types.Basic:
 			if tt.Kind() == types.UnsafePointer { // int => voidptr
+				if ctx.unsafeAdd {
+					stk.PopN(2)
+					intToPtr(ctx, v)
+					return
+				}
 				typeCast(ctx, tyUintptr, v)
 				break
 			}
@@ -563,12 +699,14 @@ func typeCastCall(ctx *blockCtx, typ types.Type) {
 	cb.Call(1)
 }
 
-func typeCastIndex(ctx *blockCtx, lhs bool) {
+func typeCastIndex(ctx *blockCtx, v *cast.Node, lhs bool) {
 	cb := ctx.cb
-	v := cb.Get(-2)
-	switch v.Type.(type) {
+	switch cb.Get(-2).Type.(type) {
 	case *types.Pointer: // p[n] = *(p+n)
-		binaryOp(ctx, token.ADD, &cast.Node{})
+		binaryOp(ctx, token.ADD, v)
+		if ctx.checked {
+			checkDeref(ctx, v)
+		}
 		if lhs {
 			cb.ElemRef()
 		} else {
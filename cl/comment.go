@@ -0,0 +1,257 @@
+package cl
+
+import (
+	"bytes"
+	"go/token"
+	"sort"
+	"strings"
+
+	goast "go/ast"
+	goparser "go/parser"
+
+	"github.com/goplus/c2go/clang/ast"
+)
+
+// -----------------------------------------------------------------------------
+// Comments of C declarations (see parser.ParseComments) become doc comments of
+// the Go declarations of functions, types, variables, enum constants and struct
+// fields. They are taken out of the AST before compiling, and added to the
+// generated code when the package is written, since gox doesn't attach
+// comments to all kinds of declarations. Doxygen commands are kept as
+// @command, and verbatim blocks such as @code become indented code blocks.
+
+// initComments takes comments out of the AST, and keeps them by the IDs of the
+// declarations they document.
+func (p *blockCtx) initComments(file *ast.Node) {
+	p.docs = make(map[string]string)
+	var walk func(node *ast.Node)
+	walk = func(node *ast.Node) {
+		inner := node.Inner[:0]
+		for _, item := range node.Inner {
+			if item.Kind == ast.FullComment {
+				if p.comments == nil {
+					p.comments = make(map[ast.ID]*ast.Node)
+				}
+				p.comments[node.ID] = item
+				continue
+			}
+			walk(item)
+			inner = append(inner, item)
+		}
+		node.Inner = inner
+	}
+	walk(file)
+}
+
+// doc records the comment of the package-level declaration decl as the doc
+// comment of the Go declaration name, or of the field Type.field.
+func (p *blockCtx) doc(decl *ast.Node, name string) {
+	if p.curfn != nil {
+		return
+	}
+	if c, ok := p.comments[decl.ID]; ok {
+		if _, ok := p.docs[name]; !ok {
+			if text := commentText(c); text != "" {
+				p.docs[name] = text
+			}
+		}
+	}
+}
+
+// commentText returns the text of the FullComment c.
+func commentText(c *ast.Node) string {
+	var lines []string
+	for _, block := range c.Inner {
+		if n := len(lines); n > 0 && lines[n-1] != "" { // blocks are separated by blank lines
+			lines = append(lines, "")
+		}
+		switch block.Kind {
+		case ast.ParagraphComment:
+			lines = appendParagraph(lines, "", block)
+		case ast.BlockCommandComment:
+			prefix := "@" + block.Name + " "
+			if block.Name == "brief" {
+				prefix = ""
+			}
+			for _, para := range block.Inner {
+				lines = appendParagraph(lines, prefix, para)
+			}
+		case ast.ParamCommandComment, ast.TParamCommandComment:
+			for _, para := range block.Inner {
+				lines = appendParagraph(lines, "@param "+block.Param+" ", para)
+			}
+		case ast.VerbatimBlockComment:
+			lines = appendVerbatim(lines, block)
+		case ast.VerbatimLineComment:
+			lines = append(lines, strings.TrimSpace("@"+block.Name+" "+strings.TrimSpace(block.Text)))
+		}
+	}
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return strings.Join(lines, "\n")
+}
+
+// appendParagraph appends the lines of the ParagraphComment para, the first of
+// which begins with prefix. A TextComment is a line, or a part of it if it is
+// next to an inline command or an HTML tag.
+func appendParagraph(lines []string, prefix string, para *ast.Node) []string {
+	var line strings.Builder
+	inline := false
+	flush := func() {
+		if text := strings.TrimSpace(line.String()); text != "" {
+			lines = append(lines, prefix+text)
+			prefix = ""
+		}
+		line.Reset()
+	}
+	for _, item := range para.Inner {
+		switch item.Kind {
+		case ast.TextComment:
+			if !inline {
+				flush()
+			}
+			line.WriteString(item.Text)
+			inline = false
+		case ast.InlineCommandComment:
+			line.WriteString(strings.Join(item.Args, " "))
+			inline = true
+		case ast.HTMLStartTagComment, ast.HTMLEndTagComment:
+			inline = true
+		}
+	}
+	flush()
+	if prefix != "" { // such as @return without text
+		lines = append(lines, strings.TrimSpace(prefix))
+	}
+	return lines
+}
+
+// appendVerbatim appends the lines of the VerbatimBlockComment block as a code
+// block, which are indented by a tab.
+func appendVerbatim(lines []string, block *ast.Node) []string {
+	indent := -1
+	for _, item := range block.Inner {
+		if text := strings.TrimRight(item.Text, " \t"); text != "" {
+			if n := len(text) - len(strings.TrimLeft(text, " \t")); indent < 0 || n < indent {
+				indent = n
+			}
+		}
+	}
+	for _, item := range block.Inner {
+		if text := strings.TrimRight(item.Text, " \t"); text != "" {
+			lines = append(lines, "\t"+text[indent:])
+		} else {
+			lines = append(lines, "")
+		}
+	}
+	return lines
+}
+
+// -----------------------------------------------------------------------------
+
+type docInsertion struct {
+	off int // offset of the line of the documented declaration
+	doc []byte
+}
+
+// document adds doc comments to the generated code src. Declarations of the
+// generated code are on lines of their own, so the comments are inserted as
+// lines before them.
+func (p Package) document(src []byte) ([]byte, error) {
+	if len(p.docs) == 0 && len(p.deprecated) == 0 {
+		return src, nil
+	}
+	fset := token.NewFileSet()
+	f, err := goparser.ParseFile(fset, "", src, goparser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+	var ins []docInsertion
+	add := func(node goast.Node, name string) {
+		if doc, ok := p.docOf(name); ok {
+			off := fset.Position(node.Pos()).Offset
+			start := bytes.LastIndexByte(src[:off], '\n') + 1
+			ins = append(ins, docInsertion{off: start, doc: docComment(src[start:off], doc)})
+		}
+	}
+	for _, decl := range f.Decls {
+		switch v := decl.(type) {
+		case *goast.FuncDecl:
+			node := goast.Node(v)
+			if v.Doc != nil { // such as go:linkname directives
+				node = v.Doc
+			}
+			add(node, v.Name.Name)
+		case *goast.GenDecl:
+			for _, spec := range v.Specs {
+				node := goast.Node(spec)
+				if !v.Lparen.IsValid() {
+					node = v
+					if v.Doc != nil {
+						node = v.Doc
+					}
+				}
+				switch spec := spec.(type) {
+				case *goast.TypeSpec:
+					add(node, spec.Name.Name)
+					if st, ok := spec.Type.(*goast.StructType); ok {
+						for _, field := range st.Fields.List {
+							if len(field.Names) > 0 {
+								add(field, spec.Name.Name+"."+field.Names[0].Name)
+							}
+						}
+					}
+				case *goast.ValueSpec:
+					add(node, spec.Names[0].Name)
+				}
+			}
+		}
+	}
+	sort.SliceStable(ins, func(i, j int) bool {
+		return ins[i].off < ins[j].off
+	})
+	var b bytes.Buffer
+	last := 0
+	for _, in := range ins {
+		b.Write(src[last:in.off])
+		b.Write(in.doc)
+		last = in.off
+	}
+	b.Write(src[last:])
+	return b.Bytes(), nil
+}
+
+// docOf returns the doc comment of the Go declaration name, which ends with a
+// "Deprecated:" paragraph if it is a deprecated function.
+func (p Package) docOf(name string) (string, bool) {
+	doc, ok := p.docs[name]
+	if msg, deprecated := p.deprecated[name]; deprecated {
+		if msg == "" {
+			msg = "this function is deprecated."
+		}
+		if ok {
+			doc += "\n\n"
+		}
+		return doc + "Deprecated: " + msg, true
+	}
+	return doc, ok
+}
+
+// docComment returns the lines of the doc comment doc, which are indented by
+// indent.
+func docComment(indent []byte, doc string) []byte {
+	var b bytes.Buffer
+	for _, line := range strings.Split(doc, "\n") {
+		b.Write(indent)
+		b.WriteString("//")
+		if line != "" && line[0] != '\t' {
+			b.WriteByte(' ')
+		}
+		b.WriteString(line)
+		b.WriteByte('\n')
+	}
+	return b.Bytes()
+}
+
+// -----------------------------------------------------------------------------
@@ -0,0 +1,97 @@
+package cl
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/goplus/c2go/clang/parser"
+)
+
+// -----------------------------------------------------------------------------
+
+func TestComments(t *testing.T) {
+	doc, src := parseWith(`
+/* Point is a point.
+ * It has two coordinates. */
+struct Point {
+	int x; // x coordinate
+	/** y coordinate */
+	int y;
+};
+
+/// Color enumerates colors.
+typedef enum {
+	Red, // the red one
+	Green,
+} Color;
+
+// counter counts calls of add.
+int counter;
+
+/**
+ * \brief add returns the sum of a and <b>b</b>.
+ *
+ * @param a first operand
+ * @return the sum
+ * @code
+ *   add(1, 2);
+ *     // 3
+ * @endcode
+ */
+int add(int a, int b) {
+	// not documentation
+	int n = a + b;
+	counter++;
+	return n;
+}
+`, parser.ParseComments, nil)
+	pkg, err := NewPackage("", "main", doc, &Config{Src: src})
+	if err != nil {
+		t.Fatal("NewPackage:", err)
+	}
+	var out bytes.Buffer
+	if err := pkg.WritePkgTo(&out); err != nil {
+		t.Fatal("WritePkgTo:", err)
+	}
+	if code := out.String(); code != `package main
+
+// Point is a point.
+// It has two coordinates.
+type struct_Point struct {
+	// x coordinate
+	x int32
+	// y coordinate
+	y int32
+}
+
+const (
+	// the red one
+	Red   int32 = 0
+	Green int32 = 1
+)
+
+// Color enumerates colors.
+type Color = int32
+
+// counter counts calls of add.
+var counter int32
+
+// add returns the sum of a and b.
+//
+// @param a first operand
+//
+// @return the sum
+//
+//	add(1, 2);
+//	  // 3
+func add(a int32, b int32) int32 {
+	var n int32 = a + b
+	counter++
+	return n
+}
+` {
+		t.Fatalf("WritePkgTo:\n%s\n", code)
+	}
+}
+
+// -----------------------------------------------------------------------------
@@ -9,6 +9,7 @@ import (
 	goast "go/ast"
 
 	"github.com/goplus/c2go/clang/ast"
+	"github.com/goplus/c2go/clang/preprocessor"
 	"github.com/goplus/c2go/clang/types/parser"
 	"github.com/goplus/gox"
 
@@ -62,6 +63,64 @@ type Config struct {
 
 	// Src specifies source code of SrcFile. Will read from SrcFile if nil.
 	Src []byte
+
+	// UnsafeAdd generates pointer arithmetic by unsafe.Add instead of uintptr
+	// round-trips, so that the output passes `go vet -unsafeptr`. It requires
+	// Go 1.17 or later.
+	UnsafeAdd bool
+
+	// FlatMemory places all C memory in the arena of package clang/mem. C data
+	// pointers become uintptr addresses, and variables whose address is taken
+	// live in the arena too. It gives exact C semantics for pointers stored in
+	// integers or copied by memcpy, at some speed cost.
+	FlatMemory bool
+
+	// CheckedPointers is a debug mode: pointer arithmetic, dereferences and
+	// array indexing are checked at runtime by package clang/checked, which
+	// also provides malloc and free. A failed check panics with the C source
+	// position of the faulting expression. It is ignored if FlatMemory is set.
+	CheckedPointers bool
+
+	// NonNullChecks checks on entry of functions that their parameters declared
+	// nonnull (see FuncAttrs) aren't NULL, by package clang/checked. A failed
+	// check panics with the C source position of the parameter. It is implied
+	// by CheckedPointers, and ignored if FlatMemory is set.
+	NonNullChecks bool
+
+	// MemCheck records the C call sites of malloc, calloc, realloc and free,
+	// and enables memory checking of package clang/libc: double frees and
+	// frees of pointers not returned by malloc are reported when they happen,
+	// and leaked blocks at exit. Only a bounded amount of freed blocks is kept,
+	// so double frees of blocks freed long before aren't detected. It is
+	// ignored if FlatMemory or CheckedPointers is set.
+	MemCheck bool
+
+	// Macros specifies macros of the source file (see preprocessor.Macros).
+	// Object-like macros whose bodies are constant expressions become Go consts.
+	Macros []*preprocessor.Macro
+
+	// Bind generates declarations only (see BindConfig): types, struct
+	// layouts, enum constants, variables and function signatures, but no
+	// function bodies.
+	Bind *BindConfig
+
+	// Providers are Go packages implementing C functions which the package
+	// uses but doesn't define, in order of precedence. Package.Dependencies
+	// forwards such functions to them (see Provider).
+	Providers []*Provider
+
+	// Overrides lists C functions which are implemented in Go by other files of
+	// the package. Their bodies aren't generated, while calls to them are still
+	// checked against their C prototypes.
+	Overrides []string
+
+	// Naming specifies how package-level C names map to Go names when the
+	// package is written by Package.WritePkgTo or WritePkgFile (see NamingConfig).
+	Naming *NamingConfig
+
+	// Split specifies how Package.WritePkgFiles splits the generated code into
+	// files (see SplitConfig).
+	Split *SplitConfig
 }
 
 type Package struct {
@@ -82,6 +141,12 @@ func NewPackage(pkgPath, pkgName string, file *ast.Node, conf *Config) (pkg Pack
 	pkg.Package = gox.NewPackage(pkgPath, pkgName, confGox)
 	pkg.Package.SetVarRedeclarable(true)
 	pkg.PkgInfo, err = loadFile(pkg.Package, conf, file, confGox)
+	if err == nil {
+		pkg.PkgInfo.providers = conf.Providers
+		pkg.PkgInfo.naming = conf.Naming
+		pkg.PkgInfo.split = conf.Split
+		pkg.PkgInfo.bind = conf.Bind
+	}
 	return
 }
 
@@ -113,6 +178,13 @@ func implicitCast(pkg *gox.Package, V, T types.Type, pv *gox.Element) bool {
 	case *types.Pointer:
 		return false
 	}
+	if T == ctypes.UnsafePointer { // pointer => void* (arguments of bound libc functions)
+		if _, ok := V.(*types.Pointer); ok {
+			e := pkg.CB().Typ(T).Val(pv).Call(1).InternalStack().Pop()
+			pv.Type, pv.Val = T, e.Val
+			return true
+		}
+	}
 	log.Panicln("==> implicitCast:", V, "to:", T)
 	return false
 }
@@ -125,15 +197,48 @@ func loadFile(p *gox.Package, conf *Config, file *ast.Node, confGox *gox.Config)
 	}
 	ctx := &blockCtx{
 		pkg: p, cb: p.CB(), fset: p.Fset,
-		unnameds: make(map[ast.ID]*types.Named),
-		typdecls: make(map[string]*gox.TypeDecl),
-		gblvars:  make(map[string]*gox.VarDefs),
-		extfns:   make(map[string]none),
-		srcfile:  conf.SrcFile,
-		src:      conf.Src,
+		unnameds:  make(map[ast.ID]*types.Named),
+		typdecls:  make(map[string]*gox.TypeDecl),
+		gblvars:   make(map[string]*gox.VarDefs),
+		extfns:    make(map[string]none),
+		fnattrs:   make(map[string]*funcAttrs),
+		extvars:   make(map[string]none),
+		builtins:  make(map[string]none),
+		headers:   make(map[string]none),
+		uses:      make(map[string]string),
+		tlsvars:   make(map[string]*tlsVar),
+		srcfile:   conf.SrcFile,
+		src:       conf.Src,
+		unsafeAdd: conf.UnsafeAdd,
+		flat:      conf.FlatMemory,
+		checked:   conf.CheckedPointers && !conf.FlatMemory,
+		nonnull:   (conf.NonNullChecks || conf.CheckedPointers) && !conf.FlatMemory,
+		bind:      conf.Bind,
+		memcheck:  conf.MemCheck && !conf.FlatMemory && !conf.CheckedPointers,
+	}
+	ctx.initComments(file)
+	ctx.initIdents(file)
+	if conf.Split != nil && conf.Split.ByFile {
+		ctx.declfiles = make(map[string]string)
+	}
+	if ctx.flat {
+		ctx.addrs = make(map[ast.ID]none)
+		ctx.gaddrs = make(map[ast.ID]none)
+		ctx.firsts = make(map[ast.ID]ast.ID)
+		ctx.garenas = make(map[string]none)
+		ctx.scanAddrs(file)
 	}
 	ctx.initCTypes()
+	ctx.initLocalFns(file)
+	ctx.initOverrides(conf.Overrides)
+	if ctx.memcheck {
+		initMemcheck(ctx)
+	}
 	compileDeclStmt(ctx, file, true)
+	compileMacros(ctx, conf.Macros)
+	if len(ctx.gotofns) > 0 {
+		dropEmptyVarDefs(p)
+	}
 	return ctx.genPkgInfo(confGox), nil
 }
 
@@ -147,6 +252,9 @@ func compileDeclStmt(ctx *blockCtx, node *ast.Node, global bool) {
 			if decl.IsImplicit {
 				continue
 			}
+			if ctx.declfiles != nil {
+				ctx.curfile = ctx.declFile(decl)
+			}
 		}
 		switch decl.Kind {
 		case ast.VarDecl:
@@ -194,7 +302,7 @@ func compileFunc(ctx *blockCtx, fn *ast.Node) {
 	var variadic, hasName bool
 	var params []*types.Var
 	var results *types.Tuple
-	var body *ast.Node
+	var body, lastParam *ast.Node
 	for _, item := range fn.Inner {
 		switch item.Kind {
 		case ast.ParmVarDecl:
@@ -205,16 +313,18 @@ func compileFunc(ctx *blockCtx, fn *ast.Node) {
 				hasName = true
 			}
 			params = append(params, newParam(ctx, item))
+			lastParam = item
 		case ast.CompoundStmt:
 			body = item
 		case ast.BuiltinAttr, ast.FormatAttr, ast.AsmLabelAttr, ast.AvailabilityAttr, ast.ColdAttr, ast.DeprecatedAttr,
 			ast.AlwaysInlineAttr, ast.WarnUnusedResultAttr, ast.NoThrowAttr, ast.NoInlineAttr, ast.AllocSizeAttr,
 			ast.NonNullAttr, ast.ConstAttr, ast.PureAttr, ast.GNUInlineAttr, ast.ReturnsTwiceAttr, ast.NoSanitizeAttr,
-			ast.RestrictAttr, ast.MSAllocatorAttr:
+			ast.RestrictAttr, ast.MSAllocatorAttr, ast.WeakAttr, ast.AllocAlignAttr, ast.C11NoReturnAttr:
 		default:
 			log.Panicln("compileFunc: unknown kind =", item.Kind)
 		}
 	}
+	attrs := ctx.initFuncAttrs(fn, body)
 	var vaParam *types.Var
 	if variadic = isVariadicFn(fnType); variadic {
 		params = append(params, newVariadicParam(ctx, hasName))
@@ -227,29 +337,55 @@ func compileFunc(ctx *blockCtx, fn *ast.Node) {
 		ret := types.NewParam(token.NoPos, pkg.Types, "", t)
 		results = types.NewTuple(ret)
 	}
+	if ctx.bind != nil {
+		bindFunc(ctx, fn, params, results, variadic, hasName)
+		return
+	}
 	sig := gox.NewCSignature(types.NewTuple(params...), results, variadic)
+	name := ctx.ident(fn.Name)
+	ctx.doc(fn, name)
+	if body != nil && ctx.overridden(fn.Name) {
+		overrideFunc(ctx, name, sig)
+		return
+	}
 	if body != nil {
-		fnName, isMain := fn.Name, false
-		if fnName == "main" && (results != nil || params != nil) {
+		fnName, isMain := name, false
+		if fnName == "main" {
 			fnName, isMain = "_cgo_main", true
 		}
 		f, err := pkg.NewFuncWith(goNodePos(fn), fnName, sig, nil)
 		if err != nil {
 			log.Panicln("compileFunc:", err)
 		}
+		ctx.declare(pkg.Types.Scope(), fnName)
 		cb := f.BodyStart(pkg)
-		if vaParam != nil {
-			cb.Scope().Insert(vaParam)
+		if vaParam != nil && hasName && lastParam.IsUsed {
+			initVaParam(ctx, lastParam)
+		}
+		if ctx.nonnull {
+			checkNonNull(ctx, fn, attrs, params)
+		}
+		info := ctx.markComplicated(fn.Name, body)
+		if info.needGoto {
+			ctx.gotofns = append(ctx.gotofns, fnName)
+		}
+		ctx.curfn = newFuncCtx(pkg, info)
+		frame := ctx.flat && ctx.needFrame(fn)
+		if frame {
+			initFrame(ctx, fn)
 		}
-		ctx.curfn = newFuncCtx(pkg, ctx.markComplicated(fn.Name, body))
 		compileSub(ctx, body)
 		checkNeedReturn(ctx, body)
+		if frame {
+			endFrame(ctx)
+		}
 		ctx.curfn = nil
 		cb.End()
-		if isMain {
+		if isMain { // returning from main calls exit, which runs atexit functions and reports leaks of MemCheck
 			pkg.NewFunc(nil, "main", nil, nil, false).BodyStart(pkg)
+			exit := pkg.Import(libcPkgPath).Ref("Exit")
 			if results != nil {
-				cb.Val(pkg.Import("os").Ref("Exit")).Typ(types.Typ[types.Int])
+				cb.Val(exit)
 			}
 			cb.Val(f.Func)
 			if params != nil {
@@ -257,39 +393,122 @@ func compileFunc(ctx *blockCtx, fn *ast.Node) {
 			}
 			cb.Call(len(params))
 			if results != nil {
-				cb.Call(1).Call(1)
+				cb.Call(1)
+			} else {
+				cb.EndStmt().Val(exit).Val(0).Call(1)
 			}
 			cb.EndStmt().End()
 		} else {
 			delete(ctx.extfns, fnName)
 		}
 	} else {
-		f := types.NewFunc(goNodePos(fn), pkg.Types, fn.Name, sig)
+		ctx.useHeader(fn)
+		if ctx.bindLibc(fn.Name, sig) { // bound to a runtime package
+			return
+		}
+		f := types.NewFunc(goNodePos(fn), pkg.Types, name, sig)
 		if pkg.Types.Scope().Insert(f) == nil && fn.IsUsed {
-			ctx.extfns[fn.Name] = none{}
+			ctx.extfns[name] = none{}
 		}
 	}
 }
 
 const (
-	valistName = "__cgo_args"
+	clangPkgPath = "github.com/goplus/c2go/clang"
+	valistName   = "__cgo_args"
 )
 
+// A va_list is a *clang.VaList, which holds the variadic arguments of a call
+// (the __cgo_args parameter) and a cursor. A function which takes a va_list
+// parameter ap receives the arguments in __cgo_args too, and starts with
+//
+//	var ap *clang.VaList = clang.NewVaList(__cgo_args)
+
+func (p *blockCtx) valistRef(name string) types.Object {
+	return p.pkg.Import(clangPkgPath).Ref(name)
+}
+
+func initVaParam(ctx *blockCtx, decl *ast.Node) {
+	pkg, cb := ctx.pkg, ctx.cb
+	args := ctx.lookupParent(valistName)
+	defs := pkg.NewVarDefs(cb.Scope())
+	defs.New(goNodePos(decl), ctx.tyValist, decl.Name).InitStart(pkg).
+		Val(ctx.valistRef("NewVaList")).Val(args).Call(1).EndInit(1)
+}
+
+// compileVAMacro compiles va_start, va_end and va_copy. It returns false if
+// fn isn't one of them.
+func compileVAMacro(ctx *blockCtx, fn string, v *ast.Node) bool {
+	cb := ctx.cb
+	switch fn {
+	case "__builtin_va_start": // ap = clang.NewVaList(__cgo_args)
+		compileExprLHS(ctx, valistVar(v.Inner[1]))
+		cb.Val(ctx.valistRef("NewVaList")).Val(ctx.lookupParent(valistName)).Call(1).
+			AssignWith(1, 1, goNode(v))
+	case "__builtin_va_end": // ap.End()
+		compileExpr(ctx, v.Inner[1])
+		cb.MemberVal("End").CallWith(0, 0, goNode(v))
+	case "__builtin_va_copy": // dst = src.Copy()
+		compileExprLHS(ctx, valistVar(v.Inner[1]))
+		compileExpr(ctx, v.Inner[2])
+		cb.MemberVal("Copy").Call(0).AssignWith(1, 1, goNode(v))
+	default:
+		return false
+	}
+	return true
+}
+
+func valistVar(v *ast.Node) *ast.Node {
+	if v.Kind == ast.ImplicitCastExpr {
+		return v.Inner[0]
+	}
+	return v
+}
+
+var vaArgFns = map[types.BasicKind]string{
+	types.Int8:    "Int32",
+	types.Int16:   "Int32",
+	types.Int32:   "Int32",
+	types.Uint8:   "Uint32",
+	types.Uint16:  "Uint32",
+	types.Uint32:  "Uint32",
+	types.Int64:   "Int64",
+	types.Uint64:  "Uint64",
+	types.Uintptr: "Uint64",
+	types.Float32: "Float64",
+	types.Float64: "Float64",
+}
+
+// compileVAArgExpr: va_arg(ap, T) => T(ap.Int32(pos)), (*T)(ap.Pointer(pos)),
+// ap.Arg(pos).(T), etc.
 func compileVAArgExpr(ctx *blockCtx, expr *ast.Node) {
-	pkg := ctx.pkg
+	cb := ctx.cb
 	typ := toType(ctx, expr.Type, 0)
-	ret := pkg.NewParam(token.NoPos, "_cgo_ret", typ)
-	cb := ctx.cb.NewClosure(nil, types.NewTuple(ret), false).BodyStart(pkg)
-	_, args := cb.Scope().LookupParent(valistName, token.NoPos)
-	//
-	// func() (_cgo_ret T) {
-	//    _cgo_ret = __cgo_args[0].(typ)
-	//    __cgo_args = __cgo_args[1:]
-	//    return
-	// }()
-	cb.VarRef(ret).Val(args).Val(0).Index(1, false).TypeAssert(typ, false).Assign(1).
-		VarRef(args).Val(args).Val(1).None().Slice(false).Assign(1).
-		Return(0).End().Call(0)
+	compileExpr(ctx, expr.Inner[0])
+	fn := "Arg"
+	switch t := typ.Underlying().(type) {
+	case *types.Basic:
+		if t.Kind() == types.UnsafePointer {
+			fn = "Pointer"
+		} else if name, ok := vaArgFns[t.Kind()]; ok {
+			if ctx.sizeof(t) == 4 && name == "Uint64" { // uintptr on 32-bit platforms
+				name = "Uint32"
+			}
+			fn = name
+		}
+	case *types.Pointer:
+		if !ctx.isValistType(typ) {
+			fn = "Pointer"
+		}
+	}
+	cb.MemberVal(fn).Val(ctx.srcPos(expr)).CallWith(1, 0, goNode(expr))
+	if fn == "Arg" {
+		cb.TypeAssert(typ, false)
+		return
+	}
+	ret := cb.InternalStack().Pop()
+	typeCast(ctx, typ, ret)
+	cb.InternalStack().Push(ret)
 }
 
 func newVariadicParam(ctx *blockCtx, hasName bool) *types.Var {
@@ -302,7 +521,9 @@ func newVariadicParam(ctx *blockCtx, hasName bool) *types.Var {
 
 func newParam(ctx *blockCtx, decl *ast.Node) *types.Var {
 	typ := toType(ctx, decl.Type, parser.FlagIsParam)
-	avoidKeyword(&decl.Name)
+	if decl.Name != "" {
+		decl.Name = ctx.ident(decl.Name)
+	}
 	return types.NewParam(goNodePos(decl), ctx.pkg.Types, decl.Name, typ)
 }
 
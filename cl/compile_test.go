@@ -6,7 +6,11 @@ import (
 	"go/types"
 	"log"
 	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
 	"strconv"
+	"strings"
 	"sync/atomic"
 	"testing"
 
@@ -37,20 +41,26 @@ func init() {
 }
 
 func parse(code string, json *[]byte) (doc *ast.Node, src []byte) {
+	return parseWith(code, 0, json)
+}
+
+func parseWith(code string, mode parser.Mode, json *[]byte) (doc *ast.Node, src []byte) {
 	idx := atomic.AddInt64(&tmpFileIdx, 1)
 	infile := tmpDir + strconv.FormatInt(idx, 10) + ".c"
 	err := os.WriteFile(infile, []byte(code), 0666)
 	check(err)
 
 	outfile := infile + ".i"
-	err = preprocessor.Do(infile, outfile, nil)
+	err = preprocessor.Do(infile, outfile, &preprocessor.Config{
+		KeepComments: (mode & parser.ParseComments) != 0,
+	})
 	check(err)
 	os.Remove(infile)
 
 	src, err = os.ReadFile(outfile)
 	check(err)
 
-	doc, _, err = parser.ParseFileEx(outfile, 0, json)
+	doc, _, err = parser.ParseFileEx(outfile, mode, json)
 	check(err)
 	os.Remove(outfile)
 	return
@@ -115,10 +125,17 @@ func testFunc(t *testing.T, name string, code string, outFunc string) Package {
 }
 
 func testWith(t *testing.T, name string, fn string, code string, outFunc string) (pkgOut Package) {
+	return testWithConf(t, name, fn, code, outFunc, &Config{})
+}
+
+var tmpFileRE = regexp.MustCompile(`[^"]*/\d+\.c:`) // source positions of temporary files
+
+func testWithConf(t *testing.T, name string, fn string, code string, outFunc string, conf *Config) (pkgOut Package) {
 	t.Run(name, func(t *testing.T) {
 		var json []byte
 		doc, src := parse(code, &json)
-		pkg, err := NewPackage("", "main", doc, &Config{Src: src})
+		conf.Src = src
+		pkg, err := NewPackage("", "main", doc, conf)
 		check(err)
 		file := gox.ASTFile(pkg.Package, false)
 		ret := goast.Node(file)
@@ -128,7 +145,8 @@ func testWith(t *testing.T, name string, fn string, code string, outFunc string)
 		w := bytes.NewBuffer(nil)
 		err = format.Node(w, pkg.Fset, ret)
 		check(err)
-		if out := w.String(); out != outFunc {
+		out := tmpFileRE.ReplaceAllString(w.String(), "test.c:")
+		if out != outFunc {
 			t.Fatalf(
 				"==> Result:\n%s\n==> Expected:\n%s\n==> AST:\n%s\n",
 				out, outFunc, string(json))
@@ -148,4 +166,759 @@ void test(int var) {
 }`)
 }
 
+func TestLiftSideEffects(t *testing.T) {
+	testFunc(t, "PostInc", `
+void test(int a, int b) {
+	a = b++;
+}
+`, `func test(a int32, b int32) {
+	_cgo_t1 := b
+	b++
+	a = _cgo_t1
+}`)
+	testFunc(t, "ChainAssign", `
+void test(int a, int b, int c) {
+	a = b = c;
+}
+`, `func test(a int32, b int32, c int32) {
+	b = c
+	a = b
+}`)
+	testFunc(t, "Goto", `
+void test(int *a, int i) {
+retry:
+	a[i++] = 1;
+	if (i < 0) goto retry;
+	a[0] = i;
+}
+`, `func test(a *int32, i int32) {
+	var _cgo_t1 int32
+retry:
+	_cgo_t1 = i
+	i++
+	*(*int32)(unsafe.Pointer(uintptr(unsafe.Pointer(a)) + uintptr(_cgo_t1)*4)) = int32(1)
+	if i < 0 {
+		goto retry
+	}
+	*(*int32)(unsafe.Pointer(uintptr(unsafe.Pointer(a)) + uintptr(0)*4)) = i
+}`)
+	testFunc(t, "GotoExit", `
+void test(int *a, int i) {
+	if (i < 0) goto out;
+	a[i++] = 1;
+out:
+	a[0] = i;
+}
+`, `func test(a *int32, i int32) {
+_cgol_1:
+	switch {
+	default:
+		if i < 0 {
+			break _cgol_1
+		}
+		_cgo_t1 := i
+		i++
+		*(*int32)(unsafe.Pointer(uintptr(unsafe.Pointer(a)) + uintptr(_cgo_t1)*4)) = int32(1)
+	}
+	*(*int32)(unsafe.Pointer(uintptr(unsafe.Pointer(a)) + uintptr(0)*4)) = i
+}`)
+	testFunc(t, "While", `
+void test(int *a, int i) {
+	while (a[i++])
+		a[0]++;
+}
+`, `func test(a *int32, i int32) {
+	for {
+		_cgo_t1 := i
+		i++
+		if !(*(*int32)(unsafe.Pointer(uintptr(unsafe.Pointer(a)) + uintptr(_cgo_t1)*4)) != 0) {
+			break
+		}
+		*(*int32)(unsafe.Pointer(uintptr(unsafe.Pointer(a)) + uintptr(0)*4))++
+	}
+}`)
+}
+
+func TestUnsafeAdd(t *testing.T) {
+	conf := &Config{UnsafeAdd: true}
+	testWithConf(t, "PtrArith", "test", `
+void test(int *p, int n) {
+	p += n;
+	p++;
+	p = p - 2;
+}
+`, `func test(p *int32, n int32) {
+	p = (*int32)(unsafe.Add(unsafe.Pointer(p), int(n)*4))
+	p = (*int32)(unsafe.Add(unsafe.Pointer(p), 4))
+	p = (*int32)(unsafe.Add(unsafe.Pointer(p), -8))
+}`, conf)
+	testWithConf(t, "IndexTypes", "test", `
+int test(int *tbl, unsigned char c, short s, int n) {
+	return tbl[c] + tbl[s] + *(tbl - n);
+}
+`, `func test(tbl *int32, c uint8, s int16, n int32) int32 {
+	return *(*int32)(unsafe.Add(unsafe.Pointer(tbl), int(c)*4)) + *(*int32)(unsafe.Add(unsafe.Pointer(tbl), int(s)*4)) + *(*int32)(unsafe.Add(unsafe.Pointer(tbl), -(int(n) * 4)))
+}`, conf)
+	testWithConf(t, "NotSimpleRef", "test", `
+int **next(void);
+
+void test(int n) {
+	*next() += n;
+	(*next())++;
+	for (; n > 0; *next() -= 2)
+		n--;
+}
+`, `func test(n int32) {
+	_cgo_t1 := &*next()
+	*_cgo_t1 = (*int32)(unsafe.Add(unsafe.Pointer(*_cgo_t1), int(n)*4))
+	_cgo_t2 := &*next()
+	*_cgo_t2 = (*int32)(unsafe.Add(unsafe.Pointer(*_cgo_t2), 4))
+	for ; n > 0; func(_cgo_t3 **int32) {
+		*_cgo_t3 = (*int32)(unsafe.Add(unsafe.Pointer(*_cgo_t3), -8))
+	}(&*next()) {
+		n--
+	}
+}`, conf)
+	testWithConf(t, "IntToPtr", "test", `
+void test(char *p) {
+	p = (char*)16;
+}
+`, `func test(p *int8) {
+	p = (*int8)(unsafe.Add(unsafe.Pointer(nil), uintptr(16)))
+}`, conf)
+}
+
+func TestFlatMemory(t *testing.T) {
+	conf := &Config{FlatMemory: true}
+	testWithConf(t, "PtrArith", "test", `
+long test(int *p, int n) {
+	int *q = p + n;
+	q++;
+	q -= 2;
+	*q = p[1];
+	return q - p;
+}
+`, `func test(p uintptr, n int32) int64 {
+	var q uintptr = p + uintptr(n)*4
+	q += 4
+	q -= 2 * 4
+	*(*int32)(mem.Ptr(q)) = mem.LoadInt32(p + 1*4)
+	return int64(q-p) / 4
+}`, conf)
+	testWithConf(t, "AddrOfLocal", "test", `
+void swap(int *a, int *b);
+
+int test(int x) {
+	int y = 2, arr[3];
+	swap(&x, &y);
+	arr[1] = x;
+	return y + arr[1];
+}
+`, `func test(x int32) int32 {
+	_cgo_fp := mem.Alloc(28)
+	defer mem.Free(_cgo_fp)
+	*(*int32)(mem.Ptr(_cgo_fp)) = x
+	*(*int32)(mem.Ptr(_cgo_fp + 8)) = 2
+	*(*[3]int32)(mem.Ptr(_cgo_fp + 16)) = [3]int32{}
+	swap(_cgo_fp, _cgo_fp+8)
+	*(*int32)(mem.Ptr(_cgo_fp + 16 + 1*4)) = mem.LoadInt32(_cgo_fp)
+	return mem.LoadInt32(_cgo_fp+8) + mem.LoadInt32(_cgo_fp+16+1*4)
+}`, conf)
+	testWithConf(t, "Struct", "test", `
+void *malloc(unsigned long);
+
+struct foo { int a; struct foo *next; };
+
+struct foo *test() {
+	struct foo *p = (struct foo*)malloc(sizeof(struct foo));
+	p->next = 0;
+	p->a = (int)(long)&p->next;
+	return p;
+}
+`, `func test() uintptr {
+	var p uintptr = uintptr(mem.Malloc(16))
+	(*struct_foo)(mem.Ptr(p)).next = uintptr(0)
+	(*struct_foo)(mem.Ptr(p)).a = int32(int64(p + 8))
+	return p
+}`, conf)
+	testWithConf(t, "String", "test", `
+const char *test() {
+	return "hi";
+}
+`, `func test() uintptr {
+	return mem.Str("hi")
+}`, conf)
+	testWithConf(t, "ShadowedGlobal", "", `
+void use(int *p);
+
+int x;
+
+int test(void) {
+	int x = 1;
+	use(&x);
+	return x;
+}
+`, `package main
+
+import mem "github.com/goplus/c2go/clang/mem"
+
+var x int32
+
+func test() int32 {
+	_cgo_fp := mem.Alloc(4)
+	defer mem.Free(_cgo_fp)
+	*(*int32)(mem.Ptr(_cgo_fp)) = 1
+	use(_cgo_fp)
+	return mem.LoadInt32(_cgo_fp)
+}
+`, conf)
+	testWithConf(t, "RedeclaredGlobal", "", `
+extern int y;
+
+int *test(void) {
+	return &y;
+}
+
+int y = 1;
+`, `package main
+
+import mem "github.com/goplus/c2go/clang/mem"
+
+func test() uintptr {
+	return y
+}
+
+var y uintptr = mem.Alloc(4)
+
+func init() {
+	*(*int32)(mem.Ptr(y)) = 1
+}
+`, conf)
+}
+
+func TestMacros(t *testing.T) {
+	macros := preprocessor.ParseMacros([]byte(`#define ANSWER 42
+#define FLAG (1<<3)
+#define MASK (FLAG | 0x10u)
+#define NEG (-ANSWER)
+#define BIG 0xFFFFFFFFFFUL
+#define PI 3.5
+#define HALF 1.f
+#define NAME "c2go" "\x41\0"
+#define CH '\n'
+#define BYTE ((unsigned char)300)
+#define COLOR (RED + 1)
+#define SQUARE(x) ((x)*(x))
+#define NOTCONST (ANSWER + foo)
+#define len 1
+#define _RESERVED 1
+#define SAFE (0 && ANSWER/0)
+#define PICK (1 ? 2 : 1/0)
+#define HUGE 1e309
+#define SYS 7
+#define USESYS (SYS + 1)
+`))
+	for _, m := range macros {
+		m.System = m.Name == "SYS"
+	}
+	pkg := testWithConf(t, "Consts", "", `
+enum { RED = 5 };
+`, `package main
+
+const RED int32 = 5
+const (
+	ANSWER int32   = 42
+	BIG    uint64  = 1099511627775
+	BYTE   uint8   = 44
+	CH     int32   = 10
+	COLOR  int32   = 6
+	FLAG   int32   = 8
+	HALF   float32 = 1.0
+	MASK   uint32  = 24
+	NAME   string  = "c2goA\x00"
+	NEG    int32   = -42
+	PI     float64 = 3.5
+	PICK   int32   = 2
+	SAFE   int32   = 0
+	USESYS int32   = 8
+)
+`, &Config{Macros: macros})
+	if pkg.PkgInfo == nil {
+		return
+	}
+	if skipped := pkg.SkippedMacros; !reflect.DeepEqual(skipped, []string{"HUGE", "NOTCONST", "SQUARE", "len"}) {
+		t.Fatal("SkippedMacros:", skipped)
+	}
+}
+
+func TestCheckedPointers(t *testing.T) {
+	conf := &Config{CheckedPointers: true}
+	testWithConf(t, "PtrArith", "test", `
+int test(int *p, int n) {
+	int *q = p + n;
+	q++;
+	return *q + p[1];
+}
+`, `func test(p *int32, n int32) int32 {
+	var q *int32 = (*int32)(checked.Add(unsafe.Pointer(p), int(n)*4, "test.c:3:11"))
+	q = (*int32)(checked.Add(unsafe.Pointer(q), 4, "test.c:4:2"))
+	return *(*int32)(checked.Deref(unsafe.Pointer(q), 4, "test.c:5:9")) + *(*int32)(checked.Deref(unsafe.Pointer((*int32)(checked.Add(unsafe.Pointer(p), 4, "test.c:5:14"))), 4, "test.c:5:14"))
+}`, conf)
+	testWithConf(t, "Struct", "test", `
+void *malloc(unsigned long);
+void free(void *);
+
+struct foo { int a[2]; };
+
+int test(int i) {
+	struct foo *p = (struct foo*)malloc(sizeof(struct foo));
+	int a = p->a[i];
+	free(p);
+	return a;
+}
+`, `func test(i int32) int32 {
+	var p *struct_foo = (*struct_foo)(checked.Malloc(8))
+	var a int32 = (*struct_foo)(checked.Deref(unsafe.Pointer(p), 8, "test.c:9:10")).a[checked.Index(int(i), 2, "test.c:9:10")]
+	checked.Free(unsafe.Pointer(p))
+	return a
+}`, conf)
+	testWithConf(t, "NonNull", "test", `
+__attribute__((nonnull(1))) int test(int *p, int *q) {
+	return q ? *p + *q : *p;
+}
+`, `func test(p *int32, q *int32) int32 {
+	checked.NonNull(unsafe.Pointer(p), "p", "test.c:2:38")
+	var _cgo_t1 int32
+	if q != nil {
+		_cgo_t1 = *(*int32)(checked.Deref(unsafe.Pointer(p), 4, "test.c:3:13")) + *(*int32)(checked.Deref(unsafe.Pointer(q), 4, "test.c:3:18"))
+	} else {
+		_cgo_t1 = *(*int32)(checked.Deref(unsafe.Pointer(p), 4, "test.c:3:23"))
+	}
+	return _cgo_t1
+}`, conf)
+	testWithConf(t, "NonNullOnly", "test", `
+__attribute__((nonnull(1))) int test(int *p, int *q) {
+	return q ? *p + *q : *p;
+}
+`, `func test(p *int32, q *int32) int32 {
+	checked.NonNull(unsafe.Pointer(p), "p", "test.c:2:38")
+	var _cgo_t1 int32
+	if q != nil {
+		_cgo_t1 = *p + *q
+	} else {
+		_cgo_t1 = *p
+	}
+	return _cgo_t1
+}`, &Config{NonNullChecks: true})
+}
+
+func TestNoReturn(t *testing.T) {
+	testWith(t, "GNU", "test", `
+void abort(void) __attribute__((noreturn));
+
+int test(int n) {
+	if (n > 0)
+		return n;
+	abort();
+}
+`, `func test(n int32) int32 {
+	if n > 0 {
+		return n
+	}
+	abort()
+	panic("unreachable")
+}`)
+	testWith(t, "C11", "test", `
+_Noreturn void fail(const char *msg);
+
+int test(int n) {
+	if (n > 0) {
+		return n;
+	} else {
+		fail("bad");
+	}
+}
+`, `func test(n int32) int32 {
+	if n > 0 {
+		return n
+	} else {
+		fail((*int8)(unsafe.Pointer(&[4]int8{'b', 'a', 'd', '\x00'})))
+	}
+	panic("unreachable")
+}`)
+}
+
 // -----------------------------------------------------------------------------
+
+func TestBind(t *testing.T) {
+	header := `
+typedef struct point { int x, y; } point;
+enum color { RED, GREEN };
+extern int count;
+int area(point *p, int);
+int area(point *p, int);
+static int twice(int x) { return x * 2; }
+void internal_helper(void);
+`
+	filter := func(name string) bool {
+		return !strings.HasPrefix(name, "internal_")
+	}
+	testWithConf(t, "Panic", "", header, `package main
+
+type struct_point struct {
+	x int32
+	y int32
+}
+type point = struct_point
+
+const (
+	RED   int32 = 0
+	GREEN int32 = 1
+)
+
+var count int32
+
+func area(p *struct_point, _ int32) int32 {
+	panic("notimpl")
+}
+func twice(x int32) int32 {
+	panic("notimpl")
+}
+`, &Config{Bind: &BindConfig{Filter: filter, Stubs: StubPanic}})
+	testWithConf(t, "Linkname", "", header, `package main
+
+import (
+	_ "unsafe"
+	_ "example.com/point"
+)
+
+type struct_point struct {
+	x int32
+	y int32
+}
+type point = struct_point
+
+const (
+	RED   int32 = 0
+	GREEN int32 = 1
+)
+
+var count int32
+//go:linkname area example.com/point.area
+func area(p *struct_point, _ int32) int32
+//go:linkname twice example.com/point.twice
+func twice(x int32) int32
+`, &Config{Bind: &BindConfig{Filter: filter, Stubs: StubLinkname, LinkPkg: "example.com/point"}})
+}
+
+func TestIdents(t *testing.T) {
+	testWith(t, "Reserved", "", `
+typedef char *string;
+enum color { nil, red };
+struct buf {
+	int len;
+	string type;
+};
+int close(int);
+int len_ = 1;
+int _cgo_ret;
+
+static int init(void) {
+	return 0;
+}
+
+int copy(struct buf *b, int error) {
+	int len = b->len;
+	if (error)
+		goto type;
+	close(len);
+	return len + len_ + red + _cgo_ret + init();
+type:
+	if (error < 0)
+		goto type;
+	return nil;
+}
+`, `package main
+
+import libc "github.com/goplus/c2go/clang/libc"
+
+type string_ = *int8
+
+const (
+	nil_ int32 = 0
+	red  int32 = 1
+)
+
+type struct_buf struct {
+	len__ int32
+	type_ *int8
+}
+
+var len_ int32 = 1
+var c_cgo_ret int32
+
+func init_() int32 {
+	return int32(0)
+}
+func copy_(b *struct_buf, error_ int32) int32 {
+	var len__ int32 = b.len__
+	if error_ != 0 {
+		goto type_
+	}
+	libc.Close(len__)
+	return len__ + len_ + red + c_cgo_ret + init_()
+type_:
+	if error_ < 0 {
+		goto type_
+	}
+	return nil_
+}
+`)
+}
+
+func TestMemCheck(t *testing.T) {
+	testWithConf(t, "Alloc", "", `
+void *malloc(unsigned long);
+void *realloc(void *, unsigned long);
+void free(void *);
+
+int main(void) {
+	char *p = malloc(8);
+	p = realloc(p, 16);
+	free(p);
+	return 0;
+}
+`, `package main
+
+import (
+	libc "github.com/goplus/c2go/clang/libc"
+	unsafe "unsafe"
+)
+
+func init() {
+	libc.EnableMemcheck()
+}
+func _cgo_main() int32 {
+	var p *int8 = (*int8)(libc.MallocAt(uint64(8), "test.c:7:12"))
+	p = (*int8)(libc.ReallocAt(unsafe.Pointer(p), uint64(16), "test.c:8:6"))
+	libc.FreeAt(unsafe.Pointer(p), "test.c:9:2")
+	return int32(0)
+}
+func main() {
+	libc.Exit(_cgo_main())
+}
+`, &Config{MemCheck: true})
+	testWithConf(t, "VoidMain", "", `
+void *malloc(unsigned long);
+
+void main(void) {
+	char *p = malloc(8);
+	p[0] = 0;
+}
+`, `package main
+
+import (
+	libc "github.com/goplus/c2go/clang/libc"
+	unsafe "unsafe"
+)
+
+func init() {
+	libc.EnableMemcheck()
+}
+func _cgo_main() {
+	var p *int8 = (*int8)(libc.MallocAt(uint64(8), "test.c:5:12"))
+	*(*int8)(unsafe.Pointer(uintptr(unsafe.Pointer(p)) + uintptr(0))) = int8(0)
+}
+func main() {
+	_cgo_main()
+	libc.Exit(0)
+}
+`, &Config{MemCheck: true})
+}
+
+func TestOverrides(t *testing.T) {
+	pkg := testWithConf(t, "Hot", "", `
+int hash(const char *s, int n);
+
+int hash(const char *s, int n) {
+	int h = 0;
+	while (n--)
+		h = h * 31 + *s++;
+	return h;
+}
+
+int test(const char *s) {
+	return hash(s, 4) + 1;
+}
+`, `package main
+
+func test(s *int8) int32 {
+	return hash(s, 4) + 1
+}
+`, &Config{Overrides: []string{"hash"}})
+	if len(pkg.UsedFuncs) != 0 {
+		t.Fatal("UsedFuncs:", pkg.UsedFuncs)
+	}
+}
+
+func TestLibc(t *testing.T) {
+	testWith(t, "Bound", "test", `
+int printf(const char *fmt, ...);
+unsigned long strlen(const char *s);
+int atoi(int n);
+
+void test(const char *s) {
+	printf("%d %d\n", (int)strlen(s), atoi(1));
+}
+`, `func test(s *int8) {
+	libc.Printf((*int8)(unsafe.Pointer(&[7]int8{'%', 'd', ' ', '%', 'd', '\n', '\x00'})), int32(libc.Strlen(s)), atoi(1))
+}`)
+	testWith(t, "Defined", "test", `
+unsigned long strlen(const char *s);
+
+int test(const char *s) {
+	return strlen(s);
+}
+
+unsigned long strlen(const char *s) {
+	return 0;
+}
+`, `func test(s *int8) int32 {
+	return int32(strlen(s))
+}`)
+	testWith(t, "Stdio", "test", `
+struct _IO_FILE { int _flags; struct _IO_marker *_markers; };
+typedef struct _IO_FILE FILE;
+extern FILE *stdout;
+int fprintf(FILE *fp, const char *fmt, ...);
+struct stat { long st_size; };
+int fstat(int fd, struct stat *st);
+int close(int fd);
+extern int *__errno_location(void);
+
+long test(int fd) {
+	struct stat st;
+	if (fstat(fd, &st) < 0 || close(fd) < 0)
+		fprintf(stdout, "%d\n", *__errno_location());
+	return st.st_size;
+}
+`, `func test(fd int32) int64 {
+	var st struct_stat
+	if libc.Fstat(fd, unsafe.Pointer(&st)) < 0 || libc.Close(fd) < 0 {
+		libc.Fprintf(libc.Stdout, (*int8)(unsafe.Pointer(&[4]int8{'%', 'd', '\n', '\x00'})), *libc.ErrnoLocation())
+	}
+	return st.st_size
+}`)
+	testWith(t, "Time", "test", `
+typedef long time_t;
+struct tm { int tm_sec, tm_min, tm_hour, tm_mday, tm_mon, tm_year, tm_wday, tm_yday, tm_isdst; };
+struct tm *gmtime(const time_t *t);
+double fabs(double x);
+
+double test(time_t t) {
+	return fabs(gmtime(&t)->tm_year) + __builtin_inf();
+}
+`, `func test(t int64) float64 {
+	return libc.Fabs(float64((*struct_tm)(libc.Gmtime(&t)).tm_year)) + libc.HugeVal()
+}`)
+}
+
+func TestTLS(t *testing.T) {
+	testWith(t, "Global", "", `
+__thread int n = 1;
+extern _Thread_local char *s;
+
+int test(void) {
+	static __thread int calls;
+	return n += ++calls;
+}
+`, `package main
+
+import libc "github.com/goplus/c2go/clang/libc"
+
+var _cgo_tls_n int32 = 1
+var n *libc.TLS = libc.NewTLS(&_cgo_tls_n)
+
+func test() int32 {
+	*(*int32)(_cgo_tls2_calls.Get())++
+	*(*int32)(n.Get()) += *(*int32)(_cgo_tls2_calls.Get())
+	return *(*int32)(n.Get())
+}
+
+var _cgo_tls2_calls_init int32
+var _cgo_tls2_calls *libc.TLS = libc.NewTLS(&_cgo_tls2_calls_init)
+`)
+	testWith(t, "Threads", "test", `
+typedef unsigned long pthread_t;
+typedef union { char __size[40]; long __align; } pthread_mutex_t;
+int pthread_create(pthread_t *th, const void *attr, void *(*start)(void *), void *arg);
+int pthread_join(pthread_t th, void **ret);
+int pthread_mutex_lock(pthread_mutex_t *m);
+int pthread_mutex_unlock(pthread_mutex_t *m);
+
+pthread_mutex_t mu;
+
+void *run(void *arg) {
+	pthread_mutex_lock(&mu);
+	pthread_mutex_unlock(&mu);
+	return arg;
+}
+
+void test(void) {
+	pthread_t th;
+	pthread_create(&th, 0, run, 0);
+	pthread_join(th, 0);
+}
+`, `func test() {
+	var th uint64
+	libc.PthreadCreate(&th, nil, run, nil)
+	libc.PthreadJoin(th, nil)
+}`)
+}
+
+func TestFromASTDump(t *testing.T) {
+	infile := filepath.Join(t.TempDir(), "test.c")
+	err := os.WriteFile(infile, []byte(`
+struct point { int x, y; };
+
+int test(int n) {
+	if (n < 0)
+		goto neg;
+	return sizeof(struct point) * n;
+neg:
+	return -1;
+}
+`), 0666)
+	check(err)
+	ifile := infile + ".i"
+	err = preprocessor.Do(infile, ifile, &preprocessor.Config{})
+	check(err)
+	astfile := ifile + ".json.gz"
+	if _, _, err = parser.RecordAST(ifile, astfile, 0); err != nil {
+		t.Fatal("RecordAST:", err)
+	}
+	os.Remove(ifile) // the source is recorded in the dump
+	doc, src, err := parser.ParseASTFileEx(astfile, ifile, parser.PruneSystemDecls)
+	if err != nil || src == nil {
+		t.Fatal("ParseASTFileEx:", err)
+	}
+	pkg, err := NewPackage("", "main", doc, &Config{SrcFile: ifile, Src: src})
+	check(err)
+	w := bytes.NewBuffer(nil)
+	err = format.Node(w, pkg.Fset, findFunc(gox.ASTFile(pkg.Package, false), "test"))
+	check(err)
+	if out := w.String(); out != `func test(n int32) int32 {
+_cgol_1:
+	switch {
+	default:
+		if n < 0 {
+			break _cgol_1
+		}
+		return int32(8 * uint64(n))
+	}
+	return int32(-1)
+	return 0
+}` {
+		t.Fatal("TestFromASTDump:", out)
+	}
+}
@@ -9,6 +9,8 @@ import (
 
 	"github.com/goplus/c2go/clang/ast"
 	"github.com/goplus/gox"
+
+	ctypes "github.com/goplus/c2go/clang/types"
 )
 
 // -----------------------------------------------------------------------------
@@ -49,6 +51,10 @@ func compileExprEx(ctx *blockCtx, expr *ast.Node, prompt string, flags int) {
 	case ast.ParenExpr, ast.ConstantExpr:
 		compileExprEx(ctx, expr.Inner[0], prompt, flags)
 	case ast.CStyleCastExpr:
+		if expr.CastKind == ast.ToVoid {
+			compileToVoid(ctx, expr, flags)
+			break
+		}
 		compileTypeCast(ctx, expr, goNode(expr))
 	case ast.ArraySubscriptExpr:
 		compileArraySubscriptExpr(ctx, expr, (flags&flagLHS) != 0)
@@ -57,7 +63,7 @@ func compileExprEx(ctx *blockCtx, expr *ast.Node, prompt string, flags int) {
 	case ast.ImplicitValueInitExpr:
 		compileImplicitValueInitExpr(ctx, expr)
 	case ast.ConditionalOperator:
-		compileConditionalOperator(ctx, expr)
+		compileConditionalOperator(ctx, expr, flags)
 	case ast.ImaginaryLiteral:
 		compileImaginaryLiteral(ctx, expr)
 	case ast.VAArgExpr:
@@ -117,6 +123,7 @@ func compileOffsetOfExpr(ctx *blockCtx, v *ast.Node) {
 func compileSizeof(ctx *blockCtx, v *ast.Node) {
 	var t types.Type
 	if len(v.Inner) > 0 {
+		defer ctx.restoreLift(ctx.setLift(false)) // operand of sizeof isn't evaluated
 		compileExpr(ctx, v.Inner[0])
 		t = ctx.cb.InternalStack().Pop().Type
 	} else {
@@ -144,9 +151,16 @@ func compileImplicitValueInitExpr(ctx *blockCtx, v *ast.Node) {
 }
 
 func compileArraySubscriptExpr(ctx *blockCtx, v *ast.Node, lhs bool) {
+	if ctx.flat {
+		compileArenaExpr(ctx, v, lhs)
+		return
+	}
+	if ctx.checked && compileCheckedIndex(ctx, v, lhs) {
+		return
+	}
 	compileExpr(ctx, v.Inner[0])
 	compileExpr(ctx, v.Inner[1])
-	typeCastIndex(ctx, lhs)
+	typeCastIndex(ctx, v, lhs)
 }
 
 // -----------------------------------------------------------------------------
@@ -165,13 +179,20 @@ func compileImplicitCastExpr(ctx *blockCtx, v *ast.Node) {
 	case ast.LValueToRValue, ast.NoOp:
 		compileExpr(ctx, v.Inner[0])
 	case ast.BuiltinFnToFnPtr:
-		if fn, ok := getBuiltinFn(v.Inner[0]); ok && ctx.pkg.Types.Scope().Lookup(fn) != nil {
-			ctx.extfns[fn] = none{}
+		if fn, ok := getBuiltinFn(v.Inner[0]); ok {
+			ctx.builtins[fn] = none{}
+			if ctx.pkg.Types.Scope().Lookup(fn) != nil {
+				ctx.extfns[fn] = none{}
+			}
 		}
 		fallthrough
 	case ast.FunctionToPointerDecay:
 		compileExpr(ctx, v.Inner[0])
 	case ast.ArrayToPointerDecay:
+		if ctx.flat {
+			compileArrayDecay(ctx, v.Inner[0])
+			break
+		}
 		compileExpr(ctx, v.Inner[0])
 		if cb := ctx.cb; !isEllipsis(ctx, cb) {
 			arrayToElemPtr(cb)
@@ -180,24 +201,56 @@ func compileImplicitCastExpr(ctx *blockCtx, v *ast.Node) {
 		ast.FloatingToIntegral, ast.FloatingComplexCast, ast.FloatingRealToComplex:
 		compileTypeCast(ctx, v, nil)
 	case ast.NullToPointer:
+		if ctx.flat && !isFunc(toType(ctx, v.Type, 0)) {
+			ctx.cb.Val(0)
+			break
+		}
 		ctx.cb.Val(nil)
 	default:
 		log.Panicln("compileImplicitCastExpr: unknown castKind =", v.CastKind)
 	}
 }
 
-func compileTypeCast(ctx *blockCtx, v *ast.Node, src goast.Node) {
-	switch v.CastKind {
-	case ast.ToVoid: // _ = expr
-		cb, _ := closureStartT(ctx, types.Typ[types.Int])
-		cb.VarRef(nil)
-		compileExpr(ctx, v.Inner[0])
-		cb.Assign(1).Val(0).Return(1).End().Call(0)
+func compileToVoid(ctx *blockCtx, v *ast.Node, flags int) {
+	if ctx.lift.on && (flags&flagIgnoreResult) != 0 {
+		cb := ctx.cb
+		stk := cb.InternalStack()
+		n := stk.Len()
+		compileExprEx(ctx, v.Inner[0], unknownExprPrompt, flagIgnoreResult)
+		if stk.Len() > n && stk.Get(-1).CVal == nil && !isCallExpr(v.Inner[0]) { // _ = expr
+			x := stk.Pop()
+			cb.VarRef(nil).Val(x).Assign(1)
+		}
 		return
 	}
+	defer ctx.restoreLift(ctx.setLift(false))
+	cb, _ := closureStartT(ctx, types.Typ[types.Int])
+	cb.VarRef(nil)
+	compileExpr(ctx, v.Inner[0])
+	cb.Assign(1).Val(0).Return(1).End().Call(0)
+}
+
+func isCallExpr(v *ast.Node) bool {
+	for {
+		switch v.Kind {
+		case ast.CallExpr:
+			return true
+		case ast.ParenExpr, ast.ImplicitCastExpr:
+			v = v.Inner[0]
+		default:
+			return false
+		}
+	}
+}
+
+func compileTypeCast(ctx *blockCtx, v *ast.Node, src goast.Node) {
 	t := toType(ctx, v.Type, 0)
 	ctx.cb.Typ(t, src)
 	if v.CastKind == ast.NullToPointer {
+		if ctx.flat && !isFunc(t) {
+			ctx.cb.Val(0).Call(1)
+			return
+		}
 		ctx.cb.Val(nil).Call(1)
 		return
 	}
@@ -208,12 +261,28 @@ func compileTypeCast(ctx *blockCtx, v *ast.Node, src goast.Node) {
 // -----------------------------------------------------------------------------
 
 func compileDeclRefExpr(ctx *blockCtx, v *ast.Node, lhs bool) {
-	name := v.ReferencedDecl.Name
-	avoidKeyword(&name)
+	if ctx.flat && isArenaLvalue(ctx, v) {
+		compileArenaExpr(ctx, v, lhs)
+		return
+	}
+	if tv := ctx.lookupTLS(v.ReferencedDecl); tv != nil {
+		compileTLSRef(ctx, tv, lhs)
+		return
+	}
+	cname := v.ReferencedDecl.Name
+	name := ctx.ident(cname)
 	obj := ctx.lookupParent(name)
+	if obj == nil || obj.Pkg() != ctx.pkg.Types { // not declared by C code, such as C library function close
+		if fn := ctx.libcFn(cname); fn != nil {
+			obj = fn
+		}
+	}
 	if obj == nil {
 		log.Panicln("compileDeclRefExpr: not found -", name)
 	}
+	if obj.Pkg() != ctx.pkg.Types || obj.Parent() == ctx.pkg.Types.Scope() {
+		ctx.use(name, v)
+	}
 	if lhs {
 		ctx.cb.VarRef(obj)
 	} else {
@@ -226,25 +295,36 @@ func compileDeclRefExpr(ctx *blockCtx, v *ast.Node, lhs bool) {
 func compileCallExpr(ctx *blockCtx, v *ast.Node) {
 	if n := len(v.Inner); n > 0 {
 		if fn := v.Inner[0]; isBuiltinFn(fn) {
-			item := fn.Inner[0]
-			switch name := item.ReferencedDecl.Name; name {
-			case "__builtin_va_start", "__builtin_va_end":
+			if compileVAMacro(ctx, fn.Inner[0].ReferencedDecl.Name, v) {
 				return
 			}
 		}
+		if ctx.memcheck && compileMemcheckCall(ctx, v) {
+			return
+		}
 		cb := ctx.cb
-		for i := 0; i < n; i++ {
+		compileExpr(ctx, v.Inner[0])
+		nfixed, variadic := fixedParams(cb.Get(-1).Type)
+		for i := 1; i < n; i++ {
 			compileExpr(ctx, v.Inner[i])
+			if variadic && i > nfixed { // variadic argument: an untyped constant gets its C type
+				if arg := cb.Get(-1); arg.CVal != nil && isUntyped(arg.Type) {
+					typeCast(ctx, toType(ctx, v.Inner[i].Type, 0), arg)
+				}
+			}
 		}
+		checkFormat(ctx, v)
 		var flags gox.InstrFlags
-		var ellipsis = n > 2 && isEllipsis(ctx, cb)
-		if ellipsis {
-			_, o := cb.Scope().LookupParent(valistName, token.NoPos)
-			cb.InternalStack().Pop()
-			cb.Val(o)
+		if n > 1 && isEllipsis(ctx, cb) && isVariadicCall(cb.Get(-n).Type, n-1) { // f(..., ap.Args()...)
+			cb.MemberVal("Args").Call(0)
 			flags = gox.InstrFlagEllipsis
 		}
 		cb.CallWith(n-1, flags, goNode(v))
+		if ret := cb.Get(-1); ret.Type == ctypes.UnsafePointer { // such as struct tm * of a bound localtime
+			if t, ok := toType(ctx, v.Type, 0).(*types.Pointer); ok {
+				typeCast(ctx, t, ret)
+			}
+		}
 	}
 }
 
@@ -252,6 +332,24 @@ func isEllipsis(ctx *blockCtx, cb *gox.CodeBuilder) bool {
 	return ctx.isValistType(cb.Get(-1).Type)
 }
 
+// fixedParams returns the number of fixed parameters of fn if it is a
+// variadic function.
+func fixedParams(fn types.Type) (n int, variadic bool) {
+	if t, ok := fn.Underlying().(*types.Signature); ok && t.Variadic() {
+		return t.Params().Len() - 1, true
+	}
+	return
+}
+
+// isVariadicCall reports whether the last of nargs arguments of a call to fn
+// is passed to the variadic parameter.
+func isVariadicCall(fn types.Type, nargs int) bool {
+	if t, ok := fn.Underlying().(*types.Signature); ok {
+		return t.Variadic() && t.Params().Len() == nargs
+	}
+	return false
+}
+
 func isBuiltinFn(fn *ast.Node) bool {
 	return fn.CastKind == ast.BuiltinFnToFnPtr
 }
@@ -259,9 +357,16 @@ func isBuiltinFn(fn *ast.Node) bool {
 // -----------------------------------------------------------------------------
 
 func compileMemberExpr(ctx *blockCtx, v *ast.Node, lhs bool) {
-	avoidKeyword(&v.Name)
+	if ctx.flat && isArenaLvalue(ctx, v) {
+		compileArenaExpr(ctx, v, lhs)
+		return
+	}
+	v.Name = ctx.ident(v.Name)
 	name := v.Name
 	compileExpr(ctx, v.Inner[0])
+	if v.IsArrow && ctx.checked {
+		checkDeref(ctx, v)
+	}
 	if name == "" { // anonymous
 		return
 	}
@@ -276,6 +381,13 @@ func compileMemberExpr(ctx *blockCtx, v *ast.Node, lhs bool) {
 // -----------------------------------------------------------------------------
 
 func compileCommaExpr(ctx *blockCtx, v *ast.Node, flags int) {
+	if ctx.lift.on {
+		n := ctx.cb.InternalStack().Len()
+		compileExprEx(ctx, v.Inner[0], unknownExprPrompt, flagIgnoreResult)
+		ctx.liftStmt(n)
+		compileExprEx(ctx, v.Inner[1], unknownExprPrompt, flags&flagIgnoreResult)
+		return
+	}
 	cb, _ := closureStart(ctx, "")
 	compileExprEx(ctx, v.Inner[0], unknownExprPrompt, flagIgnoreResult)
 	cb.EndStmt()
@@ -285,16 +397,20 @@ func compileCommaExpr(ctx *blockCtx, v *ast.Node, flags int) {
 
 func compileBinaryExpr(ctx *blockCtx, v *ast.Node, flags int) {
 	if op, ok := binaryOps[v.OpCode]; ok {
+		if ctx.flat && flatBinaryOp(ctx, op, v) {
+			return
+		}
 		isBoolOp := (op == token.LOR || op == token.LAND)
 		compileExpr(ctx, v.Inner[0])
 		if isBoolOp {
 			castToBoolExpr(ctx.cb)
-		}
-		compileExpr(ctx, v.Inner[1])
-		if isBoolOp {
+			old := ctx.setLift(false) // right operand may not be evaluated
+			compileExpr(ctx, v.Inner[1])
+			ctx.restoreLift(old)
 			castToBoolExpr(ctx.cb)
 			ctx.cb.BinaryOp(op, goNode(v))
 		} else {
+			compileExpr(ctx, v.Inner[1])
 			binaryOp(ctx, op, v)
 		}
 		return
@@ -387,6 +503,12 @@ func compileSimpleAssignExpr(ctx *blockCtx, v *ast.Node) {
 }
 
 func compileAssignExpr(ctx *blockCtx, v *ast.Node) {
+	if ctx.canLift(v.Inner[0]) { // lhs = rhs; lhs
+		compileSimpleAssignExpr(ctx, v)
+		compileExpr(ctx, v.Inner[0])
+		return
+	}
+	defer ctx.restoreLift(ctx.setLift(false))
 	cb, _ := closureStartInitAddr(ctx, v)
 
 	addr := cb.Scope().Lookup(addrVarName)
@@ -400,16 +522,26 @@ func compileAssignExpr(ctx *blockCtx, v *ast.Node) {
 func compileSimpleAssignOpExpr(ctx *blockCtx, op token.Token, v *ast.Node) {
 	compileExprLHS(ctx, v.Inner[0])
 	compileExpr(ctx, v.Inner[1])
-	assignOp(ctx, op, goNode(v.Inner[1]))
+	if !ctx.flat || !flatAssignOp(ctx, op, v) {
+		assignOp(ctx, op, v)
+	}
 }
 
 func compileAssignOpExpr(ctx *blockCtx, op token.Token, v *ast.Node) {
+	if ctx.canLift(v.Inner[0]) { // lhs op= rhs; lhs
+		compileSimpleAssignOpExpr(ctx, op, v)
+		compileExpr(ctx, v.Inner[0])
+		return
+	}
+	defer ctx.restoreLift(ctx.setLift(false))
 	cb, _ := closureStartInitAddr(ctx, v)
 
 	addr := cb.Scope().Lookup(addrVarName)
 	cb.Val(addr).ElemRef()
 	compileExpr(ctx, v.Inner[1])
-	assignOp(ctx, op, goNode(v.Inner[1]))
+	if !ctx.flat || !flatAssignOp(ctx, op, v) {
+		assignOp(ctx, op, v)
+	}
 
 	cb.Val(addr).Elem().Return(1).End().Call(0)
 }
@@ -418,8 +550,24 @@ func compileSimpleIncDec(ctx *blockCtx, op token.Token, v *ast.Node) {
 	cb := ctx.cb
 	stk := cb.InternalStack()
 	compileExprLHS(ctx, v.Inner[0])
+	if elemSize := ctx.flatPtrElemSize(v.Inner[0]); elemSize > 0 { // ptr += sizeof(T)
+		cb.Val(elemSize).AssignOp(op + (token.ADD_ASSIGN - token.INC))
+		return
+	}
 	typ, _ := gox.DerefType(stk.Get(-1).Type)
 	if t, ok := typ.(*types.Pointer); ok { // *type
+		if arg := stk.Get(-1); ctx.usePtrAdd() && isSimpleRef(arg.Val) { // ptr = ptr+1
+			stk.Push(&gox.Element{Val: arg.Val, Type: t})
+			cb.Val(1)
+			ptrAdd(ctx, t, op+(token.ADD-token.INC), v)
+			cb.Assign(1)
+			return
+		}
+		if ctx.usePtrAdd() {
+			cb.Val(1)
+			ptrAddAssign(ctx, t, op+(token.ADD-token.INC), v)
+			return
+		}
 		cb.UnaryOp(token.AND)
 		castPtrType(cb, tyUintptrPtr, stk.Pop())
 		cb.ElemRef()
@@ -432,18 +580,34 @@ func compileSimpleIncDec(ctx *blockCtx, op token.Token, v *ast.Node) {
 }
 
 func compileIncDec(ctx *blockCtx, op token.Token, v *ast.Node) {
+	if ctx.canLift(v.Inner[0]) {
+		if v.IsPostfix { // tmp := x; x++; tmp
+			compileExpr(ctx, v.Inner[0])
+			ctx.liftTemp()
+			compileSimpleIncDec(ctx, op, v)
+		} else { // x++; x
+			compileSimpleIncDec(ctx, op, v)
+			compileExpr(ctx, v.Inner[0])
+		}
+		return
+	}
+	defer ctx.restoreLift(ctx.setLift(false))
 	cb, ret := closureStartInitAddr(ctx, v)
 	n := 0
 	addr := cb.Scope().Lookup(addrVarName)
 	if v.IsPostfix {
 		cb.VarRef(ret).Val(addr).Elem().Assign(1)
 	}
-	elemSize := valOfAddr(cb, addr, ctx)
-	cb.ElemRef()
-	if elemSize == 1 {
-		cb.IncDec(op)
+	if elemSize := ctx.flatPtrElemSize(v.Inner[0]); elemSize > 0 {
+		cb.Val(addr).ElemRef().Val(elemSize).AssignOp(op + (token.ADD_ASSIGN - token.INC))
+	} else if t, ok := addr.Type().(*types.Pointer).Elem().(*types.Pointer); ok && ctx.usePtrAdd() {
+		cb.Val(addr).ElemRef().Val(addr).Elem().Val(1)
+		ptrAdd(ctx, t, op+(token.ADD-token.INC), v)
+		cb.Assign(1)
+	} else if elemSize := valOfAddr(cb, addr, ctx); elemSize == 1 {
+		cb.ElemRef().IncDec(op)
 	} else {
-		cb.Val(elemSize).AssignOp(op + (token.ADD_ASSIGN - token.INC))
+		cb.ElemRef().Val(elemSize).AssignOp(op + (token.ADD_ASSIGN - token.INC))
 	}
 	if !v.IsPostfix {
 		cb.Val(addr).Elem()
@@ -474,7 +638,11 @@ func closureStartT(ctx *blockCtx, t types.Type) (*gox.CodeBuilder, *types.Var) {
 
 // -----------------------------------------------------------------------------
 
-func compileConditionalOperator(ctx *blockCtx, v *ast.Node) {
+func compileConditionalOperator(ctx *blockCtx, v *ast.Node, flags int) {
+	if ctx.lift.on {
+		liftConditionalOperator(ctx, v, flags)
+		return
+	}
 	t := toType(ctx, v.Type, 0)
 	cb, _ := closureStartT(ctx, t)
 	cb.If()
@@ -488,18 +656,124 @@ func compileConditionalOperator(ctx *blockCtx, v *ast.Node) {
 		End().Call(0) // end func
 }
 
+// liftConditionalOperator compiles `cond ? a : b` into:
+//
+//	var tmp T
+//	if cond {
+//	    tmp = a
+//	} else {
+//	    tmp = b
+//	}
+//
+// and pushes tmp (or omits tmp if the result is ignored).
+func liftConditionalOperator(ctx *blockCtx, v *ast.Node, flags int) {
+	var ret types.Object
+	if (flags & flagIgnoreResult) == 0 {
+		ret = ctx.newTempVar(toType(ctx, v.Type, 0))
+	}
+	cb := ctx.cb
+	compileExpr(ctx, v.Inner[0])
+	castToBoolExpr(cb)
+	cond := cb.InternalStack().Pop()
+	cb.If().Val(cond).Then()
+	liftBranch(ctx, ret, v.Inner[1])
+	cb.Else()
+	liftBranch(ctx, ret, v.Inner[2])
+	cb.End()
+	if ret != nil {
+		cb.Val(ret)
+	}
+}
+
+func liftBranch(ctx *blockCtx, ret types.Object, expr *ast.Node) {
+	defer ctx.restoreLift(ctx.setLift(true))
+	cb := ctx.cb
+	if ret == nil {
+		compileExprEx(ctx, expr, unknownExprPrompt, flagIgnoreResult)
+		cb.EndStmt()
+		return
+	}
+	cb.VarRef(ret)
+	compileExpr(ctx, expr)
+	assign(ctx, goNode(expr))
+}
+
+// isPureExpr checks if an expression has no side effects, so that it can be
+// evaluated more than once.
+func isPureExpr(v *ast.Node) bool {
+	switch v.Kind {
+	case ast.DeclRefExpr, ast.IntegerLiteral, ast.CharacterLiteral, ast.FloatingLiteral, ast.StringLiteral:
+		return true
+	case ast.MemberExpr, ast.ParenExpr, ast.ArraySubscriptExpr, ast.ImplicitCastExpr, ast.CStyleCastExpr:
+	case ast.UnaryOperator:
+		switch v.OpCode {
+		case "++", "--":
+			return false
+		}
+	case ast.BinaryOperator:
+		switch v.OpCode {
+		case "=", ",":
+			return false
+		}
+	default:
+		return false
+	}
+	for _, item := range v.Inner {
+		if !isPureExpr(item) {
+			return false
+		}
+	}
+	return true
+}
+
+// hasLiftable checks if an expression has side effects which can be lifted into
+// statements, such as i++ of `a[i++]`.
+func hasLiftable(v *ast.Node) bool {
+	switch v.Kind {
+	case ast.UnaryOperator:
+		switch v.OpCode {
+		case "++", "--":
+			return true
+		}
+	case ast.BinaryOperator:
+		switch v.OpCode {
+		case "=", ",":
+			return true
+		}
+	case ast.CompoundAssignOperator:
+		return true
+	}
+	for _, item := range v.Inner {
+		if hasLiftable(item) {
+			return true
+		}
+	}
+	return false
+}
+
 // -----------------------------------------------------------------------------
 
 func compileStarExpr(ctx *blockCtx, v *ast.Node, lhs bool) {
+	if ctx.flat && isArenaLvalue(ctx, v) {
+		compileArenaExpr(ctx, v, lhs)
+		return
+	}
 	cb := ctx.cb
 	compileExpr(ctx, v.Inner[0])
 	src := goNode(v)
+	if isFunc(cb.Get(-1).Type) { // *fn => fn
+		if lhs {
+			cb.ElemRef(src)
+		}
+		return
+	}
+	if ctx.checked {
+		checkDeref(ctx, v)
+	}
 	if lhs {
 		cb.ElemRef(src)
 	} else {
-		if !isFunc(cb.Get(-1).Type) { // *fn => fn
-			cb.Elem(src)
-		}
+		cb.Elem(src)
 	}
 }
 
@@ -513,6 +787,10 @@ func compileUnaryOperator(ctx *blockCtx, v *ast.Node, flags int) {
 		log.Panicln("compileUnaryOperator: not a lhs expression -", v.OpCode)
 	}
 	if op, ok := unaryOps[v.OpCode]; ok {
+		if op == token.AND && ctx.flat && !isFunc(toType(ctx, v.Inner[0].Type, 0)) {
+			compileAddr(ctx, v.Inner[0])
+			return
+		}
 		compileExpr(ctx, v.Inner[0])
 		unaryOp(ctx, op, v)
 		return
@@ -560,6 +838,8 @@ func compileAtomicExpr(ctx *blockCtx, v *ast.Node) {
 	cb.Call(len(v.Inner))
 	if fn, ok := getCaller(cb); ok {
 		ctx.extfns[fn] = none{}
+		ctx.builtins[fn] = none{}
+		ctx.use(fn, v)
 	}
 }
 
@@ -0,0 +1,614 @@
+package cl
+
+import (
+	goast "go/ast"
+	"go/token"
+	"go/types"
+	"log"
+	"strconv"
+
+	"github.com/goplus/c2go/clang/ast"
+	"github.com/goplus/gox"
+
+	ctypes "github.com/goplus/c2go/clang/types"
+)
+
+// -----------------------------------------------------------------------------
+// In flat memory mode (Config.FlatMemory) every C data pointer is an uintptr
+// address into the arena managed by package clang/mem. Variables whose address
+// is taken live in the arena too: locals in a per-call frame, globals in their
+// own blocks. All other variables stay ordinary Go variables.
+
+const (
+	memPkgPath = "github.com/goplus/c2go/clang/mem"
+	frameName  = "_cgo_fp"
+)
+
+var (
+	memLibcFns = map[string]string{
+		"malloc":  "Malloc",
+		"calloc":  "Calloc",
+		"realloc": "Realloc",
+		"free":    "Free",
+		"memcpy":  "Memcpy",
+		"memmove": "Memmove",
+		"memset":  "Memset",
+		"memcmp":  "Memcmp",
+		"strlen":  "Strlen",
+	}
+	memLoadFns = map[types.BasicKind]string{
+		types.Int8:    "LoadInt8",
+		types.Int16:   "LoadInt16",
+		types.Int32:   "LoadInt32",
+		types.Int64:   "LoadInt64",
+		types.Uint8:   "LoadUint8",
+		types.Uint16:  "LoadUint16",
+		types.Uint32:  "LoadUint32",
+		types.Uint64:  "LoadUint64",
+		types.Uintptr: "LoadUintptr",
+		types.Float32: "LoadFloat32",
+		types.Float64: "LoadFloat64",
+	}
+)
+
+func (p *blockCtx) memRef(name string) types.Object {
+	return p.pkg.Import(memPkgPath).Ref(name)
+}
+
+// flatType replaces data pointers in typ with uintptr.
+func (p *blockCtx) flatType(typ types.Type) types.Type {
+	switch t := typ.(type) {
+	case *types.Pointer:
+		if !p.isValistType(t) {
+			return tyUintptr
+		}
+	case *types.Basic:
+		if t.Kind() == types.UnsafePointer {
+			return tyUintptr
+		}
+	case *types.Array:
+		if elem := p.flatType(t.Elem()); elem != t.Elem() {
+			return types.NewArray(elem, t.Len())
+		}
+	case *types.Signature:
+		params, pchg := p.flatTuple(t.Params())
+		results, rchg := p.flatTuple(t.Results())
+		if pchg || rchg {
+			if gox.IsCSignature(t) {
+				return gox.NewCSignature(params, results, t.Variadic())
+			}
+			return types.NewSignature(nil, params, results, t.Variadic())
+		}
+	}
+	return typ
+}
+
+func (p *blockCtx) flatTuple(t *types.Tuple) (*types.Tuple, bool) {
+	n := t.Len()
+	vars := make([]*types.Var, n)
+	changed := false
+	for i := 0; i < n; i++ {
+		v := t.At(i)
+		if typ := p.flatType(v.Type()); typ != v.Type() {
+			v = types.NewParam(v.Pos(), v.Pkg(), v.Name(), typ)
+			changed = true
+		}
+		vars[i] = v
+	}
+	return types.NewTuple(vars...), changed
+}
+
+// ptrElem returns the (flattened) element type if typ is a C data pointer.
+func (p *blockCtx) ptrElem(typ *ast.Type) (types.Type, bool) {
+	p.flat = false
+	t := toType(p, typ, 0)
+	p.flat = true
+	switch t := t.(type) {
+	case *types.Pointer:
+		if !p.isValistType(t) {
+			return p.flatType(t.Elem()), true
+		}
+	case *types.Basic:
+		if t.Kind() == types.UnsafePointer { // void* is treated as char* (GNU C)
+			return types.Typ[types.Uint8], true
+		}
+	}
+	return nil, false
+}
+
+func (p *blockCtx) ptrElemSize(typ *ast.Type) int {
+	if elem, ok := p.ptrElem(typ); ok {
+		return p.sizeof(elem)
+	}
+	return 0
+}
+
+// flatPtrElemSize returns sizeof(T) if v is a T* in flat memory mode, or 0.
+func (p *blockCtx) flatPtrElemSize(v *ast.Node) int {
+	if p.flat {
+		return p.ptrElemSize(v.Type)
+	}
+	return 0
+}
+
+// -----------------------------------------------------------------------------
+
+// scanAddrs finds variables whose address is taken, either by & or by
+// array-to-pointer decay.
+func (p *blockCtx) scanAddrs(node *ast.Node) {
+	switch node.Kind {
+	case ast.UnaryOperator:
+		if node.OpCode == "&" {
+			p.markAddr(node.Inner[0])
+		}
+	case ast.ImplicitCastExpr:
+		if node.CastKind == ast.ArrayToPointerDecay {
+			p.markAddr(node.Inner[0])
+		}
+	case ast.VarDecl:
+		if prev := node.PreviousDecl; prev != "" {
+			p.firsts[node.ID] = p.firstDecl(prev)
+		}
+	}
+	for _, item := range node.Inner {
+		p.scanAddrs(item)
+	}
+	for _, item := range node.ArrayFiller {
+		p.scanAddrs(item)
+	}
+}
+
+func (p *blockCtx) markAddr(v *ast.Node) {
+	for {
+		switch v.Kind {
+		case ast.ParenExpr:
+			v = v.Inner[0]
+			continue
+		case ast.MemberExpr:
+			if !v.IsArrow {
+				v = v.Inner[0]
+				continue
+			}
+		case ast.DeclRefExpr:
+			if decl := v.ReferencedDecl; decl.Kind == ast.VarDecl || decl.Kind == ast.ParmVarDecl {
+				p.addrs[decl.ID] = none{}
+				p.gaddrs[p.firstDecl(decl.ID)] = none{}
+			}
+		}
+		return
+	}
+}
+
+// firstDecl returns the first declaration of the variable declared by id, which
+// is shared by all declarations of a global variable.
+func (p *blockCtx) firstDecl(id ast.ID) ast.ID {
+	if first, ok := p.firsts[id]; ok {
+		return first
+	}
+	return id
+}
+
+// needFrame checks if a function has local variables that live in the arena.
+func (p *blockCtx) needFrame(fn *ast.Node) bool {
+	switch fn.Kind {
+	case ast.VarDecl, ast.ParmVarDecl:
+		if _, ok := p.addrs[fn.ID]; ok {
+			return true
+		}
+	}
+	for _, item := range fn.Inner {
+		if p.needFrame(item) {
+			return true
+		}
+	}
+	return false
+}
+
+// -----------------------------------------------------------------------------
+
+// initFrame emits:
+//
+//	_cgo_fp := mem.Alloc(frameSize)
+//	defer mem.Free(_cgo_fp)
+//
+// and copies params whose address is taken into the frame.
+func initFrame(ctx *blockCtx, fn *ast.Node) {
+	f := ctx.curfn
+	cb := ctx.cb
+	f.flit = &goast.BasicLit{Kind: token.INT, Value: "0"}
+	f.arenas = make(map[ast.ID]int)
+	cb.DefineVarStart(token.NoPos, frameName).
+		Val(ctx.memRef("Alloc")).Val(f.flit).Call(1).EndInit(1)
+	f.fp = cb.Scope().Lookup(frameName)
+	cb.Val(ctx.memRef("Free")).Val(f.fp).Call(1).Defer()
+	for _, item := range fn.Inner {
+		if item.Kind != ast.ParmVarDecl {
+			continue
+		}
+		if _, ok := ctx.addrs[item.ID]; ok {
+			typ := toType(ctx, item.Type, 0)
+			param := cb.Scope().Lookup(item.Name)
+			ctx.newLocalArena(item.ID, typ)
+			memRefOf(ctx, typ)
+			cb.Val(param).Assign(1)
+		}
+	}
+}
+
+// endFrame sets the frame size when the function body is compiled.
+func endFrame(ctx *blockCtx) {
+	f := ctx.curfn
+	f.flit.Value = strconv.Itoa(f.fsize)
+}
+
+func (p *blockCtx) newLocalArena(id ast.ID, typ types.Type) {
+	f := p.curfn
+	off := (f.fsize + 7) &^ 7
+	f.arenas[id] = off
+	f.fsize = off + p.sizeof(typ)
+	p.cb.Val(f.fp)
+	if off != 0 {
+		p.cb.Val(off).BinaryOp(token.ADD)
+	}
+}
+
+// isArenaVar checks if a variable declaration lives in the arena.
+func (p *blockCtx) isArenaVar(decl *ast.Node, global bool) bool {
+	if !p.flat {
+		return false
+	}
+	if global {
+		_, ok := p.gaddrs[p.firstDecl(decl.ID)]
+		return ok
+	}
+	_, ok := p.addrs[decl.ID]
+	return ok
+}
+
+// newArenaVar declares a variable in the arena and initializes it:
+//
+//	var x = mem.Alloc(sizeof(T)) // global
+//	*(*T)(mem.Ptr(x)) = init     // in init() if x is a global
+func newArenaVar(ctx *blockCtx, scope *types.Scope, typ types.Type, decl *ast.Node, global bool) {
+	pkg, cb := ctx.pkg, ctx.cb
+	if global {
+		varDecl, _ := ctx.newVar(scope, goNodePos(decl), tyUintptr, decl.Name)
+		varDecl.InitStart(pkg).Val(ctx.memRef("Alloc")).Val(ctx.sizeof(typ)).Call(1).EndInit(1)
+		ctx.garenas[decl.Name] = none{}
+		if len(decl.Inner) == 0 {
+			return
+		}
+		pkg.NewFunc(nil, "init", nil, nil, false).BodyStart(pkg)
+		cb.Val(gox.Lookup(scope, decl.Name))
+	} else {
+		defer ctx.restoreLift(ctx.setLift(true))
+		ctx.newLocalArena(decl.ID, typ)
+	}
+	memRefOf(ctx, typ)
+	if len(decl.Inner) > 0 {
+		if _, ok := checkUnion(ctx, typ); ok {
+			log.Panicln("TODO: initUnionVar in flat memory")
+		}
+		varInit(ctx, typ, decl.Inner[0])
+	} else {
+		cb.ZeroLit(typ)
+	}
+	cb.Assign(1)
+	if global {
+		cb.End()
+	}
+}
+
+// arenaAddr pushes the address of variable v if it lives in the arena.
+func (p *blockCtx) arenaAddr(v *ast.Node) bool {
+	decl := v.ReferencedDecl
+	if f := p.curfn; f != nil && f.arenas != nil {
+		if off, ok := f.arenas[decl.ID]; ok {
+			p.cb.Val(f.fp)
+			if off != 0 {
+				p.cb.Val(off).BinaryOp(token.ADD)
+			}
+			return true
+		}
+	}
+	if _, ok := p.garenas[p.ident(decl.Name)]; ok {
+		name := p.ident(decl.Name)
+		if obj := p.lookupParent(name); obj != nil && obj.Parent() == p.pkg.Types.Scope() {
+			p.cb.Val(obj)
+			return true
+		}
+	}
+	return false
+}
+
+// -----------------------------------------------------------------------------
+
+// isArenaLvalue checks if an lvalue expression designates arena memory.
+func isArenaLvalue(ctx *blockCtx, v *ast.Node) bool {
+	switch v.Kind {
+	case ast.ParenExpr:
+		return isArenaLvalue(ctx, v.Inner[0])
+	case ast.DeclRefExpr:
+		if decl := v.ReferencedDecl; decl.Kind == ast.VarDecl || decl.Kind == ast.ParmVarDecl {
+			if f := ctx.curfn; f != nil && f.arenas != nil {
+				if _, ok := f.arenas[decl.ID]; ok {
+					return true
+				}
+			}
+			_, ok := ctx.garenas[ctx.ident(decl.Name)]
+			return ok && !isLocalVar(ctx, decl)
+		}
+	case ast.MemberExpr:
+		return v.IsArrow || isArenaLvalue(ctx, v.Inner[0])
+	case ast.ArraySubscriptExpr:
+		return true
+	case ast.UnaryOperator:
+		return v.OpCode == "*" && !isFunc(toType(ctx, v.Type, 0))
+	}
+	return false
+}
+
+func isLocalVar(ctx *blockCtx, decl *ast.Node) bool {
+	obj := ctx.lookupParent(ctx.ident(decl.Name))
+	return obj != nil && obj.Parent() != ctx.pkg.Types.Scope()
+}
+
+// compileAddr pushes the address of an lvalue expression in the arena.
+func compileAddr(ctx *blockCtx, v *ast.Node) {
+	cb := ctx.cb
+	switch v.Kind {
+	case ast.ParenExpr:
+		compileAddr(ctx, v.Inner[0])
+	case ast.DeclRefExpr:
+		if !ctx.arenaAddr(v) {
+			log.Panicln("compileAddr: variable not in arena -", v.ReferencedDecl.Name)
+		}
+	case ast.MemberExpr:
+		var t types.Type
+		if v.IsArrow {
+			compileExpr(ctx, v.Inner[0])
+			t, _ = ctx.ptrElem(v.Inner[0].Type)
+		} else {
+			compileAddr(ctx, v.Inner[0])
+			t = toType(ctx, v.Inner[0].Type, 0)
+		}
+		var off int
+		if v.Name == "" { // anonymous
+			off = ctx.embeddedOffset(t, toType(ctx, v.Type, 0))
+		} else {
+			v.Name = ctx.ident(v.Name)
+			off = ctx.fieldOffset(t, v.Name)
+		}
+		if off != 0 {
+			cb.Val(off).BinaryOp(token.ADD)
+		}
+	case ast.ArraySubscriptExpr:
+		compileExpr(ctx, v.Inner[0])
+		compileExpr(ctx, v.Inner[1])
+		flatPtrArith(ctx, token.ADD, v.Inner[0].Type, v.Inner[1].Type)
+	case ast.UnaryOperator:
+		if v.OpCode != "*" {
+			log.Panicln("compileAddr: not a lvalue -", v.OpCode)
+		}
+		compileExpr(ctx, v.Inner[0])
+	case ast.StringLiteral:
+		s, err := strconv.Unquote(v.Value.(string))
+		if err != nil {
+			log.Panicln("compileAddr:", err)
+		}
+		cb.Val(ctx.memRef("Str")).Val(s).Call(1)
+	default:
+		log.Panicln("compileAddr: unknown kind =", v.Kind)
+	}
+}
+
+// memRefOf converts the address on the top of stack into a reference:
+//
+//	*(*T)(mem.Ptr(addr))
+func memRefOf(ctx *blockCtx, typ types.Type) {
+	cb := ctx.cb
+	addr := cb.InternalStack().Pop()
+	cb.Typ(types.NewPointer(typ)).Val(ctx.memRef("Ptr")).Val(addr).Call(1).Call(1).ElemRef()
+}
+
+// memValOf loads the value at the address on the top of stack.
+func memValOf(ctx *blockCtx, typ types.Type) {
+	cb := ctx.cb
+	addr := cb.InternalStack().Pop()
+	if t, ok := typ.(*types.Basic); ok {
+		if fn, ok := memLoadFns[t.Kind()]; ok {
+			cb.Val(ctx.memRef(fn)).Val(addr).Call(1)
+			return
+		}
+	}
+	cb.Typ(types.NewPointer(typ)).Val(ctx.memRef("Ptr")).Val(addr).Call(1).Call(1).Elem()
+}
+
+// compileArenaExpr compiles an lvalue expression which designates arena memory.
+func compileArenaExpr(ctx *blockCtx, v *ast.Node, lhs bool) {
+	typ := toType(ctx, v.Type, 0)
+	if v.Kind == ast.MemberExpr && v.Name != "" { // use gox to access bit fields and union fields
+		var t types.Type
+		if v.IsArrow {
+			compileExpr(ctx, v.Inner[0])
+			t, _ = ctx.ptrElem(v.Inner[0].Type)
+		} else {
+			compileAddr(ctx, v.Inner[0])
+			t = toType(ctx, v.Inner[0].Type, 0)
+		}
+		cb := ctx.cb
+		addr := cb.InternalStack().Pop()
+		cb.Typ(types.NewPointer(t)).Val(ctx.memRef("Ptr")).Val(addr).Call(1).Call(1)
+		v.Name = ctx.ident(v.Name)
+		if lhs {
+			cb.MemberRef(v.Name, goNode(v))
+		} else {
+			cb.MemberVal(v.Name, goNode(v))
+		}
+		return
+	}
+	compileAddr(ctx, v)
+	if lhs {
+		memRefOf(ctx, typ)
+	} else {
+		memValOf(ctx, typ)
+	}
+}
+
+// compileArrayDecay compiles an array expression which decays to a pointer.
+func compileArrayDecay(ctx *blockCtx, v *ast.Node) {
+	if v.Kind == ast.StringLiteral || isArenaLvalue(ctx, v) {
+		compileAddr(ctx, v)
+		return
+	}
+	compileExpr(ctx, v)
+	if !isEllipsis(ctx, ctx.cb) {
+		log.Panicln("compileArrayDecay: array not in arena")
+	}
+}
+
+// -----------------------------------------------------------------------------
+
+// flatPtrArith: ptr, n => ptr +/- uintptr(n)*sizeof(T)
+func flatPtrArith(ctx *blockCtx, op token.Token, t1, t2 *ast.Type) {
+	cb := ctx.cb
+	stk := cb.InternalStack()
+	elemSize := ctx.ptrElemSize(t1)
+	if elemSize == 0 { // n+ptr
+		elemSize = ctx.ptrElemSize(t2)
+		args := stk.GetArgs(2)
+		*args[0], *args[1] = *args[1], *args[0]
+	}
+	n := stk.Pop()
+	scaleIndex(ctx, n, elemSize, &op)
+	cb.BinaryOp(op)
+}
+
+// scaleIndex pushes uintptr(n)*elemSize.
+func scaleIndex(ctx *blockCtx, n *gox.Element, elemSize int, op *token.Token) {
+	cb := ctx.cb
+	if isNegConst(n) {
+		cb.InternalStack().Push(n)
+		cb.UnaryOp(token.SUB)
+		n = cb.InternalStack().Pop()
+		*op = (token.SUB + token.ADD) - *op
+	}
+	if v, ok := gox.CastFromBool(cb, tyUintptr, n); ok {
+		n = v
+	}
+	if n.CVal == nil && n.Type != tyUintptr {
+		cb.Typ(tyUintptr).Val(n).Call(1)
+	} else {
+		cb.InternalStack().Push(n)
+	}
+	if elemSize != 1 {
+		cb.Val(elemSize).BinaryOp(token.MUL)
+	}
+}
+
+// flatBinaryOp compiles ptr+n, n+ptr, ptr-n and ptr-ptr.
+func flatBinaryOp(ctx *blockCtx, op token.Token, v *ast.Node) bool {
+	if op != token.ADD && op != token.SUB {
+		return false
+	}
+	t1, t2 := v.Inner[0].Type, v.Inner[1].Type
+	elem1, ok1 := ctx.ptrElem(t1)
+	_, ok2 := ctx.ptrElem(t2)
+	if !ok1 && !ok2 {
+		return false
+	}
+	cb := ctx.cb
+	compileExpr(ctx, v.Inner[0])
+	compileExpr(ctx, v.Inner[1])
+	if ok1 && ok2 { // ptr-ptr => int64(a-b)/sizeof(T)
+		cb.BinaryOp(token.SUB, goNode(v))
+		x := cb.InternalStack().Pop()
+		cb.Typ(toType(ctx, v.Type, 0)).Val(x).Call(1)
+		if elemSize := ctx.sizeof(elem1); elemSize != 1 {
+			cb.Val(elemSize).BinaryOp(token.QUO)
+		}
+		return true
+	}
+	flatPtrArith(ctx, op, t1, t2)
+	return true
+}
+
+// flatAssignOp compiles ptr += n and ptr -= n.
+func flatAssignOp(ctx *blockCtx, op token.Token, v *ast.Node) bool {
+	if op != token.ADD_ASSIGN && op != token.SUB_ASSIGN {
+		return false
+	}
+	elemSize := ctx.ptrElemSize(v.Inner[0].Type)
+	if elemSize == 0 {
+		return false
+	}
+	cb := ctx.cb
+	n := cb.InternalStack().Pop()
+	scaleIndex(ctx, n, elemSize, &op)
+	cb.AssignOp(op, goNode(v.Inner[1]))
+	return true
+}
+
+// -----------------------------------------------------------------------------
+
+func (p *blockCtx) fieldOffset(typ types.Type, name string) int {
+	if off, ok := p.findFieldOffset(typ, name); ok {
+		return off
+	}
+	log.Panicf("fieldOffset(%v, %v): field not found", typ, name)
+	return -1
+}
+
+func (p *blockCtx) findFieldOffset(typ types.Type, name string) (int, bool) {
+	t, ok := typ.(*types.Named)
+	if !ok {
+		return 0, false
+	}
+	if ufs, ok := checkUnion(p, t); ok {
+		for i, n := 0, ufs.Len(); i < n; i++ {
+			if fld := ufs.At(i); fld.Name == name {
+				return fld.Off, true
+			}
+		}
+		return 0, false
+	}
+	struc := t.Underlying().(*types.Struct)
+	var flds []*types.Var
+	for i, n := 0, struc.NumFields(); i < n; i++ {
+		flds = append(flds, struc.Field(i))
+	}
+	offs := p.pkg.Offsetsof(flds)
+	for i, fld := range flds {
+		if fld.Name() == name {
+			return int(offs[i]), true
+		}
+		if fld.Embedded() {
+			if off, ok := p.findFieldOffset(fld.Type(), name); ok {
+				return int(offs[i]) + off, true
+			}
+		}
+	}
+	return 0, false
+}
+
+func (p *blockCtx) embeddedOffset(typ, fldType types.Type) int {
+	if t, ok := typ.(*types.Named); ok {
+		if struc, ok := t.Underlying().(*types.Struct); ok {
+			var flds []*types.Var
+			for i, n := 0, struc.NumFields(); i < n; i++ {
+				flds = append(flds, struc.Field(i))
+			}
+			offs := p.pkg.Offsetsof(flds)
+			for i, fld := range flds {
+				if fld.Embedded() && ctypes.Identical(fld.Type(), fldType) {
+					return int(offs[i])
+				}
+			}
+		}
+		return 0 // union
+	}
+	log.Panicln("embeddedOffset: not a struct -", typ)
+	return -1
+}
+
+// -----------------------------------------------------------------------------
@@ -0,0 +1,232 @@
+package cl
+
+import (
+	"go/types"
+	"strconv"
+	"strings"
+
+	"github.com/goplus/c2go/clang/ast"
+)
+
+// -----------------------------------------------------------------------------
+// Arguments of variadic functions are passed as []interface{}, so Go doesn't
+// check them against format strings. Calls of functions with format(printf,
+// ...) attributes (see funcAttrs) and literal format strings are checked at
+// translation time instead: the Go type of each argument must be of the kind
+// and size which its conversion expects, and positional conversions such as
+// %2$d check the arguments which they refer to. Signedness isn't checked, as
+// clang doesn't by default. Mismatches are reported by PkgInfo.Diagnostics.
+
+// convSpec is a conversion specification of a format string, such as %-8ld.
+type convSpec struct {
+	text  string // such as %-8ld
+	size  string // length modifier, such as l
+	verb  byte
+	width bool // width is *
+	prec  bool // precision is *
+
+	// positions of the arguments of POSIX positional conversions, such as 2
+	// of %2$d or %1$*2$d, or 0 if the arguments are the next ones
+	arg, widthArg, precArg int
+}
+
+// parseFormat returns the conversion specifications of the printf format
+// string f, which take arguments.
+func parseFormat(f string) (specs []*convSpec) {
+	for i := 0; i < len(f); {
+		if f[i] != '%' {
+			i++
+			continue
+		}
+		start := i
+		spec := new(convSpec)
+		argPos := func() int { // such as 2 of 2$
+			j := i
+			for ; j < len(f) && f[j] >= '0' && f[j] <= '9'; j++ {
+			}
+			if j > i && j < len(f) && f[j] == '$' {
+				pos, _ := strconv.Atoi(f[i:j])
+				i = j + 1
+				return pos
+			}
+			return 0
+		}
+		i++
+		spec.arg = argPos()
+		for ; i < len(f) && strings.IndexByte("-+ #0'", f[i]) >= 0; i++ {
+		}
+		if i < len(f) && f[i] == '*' {
+			spec.width = true
+			i++
+			spec.widthArg = argPos()
+		}
+		for ; i < len(f) && f[i] >= '0' && f[i] <= '9'; i++ {
+		}
+		if i < len(f) && f[i] == '.' {
+			if i++; i < len(f) && f[i] == '*' {
+				spec.prec = true
+				i++
+				spec.precArg = argPos()
+			}
+			for ; i < len(f) && f[i] >= '0' && f[i] <= '9'; i++ {
+			}
+		}
+		sizeStart := i
+		for ; i < len(f) && strings.IndexByte("hlLjztq", f[i]) >= 0; i++ {
+		}
+		spec.size = f[sizeStart:i]
+		if i >= len(f) { // incomplete conversion at the end
+			spec.text = f[start:]
+			specs = append(specs, spec)
+			break
+		}
+		spec.verb = f[i]
+		i++
+		spec.text = f[start:i]
+		if spec.verb != '%' {
+			specs = append(specs, spec)
+		}
+	}
+	return
+}
+
+// argSize returns the size of the argument of an integer conversion with the
+// length modifier size. Arguments of hh and h are promoted to int.
+func argSize(size string) int {
+	switch size {
+	case "", "hh", "h":
+		return 4
+	}
+	return 8
+}
+
+// checkFormat checks the arguments of the call v, whose arguments are on the
+// stack of the code builder, against its format string.
+func checkFormat(ctx *blockCtx, v *ast.Node) {
+	decl := calleeDecl(v)
+	if decl == nil {
+		return
+	}
+	a, ok := ctx.fnattrs[decl.Name]
+	if !ok || a.format == nil || a.format.archetype != "printf" || a.format.firstArg == 0 {
+		return
+	}
+	n := len(v.Inner)
+	fmtIdx, argIdx := a.format.fmtIdx, a.format.firstArg
+	if fmtIdx >= n || argIdx > n {
+		return
+	}
+	lit := unparen(v.Inner[fmtIdx])
+	if lit.Kind != ast.StringLiteral {
+		return
+	}
+	f, ok := unquoteC(lit.Value.(string))
+	if !ok {
+		return
+	}
+	cb := ctx.cb
+	end := argIdx // end of the arguments converted
+	arg := func(spec *convSpec, pos int) (types.Type, *ast.Node) {
+		i := argIdx
+		if pos > 0 {
+			i = a.format.firstArg + pos - 1
+		} else {
+			argIdx++
+		}
+		if i >= n {
+			ctx.warn(lit, "missing argument for "+spec.text)
+			return nil, nil
+		}
+		if i >= end {
+			end = i + 1
+		}
+		return cb.Get(-n + i).Type, v.Inner[i]
+	}
+	for _, spec := range parseFormat(f) {
+		if spec.verb == 0 {
+			ctx.warn(lit, "incomplete conversion "+spec.text)
+			return
+		}
+		star := func(pos int) {
+			if t, node := arg(spec, pos); t != nil && !isIntOfSize(ctx, t, 4) {
+				ctx.warn(node, spec.text+" expects an int field width or precision, got "+t.String())
+			}
+		}
+		if spec.width {
+			star(spec.widthArg)
+		}
+		if spec.prec {
+			star(spec.precArg)
+		}
+		switch spec.verb {
+		case 'd', 'i', 'u', 'o', 'x', 'X':
+			size := argSize(spec.size)
+			if t, node := arg(spec, spec.arg); t != nil && !isIntOfSize(ctx, t, size) {
+				ctx.warn(node, spec.text+" expects a "+strconv.Itoa(size*8)+"-bit integer, got "+t.String())
+			}
+		case 'c':
+			if t, node := arg(spec, spec.arg); t != nil && !isIntOfSize(ctx, t, 4) && !isIntOfSize(ctx, t, 1) {
+				ctx.warn(node, spec.text+" expects a character, got "+t.String())
+			}
+		case 'f', 'F', 'e', 'E', 'g', 'G', 'a', 'A':
+			if t, node := arg(spec, spec.arg); t != nil && !isFloat(t) {
+				ctx.warn(node, spec.text+" expects a floating-point number, got "+t.String())
+			}
+		case 's':
+			size := 1
+			if spec.size == "l" { // wchar_t *
+				size = 4
+			}
+			if t, node := arg(spec, spec.arg); t != nil && !isPtrTo(ctx, t, size) && t != types.Typ[types.UnsafePointer] {
+				ctx.warn(node, spec.text+" expects a C string, got "+t.String())
+			}
+		case 'p':
+			if t, node := arg(spec, spec.arg); t != nil && !isPointer(t) {
+				ctx.warn(node, spec.text+" expects a pointer, got "+t.String())
+			}
+		case 'n':
+			if t, node := arg(spec, spec.arg); t != nil && !isPtrTo(ctx, t, argSize(spec.size)) {
+				ctx.warn(node, spec.text+" expects a pointer to an integer, got "+t.String())
+			}
+		case 'm': // glibc: strerror(errno)
+		default:
+			ctx.warn(lit, "unknown conversion "+spec.text)
+			return
+		}
+	}
+	if end < n {
+		ctx.warn(v.Inner[end], "extra arguments for format "+strconv.Quote(f))
+	}
+}
+
+func isIntOfSize(ctx *blockCtx, t types.Type, size int) bool {
+	if b, ok := t.Underlying().(*types.Basic); ok && b.Info()&types.IsInteger != 0 {
+		return ctx.sizeof(b) == size
+	}
+	return false
+}
+
+func isFloat(t types.Type) bool {
+	b, ok := t.Underlying().(*types.Basic)
+	return ok && b.Info()&types.IsFloat != 0
+}
+
+func isPointer(t types.Type) bool {
+	switch t := t.Underlying().(type) {
+	case *types.Pointer, *types.Signature:
+		return true
+	case *types.Basic:
+		return t.Kind() == types.UnsafePointer
+	}
+	return false
+}
+
+// isPtrTo reports whether t is a pointer to an integer of size bytes.
+func isPtrTo(ctx *blockCtx, t types.Type, size int) bool {
+	if p, ok := t.Underlying().(*types.Pointer); ok {
+		return isIntOfSize(ctx, p.Elem(), size)
+	}
+	return false
+}
+
+// -----------------------------------------------------------------------------
@@ -0,0 +1,57 @@
+package cl
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// -----------------------------------------------------------------------------
+
+func TestFormatCheck(t *testing.T) {
+	doc, src := parseWith(`
+int printf(const char *fmt, ...) __attribute__((format(printf, 1, 2)));
+int vprintf(const char *fmt, __builtin_va_list ap) __attribute__((format(printf, 1, 0)));
+
+void test(int n, long l, double d, char *s, void *p, __builtin_va_list ap) {
+	printf("%d %ld %5.2f %s %p %c %%\n", n, l, d, s, p, 'x');
+	printf("%*d %hhd %zu\n", n, n, (char)n, sizeof(n));
+	printf("%d %s\n", l, n);
+	printf("%lld %f\n", n, n);
+	printf("%d %d\n", n);
+	printf("%d\n", n, n);
+	printf("%y\n", n);
+	vprintf("%d\n", ap);
+	printf("%2$s %1$d\n", n, s);
+	printf("%1$*2$d\?\n", n, n);
+	printf("\?%1$s %2$ld\n", n, n);
+	printf("%3$d\n", n);
+}
+`, 0, nil)
+	pkg, err := NewPackage("", "main", doc, &Config{Src: src})
+	if err != nil {
+		t.Fatal("NewPackage:", err)
+	}
+	expected := []string{
+		"test.c:8:20: %d expects a 32-bit integer, got int64",
+		"test.c:8:23: %s expects a C string, got int32",
+		"test.c:9:22: %lld expects a 64-bit integer, got int32",
+		"test.c:9:25: %f expects a floating-point number, got int32",
+		"test.c:10:9: missing argument for %d",
+		"test.c:11:20: extra arguments for format \"%d\\n\"",
+		"test.c:12:9: unknown conversion %y",
+		"test.c:16:27: %1$s expects a C string, got int32",
+		"test.c:16:30: %2$ld expects a 64-bit integer, got int32",
+		"test.c:17:9: missing argument for %3$d",
+		"test.c:17:19: extra arguments for format \"%3$d\\n\"",
+	}
+	var diags []string
+	for _, diag := range pkg.Diagnostics {
+		diags = append(diags, tmpFileRE.ReplaceAllString(diag, "test.c:"))
+	}
+	if !reflect.DeepEqual(diags, expected) {
+		t.Fatalf("Diagnostics:\n%s\n", strings.Join(diags, "\n"))
+	}
+}
+
+// -----------------------------------------------------------------------------
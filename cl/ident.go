@@ -0,0 +1,95 @@
+package cl
+
+import (
+	"go/token"
+	"go/types"
+	"strings"
+
+	"github.com/goplus/c2go/clang/ast"
+)
+
+// -----------------------------------------------------------------------------
+// C identifiers which can't be Go identifiers of the same meaning are renamed:
+// Go keywords, predeclared identifiers (such as string, len, nil and error),
+// init, the blank identifier, names of packages which generated code imports,
+// and names reserved for generated helpers (such as _cgo_ret, _cgo_addr and
+// __cgo_args). Underscores are appended to a renamed identifier until it is
+// neither reserved nor an identifier of the translation unit, and a C name is
+// renamed the same way wherever it is declared or referenced, so that
+// functions, variables, parameters, fields, typedefs, enum constants and
+// labels all agree.
+
+var importedNames = map[string]none{
+	"unsafe": {}, "clang": {}, "libc": {}, "mem": {}, "checked": {},
+}
+
+func isReservedIdent(name string) bool {
+	if name == "_" || name == "init" || token.IsKeyword(name) || types.Universe.Lookup(name) != nil {
+		return true
+	}
+	if _, ok := importedNames[name]; ok {
+		return true
+	}
+	return strings.HasPrefix(name, "_cgo") || strings.HasPrefix(name, "__cgo") || strings.HasPrefix(name, "_autoGo_")
+}
+
+// initIdents collects identifiers of the translation unit.
+func (p *blockCtx) initIdents(file *ast.Node) {
+	p.cidents = make(map[string]none)
+	p.idents = make(map[string]string)
+	p.typedefs = make(map[string]none)
+	var collect func(node *ast.Node)
+	collect = func(node *ast.Node) {
+		if node.Name != "" {
+			p.cidents[node.Name] = none{}
+		}
+		for _, item := range node.Inner {
+			collect(item)
+		}
+	}
+	collect(file)
+}
+
+// ident returns the Go identifier of a C identifier. It is idempotent.
+func (p *blockCtx) ident(name string) string {
+	if !isReservedIdent(name) {
+		return name
+	}
+	if goName, ok := p.idents[name]; ok {
+		return goName
+	}
+	goName := name + "_"
+	if strings.HasPrefix(name, "_") && name != "_" { // reserved prefixes
+		goName = "c" + name
+	}
+	for p.isTaken(goName) {
+		goName += "_"
+	}
+	p.idents[name] = goName
+	return goName
+}
+
+func (p *blockCtx) isTaken(name string) bool {
+	_, ok := p.cidents[name]
+	return ok || isReservedIdent(name)
+}
+
+// typedefIdent returns the Go identifier of a typedef name.
+func (p *blockCtx) typedefIdent(name string) string {
+	if goName := p.ident(name); goName != name {
+		p.typedefs[name] = none{}
+		return goName
+	}
+	return name
+}
+
+// typeIdent returns the Go identifier of a C type name, which is renamed only
+// if it is declared by a typedef.
+func (p *blockCtx) typeIdent(name string) string {
+	if _, ok := p.typedefs[name]; ok {
+		return p.ident(name)
+	}
+	return name
+}
+
+// -----------------------------------------------------------------------------
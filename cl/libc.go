@@ -0,0 +1,501 @@
+package cl
+
+import (
+	"go/types"
+
+	"github.com/goplus/c2go/clang/ast"
+
+	ctypes "github.com/goplus/c2go/clang/types"
+)
+
+// -----------------------------------------------------------------------------
+// Calls to C library functions are bound to Go implementations: package
+// clang/libc, or the allocators of clang/mem and clang/checked in flat memory
+// and checked pointers modes. A function is bound only if the translation
+// unit doesn't define it and its prototype matches the Go implementation.
+// Library variables (such as stdout) are bound the same way, and FILE is
+// mapped to libc.FILE.
+
+const (
+	libcPkgPath = "github.com/goplus/c2go/clang/libc"
+)
+
+var (
+	libcFns = map[string]string{
+		"printf":                      "Printf",
+		"sprintf":                     "Sprintf",
+		"snprintf":                    "Snprintf",
+		"vprintf":                     "Printf",
+		"vsprintf":                    "Sprintf",
+		"vsnprintf":                   "Snprintf",
+		"fprintf":                     "Fprintf",
+		"vfprintf":                    "Fprintf",
+		"puts":                        "Puts",
+		"putchar":                     "Putchar",
+		"fopen":                       "Fopen",
+		"fdopen":                      "Fdopen",
+		"fclose":                      "Fclose",
+		"fflush":                      "Fflush",
+		"setvbuf":                     "Setvbuf",
+		"fread":                       "Fread",
+		"fwrite":                      "Fwrite",
+		"fseek":                       "Fseek",
+		"fseeko":                      "Fseek",
+		"ftell":                       "Ftell",
+		"ftello":                      "Ftell",
+		"rewind":                      "Rewind",
+		"fgetc":                       "Fgetc",
+		"getc":                        "Fgetc",
+		"getchar":                     "Getchar",
+		"ungetc":                      "Ungetc",
+		"fgets":                       "Fgets",
+		"fputc":                       "Fputc",
+		"putc":                        "Fputc",
+		"fputs":                       "Fputs",
+		"feof":                        "Feof",
+		"ferror":                      "Ferror",
+		"clearerr":                    "Clearerr",
+		"fileno":                      "Fileno",
+		"remove":                      "Remove",
+		"rename":                      "Rename",
+		"perror":                      "Perror",
+		"stdin":                       "Stdin",
+		"stdout":                      "Stdout",
+		"stderr":                      "Stderr",
+		"__stdinp":                    "Stdin",
+		"__stdoutp":                   "Stdout",
+		"__stderrp":                   "Stderr",
+		"strlen":                      "Strlen",
+		"strcmp":                      "Strcmp",
+		"strncmp":                     "Strncmp",
+		"strcpy":                      "Strcpy",
+		"strncpy":                     "Strncpy",
+		"strcat":                      "Strcat",
+		"strchr":                      "Strchr",
+		"strrchr":                     "Strrchr",
+		"strstr":                      "Strstr",
+		"strdup":                      "Strdup",
+		"memcpy":                      "Memcpy",
+		"memmove":                     "Memmove",
+		"memset":                      "Memset",
+		"memcmp":                      "Memcmp",
+		"memchr":                      "Memchr",
+		"malloc":                      "Malloc",
+		"calloc":                      "Calloc",
+		"realloc":                     "Realloc",
+		"free":                        "Free",
+		"qsort":                       "Qsort",
+		"bsearch":                     "Bsearch",
+		"atoi":                        "Atoi",
+		"atol":                        "Atol",
+		"atoll":                       "Atoll",
+		"atof":                        "Atof",
+		"strtol":                      "Strtol",
+		"strtoul":                     "Strtoul",
+		"strtoll":                     "Strtoll",
+		"strtoull":                    "Strtoull",
+		"strtod":                      "Strtod",
+		"strtof":                      "Strtof",
+		"strtold":                     "Strtold",
+		"exit":                        "Exit",
+		"atexit":                      "Atexit",
+		"strerror":                    "Strerror",
+		"__errno_location":            "ErrnoLocation",
+		"__error":                     "ErrnoLocation",
+		"open":                        "Open",
+		"close":                       "Close",
+		"read":                        "Read",
+		"write":                       "Write",
+		"pread":                       "Pread",
+		"pwrite":                      "Pwrite",
+		"lseek":                       "Lseek",
+		"fsync":                       "Fsync",
+		"fdatasync":                   "Fsync",
+		"ftruncate":                   "Ftruncate",
+		"fstat":                       "Fstat",
+		"stat":                        "Stat",
+		"lstat":                       "Lstat",
+		"fcntl":                       "Fcntl",
+		"unlink":                      "Unlink",
+		"access":                      "Access",
+		"getpid":                      "Getpid",
+		"pthread_create":              "PthreadCreate",
+		"pthread_join":                "PthreadJoin",
+		"pthread_detach":              "PthreadDetach",
+		"pthread_exit":                "PthreadExit",
+		"pthread_self":                "PthreadSelf",
+		"pthread_equal":               "PthreadEqual",
+		"sched_yield":                 "SchedYield",
+		"pthread_attr_init":           "PthreadAttrInit",
+		"pthread_attr_destroy":        "PthreadAttrDestroy",
+		"pthread_attr_setdetachstate": "PthreadAttrSetdetachstate",
+		"pthread_attr_getdetachstate": "PthreadAttrGetdetachstate",
+		"pthread_attr_setstacksize":   "PthreadAttrSetstacksize",
+		"pthread_mutex_init":          "PthreadMutexInit",
+		"pthread_mutex_destroy":       "PthreadMutexDestroy",
+		"pthread_mutex_lock":          "PthreadMutexLock",
+		"pthread_mutex_trylock":       "PthreadMutexTrylock",
+		"pthread_mutex_timedlock":     "PthreadMutexTimedlock",
+		"pthread_mutex_unlock":        "PthreadMutexUnlock",
+		"pthread_mutexattr_init":      "PthreadMutexattrInit",
+		"pthread_mutexattr_destroy":   "PthreadMutexattrDestroy",
+		"pthread_mutexattr_settype":   "PthreadMutexattrSettype",
+		"pthread_mutexattr_gettype":   "PthreadMutexattrGettype",
+		"pthread_cond_init":           "PthreadCondInit",
+		"pthread_cond_destroy":        "PthreadCondDestroy",
+		"pthread_cond_wait":           "PthreadCondWait",
+		"pthread_cond_timedwait":      "PthreadCondTimedwait",
+		"pthread_cond_signal":         "PthreadCondSignal",
+		"pthread_cond_broadcast":      "PthreadCondBroadcast",
+		"pthread_rwlock_init":         "PthreadRwlockInit",
+		"pthread_rwlock_destroy":      "PthreadRwlockDestroy",
+		"pthread_rwlock_rdlock":       "PthreadRwlockRdlock",
+		"pthread_rwlock_tryrdlock":    "PthreadRwlockTryrdlock",
+		"pthread_rwlock_wrlock":       "PthreadRwlockWrlock",
+		"pthread_rwlock_trywrlock":    "PthreadRwlockTrywrlock",
+		"pthread_rwlock_unlock":       "PthreadRwlockUnlock",
+		"pthread_once":                "PthreadOnce",
+		"pthread_key_create":          "PthreadKeyCreate",
+		"pthread_key_delete":          "PthreadKeyDelete",
+		"pthread_getspecific":         "PthreadGetspecific",
+		"pthread_setspecific":         "PthreadSetspecific",
+		"thrd_create":                 "ThrdCreate",
+		"thrd_join":                   "ThrdJoin",
+		"thrd_detach":                 "ThrdDetach",
+		"thrd_exit":                   "ThrdExit",
+		"thrd_current":                "ThrdCurrent",
+		"thrd_equal":                  "ThrdEqual",
+		"thrd_yield":                  "ThrdYield",
+		"thrd_sleep":                  "ThrdSleep",
+		"mtx_init":                    "MtxInit",
+		"mtx_destroy":                 "MtxDestroy",
+		"mtx_lock":                    "MtxLock",
+		"mtx_trylock":                 "MtxTrylock",
+		"mtx_timedlock":               "MtxTimedlock",
+		"mtx_unlock":                  "MtxUnlock",
+		"cnd_init":                    "CndInit",
+		"cnd_destroy":                 "CndDestroy",
+		"cnd_wait":                    "CndWait",
+		"cnd_timedwait":               "CndTimedwait",
+		"cnd_signal":                  "CndSignal",
+		"cnd_broadcast":               "CndBroadcast",
+		"call_once":                   "CallOnce",
+		"tss_create":                  "TssCreate",
+		"tss_delete":                  "TssDelete",
+		"tss_get":                     "TssGet",
+		"tss_set":                     "TssSet",
+		"sin":                         "Sin",
+		"cos":                         "Cos",
+		"tan":                         "Tan",
+		"asin":                        "Asin",
+		"acos":                        "Acos",
+		"atan":                        "Atan",
+		"atan2":                       "Atan2",
+		"sinh":                        "Sinh",
+		"cosh":                        "Cosh",
+		"tanh":                        "Tanh",
+		"asinh":                       "Asinh",
+		"acosh":                       "Acosh",
+		"atanh":                       "Atanh",
+		"exp":                         "Exp",
+		"exp2":                        "Exp2",
+		"expm1":                       "Expm1",
+		"log":                         "Log",
+		"log10":                       "Log10",
+		"log2":                        "Log2",
+		"log1p":                       "Log1p",
+		"logb":                        "Logb",
+		"ilogb":                       "Ilogb",
+		"pow":                         "Pow",
+		"sqrt":                        "Sqrt",
+		"cbrt":                        "Cbrt",
+		"hypot":                       "Hypot",
+		"erf":                         "Erf",
+		"erfc":                        "Erfc",
+		"tgamma":                      "Tgamma",
+		"fabs":                        "Fabs",
+		"floor":                       "Floor",
+		"ceil":                        "Ceil",
+		"trunc":                       "Trunc",
+		"round":                       "Round",
+		"rint":                        "Rint",
+		"fmod":                        "Fmod",
+		"remainder":                   "Remainder",
+		"copysign":                    "Copysign",
+		"nextafter":                   "Nextafter",
+		"fma":                         "Fma",
+		"lgamma":                      "Lgamma",
+		"fmin":                        "Fmin",
+		"fmax":                        "Fmax",
+		"fdim":                        "Fdim",
+		"frexp":                       "Frexp",
+		"ldexp":                       "Ldexp",
+		"scalbn":                      "Scalbn",
+		"modf":                        "Modf",
+		"nan":                         "Nan",
+		"lround":                      "Lround",
+		"lrint":                       "Lrint",
+		"llround":                     "Llround",
+		"llrint":                      "Llrint",
+		"sinf":                        "Sinf",
+		"cosf":                        "Cosf",
+		"tanf":                        "Tanf",
+		"asinf":                       "Asinf",
+		"acosf":                       "Acosf",
+		"atanf":                       "Atanf",
+		"atan2f":                      "Atan2f",
+		"expf":                        "Expf",
+		"logf":                        "Logf",
+		"log10f":                      "Log10f",
+		"log2f":                       "Log2f",
+		"powf":                        "Powf",
+		"sqrtf":                       "Sqrtf",
+		"cbrtf":                       "Cbrtf",
+		"hypotf":                      "Hypotf",
+		"fabsf":                       "Fabsf",
+		"floorf":                      "Floorf",
+		"ceilf":                       "Ceilf",
+		"truncf":                      "Truncf",
+		"roundf":                      "Roundf",
+		"fmodf":                       "Fmodf",
+		"copysignf":                   "Copysignf",
+		"fminf":                       "Fminf",
+		"fmaxf":                       "Fmaxf",
+		"nanf":                        "Nanf",
+		"ldexpf":                      "Ldexpf",
+		"frexpf":                      "Frexpf",
+		"modff":                       "Modff",
+		"sinl":                        "Sin",
+		"cosl":                        "Cos",
+		"tanl":                        "Tan",
+		"asinl":                       "Asin",
+		"acosl":                       "Acos",
+		"atanl":                       "Atan",
+		"atan2l":                      "Atan2",
+		"sinhl":                       "Sinh",
+		"coshl":                       "Cosh",
+		"tanhl":                       "Tanh",
+		"asinhl":                      "Asinh",
+		"acoshl":                      "Acosh",
+		"atanhl":                      "Atanh",
+		"expl":                        "Exp",
+		"exp2l":                       "Exp2",
+		"expm1l":                      "Expm1",
+		"logl":                        "Log",
+		"log10l":                      "Log10",
+		"log2l":                       "Log2",
+		"log1pl":                      "Log1p",
+		"logbl":                       "Logb",
+		"ilogbl":                      "Ilogb",
+		"powl":                        "Pow",
+		"sqrtl":                       "Sqrt",
+		"cbrtl":                       "Cbrt",
+		"hypotl":                      "Hypot",
+		"erfl":                        "Erf",
+		"erfcl":                       "Erfc",
+		"tgammal":                     "Tgamma",
+		"fabsl":                       "Fabs",
+		"floorl":                      "Floor",
+		"ceill":                       "Ceil",
+		"truncl":                      "Trunc",
+		"roundl":                      "Round",
+		"rintl":                       "Rint",
+		"fmodl":                       "Fmod",
+		"remainderl":                  "Remainder",
+		"copysignl":                   "Copysign",
+		"nextafterl":                  "Nextafter",
+		"fmal":                        "Fma",
+		"lgammal":                     "Lgamma",
+		"fminl":                       "Fmin",
+		"fmaxl":                       "Fmax",
+		"fdiml":                       "Fdim",
+		"frexpl":                      "Frexp",
+		"ldexpl":                      "Ldexp",
+		"scalbnl":                     "Scalbn",
+		"modfl":                       "Modf",
+		"nanl":                        "Nan",
+		"lroundl":                     "Lround",
+		"lrintl":                      "Lrint",
+		"llroundl":                    "Llround",
+		"llrintl":                     "Llrint",
+		"__isnan":                     "Isnan",
+		"__isnanf":                    "Isnanf",
+		"__isnanl":                    "Isnan",
+		"__isinf":                     "Isinf",
+		"__isinff":                    "Isinff",
+		"__isinfl":                    "Isinf",
+		"__finite":                    "Finite",
+		"__finitef":                   "Finitef",
+		"__finitel":                   "Finite",
+		"__fpclassify":                "Fpclassify",
+		"__fpclassifyf":               "Fpclassifyf",
+		"__fpclassifyl":               "Fpclassify",
+		"__signbit":                   "Signbit",
+		"__signbitf":                  "Signbitf",
+		"__signbitl":                  "Signbit",
+		"__builtin_signbit":           "Signbit",
+		"__builtin_signbitf":          "Signbitf",
+		"__builtin_signbitl":          "Signbit",
+		"__builtin_fabs":              "Fabs",
+		"__builtin_fabsf":             "Fabsf",
+		"__builtin_fabsl":             "Fabs",
+		"__builtin_huge_val":          "HugeVal",
+		"__builtin_huge_valf":         "HugeValf",
+		"__builtin_huge_vall":         "HugeVal",
+		"__builtin_inf":               "HugeVal",
+		"__builtin_inff":              "HugeValf",
+		"__builtin_infl":              "HugeVal",
+		"__builtin_nan":               "Nan",
+		"__builtin_nanf":              "Nanf",
+		"__builtin_nanl":              "Nan",
+		"__ctype_b_loc":               "CtypeBLoc",
+		"__ctype_tolower_loc":         "CtypeTolowerLoc",
+		"__ctype_toupper_loc":         "CtypeToupperLoc",
+		"isalnum":                     "Isalnum",
+		"isalpha":                     "Isalpha",
+		"isblank":                     "Isblank",
+		"iscntrl":                     "Iscntrl",
+		"isdigit":                     "Isdigit",
+		"isgraph":                     "Isgraph",
+		"islower":                     "Islower",
+		"isprint":                     "Isprint",
+		"ispunct":                     "Ispunct",
+		"isspace":                     "Isspace",
+		"isupper":                     "Isupper",
+		"isxdigit":                    "Isxdigit",
+		"tolower":                     "Tolower",
+		"toupper":                     "Toupper",
+		"time":                        "Time",
+		"difftime":                    "Difftime",
+		"gmtime":                      "Gmtime",
+		"gmtime_r":                    "GmtimeR",
+		"localtime":                   "Localtime",
+		"localtime_r":                 "LocaltimeR",
+		"mktime":                      "Mktime",
+		"timegm":                      "Timegm",
+		"tzset":                       "Tzset",
+		"asctime":                     "Asctime",
+		"asctime_r":                   "AsctimeR",
+		"ctime":                       "Ctime",
+		"strftime":                    "Strftime",
+		"clock_gettime":               "ClockGettime",
+		"clock_getres":                "ClockGetres",
+		"clock":                       "Clock",
+		"gettimeofday":                "Gettimeofday",
+		"nanosleep":                   "Nanosleep",
+		"sleep":                       "Sleep",
+		"usleep":                      "Usleep",
+	}
+	libcTypes = map[string]string{
+		"struct__IO_FILE": "FILE", // glibc
+		"struct___sFILE":  "FILE", // macOS
+	}
+)
+
+// libcFnName returns the runtime package and function which the C library
+// function name is bound to, or "" if it isn't bound.
+func (p *blockCtx) libcFnName(name string) (pkgPath, fn string) {
+	if _, ok := p.localfns[name]; ok {
+		return
+	}
+	if p.flat {
+		if fn = memLibcFns[name]; fn != "" {
+			return memPkgPath, fn
+		}
+	}
+	if p.checked {
+		if fn = checkedLibcFns[name]; fn != "" {
+			return checkedPkgPath, fn
+		}
+	}
+	if fn = libcFns[name]; fn != "" {
+		return libcPkgPath, fn
+	}
+	return
+}
+
+// libcFn returns the runtime function which the C library function name is
+// bound to, or nil.
+func (p *blockCtx) libcFn(name string) types.Object {
+	if pkgPath, fn := p.libcFnName(name); fn != "" {
+		return p.pkg.Import(pkgPath).Ref(fn)
+	}
+	return nil
+}
+
+// bindLibc binds the declaration of a C library function or variable to its
+// runtime implementation. It reports false if there is no implementation of a
+// compatible type, and then name is never bound.
+func (p *blockCtx) bindLibc(name string, typ types.Type) bool {
+	if obj := p.libcFn(name); obj != nil {
+		if libcCompatible(obj.Type(), typ) {
+			return true
+		}
+		p.localfns[name] = none{}
+	}
+	return false
+}
+
+// libcCompatible reports whether a runtime implementation of type rt can be
+// used as a C declaration of type t. A runtime function may take or return an
+// unsafe.Pointer where the C function has a typed pointer (such as struct
+// stat * of fstat, or struct tm * of localtime), because any pointer converts
+// to and from void * implicitly in C.
+func libcCompatible(rt, t types.Type) bool {
+	if types.Identical(rt, t) {
+		return true
+	}
+	rsig, ok := rt.(*types.Signature)
+	if !ok {
+		return false
+	}
+	sig, ok := t.(*types.Signature)
+	if !ok || rsig.Variadic() != sig.Variadic() {
+		return false
+	}
+	return libcCompatibleTuple(rsig.Params(), sig.Params()) && libcCompatibleTuple(rsig.Results(), sig.Results())
+}
+
+func libcCompatibleTuple(rt, t *types.Tuple) bool {
+	if rt.Len() != t.Len() {
+		return false
+	}
+	for i, n := 0, t.Len(); i < n; i++ {
+		rtyp, typ := rt.At(i).Type(), t.At(i).Type()
+		if types.Identical(rtyp, typ) {
+			continue
+		}
+		if _, ok := typ.(*types.Pointer); !ok || rtyp != ctypes.UnsafePointer {
+			return false
+		}
+	}
+	return true
+}
+
+// libcType returns the runtime type which the C struct name is mapped to, or
+// nil. The struct is opaque to C code, as FILE is.
+func (p *blockCtx) libcType(name string) *types.Named {
+	if tname, ok := libcTypes[name]; ok && !p.flat {
+		return p.pkg.Import(libcPkgPath).Ref(tname).Type().(*types.Named)
+	}
+	return nil
+}
+
+// initLocalFns collects functions defined by the translation unit, which are
+// never bound to runtime functions.
+func (p *blockCtx) initLocalFns(file *ast.Node) {
+	p.localfns = make(map[string]none)
+	for _, decl := range file.Inner {
+		if decl.Kind != ast.FunctionDecl {
+			continue
+		}
+		for _, item := range decl.Inner {
+			if item.Kind == ast.CompoundStmt {
+				p.localfns[decl.Name] = none{}
+				break
+			}
+		}
+	}
+}
+
+// -----------------------------------------------------------------------------
@@ -0,0 +1,717 @@
+package cl
+
+import (
+	goast "go/ast"
+	"go/constant"
+	"go/token"
+	"go/types"
+	"math"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/goplus/c2go/clang/preprocessor"
+	"github.com/goplus/c2go/clang/types/parser"
+	"github.com/goplus/gox"
+)
+
+// -----------------------------------------------------------------------------
+// Object-like macros whose bodies are integer, floating or string constant
+// expressions become typed Go consts:
+//
+//	#define FLAG (1<<3)		=> const FLAG int32 = 8
+//	#define VERSION "1.0"	=> const VERSION string = "1.0"
+//
+// Other macros are reported by PkgInfo.SkippedMacros. Macros of system headers
+// (see preprocessor.Macro) are skipped silently, while other macros may still
+// refer to them.
+
+type macroVal struct {
+	val constant.Value
+	typ types.Type
+}
+
+type macroCtx struct {
+	ctx         *blockCtx
+	defs        map[string]*preprocessor.Macro
+	vals        map[string]*macroVal
+	busy        map[string]bool
+	toks        []string
+	pos         int
+	failed      bool
+	unevaluated int // operands skipped by &&, || and ?:, such as X/0 of `0 && X/0`
+}
+
+func compileMacros(ctx *blockCtx, macros []*preprocessor.Macro) {
+	if len(macros) == 0 {
+		return
+	}
+	p := &macroCtx{
+		ctx:  ctx,
+		defs: make(map[string]*preprocessor.Macro, len(macros)),
+		vals: make(map[string]*macroVal),
+		busy: make(map[string]bool),
+	}
+	names := make([]string, 0, len(macros))
+	for _, m := range macros {
+		if _, ok := p.defs[m.Name]; !ok {
+			names = append(names, m.Name)
+		}
+		p.defs[m.Name] = m
+	}
+	sort.Strings(names)
+	pkg := ctx.pkg
+	scope := pkg.Types.Scope()
+	var cdecl = pkg.NewConstDefs(scope)
+	for _, name := range names {
+		if strings.HasPrefix(name, "_") || p.defs[name].System { // reserved names and system macros
+			continue
+		}
+		if ctx.bind != nil && !ctx.bind.selected(name) {
+			continue
+		}
+		if p.defs[name].FuncLike {
+			ctx.skipped = append(ctx.skipped, name)
+			continue
+		}
+		v := p.eval(name)
+		if v == nil || scope.Lookup(name) != nil || types.Universe.Lookup(name) != nil ||
+			token.Lookup(name).IsKeyword() {
+			ctx.skipped = append(ctx.skipped, name)
+			continue
+		}
+		cdecl.New(func(cb *gox.CodeBuilder) int {
+			pushConst(cb, v.val)
+			return 1
+		}, 0, token.NoPos, v.typ, name)
+	}
+}
+
+func pushConst(cb *gox.CodeBuilder, v constant.Value) {
+	switch v.Kind() {
+	case constant.String:
+		cb.Val(constant.StringVal(v))
+		return
+	case constant.Float:
+		f, _ := constant.Float64Val(v)
+		lit := strconv.FormatFloat(f, 'g', -1, 64)
+		if !strings.ContainsAny(lit, ".eEn") { // 1 => 1.0
+			lit += ".0"
+		}
+		cb.Val(&goast.BasicLit{Kind: token.FLOAT, Value: strings.TrimPrefix(lit, "-")})
+	default:
+		lit := v.ExactString()
+		cb.Val(&goast.BasicLit{Kind: token.INT, Value: strings.TrimPrefix(lit, "-")})
+	}
+	if constant.Sign(v) < 0 {
+		cb.UnaryOp(token.SUB)
+	}
+}
+
+// eval returns the value of the object-like macro name, or nil if its body
+// isn't a constant expression.
+func (p *macroCtx) eval(name string) *macroVal {
+	if v, ok := p.vals[name]; ok {
+		return v
+	}
+	m := p.defs[name]
+	if m.FuncLike || p.busy[name] {
+		return nil
+	}
+	p.busy[name] = true
+	toks, pos, failed, unevaluated := p.toks, p.pos, p.failed, p.unevaluated
+	p.toks, p.pos, p.failed, p.unevaluated = tokenize(m.Body), 0, false, 0
+	v := p.expr()
+	if p.failed || p.pos != len(p.toks) {
+		v = nil
+	}
+	p.toks, p.pos, p.failed, p.unevaluated = toks, pos, failed, unevaluated
+	delete(p.busy, name)
+	p.vals[name] = v
+	return v
+}
+
+func (p *macroCtx) fail() *macroVal {
+	p.failed = true
+	return nil
+}
+
+func (p *macroCtx) peek() string {
+	if p.pos < len(p.toks) {
+		return p.toks[p.pos]
+	}
+	return ""
+}
+
+func (p *macroCtx) next() string {
+	tok := p.peek()
+	p.pos++
+	return tok
+}
+
+func (p *macroCtx) expect(tok string) bool {
+	if p.peek() != tok {
+		p.failed = true
+		return false
+	}
+	p.pos++
+	return true
+}
+
+// -----------------------------------------------------------------------------
+
+var macroBinaryOps = [...]map[string]token.Token{
+	{"||": token.LOR},
+	{"&&": token.LAND},
+	{"|": token.OR},
+	{"^": token.XOR},
+	{"&": token.AND},
+	{"==": token.EQL, "!=": token.NEQ},
+	{"<": token.LSS, ">": token.GTR, "<=": token.LEQ, ">=": token.GEQ},
+	{"<<": token.SHL, ">>": token.SHR},
+	{"+": token.ADD, "-": token.SUB},
+	{"*": token.MUL, "/": token.QUO, "%": token.REM},
+}
+
+func (p *macroCtx) expr() *macroVal {
+	cond := p.binaryExpr(0)
+	if p.failed || p.peek() != "?" {
+		return cond
+	}
+	p.next()
+	if !isNumber(cond) {
+		return p.fail()
+	}
+	yes := constant.Sign(cond.val) != 0
+	x := p.operand(!yes, p.expr)
+	if !p.expect(":") {
+		return nil
+	}
+	y := p.operand(yes, p.expr)
+	if p.failed || !isNumber(x) || !isNumber(y) {
+		return p.fail()
+	}
+	if yes {
+		return p.convert(x, p.arithType(x, y))
+	}
+	return p.convert(y, p.arithType(x, y))
+}
+
+func (p *macroCtx) binaryExpr(prec int) *macroVal {
+	if prec == len(macroBinaryOps) {
+		return p.unaryExpr()
+	}
+	x := p.binaryExpr(prec + 1)
+	for !p.failed {
+		op, ok := macroBinaryOps[prec][p.peek()]
+		if !ok {
+			break
+		}
+		p.next()
+		skip := false
+		if isNumber(x) {
+			switch op {
+			case token.LOR: // 1 || y
+				skip = constant.Sign(x.val) != 0
+			case token.LAND: // 0 && y
+				skip = constant.Sign(x.val) == 0
+			}
+		}
+		y := p.operand(skip, func() *macroVal { return p.binaryExpr(prec + 1) })
+		if p.failed {
+			break
+		}
+		x = p.binaryOp(op, x, y)
+	}
+	return x
+}
+
+// operand parses an operand by parse, which isn't evaluated if skip is set, so
+// that errors such as division by zero are ignored.
+func (p *macroCtx) operand(skip bool, parse func() *macroVal) *macroVal {
+	if skip {
+		p.unevaluated++
+		defer func() { p.unevaluated-- }()
+	}
+	return parse()
+}
+
+// evalError fails, unless the operation failing isn't evaluated.
+func (p *macroCtx) evalError(typ types.Type) *macroVal {
+	if p.unevaluated > 0 {
+		return &macroVal{constant.MakeInt64(0), typ}
+	}
+	return p.fail()
+}
+
+func (p *macroCtx) unaryExpr() *macroVal {
+	switch tok := p.peek(); tok {
+	case "+", "-", "~", "!":
+		p.next()
+		x := p.unaryExpr()
+		if p.failed || !isNumber(x) {
+			return p.fail()
+		}
+		switch tok {
+		case "!":
+			return p.boolVal(constant.Sign(x.val) == 0)
+		case "~":
+			if !isInteger(x.typ.Underlying()) {
+				return p.fail()
+			}
+			x = p.convert(x, p.promote(x.typ))
+			return p.convert(&macroVal{constant.UnaryOp(token.XOR, x.val, 0), x.typ}, x.typ)
+		case "-":
+			x = p.convert(x, p.promote(x.typ))
+			return p.convert(&macroVal{constant.UnaryOp(token.SUB, x.val, 0), x.typ}, x.typ)
+		}
+		return p.convert(x, p.promote(x.typ))
+	case "(":
+		if typ, ok := p.castType(); ok {
+			x := p.unaryExpr()
+			if p.failed || !isNumber(x) {
+				return p.fail()
+			}
+			return p.convert(x, typ)
+		}
+		p.next()
+		x := p.expr()
+		p.expect(")")
+		return x
+	}
+	return p.primaryExpr()
+}
+
+func (p *macroCtx) primaryExpr() *macroVal {
+	tok := p.next()
+	if tok == "" {
+		return p.fail()
+	}
+	switch c := tok[0:1]; {
+	case c >= "0" && c <= "9" || c == ".":
+		return p.numberLit(tok)
+	case c == "'":
+		s, ok := unquoteC(tok)
+		if !ok || len(s) != 1 {
+			return p.fail()
+		}
+		return &macroVal{constant.MakeInt64(int64(int8(s[0]))), p.cType("int")}
+	case c == "\"" || strings.HasPrefix(tok, "u8\""):
+		var b strings.Builder
+		for {
+			s, ok := unquoteC(strings.TrimPrefix(tok, "u8"))
+			if !ok {
+				return p.fail()
+			}
+			b.WriteString(s)
+			if next := p.peek(); !strings.HasPrefix(next, "\"") && !strings.HasPrefix(next, "u8\"") {
+				break
+			}
+			tok = p.next()
+		}
+		return &macroVal{constant.MakeString(b.String()), types.Typ[types.String]}
+	case isIdentStart(tok[0]):
+		if _, ok := p.defs[tok]; ok {
+			if v := p.eval(tok); v != nil {
+				return v
+			}
+		} else if o, ok := p.ctx.pkg.Types.Scope().Lookup(tok).(*types.Const); ok { // enum constant
+			return &macroVal{o.Val(), o.Type()}
+		}
+	}
+	return p.fail()
+}
+
+// castType parses `(type)` if the tokens after the current `(` are a type name.
+func (p *macroCtx) castType() (types.Type, bool) {
+	end := p.pos + 1
+	for end < len(p.toks) && p.toks[end] != ")" {
+		if tok := p.toks[end]; !isIdentStart(tok[0]) {
+			return nil, false
+		}
+		end++
+	}
+	if end == p.pos+1 || end == len(p.toks) {
+		return nil, false
+	}
+	words := p.toks[p.pos+1 : end]
+	if len(words) == 1 && !isTypeKeyword(words[0]) { // typedef name
+		if _, ok := p.ctx.pkg.Types.Scope().Lookup(words[0]).(*types.TypeName); !ok {
+			return nil, false
+		}
+	}
+	for _, word := range words {
+		if len(words) > 1 && !isTypeKeyword(word) {
+			return nil, false
+		}
+	}
+	typ, ok := p.parseType(strings.Join(words, " "))
+	if !ok || !isNumber(&macroVal{typ: typ}) {
+		return nil, false
+	}
+	p.pos = end + 1
+	return typ, true
+}
+
+func (p *macroCtx) parseType(qualType string) (types.Type, bool) {
+	ctx := p.ctx
+	conf := &parser.Config{
+		Pkg: ctx.pkg.Types, Scope: ctx.pkg.Types.Scope(), Ident: ctx.typeIdent,
+		TyValist: ctx.tyValist, TyInt128: ctx.tyI128, TyUint128: ctx.tyU128,
+	}
+	typ, _, err := parser.ParseType(qualType, conf)
+	return typ, err == nil
+}
+
+func (p *macroCtx) cType(qualType string) types.Type {
+	typ, _ := p.parseType(qualType)
+	return typ
+}
+
+func isTypeKeyword(word string) bool {
+	switch word {
+	case "char", "short", "int", "long", "signed", "unsigned", "float", "double", "_Bool":
+		return true
+	}
+	return false
+}
+
+// -----------------------------------------------------------------------------
+
+func (p *macroCtx) numberLit(lit string) *macroVal {
+	lower := strings.ToLower(lit)
+	isHex := strings.HasPrefix(lower, "0x")
+	if strings.ContainsAny(lower, ".p") || (!isHex && strings.Contains(lower, "e")) { // floating
+		typ := "double"
+		switch {
+		case strings.HasSuffix(lower, "f"):
+			typ, lower = "float", lower[:len(lower)-1]
+		case strings.HasSuffix(lower, "l"):
+			typ, lower = "long double", lower[:len(lower)-1]
+		}
+		v := constant.MakeFromLiteral(lower, token.FLOAT, 0)
+		if v.Kind() == constant.Unknown {
+			return p.fail()
+		}
+		return p.convert(&macroVal{v, types.Typ[types.UntypedFloat]}, p.cType(typ))
+	}
+	digits := strings.TrimRight(lower, "ul")
+	suffix := lower[len(digits):]
+	if len(digits) > 1 && digits[0] == '0' && !isHex { // octal
+		digits = "0o" + digits[1:]
+	}
+	v := constant.MakeFromLiteral(digits, token.INT, 0)
+	if v.Kind() != constant.Int {
+		return p.fail()
+	}
+	decimal := !isHex && digits[0] != '0' || digits == "0"
+	var cands []string
+	switch suffix {
+	case "":
+		cands = []string{"int", "unsigned int", "long", "unsigned long", "long long", "unsigned long long"}
+	case "u":
+		cands = []string{"unsigned int", "unsigned long", "unsigned long long"}
+	case "l":
+		cands = []string{"long", "unsigned long", "long long", "unsigned long long"}
+	case "ul", "lu":
+		cands = []string{"unsigned long", "unsigned long long"}
+	case "ll":
+		cands = []string{"long long", "unsigned long long"}
+	case "ull", "llu":
+		cands = []string{"unsigned long long"}
+	default:
+		return p.fail()
+	}
+	for _, cand := range cands {
+		if decimal && !strings.Contains(suffix, "u") && strings.HasPrefix(cand, "unsigned") {
+			continue // decimal literals are signed unless suffixed with u
+		}
+		if typ := p.cType(cand); p.fits(v, typ) {
+			return &macroVal{v, typ}
+		}
+	}
+	return p.fail()
+}
+
+// fits reports whether the integer v is representable by typ.
+func (p *macroCtx) fits(v constant.Value, typ types.Type) bool {
+	bits := uint(p.ctx.sizeof(typ) * 8)
+	min, max := new(big.Int), new(big.Int).Lsh(big.NewInt(1), bits)
+	if !isUnsigned(typ.Underlying()) {
+		max.Rsh(max, 1)
+		min.Neg(max)
+	}
+	max.Sub(max, big.NewInt(1))
+	x, ok := new(big.Int).SetString(v.ExactString(), 10)
+	return ok && x.Cmp(min) >= 0 && x.Cmp(max) <= 0
+}
+
+// -----------------------------------------------------------------------------
+
+func isNumber(v *macroVal) bool {
+	return v != nil && isKind(v.typ.Underlying(), types.IsInteger|types.IsFloat)
+}
+
+func (p *macroCtx) boolVal(b bool) *macroVal {
+	if b {
+		return &macroVal{constant.MakeInt64(1), p.cType("int")}
+	}
+	return &macroVal{constant.MakeInt64(0), p.cType("int")}
+}
+
+// promote applies the integer promotions to typ.
+func (p *macroCtx) promote(typ types.Type) types.Type {
+	if isInteger(typ.Underlying()) && p.ctx.sizeof(typ) < 4 {
+		return p.cType("int")
+	}
+	return typ
+}
+
+// arithType returns the result type of the usual arithmetic conversions.
+func (p *macroCtx) arithType(x, y *macroVal) types.Type {
+	tx, ty := p.promote(x.typ), p.promote(y.typ)
+	fx, fy := isKind(tx.Underlying(), types.IsFloat), isKind(ty.Underlying(), types.IsFloat)
+	switch {
+	case fx && fy:
+		if p.ctx.sizeof(tx) >= p.ctx.sizeof(ty) {
+			return tx
+		}
+		return ty
+	case fx:
+		return tx
+	case fy:
+		return ty
+	}
+	sx, sy := p.ctx.sizeof(tx), p.ctx.sizeof(ty)
+	ux, uy := isUnsigned(tx.Underlying()), isUnsigned(ty.Underlying())
+	switch {
+	case ux == uy:
+		if sx >= sy {
+			return tx
+		}
+		return ty
+	case ux && sx >= sy, uy && sy >= sx:
+		if ux {
+			return tx
+		}
+		return ty
+	case sx > sy:
+		return tx
+	case sy > sx:
+		return ty
+	}
+	return tx
+}
+
+// convert converts x to typ, wrapping integers around as C does.
+func (p *macroCtx) convert(x *macroVal, typ types.Type) *macroVal {
+	if p.failed || x == nil {
+		return p.fail()
+	}
+	val := x.val
+	if isKind(typ.Underlying(), types.IsFloat) {
+		val = constant.ToFloat(val)
+		f, _ := constant.Float64Val(val)
+		if p.ctx.sizeof(typ) == 4 {
+			f = float64(float32(f))
+			val = constant.MakeFloat64(f)
+		}
+		if math.IsInf(f, 0) { // such as 1e309, which Go consts can't hold
+			return p.evalError(typ)
+		}
+		return &macroVal{val, typ}
+	}
+	if val.Kind() == constant.Float { // truncate towards zero
+		f, _ := constant.Float64Val(val)
+		b, _ := new(big.Float).SetFloat64(f).Int(nil)
+		val = constant.Make(b)
+	}
+	bits := uint(p.ctx.sizeof(typ) * 8)
+	b, ok := new(big.Int).SetString(constant.ToInt(val).ExactString(), 10)
+	if !ok {
+		return p.fail()
+	}
+	mod := new(big.Int).Lsh(big.NewInt(1), bits)
+	b.Mod(b, mod)
+	if !isUnsigned(typ.Underlying()) && b.Bit(int(bits)-1) == 1 {
+		b.Sub(b, mod)
+	}
+	return &macroVal{constant.Make(b), typ}
+}
+
+func (p *macroCtx) binaryOp(op token.Token, x, y *macroVal) *macroVal {
+	if !isNumber(x) || !isNumber(y) {
+		return p.fail()
+	}
+	switch op {
+	case token.LOR:
+		return p.boolVal(constant.Sign(x.val) != 0 || constant.Sign(y.val) != 0)
+	case token.LAND:
+		return p.boolVal(constant.Sign(x.val) != 0 && constant.Sign(y.val) != 0)
+	case token.SHL, token.SHR:
+		x = p.convert(x, p.promote(x.typ))
+		if !isInteger(x.typ.Underlying()) || !isInteger(y.typ.Underlying()) {
+			return p.fail()
+		}
+		s, ok := constant.Uint64Val(y.val)
+		if !ok || s >= uint64(p.ctx.sizeof(x.typ)*8) {
+			return p.evalError(x.typ)
+		}
+		return p.convert(&macroVal{constant.Shift(x.val, op, uint(s)), x.typ}, x.typ)
+	}
+	typ := p.arithType(x, y)
+	x, y = p.convert(x, typ), p.convert(y, typ)
+	isInt := isInteger(typ.Underlying())
+	switch op {
+	case token.EQL, token.NEQ, token.LSS, token.GTR, token.LEQ, token.GEQ:
+		return p.boolVal(constant.Compare(x.val, op, y.val))
+	case token.QUO, token.REM:
+		if !isInt && op == token.REM {
+			return p.fail()
+		}
+		if constant.Sign(y.val) == 0 {
+			return p.evalError(typ)
+		}
+		if isInt {
+			if op == token.QUO {
+				op = token.QUO_ASSIGN // integer division
+			}
+		}
+	case token.AND, token.OR, token.XOR:
+		if !isInt {
+			return p.fail()
+		}
+	}
+	return p.convert(&macroVal{constant.BinaryOp(x.val, op, y.val), typ}, typ)
+}
+
+// -----------------------------------------------------------------------------
+
+func isIdentStart(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+func isIdentChar(c byte) bool {
+	return isIdentStart(c) || c >= '0' && c <= '9'
+}
+
+var macroPuncts = []string{
+	"<<", ">>", "<=", ">=", "==", "!=", "&&", "||",
+	"+", "-", "*", "/", "%", "<", ">", "&", "|", "^", "~", "!", "?", ":", "(", ")",
+}
+
+// tokenize splits a macro body into C tokens. An unknown character becomes a
+// token of its own, which no rule accepts.
+func tokenize(s string) (toks []string) {
+	for i := 0; i < len(s); {
+		c := s[i]
+		start := i
+		switch {
+		case c == ' ' || c == '\t':
+			i++
+			continue
+		case c == '"' || c == '\'':
+			for i++; i < len(s) && s[i] != c; i++ {
+				if s[i] == '\\' {
+					i++
+				}
+			}
+			i++
+		case c >= '0' && c <= '9' || c == '.' && i+1 < len(s) && s[i+1] >= '0' && s[i+1] <= '9':
+			for i++; i < len(s); i++ {
+				if ch := s[i]; !isIdentChar(ch) && ch != '.' &&
+					!((ch == '+' || ch == '-') && strings.ContainsRune("eEpP", rune(s[i-1]))) {
+					break
+				}
+			}
+		case isIdentStart(c):
+			for i++; i < len(s) && isIdentChar(s[i]); i++ {
+			}
+			if s[start:i] == "u8" && i < len(s) && s[i] == '"' { // u8"..."
+				for i++; i < len(s) && s[i] != '"'; i++ {
+					if s[i] == '\\' {
+						i++
+					}
+				}
+				i++
+			}
+		default:
+			i++
+			for _, punct := range macroPuncts {
+				if strings.HasPrefix(s[start:], punct) {
+					i = start + len(punct)
+					break
+				}
+			}
+		}
+		if i > len(s) {
+			i = len(s)
+		}
+		toks = append(toks, s[start:i])
+	}
+	return
+}
+
+// unquoteC decodes a C char or string literal.
+func unquoteC(lit string) (string, bool) {
+	n := len(lit)
+	if n < 2 || lit[0] != lit[n-1] {
+		return "", false
+	}
+	s := lit[1 : n-1]
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c != '\\' {
+			b.WriteByte(c)
+			continue
+		}
+		if i++; i == len(s) {
+			return "", false
+		}
+		switch c = s[i]; c {
+		case 'n':
+			b.WriteByte('\n')
+		case 't':
+			b.WriteByte('\t')
+		case 'r':
+			b.WriteByte('\r')
+		case 'a':
+			b.WriteByte('\a')
+		case 'b':
+			b.WriteByte('\b')
+		case 'f':
+			b.WriteByte('\f')
+		case 'v':
+			b.WriteByte('\v')
+		case 'x':
+			j := i + 1
+			for j < len(s) && strings.IndexByte("0123456789abcdefABCDEF", s[j]) >= 0 {
+				j++
+			}
+			v, err := strconv.ParseUint(s[i+1:j], 16, 8)
+			if err != nil {
+				return "", false
+			}
+			b.WriteByte(byte(v))
+			i = j - 1
+		case '0', '1', '2', '3', '4', '5', '6', '7':
+			j := i
+			for j < len(s) && j < i+3 && s[j] >= '0' && s[j] <= '7' {
+				j++
+			}
+			v, err := strconv.ParseUint(s[i:j], 8, 8)
+			if err != nil {
+				return "", false
+			}
+			b.WriteByte(byte(v))
+			i = j - 1
+		default: // \\ \' \" \?
+			b.WriteByte(c)
+		}
+	}
+	return b.String(), true
+}
+
+// -----------------------------------------------------------------------------
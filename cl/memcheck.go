@@ -0,0 +1,60 @@
+package cl
+
+import (
+	"github.com/goplus/c2go/clang/ast"
+)
+
+// -----------------------------------------------------------------------------
+// In memory checking mode (Config.MemCheck) calls to malloc, calloc, realloc
+// and free which are bound to package clang/libc pass their C source
+// positions to MallocAt, CallocAt, ReallocAt and FreeAt:
+//
+//	p := libc.MallocAt(n, "foo.c:12:8")
+//
+// and the package enables memory checking in an init function.
+
+var (
+	memcheckFns = map[string]string{
+		"malloc":  "MallocAt",
+		"calloc":  "CallocAt",
+		"realloc": "ReallocAt",
+		"free":    "FreeAt",
+	}
+)
+
+// initMemcheck generates: func init() { libc.EnableMemcheck() }
+func initMemcheck(ctx *blockCtx) {
+	pkg := ctx.pkg
+	cb := pkg.NewFunc(nil, "init", nil, nil, false).BodyStart(pkg)
+	cb.Val(pkg.Import(libcPkgPath).Ref("EnableMemcheck")).Call(0).EndStmt()
+	cb.End()
+}
+
+// compileMemcheckCall compiles a call to malloc, calloc, realloc or free with
+// its C source position. It reports false if v isn't such a call.
+func compileMemcheckCall(ctx *blockCtx, v *ast.Node) bool {
+	fn := v.Inner[0]
+	if fn.Kind == ast.ImplicitCastExpr && len(fn.Inner) == 1 {
+		fn = fn.Inner[0]
+	}
+	if fn.Kind != ast.DeclRefExpr || fn.ReferencedDecl == nil || fn.ReferencedDecl.Kind != ast.FunctionDecl {
+		return false
+	}
+	name := fn.ReferencedDecl.Name
+	at, ok := memcheckFns[name]
+	if !ok {
+		return false
+	}
+	if pkgPath, _ := ctx.libcFnName(name); pkgPath != libcPkgPath { // defined by C code
+		return false
+	}
+	cb := ctx.cb
+	cb.Val(ctx.pkg.Import(libcPkgPath).Ref(at))
+	for _, arg := range v.Inner[1:] {
+		compileExpr(ctx, arg)
+	}
+	cb.Val(ctx.srcPos(v)).CallWith(len(v.Inner), 0, goNode(v))
+	return true
+}
+
+// -----------------------------------------------------------------------------
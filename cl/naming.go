@@ -0,0 +1,390 @@
+package cl
+
+import (
+	"bytes"
+	"encoding/json"
+	"go/format"
+	"go/token"
+	"io"
+	"os"
+	pathpkg "path"
+	"sort"
+	"strconv"
+	"strings"
+
+	goast "go/ast"
+	goparser "go/parser"
+
+	"github.com/goplus/gox"
+)
+
+// -----------------------------------------------------------------------------
+// Generated names mirror C names: functions, variables and typedefs keep their
+// names, and tagged types are named struct_Foo, union_Foo or enum_Foo. Naming
+// rules (Config.Naming) rename package-level symbols when the package is
+// written, so that it can be used from other Go packages. The generated code
+// is parsed back, and identifiers resolving to package-level symbols (or to
+// none, such as used functions which are stubbed by Dependencies) are renamed,
+// which leaves locals and struct fields of the same names alone. A symbol keeps
+// its generated name if its Go name would collide with another symbol, with a
+// local which could capture it, or with a predeclared identifier.
+
+// NamingConfig specifies how C names map to Go names.
+type NamingConfig struct {
+	// TrimPrefixes are prefixes removed from C names, such as "sqlite3_". Only
+	// the first matching one is removed.
+	TrimPrefixes []string `json:"trimPrefixes,omitempty"`
+
+	// Export converts names to exported CamelCase, such as open_v2 to OpenV2.
+	// Names beginning with an underscore are reserved and aren't converted.
+	// Struct fields are exported as well, unless their exported names collide
+	// with other fields of the same structs.
+	Export bool `json:"export,omitempty"`
+
+	// TrimTags removes struct_, union_ and enum_ from names of tagged types.
+	// Otherwise their names remain unexported.
+	TrimTags bool `json:"trimTags,omitempty"`
+
+	// Renames maps C names to Go names explicitly, which takes precedence over
+	// the other rules. Tagged types are spelled as in C, such as "struct Foo".
+	Renames map[string]string `json:"renames,omitempty"`
+}
+
+var tagPrefixes = []string{"struct_", "union_", "enum_"}
+
+// cName returns the C spelling of a generated name, such as "struct Foo" of
+// struct_Foo.
+func cName(name string, tagged bool) string {
+	if tagged {
+		for _, prefix := range tagPrefixes {
+			if strings.HasPrefix(name, prefix) {
+				return prefix[:len(prefix)-1] + " " + name[len(prefix):]
+			}
+		}
+	}
+	return name
+}
+
+// goName returns the Go name of a C name (see cName), or "" if the rules
+// leave it unchanged or map it to a reserved name, such as int64 of
+// sqlite3_int64 which would shadow the predeclared type.
+func (p *NamingConfig) goName(cname string) string {
+	name := p.mapName(cname)
+	if isReservedIdent(name) {
+		return ""
+	}
+	return name
+}
+
+func (p *NamingConfig) mapName(cname string) string {
+	if name, ok := p.Renames[cname]; ok {
+		return name
+	}
+	tag, name := "", cname
+	if pos := strings.IndexByte(cname, ' '); pos > 0 {
+		tag, name = cname[:pos], cname[pos+1:]
+	}
+	if strings.HasPrefix(name, "_") {
+		return ""
+	}
+	for _, prefix := range p.TrimPrefixes {
+		if strings.HasPrefix(name, prefix) {
+			if trimmed := name[len(prefix):]; token.IsIdentifier(trimmed) {
+				name = trimmed
+			}
+			break
+		}
+	}
+	if tag != "" && !p.TrimTags {
+		return tag + "_" + name
+	}
+	if p.Export {
+		name = camelCase(name)
+	}
+	return name
+}
+
+// camelCase converts a C name to exported CamelCase.
+func camelCase(name string) string {
+	var b strings.Builder
+	for _, part := range strings.Split(name, "_") {
+		if part != "" {
+			b.WriteString(strings.ToUpper(part[:1]))
+			b.WriteString(part[1:])
+		}
+	}
+	return b.String()
+}
+
+// exportFields returns the exported names of the struct fields of f, which are
+// keyed by their generated names. Fields are renamed by name, as selectors
+// can't tell which structs they select from, so a field keeps its name if its
+// exported name collides with another field of any struct which declares it.
+func exportFields(f *goast.File) map[string]string {
+	fields := make(map[string]string)
+	var structs [][]string
+	goast.Inspect(f, func(node goast.Node) bool {
+		if v, ok := node.(*goast.StructType); ok {
+			var names []string
+			for _, field := range v.Fields.List {
+				for _, ident := range field.Names {
+					names = append(names, ident.Name)
+					if !strings.HasPrefix(ident.Name, "_") {
+						fields[ident.Name] = camelCase(ident.Name)
+					}
+				}
+			}
+			structs = append(structs, names)
+		}
+		return true
+	})
+	for again := true; again; {
+		again = false
+		for _, names := range structs {
+			count := make(map[string]int)
+			for _, name := range names {
+				if to, ok := fields[name]; ok {
+					name = to
+				}
+				count[name]++
+			}
+			for _, name := range names {
+				if to, ok := fields[name]; ok && count[to] > 1 {
+					delete(fields, name)
+					again = true
+				}
+			}
+		}
+	}
+	return fields
+}
+
+// localNames returns the names of the locals of f, such as variables and
+// parameters of functions, which would capture package-level symbols of the
+// same names.
+func localNames(f *goast.File) map[string]bool {
+	locals := make(map[string]bool)
+	fields := make(map[*goast.Ident]bool)
+	goast.Inspect(f, func(node goast.Node) bool {
+		switch v := node.(type) {
+		case *goast.StructType:
+			for _, field := range v.Fields.List {
+				for _, ident := range field.Names {
+					fields[ident] = true
+				}
+			}
+		case *goast.Ident:
+			if obj := v.Obj; obj != nil && obj.Kind != goast.Lbl && !fields[v] && f.Scope.Lookup(v.Name) != obj {
+				locals[v.Name] = true
+			}
+		}
+		return true
+	})
+	return locals
+}
+
+func isGeneratedName(name string) bool {
+	return name == "_" || name == "main" || name == "init" || strings.HasPrefix(name, "_cgo")
+}
+
+// -----------------------------------------------------------------------------
+
+type symbol struct {
+	cname  string
+	goName string
+}
+
+// symbols returns the Go names of the package-level symbols of the generated
+// code, which are keyed by their generated names.
+func (p Package) symbols() map[string]*symbol {
+	if p.syms != nil {
+		return p.syms
+	}
+	p.syms = make(map[string]*symbol)
+	var buf bytes.Buffer
+	if err := gox.WriteTo(&buf, p.Package, false); err != nil {
+		return p.syms
+	}
+	f, err := goparser.ParseFile(token.NewFileSet(), "", buf.Bytes(), 0)
+	if err != nil {
+		return p.syms
+	}
+	scope := p.Types.Scope()
+	tagged := make(map[string]bool)
+	for _, us := range p.UndefinedStructs {
+		tagged[us] = true
+	}
+	var names []string
+	for name, obj := range f.Scope.Objects {
+		names = append(names, name)
+		if obj.Kind == goast.Typ {
+			tagged[name] = true
+		}
+	}
+	for _, ident := range f.Unresolved { // such as used functions and undefined structs
+		if scope.Lookup(ident.Name) != nil && f.Scope.Lookup(ident.Name) == nil {
+			names = append(names, ident.Name)
+			f.Scope.Insert(goast.NewObj(goast.Bad, ident.Name))
+		}
+	}
+	sort.Strings(names)
+	if p.naming != nil && p.naming.Export {
+		p.fields = exportFields(f)
+	}
+	locals := localNames(f)
+	taken := make(map[string]bool)
+	for _, name := range names {
+		if isGeneratedName(name) {
+			taken[name] = true
+			continue
+		}
+		sym := &symbol{cname: cName(p.cname(name), tagged[name]), goName: name}
+		if p.naming != nil {
+			if goName := p.naming.goName(sym.cname); goName != "" && goName != sym.cname {
+				sym.goName = goName
+			}
+		}
+		p.syms[name] = sym
+		if sym.goName == name {
+			taken[name] = true
+		}
+	}
+	for _, name := range names { // a name which collides with another keeps its generated name
+		if sym, ok := p.syms[name]; ok && sym.goName != name {
+			if taken[sym.goName] || locals[sym.goName] {
+				sym.goName = name
+			}
+			taken[sym.goName] = true
+		}
+	}
+	return p.syms
+}
+
+// rename applies naming rules to the generated code src.
+func (p Package) rename(src []byte) ([]byte, error) {
+	if p.naming == nil {
+		return src, nil
+	}
+	syms := p.symbols()
+	fset := token.NewFileSet()
+	f, err := goparser.ParseFile(fset, "", src, goparser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+	unresolved := make(map[*goast.Ident]bool, len(f.Unresolved))
+	for _, ident := range f.Unresolved {
+		unresolved[ident] = true
+	}
+	imports := make(map[string]bool)
+	for _, spec := range f.Imports {
+		if spec.Name != nil {
+			imports[spec.Name.Name] = true
+		} else if path, err := strconv.Unquote(spec.Path.Value); err == nil {
+			imports[pathpkg.Base(path)] = true
+		}
+	}
+	renameField := func(ident *goast.Ident) {
+		if name, ok := p.fields[ident.Name]; ok {
+			ident.Name = name
+		}
+	}
+	skip := make(map[*goast.Ident]bool)
+	goast.Inspect(f, func(node goast.Node) bool {
+		switch v := node.(type) {
+		case *goast.StructType:
+			for _, field := range v.Fields.List {
+				for _, ident := range field.Names {
+					renameField(ident)
+					skip[ident] = true
+				}
+			}
+		case *goast.SelectorExpr: // field, method or imported name
+			if x, ok := v.X.(*goast.Ident); !ok || x.Obj != nil || !imports[x.Name] {
+				renameField(v.Sel)
+			}
+			skip[v.Sel] = true
+		case *goast.KeyValueExpr: // field name of a composite literal
+			if key, ok := v.Key.(*goast.Ident); ok {
+				renameField(key)
+				skip[key] = true
+			}
+		case *goast.Ident:
+			if sym, ok := syms[v.Name]; ok && !skip[v] {
+				if unresolved[v] || (v.Obj != nil && f.Scope.Lookup(v.Name) == v.Obj) {
+					v.Name = sym.goName
+				}
+			}
+		}
+		return true
+	})
+	var buf bytes.Buffer
+	err = format.Node(&buf, fset, f)
+	return buf.Bytes(), err
+}
+
+// writeTo writes pkg, which is the package itself or its dependencies, with
+// doc comments added and the naming rules applied.
+func (p Package) writeTo(dst io.Writer, pkg *gox.Package) error {
+	var buf bytes.Buffer
+	if err := gox.WriteTo(&buf, pkg, false); err != nil {
+		return err
+	}
+	src, err := p.document(buf.Bytes())
+	if err == nil {
+		src, err = p.rename(src)
+	}
+	if err != nil {
+		return err
+	}
+	_, err = dst.Write(src)
+	return err
+}
+
+func writeFile(file string, write func(dst io.Writer) error) error {
+	f, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	err = write(f)
+	if e := f.Close(); err == nil {
+		err = e
+	}
+	if err != nil {
+		os.Remove(file)
+	}
+	return err
+}
+
+// WritePkgTo writes the generated code with the naming rules applied.
+func (p Package) WritePkgTo(dst io.Writer) error {
+	return p.writeTo(dst, p.Package)
+}
+
+// WritePkgFile writes the generated code with the naming rules applied to
+// file, and the assembly file of StubLinkname next to it.
+func (p Package) WritePkgFile(file string) error {
+	if err := writeFile(file, p.WritePkgTo); err != nil {
+		return err
+	}
+	return p.writeStubAsm(file)
+}
+
+// WriteSymbolsTo writes the map of C names to Go names of the package-level
+// symbols as JSON.
+func (p Package) WriteSymbolsTo(dst io.Writer) error {
+	names := make(map[string]string)
+	for _, sym := range p.symbols() {
+		names[sym.cname] = sym.goName
+	}
+	enc := json.NewEncoder(dst)
+	enc.SetIndent("", "\t")
+	return enc.Encode(names)
+}
+
+// WriteSymbolFile writes the map of C names to Go names of the package-level
+// symbols to file as JSON.
+func (p Package) WriteSymbolFile(file string) error {
+	return writeFile(file, p.WriteSymbolsTo)
+}
+
+// -----------------------------------------------------------------------------
@@ -0,0 +1,167 @@
+package cl
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// -----------------------------------------------------------------------------
+
+func TestNaming(t *testing.T) {
+	conf := &Config{Naming: &NamingConfig{
+		TrimPrefixes: []string{"db_"},
+		Export:       true,
+		TrimTags:     true,
+		Renames:      map[string]string{"db_errmsg": "ErrorMessage"},
+	}}
+	pkg := testWithConf(t, "Rules", "", `
+struct db_conn {
+	int db_count;
+};
+typedef struct db_conn db_conn_t;
+int db_count;
+int db_errmsg(int);
+int db_close(struct db_conn *c);
+
+int db_open_v2(db_conn_t *c) {
+	int db_count = c->db_count;
+	c->db_count = db_errmsg(db_count);
+	return db_close(c);
+}
+`, `package main
+
+type struct_db_conn struct {
+	db_count int32
+}
+type db_conn_t = struct_db_conn
+
+var db_count int32
+
+func db_open_v2(c *struct_db_conn) int32 {
+	var db_count int32 = c.db_count
+	c.db_count = db_errmsg(db_count)
+	return db_close(c)
+}
+`, conf)
+	var out bytes.Buffer
+	if err := pkg.WritePkgTo(&out); err != nil {
+		t.Fatal("WritePkgTo:", err)
+	}
+	if code := out.String(); code != `package main
+
+type Conn struct {
+	DbCount int32
+}
+type ConnT = Conn
+
+var Count int32
+
+func OpenV2(c *Conn) int32 {
+	var db_count int32 = c.DbCount
+	c.DbCount = ErrorMessage(db_count)
+	return Close(c)
+}
+` {
+		t.Fatalf("WritePkgTo:\n%s\n", code)
+	}
+	out.Reset()
+	pkg.WriteDepTo(&out)
+	if deps := out.String(); !strings.Contains(deps, "func Close(c *Conn) int32 {") ||
+		!strings.Contains(deps, "func ErrorMessage(int32) int32 {") {
+		t.Fatalf("WriteDepTo:\n%s\n", deps)
+	}
+	out.Reset()
+	pkg.WriteSymbolsTo(&out)
+	if syms := out.String(); syms != `{
+	"db_close": "Close",
+	"db_conn_t": "ConnT",
+	"db_count": "Count",
+	"db_errmsg": "ErrorMessage",
+	"db_open_v2": "OpenV2",
+	"struct db_conn": "Conn"
+}
+` {
+		t.Fatalf("WriteSymbolsTo:\n%s\n", syms)
+	}
+}
+
+func TestNamingReserved(t *testing.T) {
+	pkg := testWithConf(t, "Reserved", "", `
+typedef long long db_int64;
+struct db_pair { int a_b, aB, c_d; };
+int db_open(void) {
+	return 0;
+}
+int db_find(void) {
+	int open = 1;
+	struct db_pair p = {1, 2, 3};
+	return db_open() + open + p.c_d;
+}
+`, `package main
+
+type db_int64 = int64
+type struct_db_pair struct {
+	a_b int32
+	aB  int32
+	c_d int32
+}
+
+func db_open() int32 {
+	return int32(0)
+}
+func db_find() int32 {
+	var open int32 = 1
+	var p struct_db_pair = struct_db_pair{1, 2, 3}
+	return db_open() + open + p.c_d
+}
+`, &Config{Naming: &NamingConfig{TrimPrefixes: []string{"db_"}}})
+	var out bytes.Buffer
+	pkg.WriteSymbolsTo(&out)
+	if syms := out.String(); syms != `{
+	"db_find": "find",
+	"db_int64": "db_int64",
+	"db_open": "db_open",
+	"struct db_pair": "struct_pair"
+}
+` {
+		t.Fatalf("WriteSymbolsTo:\n%s\n", syms)
+	}
+	pkg.naming.Export = true
+	pkg.syms = nil
+	out.Reset()
+	if err := pkg.WritePkgTo(&out); err != nil {
+		t.Fatal("WritePkgTo:", err)
+	}
+	if code := out.String(); !strings.Contains(code, "type struct_pair struct {\n\ta_b int32\n\taB  int32\n\tCD  int32\n}") ||
+		!strings.Contains(code, "return Open() + open + p.CD") {
+		t.Fatalf("WritePkgTo:\n%s\n", code)
+	}
+}
+
+func TestNamingCollision(t *testing.T) {
+	pkg := testWithConf(t, "Collision", "", `
+typedef struct node { int v; } node;
+node *head;
+`, `package main
+
+type struct_node struct {
+	v int32
+}
+type node = struct_node
+
+var head *struct_node
+`, &Config{Naming: &NamingConfig{TrimTags: true}})
+	var out bytes.Buffer
+	pkg.WriteSymbolsTo(&out)
+	if syms := out.String(); syms != `{
+	"head": "head",
+	"node": "node",
+	"struct node": "struct_node"
+}
+` {
+		t.Fatalf("WriteSymbolsTo:\n%s\n", syms)
+	}
+}
+
+// -----------------------------------------------------------------------------
@@ -0,0 +1,34 @@
+package cl
+
+import (
+	"go/token"
+	"go/types"
+)
+
+// -----------------------------------------------------------------------------
+// Overridden functions (Config.Overrides) are C functions with hand-written Go
+// implementations in other files of the package, such as hot paths or platform
+// code. Their definitions are compiled as prototypes: calls are checked against
+// the C signatures, but no bodies are generated.
+
+func (p *blockCtx) initOverrides(names []string) {
+	p.overrides = make(map[string]none, len(names))
+	for _, name := range names {
+		p.overrides[name] = none{}
+	}
+}
+
+func (p *blockCtx) overridden(name string) bool {
+	_, ok := p.overrides[name]
+	return ok
+}
+
+func overrideFunc(ctx *blockCtx, name string, sig *types.Signature) {
+	pkg := ctx.pkg.Types
+	if scope := pkg.Scope(); scope.Lookup(name) == nil {
+		scope.Insert(types.NewFunc(token.NoPos, pkg, name, sig))
+	}
+	delete(ctx.extfns, name) // implemented, though not by this file
+}
+
+// -----------------------------------------------------------------------------
@@ -1,25 +1,104 @@
 package cl
 
 import (
+	"encoding/json"
 	"go/token"
 	"go/types"
 	"io"
+	"os"
 	"sort"
 
+	"github.com/goplus/c2go/clang/ast"
 	"github.com/goplus/gox"
 )
 
 // -----------------------------------------------------------------------------
 
+// PkgInfo describes what a translated package needs from outside: undefined
+// structs, functions, variables and builtins, and the system headers which
+// declare them. It can be exported as JSON to aggregate across packages.
 type PkgInfo struct {
-	UndefinedStructs []string
-	UsedFuncs        []string
+	UndefinedStructs []string `json:"undefinedStructs,omitempty"`
+	UndefinedVars    []string `json:"undefinedVars,omitempty"` // extern variables which are used but not defined
+	UsedFuncs        []string `json:"usedFuncs,omitempty"`
+	UsedBuiltins     []string `json:"usedBuiltins,omitempty"`  // compiler builtins, such as __builtin_bswap32
+	UsedHeaders      []string `json:"usedHeaders,omitempty"`   // system headers which declare used functions and variables
+	GotoFuncs        []string `json:"gotoFuncs,omitempty"`     // functions which still need gotos
+	SkippedMacros    []string `json:"skippedMacros,omitempty"` // macros which aren't converted to Go consts
+	Diagnostics      []string `json:"diagnostics,omitempty"`   // warnings with C source positions, such as format mismatches
 
-	confGox *gox.Config
+	// FuncAttrs maps defined and used functions to the spellings of their
+	// attributes, such as nonnull(1, 3) and format(printf, 2, 3).
+	FuncAttrs map[string][]string `json:"funcAttrs,omitempty"`
+
+	// FirstUses maps undefined variables, used functions and builtins to the C
+	// source positions (file:line:col) of their first uses.
+	FirstUses map[string]string `json:"firstUses,omitempty"`
+
+	confGox    *gox.Config
+	providers  []*Provider
+	naming     *NamingConfig
+	syms       map[string]*symbol // Go names of package-level symbols
+	fields     map[string]string  // Go names of struct fields (see exportFields)
+	cnames     map[string]string  // C names of renamed identifiers (see blockCtx.ident)
+	split      *SplitConfig
+	bind       *BindConfig
+	declfiles  map[string]string // C source files of package-level declarations
+	docs       map[string]string // doc comments of package-level declarations
+	deprecated map[string]string // messages of deprecated functions
+}
+
+// WriteJSONTo writes the package information as JSON.
+func (p *PkgInfo) WriteJSONTo(dst io.Writer) error {
+	enc := json.NewEncoder(dst)
+	enc.SetIndent("", "\t")
+	return enc.Encode(p)
+}
+
+func (p *PkgInfo) WriteJSONFile(file string) error {
+	f, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	err = p.WriteJSONTo(f)
+	if e := f.Close(); err == nil {
+		err = e
+	}
+	return err
 }
 
 // -----------------------------------------------------------------------------
 
+// use records the C source position of the first use of a package-level
+// symbol.
+func (p *blockCtx) use(name string, v *ast.Node) {
+	if _, ok := p.uses[name]; !ok {
+		pos := ""
+		if p.src != nil || p.srcfile != "" {
+			pos = p.srcPos(v)
+		}
+		p.uses[name] = pos
+	}
+}
+
+// useHeader records the system header which declares decl if decl is used.
+func (p *blockCtx) useHeader(decl *ast.Node) {
+	if decl.IsUsed && decl.Range != nil {
+		if file, _, _, system := p.srcLoc(int(decl.Range.Begin.Offset)); system {
+			p.headers[file] = none{}
+		}
+	}
+}
+
+func sortedNames(names map[string]none) []string {
+	ret := make([]string, 0, len(names))
+	for name := range names {
+		ret = append(ret, name)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
 func (p *blockCtx) genPkgInfo(confGox *gox.Config) *PkgInfo {
 	var uds []string
 	for name, tdecl := range p.typdecls {
@@ -28,18 +107,64 @@ func (p *blockCtx) genPkgInfo(confGox *gox.Config) *PkgInfo {
 		}
 	}
 	sort.Strings(uds)
-	extfns := make([]string, 0, len(p.extfns))
-	for name := range p.extfns {
-		extfns = append(extfns, name)
+	var uvs []string
+	for name := range p.extvars {
+		if _, ok := p.uses[name]; ok {
+			uvs = append(uvs, name)
+		}
+	}
+	sort.Strings(uvs)
+	extfns, builtins := sortedNames(p.extfns), sortedNames(p.builtins)
+	firstUses := make(map[string]string)
+	for _, names := range [][]string{uvs, extfns, builtins} {
+		for _, name := range names {
+			if pos, ok := p.uses[name]; ok && pos != "" {
+				firstUses[name] = pos
+			}
+		}
+	}
+	gotofns := p.gotofns
+	sort.Strings(gotofns)
+	cnames := make(map[string]string, len(p.idents))
+	for cname, name := range p.idents {
+		cnames[name] = cname
+	}
+	return &PkgInfo{
+		UndefinedStructs: uds, UndefinedVars: uvs, UsedFuncs: extfns, UsedBuiltins: builtins,
+		UsedHeaders: sortedNames(p.headers), GotoFuncs: gotofns, SkippedMacros: p.skipped, Diagnostics: p.diags,
+		FirstUses: firstUses, confGox: confGox, cnames: cnames, declfiles: p.declfiles,
+		FuncAttrs: p.attrsOfFuncs(), docs: p.docs, deprecated: p.deprecations(),
+	}
+}
+
+// cname returns the C name of a package-level symbol.
+func (p *PkgInfo) cname(name string) string {
+	if cname, ok := p.cnames[name]; ok {
+		return cname
 	}
-	sort.Strings(extfns)
-	return &PkgInfo{UndefinedStructs: uds, UsedFuncs: extfns, confGox: confGox}
+	return name
 }
 
 // -----------------------------------------------------------------------------
 
+// Dependencies generates the functions and variables which the package uses
+// but doesn't define. Functions implemented by Config.Providers are forwarded
+// to them, and the others are stubs which panic.
 func (p Package) Dependencies() *gox.Package {
-	pkg := gox.NewPackage("", p.Types.Name(), p.confGox)
+	pkg, _ := p.deps()
+	return pkg
+}
+
+// Unimplemented returns the C names of the used functions which no provider
+// implements and of the undefined variables, which are stubbed or declared by
+// Dependencies.
+func (p Package) Unimplemented() []string {
+	_, missing := p.deps()
+	return missing
+}
+
+func (p Package) deps() (pkg *gox.Package, missing []string) {
+	pkg = gox.NewPackage("", p.Types.Name(), p.confGox)
 	scope := p.Types.Scope()
 	me, old := *pkg.Types, *p.Types
 	pkg.Types = p.Types
@@ -51,25 +176,34 @@ func (p Package) Dependencies() *gox.Package {
 	for _, us := range p.UndefinedStructs {
 		pkg.NewType(us).InitType(pkg, empty)
 	}
+	for _, uv := range p.UndefinedVars {
+		pkg.NewVar(token.NoPos, scope.Lookup(uv).Type(), uv)
+		missing = append(missing, uv)
+	}
 	vPanic := types.Universe.Lookup("panic")
 	for _, uf := range p.UsedFuncs {
 		sig := scope.Lookup(uf).Type().(*types.Signature)
+		if fn := provide(pkg, p.providers, p.cname(uf), sig); fn != nil {
+			forwardFunc(pkg, uf, sig, fn)
+			continue
+		}
 		f, _ := pkg.NewFuncWith(token.NoPos, uf, sig, nil)
 		f.BodyStart(pkg).
 			Val(vPanic).Val("notimpl").Call(1).EndStmt().
 			End()
+		missing = append(missing, uf)
 	}
-	return pkg
+	sort.Strings(missing)
+	return
 }
 
 func (p Package) WriteDepTo(dst io.Writer) error {
 	pkg := p.Dependencies()
-	return gox.WriteTo(dst, pkg, false)
+	return p.writeTo(dst, pkg)
 }
 
 func (p Package) WriteDepFile(file string) error {
-	pkg := p.Dependencies()
-	return gox.WriteFile(file, pkg, false)
+	return writeFile(file, p.WriteDepTo)
 }
 
 // -----------------------------------------------------------------------------
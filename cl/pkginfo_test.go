@@ -3,6 +3,8 @@ package cl
 import (
 	"bytes"
 	"os"
+	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -39,4 +41,117 @@ func f() {
 	os.Remove(genfile)
 }
 
+func TestDependencies(t *testing.T) {
+	conf := &Config{Providers: []*Provider{
+		{PkgPath: libcPkgPath, Names: map[string]string{"my_strlen": "Strlen", "my_localtime": "Localtime", "my_abs": "Strlen"}},
+		LibcProvider(),
+	}}
+	pkg := testWithConf(t, "Providers", "test", `
+struct tm;
+unsigned long my_strlen(const char *s);
+struct tm *my_localtime(const long *t);
+int my_abs(int);
+int my_printf(const char *format, ...);
+int test(long t) {
+	my_localtime(&t);
+	return my_strlen("hi") + my_abs(-1) + my_printf("");
+}
+`, `func test(t int64) int32 {
+	my_localtime(&t)
+	return int32(my_strlen((*int8)(unsafe.Pointer(&[3]int8{'h', 'i', '\x00'}))) + uint64(my_abs(-1)) + uint64(my_printf((*int8)(unsafe.Pointer(&[1]int8{'\x00'})))))
+}`, conf)
+	var out bytes.Buffer
+	pkg.WriteDepTo(&out)
+	if deps := out.String(); deps != `package main
+
+import libc "github.com/goplus/c2go/clang/libc"
+
+type struct_tm struct {
+}
+
+func my_abs(int32) int32 {
+	panic("notimpl")
+}
+func my_localtime(t *int64) *struct_tm {
+	return (*struct_tm)(libc.Localtime(t))
+}
+func my_printf(format *int8, __cgo_args ...interface {
+}) int32 {
+	panic("notimpl")
+}
+func my_strlen(s *int8) uint64 {
+	return libc.Strlen(s)
+}
+` {
+		t.Fatalf("WriteDepTo:\n%s\n", deps)
+	}
+	if missing := pkg.Unimplemented(); !reflect.DeepEqual(missing, []string{"my_abs", "my_printf"}) {
+		t.Fatal("Unimplemented:", missing)
+	}
+}
+
+func TestPkgInfoExtern(t *testing.T) {
+	pkg := testFunc(t, "Extern", `
+# 1 "/usr/include/sys.h" 1 3 4
+extern int sys_errors;
+extern int sys_unused;
+int sys_call(int);
+# 6 "test.c"
+extern int count;
+extern int limit;
+int limit = 10;
+
+int test(void) {
+	count++;
+	return sys_call(limit) + sys_errors + __builtin_bswap32(count);
+}
+`, `func test() int32 {
+	count++
+	return int32(uint32(sys_call(limit)+sys_errors) + __builtin_bswap32(uint32(count)))
+}`)
+	info := pkg.PkgInfo
+	if !reflect.DeepEqual(info.UndefinedVars, []string{"count", "sys_errors"}) {
+		t.Fatal("UndefinedVars:", info.UndefinedVars)
+	}
+	if !reflect.DeepEqual(info.UsedBuiltins, []string{"__builtin_bswap32"}) ||
+		!reflect.DeepEqual(info.UsedHeaders, []string{"/usr/include/sys.h"}) {
+		t.Fatal("UsedBuiltins:", info.UsedBuiltins, "UsedHeaders:", info.UsedHeaders)
+	}
+	var out bytes.Buffer
+	if err := info.WriteJSONTo(&out); err != nil {
+		t.Fatal("WriteJSONTo:", err)
+	}
+	json := tmpFileRE.ReplaceAllString(out.String(), "test.c:")
+	if json != `{
+	"undefinedVars": [
+		"count",
+		"sys_errors"
+	],
+	"usedFuncs": [
+		"__builtin_bswap32",
+		"sys_call"
+	],
+	"usedBuiltins": [
+		"__builtin_bswap32"
+	],
+	"usedHeaders": [
+		"/usr/include/sys.h"
+	],
+	"firstUses": {
+		"__builtin_bswap32": "test.c:12:40",
+		"count": "test.c:11:2",
+		"sys_call": "test.c:12:9",
+		"sys_errors": "test.c:12:27"
+	}
+}
+` {
+		t.Fatal("WriteJSONTo:", json)
+	}
+	out.Reset()
+	pkg.WriteDepTo(&out)
+	if deps := out.String(); !strings.Contains(deps, "var count int32\nvar sys_errors int32\n") {
+		t.Fatal("WriteDepTo:", deps)
+	}
+}
+
 // -----------------------------------------------------------------------------
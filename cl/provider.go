@@ -0,0 +1,111 @@
+package cl
+
+import (
+	"go/token"
+	"go/types"
+	"strconv"
+	"strings"
+
+	"github.com/goplus/gox"
+
+	ctypes "github.com/goplus/c2go/clang/types"
+)
+
+// -----------------------------------------------------------------------------
+// The dependencies of a package (see Package.Dependencies) are the functions
+// and variables it uses but doesn't define. A used function is forwarded to
+// the first provider implementing it by a function of a compatible type, and
+// only functions which no provider implements get stubs that panic. Go has no
+// variable aliases, so undefined variables are always declared in place.
+
+// Provider is a Go package which implements C functions, such as package
+// clang/libc, a user-supplied package, or a package of hand-written overrides.
+type Provider struct {
+	// PkgPath is the import path of the Go package.
+	PkgPath string
+
+	// Names maps C names to Go names of the package. If Names is nil, a C name
+	// maps to the Go name with the first letter upper-cased (strlen to
+	// Strlen). Only the C names in Names are provided otherwise.
+	Names map[string]string
+}
+
+// LibcProvider returns the provider of package clang/libc.
+func LibcProvider() *Provider {
+	names := make(map[string]string, len(libcFns))
+	for name, fn := range libcFns {
+		names[name] = fn
+	}
+	return &Provider{PkgPath: libcPkgPath, Names: names}
+}
+
+func (p *Provider) goName(name string) string {
+	if p.Names != nil {
+		return p.Names[name]
+	}
+	if name == "" || name[0] < 'a' || name[0] > 'z' {
+		return ""
+	}
+	return strings.ToUpper(name[:1]) + name[1:]
+}
+
+// provide returns the function of the first provider which implements the C
+// function name of signature sig, or nil.
+func provide(pkg *gox.Package, providers []*Provider, name string, sig *types.Signature) types.Object {
+	for _, p := range providers {
+		if goName := p.goName(name); goName != "" {
+			if obj := pkg.Import(p.PkgPath).TryRef(goName); obj != nil {
+				if _, ok := obj.(*types.Func); ok && libcCompatible(obj.Type(), sig) {
+					return obj
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// forwardFunc generates the C function name of signature sig, which calls fn
+// of a provider.
+func forwardFunc(pkg *gox.Package, name string, sig *types.Signature, fn types.Object) {
+	params := make([]*types.Var, sig.Params().Len())
+	for i := range params {
+		param := sig.Params().At(i)
+		pname := param.Name()
+		if pname == "" || pname == "_" { // parameters of C prototypes may be unnamed
+			pname = "_cgo_arg" + strconv.Itoa(i)
+		}
+		params[i] = types.NewParam(token.NoPos, pkg.Types, pname, param.Type())
+	}
+	wrapper := types.NewSignature(nil, types.NewTuple(params...), sig.Results(), sig.Variadic())
+	f, _ := pkg.NewFuncWith(token.NoPos, name, wrapper, nil)
+	cb := f.BodyStart(pkg)
+	rsig := fn.Type().(*types.Signature)
+	var result types.Type
+	if sig.Results().Len() == 1 {
+		if result = sig.Results().At(0).Type(); types.Identical(result, rsig.Results().At(0).Type()) {
+			result = nil
+		} else {
+			cb.Typ(result)
+		}
+	}
+	cb.Val(fn)
+	for i, param := range params {
+		if types.Identical(param.Type(), rsig.Params().At(i).Type()) {
+			cb.Val(param)
+		} else {
+			cb.Typ(ctypes.UnsafePointer).Val(param).Call(1)
+		}
+	}
+	cb.Call(len(params), sig.Variadic())
+	if result != nil {
+		cb.Call(1)
+	}
+	if sig.Results().Len() == 1 {
+		cb.Return(1)
+	} else {
+		cb.EndStmt()
+	}
+	cb.End()
+}
+
+// -----------------------------------------------------------------------------
@@ -0,0 +1,300 @@
+package cl
+
+import (
+	"bytes"
+	"go/format"
+	"go/printer"
+	"go/token"
+	"go/types"
+	"io"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	goast "go/ast"
+	goparser "go/parser"
+
+	"github.com/goplus/c2go/clang/ast"
+	"github.com/goplus/gox"
+)
+
+// -----------------------------------------------------------------------------
+// The generated code of a large translation unit, such as sqlite3.c, is too big
+// to be reviewed as one file. Package.WritePkgFiles splits it into files of the
+// same package, by the C source files which package-level declarations come
+// from, or into chunks of limited size. Declarations keep the order in which
+// they are generated, and files are named after the main output file, so that
+// the same input always gives the same files.
+
+// SplitConfig specifies how the generated code is split into files.
+type SplitConfig struct {
+	// ByFile puts the declarations of each C source file (as named by line
+	// markers of the preprocessed source) into a file of its own, such as
+	// foo.c.i.stdio.go for /usr/include/stdio.h if the main output file is
+	// foo.c.i.go. Declarations of the main C source file, and generated ones
+	// such as consts of macros, remain in the main output file.
+	ByFile bool
+
+	// MaxLines, if positive, splits files further into chunks of at most
+	// MaxLines lines at declaration boundaries, such as foo.c.i.2.go. A longer
+	// declaration gets a chunk of its own.
+	MaxLines int
+}
+
+// declFile returns the C source file of the top-level declaration decl, or ""
+// if it is the main source file.
+func (p *blockCtx) declFile(decl *ast.Node) string {
+	if decl.Range == nil || (p.src == nil && p.srcfile == "") {
+		return p.curfile
+	}
+	off := decl.Range.Begin.Offset
+	if loc := decl.Range.Begin.ExpansionLoc; loc != nil { // begins with a macro
+		off = loc.Offset
+	}
+	file, _, _, _ := p.srcLoc(int(off))
+	main := p.srcfile
+	if len(p.markers) > 0 { // such as `# 0 "foo.c"` of gcc -E
+		main = p.markers[0].file
+	}
+	if file == main {
+		return ""
+	}
+	return file
+}
+
+// declare records that the package-level declaration name comes from the
+// current C source file.
+func (p *blockCtx) declare(scope *types.Scope, name string) {
+	if p.declfiles != nil && scope == p.pkg.Types.Scope() {
+		if _, ok := p.declfiles[name]; !ok {
+			p.declfiles[name] = p.curfile
+		}
+	}
+}
+
+// -----------------------------------------------------------------------------
+
+func declName(decl goast.Decl) string {
+	switch v := decl.(type) {
+	case *goast.FuncDecl:
+		return v.Name.Name
+	case *goast.GenDecl:
+		if len(v.Specs) > 0 {
+			switch spec := v.Specs[0].(type) {
+			case *goast.TypeSpec:
+				return spec.Name.Name
+			case *goast.ValueSpec:
+				return spec.Names[0].Name
+			}
+		}
+	}
+	return ""
+}
+
+type splitPart struct {
+	cfile string // C source file, or "" of the main one
+	decls []goast.Decl
+}
+
+// WritePkgFiles writes the generated code with the naming rules applied to
+// file, split into files next to it by Config.Split, and returns the names of
+// the files written. The main output file is always written.
+func (p Package) WritePkgFiles(file string) ([]string, error) {
+	if p.split == nil {
+		return []string{file}, p.WritePkgFile(file)
+	}
+	var buf bytes.Buffer
+	if err := gox.WriteTo(&buf, p.Package, false); err != nil {
+		return nil, err
+	}
+	fset := token.NewFileSet()
+	f, err := goparser.ParseFile(fset, "", buf.Bytes(), goparser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+	var imports []*goast.ImportSpec
+	parts := []*splitPart{{}}
+	index := map[string]*splitPart{"": parts[0]}
+	for _, decl := range f.Decls {
+		if v, ok := decl.(*goast.GenDecl); ok && v.Tok == token.IMPORT {
+			for _, spec := range v.Specs {
+				imports = append(imports, spec.(*goast.ImportSpec))
+			}
+			continue
+		}
+		cfile := p.declfiles[declName(decl)]
+		part, ok := index[cfile]
+		if !ok {
+			part = &splitPart{cfile: cfile}
+			index[cfile] = part
+			parts = append(parts, part)
+		}
+		part.decls = append(part.decls, decl)
+	}
+	names := &fileNames{stem: strings.TrimSuffix(file, ".go"), taken: make(map[string]bool)}
+	comments := f.Comments
+	var files []string
+	for _, part := range parts {
+		var chunks [][]goast.Decl
+		var srcs [][][]byte
+		lines := 0
+		for _, decl := range part.decls {
+			var src []byte
+			if src, comments, err = declSrc(fset, decl, comments); err != nil {
+				return nil, err
+			}
+			n := bytes.Count(src, []byte{'\n'}) + 2
+			if len(chunks) == 0 || (p.split.MaxLines > 0 && lines+n > p.split.MaxLines && lines > 0) {
+				chunks, srcs, lines = append(chunks, nil), append(srcs, nil), 0
+			}
+			chunks[len(chunks)-1] = append(chunks[len(chunks)-1], decl)
+			srcs[len(srcs)-1] = append(srcs[len(srcs)-1], src)
+			lines += n
+		}
+		if len(chunks) == 0 { // the main output file without declarations
+			chunks, srcs = append(chunks, nil), append(srcs, nil)
+		}
+		for i, chunk := range chunks {
+			name := names.get(part.cfile, i)
+			src, err := format.Source(chunkSrc(f.Name.Name, usedImports(imports, chunk), srcs[i]))
+			if err == nil {
+				src, err = p.document(src)
+			}
+			if err == nil {
+				src, err = p.rename(src)
+			}
+			if err != nil {
+				return nil, err
+			}
+			err = writeFile(name, func(dst io.Writer) error {
+				_, err := dst.Write(src)
+				return err
+			})
+			if err != nil {
+				return nil, err
+			}
+			files = append(files, name)
+		}
+	}
+	return files, p.writeStubAsm(file)
+}
+
+// declSrc returns the source of decl with its comments, which are the first of
+// comments, and the comments after decl.
+func declSrc(fset *token.FileSet, decl goast.Decl, comments []*goast.CommentGroup) ([]byte, []*goast.CommentGroup, error) {
+	start := decl.Pos()
+	switch v := decl.(type) {
+	case *goast.FuncDecl:
+		if v.Doc != nil {
+			start = v.Doc.Pos()
+		}
+	case *goast.GenDecl:
+		if v.Doc != nil {
+			start = v.Doc.Pos()
+		}
+	}
+	for len(comments) > 0 && comments[0].Pos() < start { // between declarations
+		comments = comments[1:]
+	}
+	n := 0
+	for n < len(comments) && comments[n].End() <= decl.End() {
+		n++
+	}
+	var buf bytes.Buffer
+	err := format.Node(&buf, fset, &printer.CommentedNode{Node: decl, Comments: comments[:n]})
+	return buf.Bytes(), comments[n:], err
+}
+
+// usedImports returns the imports which decls refer to. Blank imports, such as
+// unsafe of go:linkname directives, are always used.
+func usedImports(imports []*goast.ImportSpec, decls []goast.Decl) (used []*goast.ImportSpec) {
+	names := make(map[string]bool)
+	for _, decl := range decls {
+		goast.Inspect(decl, func(node goast.Node) bool {
+			if sel, ok := node.(*goast.SelectorExpr); ok {
+				if x, ok := sel.X.(*goast.Ident); ok && x.Obj == nil {
+					names[x.Name] = true
+				}
+			}
+			return true
+		})
+	}
+	for _, spec := range imports {
+		pkgPath, _ := strconv.Unquote(spec.Path.Value)
+		name := path.Base(pkgPath)
+		if spec.Name != nil {
+			name = spec.Name.Name
+		}
+		if name == "_" || names[name] {
+			used = append(used, spec)
+		}
+	}
+	return
+}
+
+func chunkSrc(pkgName string, imports []*goast.ImportSpec, decls [][]byte) []byte {
+	var b bytes.Buffer
+	b.WriteString("package " + pkgName + "\n")
+	if len(imports) > 0 {
+		b.WriteString("\nimport (\n")
+		for _, spec := range imports {
+			if spec.Name != nil {
+				b.WriteString(spec.Name.Name + " ")
+			}
+			b.WriteString(spec.Path.Value + "\n")
+		}
+		b.WriteString(")\n")
+	}
+	for _, decl := range decls {
+		b.WriteByte('\n')
+		b.Write(decl)
+		b.WriteByte('\n')
+	}
+	return b.Bytes()
+}
+
+// -----------------------------------------------------------------------------
+
+type fileNames struct {
+	stem  string
+	taken map[string]bool
+}
+
+// get returns the name of the i-th chunk of the declarations of the C source
+// file cfile.
+func (p *fileNames) get(cfile string, i int) string {
+	base := p.stem
+	if cfile != "" {
+		base += "." + partName(cfile)
+	}
+	if i > 0 {
+		base += "." + strconv.Itoa(i+1)
+	}
+	name := base + ".go"
+	for n := 2; p.taken[name]; n++ { // such as stdio.h of different directories
+		name = base + "-" + strconv.Itoa(n) + ".go"
+	}
+	p.taken[name] = true
+	return name
+}
+
+// partName returns the name of the file part of the C source file cfile. Only
+// letters, digits, dots and dashes are kept, so that it doesn't look like a
+// build constraint (such as _linux) or a test file.
+func partName(cfile string) string {
+	base := filepath.Base(cfile)
+	base = strings.TrimSuffix(base, filepath.Ext(base))
+	name := strings.Map(func(c rune) rune {
+		if c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '.' {
+			return c
+		}
+		return '-'
+	}, base)
+	if name = strings.Trim(name, "-."); name == "" {
+		return "src"
+	}
+	return name
+}
+
+// -----------------------------------------------------------------------------
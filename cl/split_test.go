@@ -0,0 +1,130 @@
+package cl
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// -----------------------------------------------------------------------------
+
+func TestSplit(t *testing.T) {
+	conf := &Config{Split: &SplitConfig{ByFile: true}}
+	pkg := testWithConf(t, "ByFile", "", `
+int count;
+
+int next() {
+	return ++count;
+}
+# 1 "lib/util_linux.h"
+typedef unsigned long size_t;
+int util_len(const char *s) {
+	int n = 0;
+	while (s[n]) n++;
+	return n;
+}
+# 1 "strings.h"
+struct str {
+	char *data;
+	size_t len;
+};
+`, `package main
+
+import unsafe "unsafe"
+
+var count int32
+
+func next() int32 {
+	count++
+	return count
+}
+
+type size_t = uint64
+
+func util_len(s *int8) int32 {
+	var n int32 = 0
+	for *(*int8)(unsafe.Pointer(uintptr(unsafe.Pointer(s)) + uintptr(n))) != 0 {
+		n++
+	}
+	return n
+}
+
+type struct_str struct {
+	data *int8
+	len_ uint64
+}
+`, conf)
+	dir := t.TempDir()
+	files, err := pkg.WritePkgFiles(dir + "/test.c.i.go")
+	if err != nil {
+		t.Fatal("WritePkgFiles:", err)
+	}
+	expected := map[string]string{
+		"test.c.i.go": `package main
+
+var count int32
+
+func next() int32 {
+	count++
+	return count
+}
+`,
+		"test.c.i.util-linux.go": `package main
+
+import (
+	unsafe "unsafe"
+)
+
+type size_t = uint64
+
+func util_len(s *int8) int32 {
+	var n int32 = 0
+	for *(*int8)(unsafe.Pointer(uintptr(unsafe.Pointer(s)) + uintptr(n))) != 0 {
+		n++
+	}
+	return n
+}
+`,
+		"test.c.i.strings.go": `package main
+
+type struct_str struct {
+	data *int8
+	len_ uint64
+}
+`,
+	}
+	if len(files) != len(expected) {
+		t.Fatal("WritePkgFiles:", files)
+	}
+	for _, file := range files {
+		b, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal("WritePkgFiles:", err)
+		}
+		if code, ok := expected[strings.TrimPrefix(file, dir+"/")]; !ok || string(b) != code {
+			t.Fatalf("WritePkgFiles: %s\n%s\n", file, b)
+		}
+	}
+
+	conf = &Config{Split: &SplitConfig{MaxLines: 4}}
+	pkg = testWithConf(t, "Chunks", "", `
+int a;
+int b;
+int c;
+`, `package main
+
+var a int32
+var b int32
+var c int32
+`, conf)
+	files, err = pkg.WritePkgFiles(dir + "/chunk.go")
+	if err != nil {
+		t.Fatal("WritePkgFiles:", err)
+	}
+	if !reflect.DeepEqual(files, []string{dir + "/chunk.go", dir + "/chunk.2.go"}) {
+		t.Fatal("WritePkgFiles:", files)
+	}
+}
+
+// -----------------------------------------------------------------------------
@@ -43,24 +43,60 @@ func compileStmt(ctx *blockCtx, stmt *ast.Node) {
 	case ast.GCCAsmStmt:
 		// TODO: skip asm
 	default:
+		old := ctx.setLift(true)
 		compileExprEx(ctx, stmt, "compileStmt: unknown kind =", flagIgnoreResult)
 		ctx.cb.EndStmt()
+		ctx.restoreLift(old)
 	}
 }
 
+// compileLiftedExpr compiles an expression evaluated before the statement being
+// compiled, so its side effects can be lifted into preceding statements.
+func compileLiftedExpr(ctx *blockCtx, expr *ast.Node, isCond bool) *gox.Element {
+	defer ctx.restoreLift(ctx.setLift(true))
+	cb := ctx.cb
+	compileExpr(ctx, expr)
+	if isCond {
+		castToBoolExpr(cb)
+	}
+	return cb.InternalStack().Pop()
+}
+
 // -----------------------------------------------------------------------------
 
 func compileSub(ctx *blockCtx, stmt *ast.Node) {
 	switch stmt.Kind {
 	case ast.CompoundStmt:
-		for _, item := range stmt.Inner {
-			compileStmt(ctx, item)
-		}
+		compileStmts(ctx, stmt.Inner, 0)
 		return
 	}
 	compileStmt(ctx, stmt)
 }
 
+// compileStmts compiles statements of a compound statement. The outer block
+// exits of stmts[0] are already opened. Statements of a block exit are wrapped
+// into a labeled `switch { default: ... }`, and gotos to its label are compiled
+// into breaks of it.
+func compileStmts(ctx *blockCtx, stmts []*ast.Node, outer int) {
+	fn := ctx.curfn
+	for i := 0; i < len(stmts); i++ {
+		if labels := fn.info.exits[stmts[i]]; len(labels) > outer {
+			end := i + 1
+			for stmts[end] != labels[outer] {
+				end++
+			}
+			fn.labelFlow(ctx.cb, labels[outer])
+			cb := ctx.cb.Switch().None().Then().Case(0)
+			compileStmts(ctx, stmts[i:end], outer+1)
+			cb.End().End()
+			i = end - 1
+		} else {
+			compileStmt(ctx, stmts[i])
+		}
+		outer = 0
+	}
+}
+
 func compileDoStmt(ctx *blockCtx, stmt *ast.Node) {
 	if stmt.Complicated {
 		compileComplicatedDoStmt(ctx, stmt)
@@ -70,6 +106,7 @@ func compileDoStmt(ctx *blockCtx, stmt *ast.Node) {
 	flow := ctx.enterFlow(flowKindLoop)
 	defer ctx.leave(flow)
 
+	ctx.curfn.labelFlow(ctx.cb, stmt)
 	cb := ctx.cb.For().None().Then()
 	{
 		compileSub(ctx, stmt.Inner[0])
@@ -110,6 +147,10 @@ func checkNeedReturn(ctx *blockCtx, body *ast.Node) {
 	}
 	cb := ctx.cb
 	if ret, ok := getRetTypeEx(cb); ok {
+		if n > 0 && !ctx.fallsThrough(body.Inner[n-1]) { // such as a call of abort
+			cb.Val(types.Universe.Lookup("panic")).Val("unreachable").Call(1).EndStmt()
+			return
+		}
 		cb.ZeroLit(ret).Return(1)
 	}
 }
@@ -125,6 +166,15 @@ func compileWhileStmt(ctx *blockCtx, stmt *ast.Node) {
 	flow := ctx.enterFlow(flowKindLoop)
 	defer ctx.leave(flow)
 
+	ctx.curfn.labelFlow(ctx.cb, stmt)
+	if cond := stmt.Inner[0]; hasLiftable(cond) { // for { cond; if !cond { break }; body }
+		cb := ctx.cb.For().None().Then()
+		val := compileLiftedExpr(ctx, cond, true)
+		cb.If().Val(val).UnaryOp(token.NOT).Then().Break(nil).End()
+		compileSub(ctx, stmt.Inner[1])
+		cb.End()
+		return
+	}
 	cb := ctx.cb.For()
 	compileExpr(ctx, stmt.Inner[0])
 	castToBoolExpr(cb)
@@ -139,10 +189,9 @@ func compileComplicatedWhileStmt(ctx *blockCtx, stmt *ast.Node) {
 
 	loop.labelStart(ctx)
 
-	cb := ctx.cb.If()
-	compileExpr(ctx, stmt.Inner[0])
-	castToBoolExpr(cb)
+	cond := compileLiftedExpr(ctx, stmt.Inner[0], true)
 	done := loop.EndLabel(ctx)
+	cb := ctx.cb.If().Val(cond)
 	cb.UnaryOp(token.NOT).Then().Goto(done).End()
 
 	compileSub(ctx, stmt.Inner[1])
@@ -163,9 +212,8 @@ func compileComplicatedIfStmt(ctx *blockCtx, stmt *ast.Node) {
 		label = done
 	}
 
-	cb := ctx.cb.If()
-	compileExpr(ctx, stmt.Inner[0])
-	castToBoolExpr(cb)
+	cond := compileLiftedExpr(ctx, stmt.Inner[0], true)
+	cb := ctx.cb.If().Val(cond)
 	cb.UnaryOp(token.NOT).Then().Goto(label).End()
 	compileSub(ctx, stmt.Inner[1])
 
@@ -185,10 +233,8 @@ func compileIfStmt(ctx *blockCtx, stmt *ast.Node) {
 	flow := ctx.enterFlow(flowKindIf)
 	defer ctx.leave(flow)
 
-	cb := ctx.cb.If()
-	compileExpr(ctx, stmt.Inner[0])
-	castToBoolExpr(cb)
-	cb.Then()
+	cond := compileLiftedExpr(ctx, stmt.Inner[0], true)
+	cb := ctx.cb.If().Val(cond).Then()
 	compileSub(ctx, stmt.Inner[1])
 	if stmt.HasElse {
 		cb.Else()
@@ -206,9 +252,7 @@ func compileCompoundStmt(ctx *blockCtx, cStmt *ast.Node) {
 	} else {
 		cb.Block()
 	}
-	for _, stmt := range cStmt.Inner {
-		compileStmt(ctx, stmt)
-	}
+	compileStmts(ctx, cStmt.Inner, 0)
 	cb.End()
 }
 
@@ -222,9 +266,10 @@ func compileForStmt(ctx *blockCtx, stmt *ast.Node) {
 	flow := ctx.enterFlow(flowKindLoop)
 	defer ctx.leave(flow)
 
+	ctx.curfn.labelFlow(ctx.cb, stmt)
 	cb := ctx.cb.For()
 	if initStmt := stmt.Inner[0]; initStmt.Kind != "" {
-		compileStmt(ctx, initStmt)
+		compileForClause(ctx, initStmt)
 	}
 	if stmt := stmt.Inner[1]; stmt.Kind != "" {
 		log.Panicln("compileForStmt: unexpected -", stmt.Kind)
@@ -239,11 +284,22 @@ func compileForStmt(ctx *blockCtx, stmt *ast.Node) {
 	compileSub(ctx, stmt.Inner[4])
 	if postStmt := stmt.Inner[3]; postStmt.Kind != "" {
 		cb.Post()
-		compileStmt(ctx, postStmt)
+		compileForClause(ctx, postStmt)
 	}
 	cb.End()
 }
 
+// compileForClause compiles init/post statement of a for statement. They
+// must be single statements so side effects can't be lifted.
+func compileForClause(ctx *blockCtx, stmt *ast.Node) {
+	if stmt.Kind == ast.DeclStmt {
+		compileStmt(ctx, stmt)
+		return
+	}
+	compileExprEx(ctx, stmt, "compileForClause: unknown kind =", flagIgnoreResult)
+	ctx.cb.EndStmt()
+}
+
 // -----------------------------------------------------------------------------
 
 func compileSwitchStmt(ctx *blockCtx, switchStmt *ast.Node) {
@@ -258,8 +314,7 @@ func compileComplicatedSwitchStmt(ctx *blockCtx, switchStmt *ast.Node) {
 	sw := ctx.enterSwitch()
 	defer ctx.leave(sw)
 
-	compileExpr(ctx, switchStmt.Inner[0])
-	tag := ctx.cb.InternalStack().Pop()
+	tag := compileLiftedExpr(ctx, switchStmt.Inner[0], false)
 
 	const (
 		tagName        = "_tag"
@@ -331,9 +386,9 @@ func compileSimpleSwitchStmt(ctx *blockCtx, switchStmt *ast.Node) {
 	flow := ctx.enterFlow(flowKindSwitch)
 	defer ctx.leave(flow)
 
-	cb := ctx.cb.Switch()
-	compileExpr(ctx, switchStmt.Inner[0])
-	cb.Then()
+	ctx.curfn.labelFlow(ctx.cb, switchStmt)
+	tag := compileLiftedExpr(ctx, switchStmt.Inner[0], false)
+	cb := ctx.cb.Switch().Val(tag).Then()
 	body := switchStmt.Inner[1]
 	if body.Kind != ast.CompoundStmt {
 		log.Panicln("compileSimpleSwitchStmt: not a simple switch stmt")
@@ -395,14 +450,26 @@ func compileBreakStmt(ctx *blockCtx, stmt *ast.Node) {
 }
 
 func compileLabelStmt(ctx *blockCtx, stmt *ast.Node) {
-	l := ctx.getLabel(goNodePos(stmt), stmt.Name)
-	ctx.cb.Label(l)
+	if _, dead := ctx.curfn.info.deadLabels[stmt.Name]; !dead {
+		l := ctx.getLabel(goNodePos(stmt), ctx.ident(stmt.Name))
+		ctx.cb.Label(l)
+	}
 	compileStmt(ctx, stmt.Inner[0])
 }
 
 func compileGotoStmt(ctx *blockCtx, stmt *ast.Node) {
+	fn := ctx.curfn
+	if j, ok := fn.info.jumps[stmt]; ok {
+		l := fn.flows[j.flow]
+		if j.tok == token.BREAK {
+			ctx.cb.Break(l)
+		} else {
+			ctx.cb.Continue(l)
+		}
+		return
+	}
 	label := ctx.labelOfGoto(stmt)
-	l := ctx.getLabel(goNodePos(stmt), label)
+	l := ctx.getLabel(goNodePos(stmt), ctx.ident(label))
 	ctx.cb.Goto(l)
 }
 
@@ -410,6 +477,7 @@ func compileReturnStmt(ctx *blockCtx, stmt *ast.Node) {
 	n := len(stmt.Inner)
 	if n > 0 {
 		n = 1
+		defer ctx.restoreLift(ctx.setLift(true))
 		compileExpr(ctx, stmt.Inner[0])
 		cb := ctx.cb
 		typeCast(ctx, getRetType(cb), cb.Get(-1))
@@ -1,6 +1,7 @@
 package cl
 
 import (
+	"go/token"
 	"testing"
 
 	"github.com/goplus/c2go/clang/ast"
@@ -264,3 +265,141 @@ func checkSimpleCompoundStmt(ctx *blockCtx, node *ast.Node) bool {
 }
 
 // -----------------------------------------------------------------------------
+
+func TestStructJump(t *testing.T) {
+	cases := []struct {
+		name  string
+		code  string
+		jumps int
+		tok   token.Token
+	}{
+		{name: "BreakLoop", jumps: 1, tok: token.BREAK, code: `
+void foo(int n) {
+	while (n > 0) {
+		switch (n) {
+		case 1:
+			goto done;
+		}
+		n--;
+	}
+done:
+	;
+}
+`},
+		{name: "ContinueLoop", jumps: 1, tok: token.CONTINUE, code: `
+void foo(int n) {
+	for (; n > 0; n--) {
+		if (n == 2) {
+			goto next;
+		}
+		n++;
+next:
+		;
+	}
+}
+`},
+		{name: "GotoOuter", jumps: 1, tok: token.BREAK, code: `
+void foo(int n) {
+	goto done;
+	while (n > 0) {
+		n--;
+	}
+done:
+	;
+}
+`},
+		{name: "BlockExit", jumps: 3, tok: token.BREAK, code: `
+void *malloc(unsigned long);
+void free(void *);
+
+int foo(int n) {
+	char *p, *q;
+	p = malloc(n);
+	if (!p)
+		goto out;
+	q = malloc(n);
+	if (!q) {
+		goto fail;
+	}
+	for (; n > 0; n--) {
+		if (p[n] != q[n])
+			goto fail;
+	}
+	free(q);
+	return 0;
+fail:
+	free(p);
+out:
+	return -1;
+}
+`},
+		{name: "BlockExitBackward", jumps: 0, code: `
+void foo(int n) {
+	if (n > 0)
+		goto done;
+	n++;
+done:
+	n--;
+	if (n > 0)
+		goto done;
+}
+`},
+		{name: "BlockExitBreak", jumps: 0, code: `
+void foo(int n) {
+	while (n > 0) {
+		if (n == 2)
+			goto next;
+		if (n == 3)
+			break;
+		n--;
+next:
+		n--;
+	}
+}
+`},
+		{name: "BlockExitDecl", jumps: 0, code: `
+int foo(int n) {
+	if (n > 0)
+		goto done;
+	int m = n + 1;
+	n = m;
+done:
+	return n + m;
+}
+`},
+		{name: "BlockExitInto", jumps: 0, code: `
+void foo(int n) {
+	if (n > 0)
+		goto done;
+	n++;
+retry:
+	n--;
+done:
+	if (n > 0)
+		goto retry;
+}
+`},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			f, src := parse(c.code, nil)
+			ctx := &blockCtx{src: src}
+			fn := findNode(f, ast.FunctionDecl, "foo")
+			body := fn.Inner[len(fn.Inner)-1]
+			info := ctx.markComplicated("foo", body)
+			if len(info.jumps) != c.jumps {
+				t.Fatal("TestStructJump:", len(info.jumps), ", expect:", c.jumps)
+			}
+			for _, j := range info.jumps {
+				if j.tok != c.tok {
+					t.Fatal("TestStructJump:", j.tok, ", expect:", c.tok)
+				}
+			}
+			if c.jumps > 0 && info.needGoto {
+				t.Fatal("TestStructJump: needGoto")
+			}
+		})
+	}
+}
+
+// -----------------------------------------------------------------------------
@@ -1,7 +1,9 @@
 package cl
 
 import (
+	"go/token"
 	"log"
+	"sort"
 	"time"
 
 	"github.com/goplus/c2go/clang/ast"
@@ -99,6 +101,40 @@ func (p *labelCtx) useLabel(name string, at *blockMarkCtx) {
 	}
 }
 
+type gotoCtx struct {
+	stmt  *ast.Node
+	name  string
+	at    *blockMarkCtx
+	owner *ownerStmtCtx
+}
+
+// structJump represents a goto statement that can be expressed as a labeled
+// break or continue of an enclosing loop/switch statement, or as a labeled
+// break of a block exit.
+type structJump struct {
+	flow  *ast.Node   // the loop/switch statement, or the label of a block exit
+	tok   token.Token // token.BREAK or token.CONTINUE
+	block *ast.Node   // the compound statement of a block exit
+}
+
+// blockExit represents statements of a compound statement which are followed
+// by a label, such as `if (!p) goto fail; ...; fail: ...`. The statements are
+// compiled into a labeled `switch { default: ... }`, so that forward gotos to
+// the label can be compiled into labeled breaks.
+type blockExit struct {
+	body   *ast.Node // the compound statement
+	label  *ast.Node // the label stmt
+	start  int       // index of the first statement of the block in body
+	end    int       // index of the label stmt in body
+	gotos  [2]int    // range of markCtx.gotos in the block
+	labels [2]int    // range of markCtx.defs in the block
+}
+
+// markPos is the position of markCtx before marking a statement.
+type markPos struct {
+	gotos, escapes, defs int
+}
+
 type ownerStmtCtx struct {
 	parent *blockMarkCtx
 	stmt   *ast.Node
@@ -119,10 +155,24 @@ func (p *ownerStmtCtx) markComplicated(ctx *markCtx) *blockMarkCtx {
 	return nil
 }
 
+func (p *ownerStmtCtx) parentOwner() *ownerStmtCtx {
+	if at := p.parent; at != nil {
+		return at.owner
+	}
+	return nil
+}
+
 type markCtx struct {
 	current   *blockMarkCtx
 	owner     *ownerStmtCtx
 	labels    map[string]*labelCtx
+	gotos     []*gotoCtx
+	breaks    map[string]*ast.Node // label => loop/switch stmt just before the label
+	conts     map[string]*ast.Node // label => loop stmt whose body ends with the label
+	exits     map[string]*blockExit
+	escapes   []*ownerStmtCtx // owners of break/case stmts
+	defs      []string        // labels in order of definition
+	jumps     map[*ast.Node]*structJump
 	complicat bool
 }
 
@@ -169,14 +219,146 @@ func (p *markCtx) markSub(ctx *blockCtx, name string, stmt *ast.Node) {
 func (p *markCtx) markBody(ctx *blockCtx, stmt *ast.Node) {
 	switch stmt.Kind {
 	case ast.CompoundStmt:
-		for _, item := range stmt.Inner {
+		n := len(stmt.Inner)
+		marks := make([]markPos, n+1)
+		for i := 0; i < n; i++ {
+			item := stmt.Inner[i]
+			marks[i] = p.pos()
 			p.mark(ctx, item)
+			if i+1 < n {
+				p.checkBreakTarget(item, stmt.Inner[i+1])
+			}
 		}
+		marks[n] = p.pos()
+		p.checkBlockExits(stmt, marks)
 		return
 	}
 	p.mark(ctx, stmt)
 }
 
+func (p *markCtx) pos() markPos {
+	return markPos{gotos: len(p.gotos), escapes: len(p.escapes), defs: len(p.defs)}
+}
+
+// checkBlockExits records the block exits of body (see blockExit), whose
+// statements were marked at positions marks. A block begins with the statement
+// of the first goto to its label, and may begin earlier so that blocks nest.
+// It mustn't contain break/case stmts of enclosing statements, or declare
+// variables which are used after it.
+func (p *markCtx) checkBlockExits(body *ast.Node, marks []markPos) {
+	var exits []*blockExit
+	for end, item := range body.Inner {
+		if item.Kind != ast.LabelStmt {
+			continue
+		}
+		start := -1
+		for i := 0; i < end && start < 0; i++ {
+			for _, g := range p.gotos[marks[i].gotos:marks[i+1].gotos] {
+				if g.name == item.Name {
+					start = i
+					break
+				}
+			}
+		}
+		if start < 0 {
+			continue
+		}
+		for i := len(exits) - 1; i >= 0; i-- {
+			if e := exits[i]; e.start < start && start <= e.end {
+				start = e.start
+			}
+		}
+		if p.hasEscape(marks[start].escapes, marks[end].escapes) || declaresUsed(body.Inner, start, end) {
+			continue
+		}
+		e := &blockExit{
+			body: body, label: item, start: start, end: end,
+			gotos:  [2]int{marks[start].gotos, marks[end].gotos},
+			labels: [2]int{marks[start].defs, marks[end].defs},
+		}
+		p.exits[item.Name] = e
+		exits = append(exits, e)
+	}
+}
+
+// hasEscape checks if p.escapes[from:to] has a break/case stmt of a statement
+// enclosing the current block.
+func (p *markCtx) hasEscape(from, to int) bool {
+	for _, owner := range p.escapes[from:to] {
+		escape := true
+		for ; owner != p.owner; owner = owner.parentOwner() {
+			switch owner.stmt.Kind {
+			case ast.ForStmt, ast.WhileStmt, ast.DoStmt, ast.SwitchStmt:
+				escape = false
+			}
+		}
+		if escape {
+			return true
+		}
+	}
+	return false
+}
+
+// declaresUsed checks if stmts[start:end] declare anything which is used by
+// stmts[end:].
+func declaresUsed(stmts []*ast.Node, start, end int) bool {
+	ids := make(map[ast.ID]none)
+	for _, stmt := range stmts[start:end] {
+		if stmt.Kind == ast.DeclStmt {
+			for _, decl := range stmt.Inner {
+				if decl.Kind != ast.VarDecl { // such as a typedef
+					return true
+				}
+				ids[decl.ID] = none{}
+			}
+		}
+	}
+	return len(ids) > 0 && refersTo(stmts[end:], ids)
+}
+
+func refersTo(nodes []*ast.Node, ids map[ast.ID]none) bool {
+	for _, node := range nodes {
+		if node == nil {
+			continue
+		}
+		if ref := node.ReferencedDecl; ref != nil {
+			if _, ok := ids[ref.ID]; ok {
+				return true
+			}
+		}
+		if refersTo(node.Inner, ids) || refersTo(node.ArrayFiller, ids) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkBreakTarget records `flow; label: ...` so that `goto label` inside flow
+// can be compiled into `break flow`.
+func (p *markCtx) checkBreakTarget(flow, next *ast.Node) {
+	if next.Kind != ast.LabelStmt {
+		return
+	}
+	switch flow.Kind {
+	case ast.ForStmt, ast.WhileStmt, ast.DoStmt, ast.SwitchStmt:
+		p.breaks[next.Name] = flow
+	}
+}
+
+// checkContinueTarget records `loop { ...; label: ; }` so that `goto label`
+// inside loop can be compiled into `continue loop`.
+func (p *markCtx) checkContinueTarget(loop, body *ast.Node) {
+	if body.Kind != ast.CompoundStmt {
+		return
+	}
+	if n := len(body.Inner); n > 0 {
+		last := body.Inner[n-1]
+		if last.Kind == ast.LabelStmt && last.Inner[0].Kind == ast.NullStmt {
+			p.conts[last.Name] = loop
+		}
+	}
+}
+
 func (p *markCtx) mark(ctx *blockCtx, stmt *ast.Node) {
 	switch stmt.Kind {
 	case ast.IfStmt:
@@ -192,10 +374,12 @@ func (p *markCtx) mark(ctx *blockCtx, stmt *ast.Node) {
 		ret := p.enterOwner(stmt)
 		defer p.leaveOwner(ret)
 		p.markSub(ctx, "forBody", stmt.Inner[4])
+		p.checkContinueTarget(stmt, stmt.Inner[4])
 	case ast.WhileStmt:
 		ret := p.enterOwner(stmt)
 		defer p.leaveOwner(ret)
 		p.markSub(ctx, "whileBody", stmt.Inner[1])
+		p.checkContinueTarget(stmt, stmt.Inner[1])
 	case ast.DoStmt:
 		ret := p.enterOwner(stmt)
 		defer p.leaveOwner(ret)
@@ -203,15 +387,20 @@ func (p *markCtx) mark(ctx *blockCtx, stmt *ast.Node) {
 	case ast.LabelStmt:
 		name := stmt.Name
 		p.reqLabel(name).defineLabel(name, p.current)
+		p.defs = append(p.defs, name)
+		p.mark(ctx, stmt.Inner[0])
 	case ast.GotoStmt:
 		name := ctx.labelOfGoto(stmt)
-		p.reqLabel(name).useLabel(name, p.current)
+		p.gotos = append(p.gotos, &gotoCtx{stmt: stmt, name: name, at: p.current, owner: p.owner})
 	case ast.CompoundStmt:
 		ret := p.enterOwner(stmt)
 		defer p.leaveOwner(ret)
 		p.markSub(ctx, "blockBody", stmt)
 	case ast.CaseStmt, ast.DefaultStmt:
+		p.escapes = append(p.escapes, p.owner)
 		p.markSwitchComplicated()
+	case ast.BreakStmt:
+		p.escapes = append(p.escapes, p.owner)
 	}
 }
 
@@ -269,11 +458,94 @@ func (p *markCtx) markSwitch(ctx *blockCtx, switchStmt *ast.Node) {
 }
 
 func (p *markCtx) markEnd() {
-	for _, l := range p.labels {
-		for ref := range l.refs {
-			l.at.markComplicated(p, ref)
+	p.checkExitGotos()
+	for {
+		for _, l := range p.labels {
+			l.refs = nil
+		}
+		p.jumps = make(map[*ast.Node]*structJump)
+		for _, g := range p.gotos {
+			if j := p.structJumpOf(g); j != nil {
+				p.jumps[g.stmt] = j
+				continue
+			}
+			p.reqLabel(g.name).useLabel(g.name, g.at)
+		}
+		for _, l := range p.labels {
+			for ref := range l.refs {
+				l.at.markComplicated(p, ref)
+			}
+		}
+		if !p.hasInvalidJump() {
+			return
+		}
+	}
+}
+
+// structJumpOf checks if a goto statement can be expressed as a labeled
+// break/continue. The target loop/switch must enclose the goto statement and
+// must be compiled into a Go for/switch statement (that is, not complicated).
+func (p *markCtx) structJumpOf(g *gotoCtx) *structJump {
+	var flow *ast.Node
+	var tok token.Token
+	if flow = p.breaks[g.name]; flow != nil {
+		tok = token.BREAK
+	} else if flow = p.conts[g.name]; flow != nil {
+		tok = token.CONTINUE
+	} else {
+		return p.exitJumpOf(g)
+	}
+	if flow.Complicated {
+		return p.exitJumpOf(g)
+	}
+	for owner := g.owner; owner != nil; owner = owner.parentOwner() {
+		if owner.stmt == flow {
+			if debugMarkComplicated {
+				log.Println("--> goto", g.name, "=>", tok, flow.Kind)
+			}
+			return &structJump{flow: flow, tok: tok}
+		}
+	}
+	return p.exitJumpOf(g)
+}
+
+// exitJumpOf checks if a goto statement can be expressed as a labeled break of
+// a block exit. The compound statement of the block exit must not be
+// complicated.
+func (p *markCtx) exitJumpOf(g *gotoCtx) *structJump {
+	if e := p.exits[g.name]; e != nil && !e.body.Complicated {
+		if debugMarkComplicated {
+			log.Println("--> goto", g.name, "=> block exit")
+		}
+		return &structJump{flow: e.label, tok: token.BREAK, block: e.body}
+	}
+	return nil
+}
+
+// checkExitGotos removes the block exits which gotos from outside of them jump
+// to or into.
+func (p *markCtx) checkExitGotos() {
+	for name, e := range p.exits {
+		inner := make(map[string]bool)
+		for _, label := range p.defs[e.labels[0]:e.labels[1]] {
+			inner[label] = true
+		}
+		for i, g := range p.gotos {
+			if (g.name == name || inner[g.name]) && (i < e.gotos[0] || i >= e.gotos[1]) {
+				delete(p.exits, name)
+				break
+			}
+		}
+	}
+}
+
+func (p *markCtx) hasInvalidJump() bool {
+	for _, j := range p.jumps {
+		if j.flow.Complicated || (j.block != nil && j.block.Complicated) {
+			return true
 		}
 	}
+	return false
 }
 
 func (p *markCtx) markComplicated(stmt *ast.Node) {
@@ -287,18 +559,59 @@ func (p *markCtx) markComplicated(stmt *ast.Node) {
 	p.complicat = true
 }
 
-func (p *blockCtx) markComplicated(name string, body *ast.Node) bool {
+// flowInfo is the result of markComplicated.
+type flowInfo struct {
+	jumps       map[*ast.Node]*structJump // goto stmt => labeled break/continue
+	flows       map[*ast.Node]none        // loop/switch stmts and labels of block exits that need a label
+	exits       map[*ast.Node][]*ast.Node // first stmt of block exits => their labels, the outermost first
+	deadLabels  map[string]none           // labels that are not referred by any goto
+	complicated bool
+	needGoto    bool
+}
+
+func (p *blockCtx) markComplicated(name string, body *ast.Node) *flowInfo {
 	if debugMarkComplicated {
 		start := time.Now()
 		defer func() {
 			log.Printf("==> Marked %s: %v\n", name, time.Since(start))
 		}()
 	}
-	labels := make(map[string]*labelCtx)
-	marker := &markCtx{labels: labels}
+	marker := &markCtx{
+		labels: make(map[string]*labelCtx),
+		breaks: make(map[string]*ast.Node),
+		conts:  make(map[string]*ast.Node),
+		exits:  make(map[string]*blockExit),
+	}
 	marker.markBody(p, body)
 	marker.markEnd()
-	return marker.complicat
+	ret := &flowInfo{
+		jumps:       marker.jumps,
+		flows:       make(map[*ast.Node]none),
+		exits:       make(map[*ast.Node][]*ast.Node),
+		deadLabels:  make(map[string]none),
+		complicated: marker.complicat,
+		needGoto:    marker.complicat,
+	}
+	for _, j := range marker.jumps {
+		if _, ok := ret.flows[j.flow]; !ok && j.block != nil {
+			e := marker.exits[j.flow.Name]
+			ret.exits[e.body.Inner[e.start]] = append(ret.exits[e.body.Inner[e.start]], j.flow)
+		}
+		ret.flows[j.flow] = none{}
+	}
+	for _, labels := range ret.exits {
+		sort.Slice(labels, func(i, j int) bool {
+			return marker.exits[labels[i].Name].end > marker.exits[labels[j].Name].end
+		})
+	}
+	for name, l := range marker.labels {
+		if l.refs == nil {
+			ret.deadLabels[name] = none{}
+		} else {
+			ret.needGoto = true
+		}
+	}
+	return ret
 }
 
 // -----------------------------------------------------------------------------
@@ -0,0 +1,91 @@
+package cl
+
+import (
+	"go/token"
+	"go/types"
+	"log"
+	"strconv"
+
+	"github.com/goplus/c2go/clang/ast"
+)
+
+// -----------------------------------------------------------------------------
+// Variables of thread storage duration (`__thread`, `_Thread_local`) have a
+// copy per thread, which is a goroutine. They are declared as
+//
+//	var _cgo_tls_x T = init
+//	var x = libc.NewTLS(&_cgo_tls_x)
+//
+// and accessed as (*(*T)(x.Get())). A thread-local variable declared in a
+// function has static storage too, so it is declared in the package scope.
+
+type tlsVar struct {
+	holder types.Object // of type *libc.TLS
+	typ    types.Type
+}
+
+// newTLSVar declares a thread-local variable.
+func newTLSVar(ctx *blockCtx, typ types.Type, decl *ast.Node, global bool) {
+	if ctx.flat {
+		log.Panicln("TODO: thread-local variable in flat memory mode -", decl.Name)
+	}
+	pkg := ctx.pkg
+	scope := pkg.Types.Scope()
+	pos := goNodePos(decl)
+	tyTLS := types.NewPointer(pkg.Import(libcPkgPath).Ref("TLS").Type())
+	name, key := decl.Name, decl.Name
+	if !global {
+		name = "_cgo_tls" + strconv.Itoa(len(ctx.tlsvars)) + "_" + decl.Name
+		key = string(decl.ID)
+	}
+	if decl.StorageClass == ast.Extern {
+		holder := types.NewVar(pos, pkg.Types, name, tyTLS)
+		if old := scope.Insert(holder); old != nil {
+			holder = old.(*types.Var)
+		}
+		ctx.tlsvars[key] = &tlsVar{holder: holder, typ: typ}
+		return
+	}
+	init := "_cgo_tls_" + name
+	if !global {
+		init = name + "_init"
+	}
+	tmpl := pkg.NewVarDefs(scope).New(pos, typ, init)
+	ctx.declare(scope, init)
+	if len(decl.Inner) > 0 {
+		if _, ok := checkUnion(ctx, typ); ok {
+			log.Panicln("TODO: thread-local union with initializer -", decl.Name)
+		}
+		cb := tmpl.InitStart(pkg)
+		varInit(ctx, typ, decl.Inner[0])
+		cb.EndInit(1)
+	}
+	cb := pkg.NewVarDefs(scope).New(pos, tyTLS, name).InitStart(pkg)
+	ctx.declare(scope, name)
+	cb.Val(pkg.Import(libcPkgPath).Ref("NewTLS")).Val(scope.Lookup(init)).UnaryOp(token.AND).Call(1).EndInit(1)
+	ctx.tlsvars[key] = &tlsVar{holder: scope.Lookup(name), typ: typ}
+}
+
+// lookupTLS returns the thread-local variable which v refers to, or nil.
+func (p *blockCtx) lookupTLS(v *ast.Node) *tlsVar {
+	if tv, ok := p.tlsvars[string(v.ID)]; ok { // declared in a function
+		return tv
+	}
+	if tv, ok := p.tlsvars[p.ident(v.Name)]; ok && p.lookupParent(p.ident(v.Name)) == tv.holder {
+		return tv
+	}
+	return nil
+}
+
+// compileTLSRef compiles a reference to a thread-local variable.
+func compileTLSRef(ctx *blockCtx, tv *tlsVar, lhs bool) {
+	cb := ctx.cb
+	cb.Typ(types.NewPointer(tv.typ)).Val(tv.holder).MemberVal("Get").Call(0).Call(1)
+	if lhs {
+		cb.ElemRef()
+	} else {
+		cb.Elem()
+	}
+}
+
+// -----------------------------------------------------------------------------
@@ -28,7 +28,7 @@ func toType(ctx *blockCtx, typ *ast.Type, flags int) types.Type {
 
 func toTypeEx(ctx *blockCtx, scope *types.Scope, tyAnonym types.Type, typ *ast.Type, flags int) (t types.Type, kind int) {
 	conf := &parser.Config{
-		Pkg: ctx.pkg.Types, Scope: scope, Flags: flags,
+		Pkg: ctx.pkg.Types, Scope: scope, Flags: flags, Ident: ctx.typeIdent,
 		TyAnonym: tyAnonym, TyValist: ctx.tyValist, TyInt128: ctx.tyI128, TyUint128: ctx.tyU128,
 	}
 retry:
@@ -36,10 +36,14 @@ retry:
 	if err != nil {
 		if e, ok := err.(*parser.TypeNotFound); ok && e.StructOrUnion {
 			ctx.typdecls[e.Literal] = ctx.cb.NewType(e.Literal)
+			ctx.declare(ctx.cb.Scope(), e.Literal)
 			goto retry
 		}
 		log.Panicln("toType:", err, "-", typ.QualType)
 	}
+	if ctx.flat {
+		t = ctx.flatType(t)
+	}
 	return
 }
 
@@ -54,7 +58,8 @@ func toStructType(ctx *blockCtx, t *types.Named, struc *ast.Node) *types.Struct
 			if debugCompileDecl {
 				log.Println("  => field", decl.Name, "-", decl.Type.QualType)
 			}
-			avoidKeyword(&decl.Name)
+			decl.Name = ctx.ident(decl.Name)
+			ctx.doc(decl, t.Obj().Name()+"."+decl.Name)
 			typ, _ := toTypeEx(ctx, scope, nil, decl.Type, parser.FlagIsField)
 			if decl.IsBitfield {
 				bits := toInt64(ctx, decl.Inner[0], "non-constant bit field")
@@ -75,7 +80,7 @@ func toStructType(ctx *blockCtx, t *types.Named, struc *ast.Node) *types.Struct
 						b.Field(ctx, goNodePos(decl), typ, name, true)
 						i++
 					} else if ret, ok := checkAnonymous(ctx, scope, typ, next); ok {
-						b.Field(ctx, goNodePos(next), ret, next.Name, false)
+						b.Field(ctx, goNodePos(next), ret, ctx.ident(next.Name), false)
 						i++
 						continue
 					}
@@ -101,6 +106,8 @@ func toUnionType(ctx *blockCtx, t *types.Named, unio *ast.Node) types.Type {
 			if debugCompileDecl {
 				log.Println("  => field", decl.Name, "-", decl.Type.QualType)
 			}
+			decl.Name = ctx.ident(decl.Name)
+			ctx.doc(decl, t.Obj().Name()+"."+decl.Name)
 			typ, _ := toTypeEx(ctx, scope, nil, decl.Type, 0)
 			b.Field(ctx, goNodePos(decl), typ, decl.Name, false)
 		case ast.RecordDecl:
@@ -116,7 +123,7 @@ func toUnionType(ctx *blockCtx, t *types.Named, unio *ast.Node) types.Type {
 						b.Field(ctx, goNodePos(decl), typ, name, true)
 						i++
 					} else if ret, ok := checkAnonymous(ctx, scope, typ, next); ok {
-						b.Field(ctx, goNodePos(next), ret, next.Name, false)
+						b.Field(ctx, goNodePos(next), ret, ctx.ident(next.Name), false)
 						i++
 						continue
 					}
@@ -140,7 +147,8 @@ func checkAnonymous(ctx *blockCtx, scope *types.Scope, typ types.Type, v *ast.No
 // -----------------------------------------------------------------------------
 
 func compileTypedef(ctx *blockCtx, decl *ast.Node) {
-	name, qualType := decl.Name, decl.Type.QualType
+	name, qualType := ctx.typedefIdent(decl.Name), decl.Type.QualType
+	ctx.doc(decl, name)
 	if debugCompileDecl {
 		log.Println("typedef", name, "-", qualType, decl.Loc.PresumedLine)
 	}
@@ -150,6 +158,7 @@ func compileTypedef(ctx *blockCtx, decl *ast.Node) {
 			if owned := item.OwnedTagDecl; owned != nil && owned.Name == "" {
 				if owned.Kind == ast.EnumDecl {
 					ctx.cb.AliasType(name, ctypes.Enum, goNodePos(decl))
+					ctx.declare(ctx.cb.Scope(), name)
 					return
 				}
 				id := owned.ID
@@ -167,16 +176,25 @@ func compileTypedef(ctx *blockCtx, decl *ast.Node) {
 		return
 	}
 	ctx.cb.AliasType(name, typ, goNodePos(decl))
+	ctx.declare(ctx.cb.Scope(), name)
 }
 
 func compileStructOrUnion(ctx *blockCtx, name string, decl *ast.Node) *types.Named {
 	if debugCompileDecl {
 		log.Println(decl.TagUsed, name, "-", decl.Loc.PresumedLine)
 	}
+	if t := ctx.libcType(name); t != nil { // implemented by a runtime package
+		if ctx.cb.Scope().Lookup(name) == nil {
+			aliasType(ctx.cb.Scope(), ctx.pkg.Types, name, t)
+		}
+		return t
+	}
+	ctx.doc(decl, name)
 	t, decled := ctx.typdecls[name]
 	if !decled {
 		t = ctx.cb.NewType(name, goNodePos(decl))
 		ctx.typdecls[name] = t
+		ctx.declare(ctx.cb.Scope(), name)
 	}
 	if decl.CompleteDefinition {
 		var inner types.Type
@@ -203,6 +221,13 @@ func compileEnum(ctx *blockCtx, decl *ast.Node) {
 func compileEnumConst(ctx *blockCtx, cdecl *gox.ConstDefs, v *ast.Node, iotav int) int {
 	fn := func(cb *gox.CodeBuilder) int {
 		if len(v.Inner) > 0 {
+			if init := v.Inner[0]; init.Kind == ast.ConstantExpr && init.Value != nil { // value evaluated by clang, such as `0 < 8 ? 1 << 8 : 1 >> 8`
+				if ival, err := strconv.ParseInt(init.Value.(string), 0, 64); err == nil {
+					cb.Val(int(ival))
+					iotav = int(ival)
+					return 1
+				}
+			}
 			compileExpr(ctx, v.Inner[0])
 			cval := cb.Get(-1).CVal
 			if cval == nil {
@@ -218,7 +243,10 @@ func compileEnumConst(ctx *blockCtx, cdecl *gox.ConstDefs, v *ast.Node, iotav in
 		}
 		return 1
 	}
-	cdecl.New(fn, iotav, goNodePos(v), ctypes.Enum, v.Name)
+	name := ctx.ident(v.Name)
+	ctx.doc(v, name)
+	cdecl.New(fn, iotav, goNodePos(v), ctypes.Enum, name)
+	ctx.declare(ctx.cb.Scope(), name)
 	return iotav + 1
 }
 
@@ -232,14 +260,40 @@ func compileVarDecl(ctx *blockCtx, decl *ast.Node, global bool) {
 	}
 	scope := ctx.cb.Scope()
 	typ, kind := toTypeEx(ctx, scope, nil, decl.Type, flags)
-	avoidKeyword(&decl.Name)
+	if global {
+		ctx.doc(decl, ctx.ident(decl.Name))
+	}
+	if global && ctx.bind != nil {
+		bindVar(ctx, scope, typ, decl)
+		return
+	}
+	cname := decl.Name
+	decl.Name = ctx.ident(cname)
+	if decl.TLS != "" {
+		newTLSVar(ctx, typ, decl, global)
+		return
+	}
 	if flags == parser.FlagIsExtern {
-		scope.Insert(types.NewVar(goNodePos(decl), ctx.pkg.Types, decl.Name, typ))
+		ctx.useHeader(decl)
+		if ctx.bindLibc(cname, typ) { // bound to a runtime package
+			return
+		}
+		if ctx.isArenaVar(decl, true) { // address of an arena variable
+			typ = tyUintptr
+			ctx.garenas[decl.Name] = none{}
+		}
+		if scope.Insert(types.NewVar(goNodePos(decl), ctx.pkg.Types, decl.Name, typ)) == nil {
+			ctx.extvars[decl.Name] = none{}
+		}
 	} else {
-		if (kind&parser.KindFConst) != 0 && isInteger(typ) && tryNewConstInteger(ctx, typ, decl) {
+		if global {
+			delete(ctx.extvars, decl.Name)
+		}
+		if (kind&parser.KindFConst) != 0 && isInteger(typ) && !ctx.isArenaVar(decl, global) &&
+			tryNewConstInteger(ctx, typ, decl) {
 			return
 		}
-		if ctx.isValistType(typ) { // skip valist variable
+		if ctx.isValistType(typ) && !decl.IsUsed { // skip unused valist variable
 			scope.Insert(types.NewVar(token.NoPos, ctx.pkg.Types, decl.Name, typ))
 			return
 		}
@@ -247,14 +301,6 @@ func compileVarDecl(ctx *blockCtx, decl *ast.Node, global bool) {
 	}
 }
 
-func avoidKeyword(name *string) {
-	switch *name {
-	case "map", "type", "range", "chan", "var", "func", "go", "select",
-		"defer", "package", "import", "interface", "fallthrough":
-		*name += "_"
-	}
-}
-
 func compileVarWith(ctx *blockCtx, typ types.Type, decl *ast.Node) {
 	scope := ctx.cb.Scope()
 	newVarAndInit(ctx, scope, typ, decl, false)
@@ -264,6 +310,10 @@ func newVarAndInit(ctx *blockCtx, scope *types.Scope, typ types.Type, decl *ast.
 	if debugCompileDecl {
 		log.Println("var", decl.Name, typ, "-", decl.Kind)
 	}
+	if inGlobal := scope == ctx.pkg.Types.Scope(); ctx.isArenaVar(decl, inGlobal) {
+		newArenaVar(ctx, scope, typ, decl, inGlobal)
+		return
+	}
 	varDecl, inVBlock := ctx.newVar(scope, goNodePos(decl), typ, decl.Name)
 	if len(decl.Inner) > 0 {
 		initExpr := decl.Inner[0]
@@ -309,6 +359,9 @@ retry:
 }
 
 func varAssign(ctx *blockCtx, scope *types.Scope, typ types.Type, name string, initExpr *ast.Node) {
+	if ctx.curfn != nil {
+		defer ctx.restoreLift(ctx.setLift(true))
+	}
 	addr := gox.Lookup(scope, name)
 	cb := ctx.cb.VarRef(addr)
 	varInit(ctx, typ, initExpr)
@@ -457,6 +510,10 @@ func isBool(typ types.Type) bool {
 	return isKind(typ, types.IsBoolean)
 }
 
+func isUntyped(typ types.Type) bool {
+	return isKind(typ, types.IsUntyped)
+}
+
 func isKind(typ types.Type, mask types.BasicInfo) bool {
 	if t, ok := typ.(*types.Basic); ok {
 		return (t.Info() & mask) != 0
@@ -327,6 +327,53 @@ void test() {
 	typedef __builtin_va_list foo;
 }
 `, `func test() {
+}`)
+	testFunc(t, "testVaStart", `
+void vlog(const char *fmt, __builtin_va_list ap);
+
+void test(const char *fmt, ...) {
+	__builtin_va_list ap, aq;
+	__builtin_va_start(ap, fmt);
+	__builtin_va_copy(aq, ap);
+	vlog(fmt, aq);
+	__builtin_va_end(aq);
+	vlog(fmt, ap);
+	__builtin_va_end(ap);
+}
+`, `func test(fmt *int8, __cgo_args ...interface {
+}) {
+	var ap *clang.VaList
+	var aq *clang.VaList
+	ap = clang.NewVaList(__cgo_args)
+	aq = ap.Copy()
+	vlog(fmt, aq.Args()...)
+	aq.End()
+	vlog(fmt, ap.Args()...)
+	ap.End()
+}`)
+	testFunc(t, "testVaArg", `
+void test(int n, __builtin_va_list ap) {
+	char c = __builtin_va_arg(ap, int);
+	unsigned long l = __builtin_va_arg(ap, unsigned long);
+	double d = __builtin_va_arg(ap, double);
+	char *s = __builtin_va_arg(ap, char*);
+}
+`, `func test(n int32, __cgo_args ...interface {
+}) {
+	var ap *clang.VaList = clang.NewVaList(__cgo_args)
+	var c int8 = int8(ap.Int32("test.c:3:11"))
+	var l uint64 = ap.Uint64("test.c:4:20")
+	var d float64 = ap.Float64("test.c:5:13")
+	var s *int8 = (*int8)(ap.Pointer("test.c:6:12"))
+}`)
+	testFunc(t, "testVaPromote", `
+void log(const char *fmt, ...);
+
+void test() {
+	log("", 1, 2L, 3.0, 'c');
+}
+`, `func test() {
+	log((*int8)(unsafe.Pointer(&[1]int8{'\x00'})), int32(1), int64(2), float64(3), int32('c'))
 }`)
 }
 
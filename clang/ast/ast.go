@@ -75,6 +75,9 @@ const (
 	MaxFieldAlignmentAttr    Kind = "MaxFieldAlignmentAttr"
 	WarnUnusedResultAttr     Kind = "WarnUnusedResultAttr"
 	AllocSizeAttr            Kind = "AllocSizeAttr"
+	AllocAlignAttr           Kind = "AllocAlignAttr"
+	C11NoReturnAttr          Kind = "C11NoReturnAttr"
+	WeakAttr                 Kind = "WeakAttr"
 	AlignedAttr              Kind = "AlignedAttr"
 	FunctionProtoType        Kind = "FunctionProtoType"
 	FunctionDecl             Kind = "FunctionDecl"
@@ -119,6 +122,21 @@ const (
 	StringLiteral            Kind = "StringLiteral"
 	FloatingLiteral          Kind = "FloatingLiteral"
 	ImaginaryLiteral         Kind = "ImaginaryLiteral"
+
+	// Comments of declarations (see parser.ParseComments). A FullComment is an
+	// inner node of the declaration it documents.
+	FullComment              Kind = "FullComment"
+	ParagraphComment         Kind = "ParagraphComment"
+	TextComment              Kind = "TextComment"
+	InlineCommandComment     Kind = "InlineCommandComment" // such as \c word
+	HTMLStartTagComment      Kind = "HTMLStartTagComment"
+	HTMLEndTagComment        Kind = "HTMLEndTagComment"
+	BlockCommandComment      Kind = "BlockCommandComment" // such as @brief and @return
+	ParamCommandComment      Kind = "ParamCommandComment"
+	TParamCommandComment     Kind = "TParamCommandComment"
+	VerbatimBlockComment     Kind = "VerbatimBlockComment" // such as @code ... @endcode
+	VerbatimBlockLineComment Kind = "VerbatimBlockLineComment"
+	VerbatimLineComment      Kind = "VerbatimLineComment" // such as @fn
 )
 
 type ValueCategory string
@@ -141,6 +159,15 @@ const (
 	Extern StorageClass = "extern"
 )
 
+// TLSKind is the thread storage duration of a VarDecl: `__thread` and
+// `_Thread_local` are "static".
+type TLSKind string
+
+const (
+	TLSStatic  TLSKind = "static"
+	TLSDynamic TLSKind = "dynamic"
+)
+
 type CastKind string
 
 const (
@@ -203,6 +230,7 @@ type Node struct {
 	IsBitfield           bool          `json:"isBitfield,omitempty"`
 	Inline               bool          `json:"inline,omitempty"`
 	StorageClass         StorageClass  `json:"storageClass,omitempty"`
+	TLS                  TLSKind       `json:"tls,omitempty"`
 	TagUsed              string        `json:"tagUsed,omitempty"` // struct | union
 	HasElse              bool          `json:"hasElse,omitempty"`
 	CompleteDefinition   bool          `json:"completeDefinition,omitempty"`
@@ -219,7 +247,10 @@ type Node struct {
 	ValueCategory        ValueCategory `json:"valueCategory,omitempty"`
 	Value                interface{}   `json:"value,omitempty"`
 	CastKind             CastKind      `json:"castKind,omitempty"`
-	Size                 int           `json:"size,omitempty"` // array size
+	Size                 int           `json:"size,omitempty"`  // array size
+	Text                 string        `json:"text,omitempty"`  // text of a comment
+	Param                string        `json:"param,omitempty"` // parameter of a ParamCommandComment
+	Args                 []string      `json:"args,omitempty"`  // arguments of an InlineCommandComment
 	Inner                []*Node       `json:"inner,omitempty"`
 	ArrayFiller          []*Node       `json:"array_filler,omitempty"`
 }
@@ -0,0 +1,227 @@
+// Package checked implements the runtime of code translated with
+// cl.Config.CheckedPointers. Blocks returned by its allocator carry
+// provenance (base, length and a freed flag), so that pointer arithmetic and
+// dereferences through them can be checked. Violations panic with an *Error
+// which reports the C source position of the faulting expression.
+//
+// Freed blocks are kept in quarantine, so that their memory isn't reused while
+// uses after free and double frees of them can be detected. The oldest freed
+// blocks are forgotten once the quarantine exceeds its size (see quarantine).
+//
+// Pointers into memory which is not allocated by this package (Go variables,
+// for example) are only checked for NULL.
+package checked
+
+import (
+	"math/bits"
+	"sort"
+	"sync"
+	"unsafe"
+
+	c "github.com/goplus/c2go/clang"
+)
+
+// -----------------------------------------------------------------------------
+
+// Error is the panic value of a pointer check failure.
+type Error struct {
+	Pos string // C source position: file:line:col
+	Msg string
+}
+
+func (p *Error) Error() string {
+	if p.Pos == "" {
+		return p.Msg
+	}
+	return p.Pos + ": " + p.Msg
+}
+
+func fail(pos, msg string) {
+	panic(&Error{Pos: pos, Msg: msg})
+}
+
+// -----------------------------------------------------------------------------
+
+type block struct {
+	base  uintptr
+	end   uintptr
+	freed bool
+	data  []unsafe.Pointer // keeps memory alive (and not reused) in quarantine
+}
+
+// quarantine is the maximum total size of freed blocks which are kept.
+var quarantine uintptr = 64 << 20
+
+var (
+	mutex  sync.Mutex
+	blocks []*block // sorted by base
+	freed  []*block // freed blocks in quarantine, the oldest first
+	nfreed uintptr  // total size of freed blocks in quarantine
+)
+
+func find(p uintptr) *block {
+	mutex.Lock()
+	defer mutex.Unlock()
+	i := sort.Search(len(blocks), func(i int) bool {
+		return blocks[i].base > p
+	})
+	if i > 0 {
+		if b := blocks[i-1]; p <= b.end {
+			return b
+		}
+	}
+	return nil
+}
+
+func alloc(n uintptr) unsafe.Pointer {
+	words := (n+7)/8 + 1 // padding: the end of a block is never the base of another
+	data := make([]unsafe.Pointer, words)
+	base := uintptr(unsafe.Pointer(&data[0]))
+	b := &block{base: base, end: base + n, data: data}
+	mutex.Lock()
+	i := sort.Search(len(blocks), func(i int) bool {
+		return blocks[i].base > base
+	})
+	blocks = append(blocks, nil)
+	copy(blocks[i+1:], blocks[i:])
+	blocks[i] = b
+	mutex.Unlock()
+	return unsafe.Pointer(&data[0])
+}
+
+// release puts the freed block b in quarantine and forgets the oldest freed
+// blocks beyond its size, except b itself. mutex must be held.
+func release(b *block) {
+	freed = append(freed, b)
+	nfreed += b.end - b.base
+	for nfreed > quarantine && len(freed) > 1 {
+		old := freed[0]
+		freed[0] = nil
+		freed = freed[1:]
+		nfreed -= old.end - old.base
+		i := sort.Search(len(blocks), func(i int) bool {
+			return blocks[i].base >= old.base
+		})
+		copy(blocks[i:], blocks[i+1:])
+		blocks[len(blocks)-1] = nil
+		blocks = blocks[:len(blocks)-1]
+	}
+}
+
+// -----------------------------------------------------------------------------
+
+// Add returns p+off and checks that the result stays within the block of p
+// (the position just past the end of the block is allowed).
+func Add(p unsafe.Pointer, off int, pos string) unsafe.Pointer {
+	if p == nil {
+		if off == 0 {
+			return nil
+		}
+		fail(pos, "pointer arithmetic on NULL pointer")
+	}
+	addr := uintptr(p)
+	if b := find(addr); b != nil {
+		if b.freed {
+			fail(pos, "pointer arithmetic on freed memory")
+		}
+		if q := int(addr-b.base) + off; q < 0 || q > int(b.end-b.base) {
+			fail(pos, "pointer arithmetic out of bounds")
+		}
+	}
+	return unsafe.Pointer(uintptr(p) + uintptr(off))
+}
+
+// Deref checks that size bytes at p can be accessed and returns p.
+func Deref(p unsafe.Pointer, size uintptr, pos string) unsafe.Pointer {
+	if p == nil {
+		fail(pos, "NULL pointer dereference")
+	}
+	addr := uintptr(p)
+	if b := find(addr); b != nil {
+		if b.freed {
+			fail(pos, "use after free")
+		}
+		if addr+size > b.end {
+			fail(pos, "access out of bounds")
+		}
+	}
+	return p
+}
+
+// Index checks that 0 <= i < n and returns i.
+func Index(i, n int, pos string) int {
+	if i < 0 || i >= n {
+		fail(pos, "array index out of bounds")
+	}
+	return i
+}
+
+// NonNull checks that the parameter param of a function declared nonnull isn't
+// NULL on entry.
+func NonNull(p unsafe.Pointer, param, pos string) {
+	if p == nil {
+		fail(pos, "NULL passed as nonnull parameter "+param)
+	}
+}
+
+// -----------------------------------------------------------------------------
+
+func Malloc(n c.SizeT) unsafe.Pointer {
+	return alloc(uintptr(n))
+}
+
+// Calloc returns NULL if n*size overflows.
+func Calloc(n, size c.SizeT) unsafe.Pointer {
+	hi, lo := bits.Mul64(uint64(n), uint64(size))
+	if hi != 0 {
+		return nil
+	}
+	return alloc(uintptr(lo))
+}
+
+func Realloc(p unsafe.Pointer, n c.SizeT) unsafe.Pointer {
+	ret := alloc(uintptr(n))
+	if p != nil {
+		b := checkFree(p, "realloc")
+		size := b.end - b.base
+		if uintptr(n) < size {
+			size = uintptr(n)
+		}
+		copy(bytesOf(ret, size), bytesOf(p, size))
+	}
+	return ret
+}
+
+func Free(p unsafe.Pointer) {
+	if p != nil {
+		checkFree(p, "free")
+	}
+}
+
+func checkFree(p unsafe.Pointer, fn string) *block {
+	addr := uintptr(p)
+	b := find(addr)
+	if b == nil || b.base != addr {
+		fail("", fn+": invalid pointer")
+	}
+	mutex.Lock()
+	wasFreed := b.freed
+	if !wasFreed {
+		b.freed = true
+		release(b)
+	}
+	mutex.Unlock()
+	if wasFreed {
+		fail("", fn+": double free")
+	}
+	return b
+}
+
+func bytesOf(p unsafe.Pointer, n uintptr) []byte {
+	if n == 0 {
+		return nil
+	}
+	return (*[1 << 30]byte)(p)[:n:n]
+}
+
+// -----------------------------------------------------------------------------
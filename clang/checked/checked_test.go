@@ -0,0 +1,121 @@
+package checked
+
+import (
+	"testing"
+	"unsafe"
+)
+
+// -----------------------------------------------------------------------------
+
+func expectError(t *testing.T, msg string, fn func()) {
+	t.Helper()
+	defer func() {
+		e, ok := recover().(*Error)
+		if !ok || e.Error() != msg {
+			t.Fatalf("expect error %q, got %v", msg, e)
+		}
+	}()
+	fn()
+}
+
+func TestAdd(t *testing.T) {
+	p := Malloc(16)
+	if q := Add(p, 16, "a.c:1:1"); uintptr(q)-uintptr(p) != 16 {
+		t.Fatal("Add:", p, q)
+	}
+	expectError(t, "a.c:1:2: pointer arithmetic out of bounds", func() {
+		Add(p, 17, "a.c:1:2")
+	})
+	expectError(t, "a.c:1:3: pointer arithmetic out of bounds", func() {
+		Add(Add(p, 8, ""), -9, "a.c:1:3")
+	})
+	expectError(t, "a.c:1:4: pointer arithmetic on NULL pointer", func() {
+		Add(nil, 1, "a.c:1:4")
+	})
+	var x [2]int32
+	if q := Add(unsafe.Pointer(&x), 100, ""); uintptr(q) != uintptr(unsafe.Pointer(&x))+100 {
+		t.Fatal("Add: untracked memory")
+	}
+	Free(p)
+	expectError(t, "a.c:1:5: pointer arithmetic on freed memory", func() {
+		Add(p, 1, "a.c:1:5")
+	})
+}
+
+func TestDeref(t *testing.T) {
+	p := Calloc(2, 4)
+	*(*int32)(Deref(Add(p, 4, ""), 4, "")) = 1
+	expectError(t, "a.c:2:1: access out of bounds", func() {
+		Deref(Add(p, 8, ""), 4, "a.c:2:1")
+	})
+	expectError(t, "a.c:2:2: NULL pointer dereference", func() {
+		Deref(nil, 4, "a.c:2:2")
+	})
+	q := Realloc(p, 16)
+	if *(*int32)(Deref(Add(q, 4, ""), 4, "")) != 1 {
+		t.Fatal("Realloc: data not copied")
+	}
+	expectError(t, "a.c:2:3: use after free", func() {
+		Deref(p, 4, "a.c:2:3")
+	})
+	Free(q)
+	expectError(t, "free: double free", func() {
+		Free(q)
+	})
+	r := Malloc(8)
+	expectError(t, "free: invalid pointer", func() {
+		Free(Add(r, 4, ""))
+	})
+	Free(r)
+}
+
+func TestAdjacent(t *testing.T) {
+	for i := 0; i < 16; i++ {
+		p, q := Malloc(16), Malloc(16)
+		Free(q)
+		expectError(t, "a.c:4:1: access out of bounds", func() {
+			Deref(Add(p, 16, ""), 4, "a.c:4:1")
+		})
+		Free(p)
+	}
+}
+
+func TestQuarantine(t *testing.T) {
+	defer func(old uintptr) { quarantine = old }(quarantine)
+	quarantine = 64
+	var ps []unsafe.Pointer
+	for i := 0; i < 16; i++ {
+		ps = append(ps, Malloc(16))
+	}
+	for _, p := range ps {
+		Free(p)
+	}
+	if len(freed) != 4 || nfreed != 64 || find(uintptr(ps[11])) != nil {
+		t.Fatal("quarantine:", len(freed), nfreed)
+	}
+	expectError(t, "a.c:5:1: use after free", func() {
+		Deref(ps[15], 4, "a.c:5:1")
+	})
+	if Calloc(1<<32, 1<<32) != nil {
+		t.Fatal("Calloc: overflow not detected")
+	}
+}
+
+func TestIndex(t *testing.T) {
+	if Index(2, 3, "") != 2 {
+		t.Fatal("Index")
+	}
+	expectError(t, "a.c:3:1: array index out of bounds", func() {
+		Index(3, 3, "a.c:3:1")
+	})
+}
+
+func TestNonNull(t *testing.T) {
+	var x int
+	NonNull(unsafe.Pointer(&x), "p", "")
+	expectError(t, "a.c:1:1: NULL passed as nonnull parameter p", func() {
+		NonNull(nil, "p", "a.c:1:1")
+	})
+}
+
+// -----------------------------------------------------------------------------
@@ -0,0 +1,14 @@
+//go:build !linux && !darwin
+// +build !linux,!darwin
+
+package libc
+
+import (
+	"time"
+)
+
+// cputime returns the CPU time used by the process. It is approximated by
+// the wall time since the process started.
+func cputime() time.Duration {
+	return time.Since(started)
+}
@@ -0,0 +1,129 @@
+package libc
+
+import (
+	c "github.com/goplus/c2go/clang"
+)
+
+// -----------------------------------------------------------------------------
+// Character classification of the C locale. Macros of glibc ctype.h look up
+// the tables of __ctype_b_loc, __ctype_tolower_loc and __ctype_toupper_loc,
+// which are indexed by characters from -128 (signed char) to 255.
+
+const (
+	ctypeUpper  = 1 << 8 // _ISbit(0) .. _ISbit(11) of little endian glibc
+	ctypeLower  = 1 << 9
+	ctypeAlpha  = 1 << 10
+	ctypeDigit  = 1 << 11
+	ctypeXdigit = 1 << 12
+	ctypeSpace  = 1 << 13
+	ctypePrint  = 1 << 14
+	ctypeGraph  = 1 << 15
+	ctypeBlank  = 1 << 0
+	ctypeCntrl  = 1 << 1
+	ctypePunct  = 1 << 2
+	ctypeAlnum  = 1 << 3
+)
+
+var (
+	ctypeB       [384]uint16
+	ctypeTolower [384]c.Int
+	ctypeToupper [384]c.Int
+
+	ctypeBPtr       = &ctypeB[128]
+	ctypeTolowerPtr = &ctypeTolower[128]
+	ctypeToupperPtr = &ctypeToupper[128]
+)
+
+func init() {
+	for i := range ctypeB {
+		ch := i - 128
+		ctypeTolower[i], ctypeToupper[i] = c.Int(ch), c.Int(ch)
+		if ch < 0 {
+			if ch != -1 { // signed char maps to unsigned char, except EOF
+				ctypeTolower[i], ctypeToupper[i] = c.Int(ch+256), c.Int(ch+256)
+			}
+			continue
+		}
+		var mask uint16
+		switch {
+		case ch >= 'A' && ch <= 'Z':
+			mask |= ctypeUpper | ctypeAlpha | ctypeAlnum
+			ctypeTolower[i] = c.Int(ch + 'a' - 'A')
+		case ch >= 'a' && ch <= 'z':
+			mask |= ctypeLower | ctypeAlpha | ctypeAlnum
+			ctypeToupper[i] = c.Int(ch - 'a' + 'A')
+		case ch >= '0' && ch <= '9':
+			mask |= ctypeDigit | ctypeAlnum
+		}
+		if (ch >= '0' && ch <= '9') || (ch|0x20 >= 'a' && ch|0x20 <= 'f') {
+			mask |= ctypeXdigit
+		}
+		switch {
+		case ch == ' ':
+			mask |= ctypeSpace | ctypeBlank | ctypePrint
+		case ch == '\t':
+			mask |= ctypeSpace | ctypeBlank | ctypeCntrl
+		case ch >= '\n' && ch <= '\r':
+			mask |= ctypeSpace | ctypeCntrl
+		case ch < 0x20 || ch == 0x7f:
+			mask |= ctypeCntrl
+		case ch < 0x7f:
+			mask |= ctypePrint | ctypeGraph
+			if mask&ctypeAlnum == 0 {
+				mask |= ctypePunct
+			}
+		}
+		ctypeB[i] = mask
+	}
+}
+
+// CtypeBLoc implements __ctype_b_loc.
+func CtypeBLoc() **uint16 {
+	return &ctypeBPtr
+}
+
+// CtypeTolowerLoc implements __ctype_tolower_loc.
+func CtypeTolowerLoc() **c.Int {
+	return &ctypeTolowerPtr
+}
+
+// CtypeToupperLoc implements __ctype_toupper_loc.
+func CtypeToupperLoc() **c.Int {
+	return &ctypeToupperPtr
+}
+
+func ctype(ch c.Int, mask uint16) c.Int {
+	if ch < -128 || ch > 255 {
+		return 0
+	}
+	return c.Int(ctypeB[ch+128] & mask)
+}
+
+func Isalnum(ch c.Int) c.Int  { return ctype(ch, ctypeAlnum) }
+func Isalpha(ch c.Int) c.Int  { return ctype(ch, ctypeAlpha) }
+func Isblank(ch c.Int) c.Int  { return ctype(ch, ctypeBlank) }
+func Iscntrl(ch c.Int) c.Int  { return ctype(ch, ctypeCntrl) }
+func Isdigit(ch c.Int) c.Int  { return ctype(ch, ctypeDigit) }
+func Isgraph(ch c.Int) c.Int  { return ctype(ch, ctypeGraph) }
+func Islower(ch c.Int) c.Int  { return ctype(ch, ctypeLower) }
+func Isprint(ch c.Int) c.Int  { return ctype(ch, ctypePrint) }
+func Ispunct(ch c.Int) c.Int  { return ctype(ch, ctypePunct) }
+func Isspace(ch c.Int) c.Int  { return ctype(ch, ctypeSpace) }
+func Isupper(ch c.Int) c.Int  { return ctype(ch, ctypeUpper) }
+func Isxdigit(ch c.Int) c.Int { return ctype(ch, ctypeXdigit) }
+
+func Tolower(ch c.Int) c.Int {
+	if ch < -128 || ch > 255 {
+		return ch
+	}
+	return ctypeTolower[ch+128]
+}
+
+func Toupper(ch c.Int) c.Int {
+	if ch < -128 || ch > 255 {
+		return ch
+	}
+	return ctypeToupper[ch+128]
+}
+
+// -----------------------------------------------------------------------------
@@ -0,0 +1,91 @@
+package libc
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+
+	c "github.com/goplus/c2go/clang"
+)
+
+// -----------------------------------------------------------------------------
+
+// errno is the C errno. It is thread-local.
+var errno = NewTLS(new(c.Int))
+
+const (
+	EPERM     = c.Int(syscall.EPERM)
+	ENOENT    = c.Int(syscall.ENOENT)
+	ESRCH     = c.Int(syscall.ESRCH)
+	EIO       = c.Int(syscall.EIO)
+	EBADF     = c.Int(syscall.EBADF)
+	EAGAIN    = c.Int(syscall.EAGAIN)
+	EACCES    = c.Int(syscall.EACCES)
+	EBUSY     = c.Int(syscall.EBUSY)
+	EEXIST    = c.Int(syscall.EEXIST)
+	EINVAL    = c.Int(syscall.EINVAL)
+	ENOSPC    = c.Int(syscall.ENOSPC)
+	EDOM      = c.Int(syscall.EDOM)
+	ERANGE    = c.Int(syscall.ERANGE)
+	EDEADLK   = c.Int(syscall.EDEADLK)
+	ETIMEDOUT = c.Int(syscall.ETIMEDOUT)
+)
+
+const (
+	SEEK_SET = 0
+	SEEK_CUR = 1
+	SEEK_END = 2
+)
+
+// ErrnoLocation implements __errno_location (glibc) and __error (macOS),
+// which errno expands to. Every thread has its own errno.
+func ErrnoLocation() *c.Int {
+	return (*c.Int)(errno.Get())
+}
+
+// seterr sets errno by err and returns -1.
+func seterr(err error) c.Int {
+	var e syscall.Errno
+	if errors.As(err, &e) {
+		*ErrnoLocation() = c.Int(e)
+	} else {
+		*ErrnoLocation() = EIO
+	}
+	return -1
+}
+
+var (
+	errMutex sync.Mutex
+	errStrs  = make(map[c.Int]*c.Char)
+)
+
+func Strerror(errno c.Int) *c.Char {
+	errMutex.Lock()
+	defer errMutex.Unlock()
+	s, ok := errStrs[errno]
+	if !ok {
+		msg := syscall.Errno(errno).Error()
+		if strings.HasPrefix(msg, "errno ") {
+			msg = "Unknown error " + strconv.Itoa(int(errno))
+		} else {
+			msg = strings.ToUpper(msg[:1]) + msg[1:]
+		}
+		s = CString(msg)
+		errStrs[errno] = s
+	}
+	return s
+}
+
+func Perror(s *c.Char) {
+	msg := GoString(Strerror(*ErrnoLocation()))
+	if s != nil && *s != 0 {
+		msg = GoString(s) + ": " + msg
+	}
+	Stderr.mu.Lock()
+	Stderr.write([]byte(msg + "\n"))
+	Stderr.mu.Unlock()
+}
+
+// -----------------------------------------------------------------------------
@@ -0,0 +1,54 @@
+// Package libc implements a subset of the C standard library in Go for code
+// translated by c2go: the printf family, string.h, and memory allocation,
+// sorting, number parsing and process exit of stdlib.h, math.h, ctype.h and
+// time.h, FILE streams and POSIX file I/O, and POSIX and C11 threads on
+// goroutines. Calls to these functions are bound to this package by the
+// translator automatically.
+package libc
+
+import (
+	"unsafe"
+
+	c "github.com/goplus/c2go/clang"
+)
+
+// -----------------------------------------------------------------------------
+
+// GoString returns the Go string of a NUL-terminated C string.
+func GoString(s *c.Char) string {
+	if s == nil {
+		return ""
+	}
+	return string(bytesOf(unsafe.Pointer(s), strlen(s)))
+}
+
+// CString returns a NUL-terminated C string of s. It is allocated by Malloc.
+func CString(s string) *c.Char {
+	p := Malloc(c.SizeT(len(s) + 1))
+	b := bytesOf(p, uintptr(len(s)+1))
+	copy(b, s)
+	b[len(s)] = 0
+	return (*c.Char)(p)
+}
+
+func bytesOf(p unsafe.Pointer, n uintptr) []byte {
+	if n == 0 {
+		return nil
+	}
+	return (*[1 << 30]byte)(p)[:n:n]
+}
+
+func add(p unsafe.Pointer, n uintptr) unsafe.Pointer {
+	return unsafe.Pointer(uintptr(p) + n)
+}
+
+func strlen(s *c.Char) uintptr {
+	p := unsafe.Pointer(s)
+	n := uintptr(0)
+	for *(*byte)(add(p, n)) != 0 {
+		n++
+	}
+	return n
+}
+
+// -----------------------------------------------------------------------------
@@ -0,0 +1,247 @@
+package libc
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"testing"
+	"unsafe"
+
+	c "github.com/goplus/c2go/clang"
+)
+
+// -----------------------------------------------------------------------------
+
+func sprintf(format string, args ...interface{}) string {
+	var buf [256]c.Char
+	Snprintf(&buf[0], c.SizeT(len(buf)), CString(format), args...)
+	return GoString(&buf[0])
+}
+
+func TestPrintf(t *testing.T) {
+	inf, nan := math.Inf(1), math.NaN()
+	cases := []struct {
+		format string
+		args   []interface{}
+		want   string
+	}{
+		{"%d|%5d|%-5d|%05d|%+d|% d", []interface{}{int32(42), int32(42), int32(42), int32(-42), int32(42), int32(42)},
+			"42|   42|42   |-0042|+42| 42"},
+		{"%.3d|%.0d|%8.3d|%-+8.3d|%08.3d", []interface{}{int32(7), int32(0), int32(-7), int32(7), int32(7)},
+			"007||    -007|+007    |     007"},
+		{"%u|%x|%X|%#x|%#o|%o|%#o", []interface{}{int32(-1), int32(255), int32(255), int32(255), int32(8), int32(8), int32(0)},
+			"4294967295|ff|FF|0xff|010|10|0"},
+		{"%hhd|%hd|%hhu|%lld|%llu|%ld", []interface{}{int32(300), int32(70000), int32(-1), int64(math.MinInt64), uint64(math.MaxUint64), int64(1) << 40},
+			"44|4464|255|-9223372036854775808|18446744073709551615|1099511627776"},
+		{"%f|%.2f|%10.3f|%-10.1f|%+f|%010.2f|%#.0f|%.0f", []interface{}{3.14159, 2.005, -1.5, 2.25, 1.0, -3.5, 2.0, 2.5},
+			"3.141590|2.00|    -1.500|2.2       |+1.000000|-000003.50|2.|2"},
+		{"%e|%.2E|%#.0e|%12.4e", []interface{}{12345.678, 0.000123, 5.0, -1e-300},
+			"1.234568e+04|1.23E-04|5.e+00|-1.0000e-300"},
+		{"%g|%g|%g|%g|%g|%.3g|%#g|%G|%g", []interface{}{100000.0, 1000000.0, 0.0001, 0.00001, 1.5, 3.14159, 1.0, 1e-10, 0.0},
+			"100000|1e+06|0.0001|1e-05|1.5|3.14|1.00000|1E-10|0"},
+		{"%f|%F|%e|%g|%5.1f|%-6f|%+f", []interface{}{inf, -inf, nan, -inf, inf, nan, inf},
+			"inf|-INF|nan|-inf|  inf|nan   |+inf"},
+		{"%a|%A|%.2a|%a|%a", []interface{}{1.0, 255.5, 1.0 / 3, 0.0, -0.1},
+			"0x1p+0|0X1.FFP+7|0x1.55p-2|0x0p+0|-0x1.999999999999ap-4"},
+		{"%c|%3c|%-3c|%%|%s|%.2s|%5s|%-5s|", []interface{}{int32('x'), int32('y'), int32('z'), CString("hi"), CString("hello"), CString("ab"), CString("cd")},
+			"x|  y|z  |%|hi|he|   ab|cd   |"},
+		{"%*d|%-*d|%.*f|%*.*s|", []interface{}{int32(5), int32(1), int32(5), int32(2), int32(2), 3.14159, int32(6), int32(2), CString("abcdef")},
+			"    1|2    |3.14|    ab|"},
+		{"%p|%s", []interface{}{nil, (*c.Char)(nil)},
+			"(nil)|(null)"},
+	}
+	for _, tc := range cases {
+		if got := sprintf(tc.format, tc.args...); got != tc.want {
+			t.Errorf("printf(%q) = %q, want %q", tc.format, got, tc.want)
+		}
+	}
+	var n int32
+	if got, want := sprintf("%p", &n), fmt.Sprintf("%p", &n); got != want {
+		t.Errorf("%%p: %s, want %s", got, want)
+	}
+	if got := sprintf("abc%n%d", &n, int32(1)); got != "abc1" || n != 3 {
+		t.Error("%n:", got, n)
+	}
+}
+
+func TestSnprintf(t *testing.T) {
+	var buf [4]c.Char
+	if n := Snprintf(&buf[0], 4, CString("%d"), int32(123456)); n != 6 || GoString(&buf[0]) != "123" {
+		t.Fatal("Snprintf:", n, GoString(&buf[0]))
+	}
+}
+
+// -----------------------------------------------------------------------------
+
+func TestString(t *testing.T) {
+	s := CString("hello")
+	if Strlen(s) != 5 || Strcmp(s, CString("help")) >= 0 || Strncmp(s, CString("help"), 3) != 0 {
+		t.Fatal("Strlen/Strcmp")
+	}
+	buf := (*c.Char)(Malloc(16))
+	Strcat(Strcpy(buf, s), CString(", world"))
+	if GoString(buf) != "hello, world" {
+		t.Fatal("Strcpy/Strcat:", GoString(buf))
+	}
+	if GoString(Strchr(buf, 'o')) != "o, world" || GoString(Strrchr(buf, 'o')) != "orld" ||
+		GoString(Strstr(buf, CString("wor"))) != "world" || Strchr(buf, 'z') != nil {
+		t.Fatal("Strchr/Strrchr/Strstr")
+	}
+	p := unsafe.Pointer(buf)
+	Memmove(add(p, 1), p, 5)
+	if GoString(buf) != "hhello world" {
+		t.Fatal("Memmove:", GoString(buf))
+	}
+	Memset(p, 'x', 3)
+	if GoString(buf) != "xxxllo world" || Memcmp(p, unsafe.Pointer(CString("xxy")), 3) >= 0 {
+		t.Fatal("Memset/Memcmp:", GoString(buf))
+	}
+}
+
+// -----------------------------------------------------------------------------
+
+func TestMalloc(t *testing.T) {
+	p := Calloc(4, 4)
+	a := (*[4]int32)(p)
+	a[3] = 7
+	q := Realloc(p, 64)
+	if (*[16]int32)(q)[3] != 7 {
+		t.Fatal("Realloc: data not copied")
+	}
+	Free(q)
+	Free(nil)
+	if Calloc(1<<32, 1<<32) != nil {
+		t.Fatal("Calloc: overflow not detected")
+	}
+}
+
+func cmpInt(a, b unsafe.Pointer) c.Int {
+	return *(*c.Int)(a) - *(*c.Int)(b)
+}
+
+func TestQsort(t *testing.T) {
+	a := []c.Int{5, 3, 9, 1, 7, 3}
+	Qsort(unsafe.Pointer(&a[0]), c.SizeT(len(a)), 4, cmpInt)
+	if !sort.SliceIsSorted(a, func(i, j int) bool { return a[i] < a[j] }) {
+		t.Fatal("Qsort:", a)
+	}
+	key := c.Int(7)
+	if p := Bsearch(unsafe.Pointer(&key), unsafe.Pointer(&a[0]), c.SizeT(len(a)), 4, cmpInt); p != unsafe.Pointer(&a[4]) {
+		t.Fatal("Bsearch:", p)
+	}
+	key = 4
+	if p := Bsearch(unsafe.Pointer(&key), unsafe.Pointer(&a[0]), c.SizeT(len(a)), 4, cmpInt); p != nil {
+		t.Fatal("Bsearch:", p)
+	}
+}
+
+func TestStrtol(t *testing.T) {
+	cases := []struct {
+		s    string
+		base c.Int
+		v    int64
+		n    int
+	}{
+		{"  -123abc", 10, -123, 6},
+		{"0x1F", 0, 31, 4},
+		{"0x", 16, 0, 1},
+		{"0777", 0, 511, 4},
+		{"zz", 36, 1295, 2},
+		{"+", 10, 0, 0},
+		{"99999999999999999999", 10, math.MaxInt64, 20},
+		{"-9223372036854775809", 10, math.MinInt64, 20},
+	}
+	for _, tc := range cases {
+		s := CString(tc.s)
+		var end *c.Char
+		v := Strtoll(s, &end, tc.base)
+		if n := int(uintptr(unsafe.Pointer(end)) - uintptr(unsafe.Pointer(s))); v != tc.v || n != tc.n {
+			t.Errorf("strtoll(%q, %d) = %d, %d", tc.s, tc.base, v, n)
+		}
+	}
+	if v := Strtoull(CString("-1"), nil, 10); v != math.MaxUint64 {
+		t.Error("strtoull(-1):", v)
+	}
+	errnos := []struct {
+		s     string
+		base  c.Int
+		errno c.Int
+	}{
+		{"9223372036854775807", 10, 0},
+		{"9223372036854775808", 10, ERANGE},
+		{"-9223372036854775809", 10, ERANGE},
+		{"12", 1, EINVAL},
+		{"12", 37, EINVAL},
+	}
+	for _, tc := range errnos {
+		*ErrnoLocation() = 0
+		Strtol(CString(tc.s), nil, tc.base)
+		if e := *ErrnoLocation(); e != tc.errno {
+			t.Errorf("strtol(%q, %d): errno %d", tc.s, tc.base, e)
+		}
+	}
+	*ErrnoLocation() = 0
+	if v := Strtoul(CString("18446744073709551616"), nil, 10); v != math.MaxUint64 || *ErrnoLocation() != ERANGE {
+		t.Error("strtoul(2^64):", v, *ErrnoLocation())
+	}
+	if v := Atoi(CString(" 42x")); v != 42 {
+		t.Error("atoi:", v)
+	}
+}
+
+func TestStrtod(t *testing.T) {
+	cases := []struct {
+		s string
+		v float64
+		n int
+	}{
+		{" 1.5e3x", 1500, 6},
+		{"-.5", -0.5, 3},
+		{"1e", 1, 1},
+		{"0x1.8p1", 3, 7},
+		{"0x10", 16, 4},
+		{"-Infinity", math.Inf(-1), 9},
+		{"inf", math.Inf(1), 3},
+		{"1e400", math.Inf(1), 5},
+		{".", 0, 0},
+	}
+	for _, tc := range cases {
+		s := CString(tc.s)
+		var end *c.Char
+		v := Strtod(s, &end)
+		if n := int(uintptr(unsafe.Pointer(end)) - uintptr(unsafe.Pointer(s))); v != tc.v || n != tc.n {
+			t.Errorf("strtod(%q) = %v, %d", tc.s, v, n)
+		}
+	}
+	if v := Strtod(CString("nan(123)"), nil); !math.IsNaN(v) {
+		t.Error("strtod(nan):", v)
+	}
+}
+
+func TestStrtodErrno(t *testing.T) {
+	cases := []struct {
+		s     string
+		errno c.Int
+	}{
+		{"1e308", 0},
+		{"1e309", ERANGE},
+		{"1e-400", ERANGE},
+		{"1e-320", ERANGE}, // inexact subnormal
+		{"0x1p-1074", 0},   // exact subnormal
+		{"2.2250738585072011e-308", ERANGE},
+		{"2.2250738585072014e-308", 0},
+	}
+	for _, tc := range cases {
+		*ErrnoLocation() = 0
+		Strtod(CString(tc.s), nil)
+		if e := *ErrnoLocation(); e != tc.errno {
+			t.Errorf("strtod(%q): errno %d", tc.s, e)
+		}
+	}
+	*ErrnoLocation() = 0
+	if v := Strtof(CString("1e-40"), nil); v == 0 || *ErrnoLocation() != ERANGE {
+		t.Error("strtof(1e-40):", v, *ErrnoLocation())
+	}
+}
+
+// -----------------------------------------------------------------------------
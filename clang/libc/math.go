@@ -0,0 +1,355 @@
+package libc
+
+import (
+	"math"
+
+	c "github.com/goplus/c2go/clang"
+)
+
+// -----------------------------------------------------------------------------
+// Functions of math.h set errno as the GNU C library does (math_errhandling
+// is MATH_ERRNO): EDOM on a domain error, where the result is NaN while no
+// argument is, and ERANGE on a pole error or an overflow, where the result is
+// infinite while all arguments are finite, and on an underflow to zero.
+//
+// Results are those of package math. Operations with exact results (sqrt,
+// fmod, floor, frexp and the like) match C bit for bit; transcendental
+// functions may differ from the C library in the last place. long double is
+// double.
+
+// dnan is the default NaN of x86 which most C functions return on a domain
+// error. Its sign bit is set, so printf shows it as -nan.
+var dnan = math.Float64frombits(0xfff8000000000000)
+
+// mathErr sets errno for a result v of a function of args. A NaN result of a
+// domain error is replaced by nan.
+func mathErr(v, nan float64, args ...float64) float64 {
+	finite := true
+	for _, arg := range args {
+		if math.IsNaN(arg) {
+			return v
+		}
+		if math.IsInf(arg, 0) {
+			finite = false
+		}
+	}
+	switch {
+	case math.IsNaN(v):
+		*ErrnoLocation() = EDOM
+		return nan
+	case math.IsInf(v, 0) && finite:
+		*ErrnoLocation() = ERANGE
+	}
+	return v
+}
+
+// underflow sets errno to ERANGE if v underflows to zero, that is, v is zero
+// while x, which scales v, isn't.
+func underflow(v, x float64, args ...float64) float64 {
+	for _, arg := range args {
+		if math.IsInf(arg, 0) || math.IsNaN(arg) {
+			return v
+		}
+	}
+	if v == 0 && x != 0 {
+		*ErrnoLocation() = ERANGE
+	}
+	return v
+}
+
+// logOf is math.Log, which doesn't handle subnormal numbers on some platforms.
+func logOf(x float64) float64 {
+	if x > 0 && x < 0x1p-1022 {
+		return math.Log(x*0x1p52) - 52*math.Ln2
+	}
+	return math.Log(x)
+}
+
+// hypotOf is math.Hypot with a correction step (Borges, 2019), so it rounds
+// to nearest as glibc does.
+func hypotOf(x, y float64) float64 {
+	switch {
+	case math.IsInf(x, 0) || math.IsInf(y, 0):
+		return math.Inf(1)
+	case math.IsNaN(x) || math.IsNaN(y):
+		return math.NaN()
+	}
+	x, y = math.Abs(x), math.Abs(y)
+	if x < y {
+		x, y = y, x
+	}
+	if y == 0 {
+		return x
+	}
+	scale := 1.0
+	if x > 0x1p500 {
+		x, y, scale = x*0x1p-600, y*0x1p-600, 0x1p600
+	} else if x < 0x1p-500 {
+		x, y, scale = x*0x1p600, y*0x1p600, 0x1p-600
+	}
+	h := math.Sqrt(math.FMA(x, x, y*y))
+	hsq, xsq, ysq := h*h, x*x, y*y
+	e := -math.FMA(h, h, -hsq) + math.FMA(x, x, -xsq) + math.FMA(y, y, -ysq) + (xsq - hsq) + ysq
+	return (h - e/(2*h)) * scale
+}
+
+func Sin(x c.Double) c.Double  { return mathErr(math.Sin(x), dnan, x) }
+func Cos(x c.Double) c.Double  { return mathErr(math.Cos(x), dnan, x) }
+func Tan(x c.Double) c.Double  { return mathErr(math.Tan(x), dnan, x) }
+func Asin(x c.Double) c.Double { return mathErr(math.Asin(x), math.NaN(), x) }
+func Acos(x c.Double) c.Double { return mathErr(math.Acos(x), math.NaN(), x) }
+func Atan(x c.Double) c.Double { return math.Atan(x) }
+
+func Atan2(y, x c.Double) c.Double { return math.Atan2(y, x) }
+
+func Sinh(x c.Double) c.Double  { return mathErr(math.Sinh(x), dnan, x) }
+func Cosh(x c.Double) c.Double  { return mathErr(math.Cosh(x), dnan, x) }
+func Tanh(x c.Double) c.Double  { return math.Tanh(x) }
+func Asinh(x c.Double) c.Double { return math.Asinh(x) }
+func Acosh(x c.Double) c.Double { return mathErr(math.Acosh(x), dnan, x) }
+func Atanh(x c.Double) c.Double { return mathErr(math.Atanh(x), dnan, x) }
+
+func Exp(x c.Double) c.Double   { return underflow(mathErr(math.Exp(x), dnan, x), 1, x) }
+func Exp2(x c.Double) c.Double  { return underflow(mathErr(math.Exp2(x), dnan, x), 1, x) }
+func Expm1(x c.Double) c.Double { return mathErr(math.Expm1(x), dnan, x) }
+func Log(x c.Double) c.Double   { return mathErr(logOf(x), dnan, x) }
+func Log10(x c.Double) c.Double { return mathErr(logOf(x)*(1/math.Ln10), math.NaN(), x) }
+func Log2(x c.Double) c.Double  { return mathErr(math.Log2(x), dnan, x) }
+func Log1p(x c.Double) c.Double { return mathErr(math.Log1p(x), dnan, x) }
+func Logb(x c.Double) c.Double  { return math.Logb(x) }
+
+// Ilogb implements ilogb. It returns INT_MIN for zero and NaN and INT_MAX for
+// infinities, and sets errno to EDOM for them.
+func Ilogb(x c.Double) c.Int {
+	switch {
+	case x == 0 || math.IsNaN(x):
+		*ErrnoLocation() = EDOM
+		return math.MinInt32
+	case math.IsInf(x, 0):
+		*ErrnoLocation() = EDOM
+		return math.MaxInt32
+	}
+	return c.Int(math.Ilogb(x))
+}
+
+func Pow(x, y c.Double) c.Double {
+	return underflow(mathErr(math.Pow(x, y), dnan, x, y), x, y)
+}
+
+func Sqrt(x c.Double) c.Double         { return mathErr(math.Sqrt(x), dnan, x) }
+func Cbrt(x c.Double) c.Double         { return math.Cbrt(x) }
+func Hypot(x, y c.Double) c.Double     { return mathErr(hypotOf(x, y), dnan, x, y) }
+func Erf(x c.Double) c.Double          { return math.Erf(x) }
+func Erfc(x c.Double) c.Double         { return underflow(math.Erfc(x), 1, x) }
+func Tgamma(x c.Double) c.Double       { return mathErr(math.Gamma(x), math.NaN(), x) }
+func Fabs(x c.Double) c.Double         { return math.Abs(x) }
+func Floor(x c.Double) c.Double        { return math.Floor(x) }
+func Ceil(x c.Double) c.Double         { return math.Ceil(x) }
+func Trunc(x c.Double) c.Double        { return math.Trunc(x) }
+func Round(x c.Double) c.Double        { return math.Round(x) }
+func Rint(x c.Double) c.Double         { return math.RoundToEven(x) }
+func Fmod(x, y c.Double) c.Double      { return mathErr(math.Mod(x, y), dnan, x, y) }
+func Remainder(x, y c.Double) c.Double { return mathErr(math.Remainder(x, y), dnan, x, y) }
+func Copysign(x, y c.Double) c.Double  { return math.Copysign(x, y) }
+func Nextafter(x, y c.Double) c.Double { return math.Nextafter(x, y) }
+func Fma(x, y, z c.Double) c.Double    { return math.FMA(x, y, z) }
+
+func Lgamma(x c.Double) c.Double {
+	v, _ := math.Lgamma(x)
+	return mathErr(v, dnan, x)
+}
+
+func Fmin(x, y c.Double) c.Double {
+	if math.IsNaN(x) {
+		return y
+	} else if math.IsNaN(y) {
+		return x
+	}
+	return math.Min(x, y)
+}
+
+func Fmax(x, y c.Double) c.Double {
+	if math.IsNaN(x) {
+		return y
+	} else if math.IsNaN(y) {
+		return x
+	}
+	return math.Max(x, y)
+}
+
+func Fdim(x, y c.Double) c.Double {
+	if x <= y {
+		return 0
+	}
+	return mathErr(x-y, dnan, x, y)
+}
+
+func Frexp(x c.Double, exp *c.Int) c.Double {
+	frac, e := math.Frexp(x)
+	*exp = c.Int(e)
+	return frac
+}
+
+func Ldexp(x c.Double, exp c.Int) c.Double {
+	return underflow(mathErr(math.Ldexp(x, int(exp)), dnan, x), x, x)
+}
+
+func Scalbn(x c.Double, exp c.Int) c.Double {
+	return Ldexp(x, exp)
+}
+
+func Modf(x c.Double, iptr *c.Double) c.Double {
+	ip, frac := math.Modf(x)
+	if math.IsInf(x, 0) {
+		frac = math.Copysign(0, x)
+	}
+	*iptr = ip
+	return frac
+}
+
+// Nan implements nan. The payload of tag is ignored.
+func Nan(tag *c.Char) c.Double {
+	return math.NaN()
+}
+
+// toLong converts x to a long as x86 does: NaN and values out of range
+// become LONG_MIN.
+func toLong(x float64) c.Long {
+	if math.IsNaN(x) || x >= 1<<63 || x < -(1<<63) {
+		return math.MinInt64
+	}
+	return c.Long(x)
+}
+
+func Lround(x c.Double) c.Long { return toLong(math.Round(x)) }
+func Lrint(x c.Double) c.Long  { return toLong(math.RoundToEven(x)) }
+
+func Llround(x c.Double) int64 { return int64(Lround(x)) }
+func Llrint(x c.Double) int64  { return int64(Lrint(x)) }
+
+// -----------------------------------------------------------------------------
+
+// float versions compute in double and round the result.
+
+func Sinf(x c.Float) c.Float              { return c.Float(Sin(c.Double(x))) }
+func Cosf(x c.Float) c.Float              { return c.Float(Cos(c.Double(x))) }
+func Tanf(x c.Float) c.Float              { return c.Float(Tan(c.Double(x))) }
+func Asinf(x c.Float) c.Float             { return c.Float(Asin(c.Double(x))) }
+func Acosf(x c.Float) c.Float             { return c.Float(Acos(c.Double(x))) }
+func Atanf(x c.Float) c.Float             { return c.Float(Atan(c.Double(x))) }
+func Atan2f(y, x c.Float) c.Float         { return c.Float(Atan2(c.Double(y), c.Double(x))) }
+func Expf(x c.Float) c.Float              { return floatErr(Exp(c.Double(x)), x) }
+func Logf(x c.Float) c.Float              { return c.Float(Log(c.Double(x))) }
+func Log10f(x c.Float) c.Float            { return c.Float(Log10(c.Double(x))) }
+func Log2f(x c.Float) c.Float             { return c.Float(Log2(c.Double(x))) }
+func Powf(x, y c.Float) c.Float           { return floatErr(Pow(c.Double(x), c.Double(y)), x, y) }
+func Sqrtf(x c.Float) c.Float             { return c.Float(Sqrt(c.Double(x))) }
+func Cbrtf(x c.Float) c.Float             { return c.Float(Cbrt(c.Double(x))) }
+func Hypotf(x, y c.Float) c.Float         { return floatErr(Hypot(c.Double(x), c.Double(y)), x, y) }
+func Fabsf(x c.Float) c.Float             { return c.Float(math.Abs(c.Double(x))) }
+func Floorf(x c.Float) c.Float            { return c.Float(math.Floor(c.Double(x))) }
+func Ceilf(x c.Float) c.Float             { return c.Float(math.Ceil(c.Double(x))) }
+func Truncf(x c.Float) c.Float            { return c.Float(math.Trunc(c.Double(x))) }
+func Roundf(x c.Float) c.Float            { return c.Float(math.Round(c.Double(x))) }
+func Fmodf(x, y c.Float) c.Float          { return c.Float(Fmod(c.Double(x), c.Double(y))) }
+func Copysignf(x, y c.Float) c.Float      { return c.Float(math.Copysign(c.Double(x), c.Double(y))) }
+func Fminf(x, y c.Float) c.Float          { return c.Float(Fmin(c.Double(x), c.Double(y))) }
+func Fmaxf(x, y c.Float) c.Float          { return c.Float(Fmax(c.Double(x), c.Double(y))) }
+func Nanf(tag *c.Char) c.Float            { return c.Float(math.NaN()) }
+func Ldexpf(x c.Float, exp c.Int) c.Float { return floatErr(Ldexp(c.Double(x), exp), x) }
+
+func Frexpf(x c.Float, exp *c.Int) c.Float {
+	return c.Float(Frexp(c.Double(x), exp))
+}
+
+func Modff(x c.Float, iptr *c.Float) c.Float {
+	var ip c.Double
+	frac := Modf(c.Double(x), &ip)
+	*iptr = c.Float(ip)
+	return c.Float(frac)
+}
+
+// floatErr rounds a result of a float function, which overflows or
+// underflows in float even if it doesn't in double.
+func floatErr(v c.Double, args ...c.Float) c.Float {
+	f := c.Float(v)
+	for _, arg := range args {
+		if math.IsInf(float64(arg), 0) || math.IsNaN(float64(arg)) {
+			return f
+		}
+	}
+	if (math.IsInf(float64(f), 0) && !math.IsInf(v, 0)) || (f == 0 && v != 0) {
+		*ErrnoLocation() = ERANGE
+	}
+	return f
+}
+
+// -----------------------------------------------------------------------------
+
+// Classification macros of glibc call the following functions: isnan(x)
+// expands to __isnan(x), __isnanf(x) or __isnanl(x) by the size of x.
+
+const (
+	FP_NAN       = 0
+	FP_INFINITE  = 1
+	FP_ZERO      = 2
+	FP_SUBNORMAL = 3
+	FP_NORMAL    = 4
+)
+
+func bool2int(b bool) c.Int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func Isnan(x c.Double) c.Int  { return bool2int(math.IsNaN(x)) }
+func Isnanf(x c.Float) c.Int  { return Isnan(c.Double(x)) }
+func Finite(x c.Double) c.Int { return bool2int(!math.IsNaN(x) && !math.IsInf(x, 0)) }
+func Finitef(x c.Float) c.Int { return Finite(c.Double(x)) }
+
+// Isinf implements __isinf, which returns -1 for -Inf.
+func Isinf(x c.Double) c.Int {
+	switch {
+	case math.IsInf(x, 1):
+		return 1
+	case math.IsInf(x, -1):
+		return -1
+	}
+	return 0
+}
+
+func Isinff(x c.Float) c.Int { return Isinf(c.Double(x)) }
+
+// Signbit implements __signbit and __builtin_signbit.
+func Signbit(x c.Double) c.Int { return bool2int(math.Signbit(x)) }
+func Signbitf(x c.Float) c.Int { return Signbit(c.Double(x)) }
+
+func Fpclassify(x c.Double) c.Int {
+	switch {
+	case math.IsNaN(x):
+		return FP_NAN
+	case math.IsInf(x, 0):
+		return FP_INFINITE
+	case x == 0:
+		return FP_ZERO
+	case math.Abs(x) < 0x1p-1022:
+		return FP_SUBNORMAL
+	}
+	return FP_NORMAL
+}
+
+func Fpclassifyf(x c.Float) c.Int {
+	if v := math.Abs(float64(x)); v != 0 && v < 0x1p-126 {
+		return FP_SUBNORMAL
+	}
+	return Fpclassify(c.Double(x))
+}
+
+// HugeVal implements __builtin_huge_val and __builtin_inf, which HUGE_VAL and
+// INFINITY expand to.
+func HugeVal() c.Double { return math.Inf(1) }
+func HugeValf() c.Float { return c.Float(math.Inf(1)) }
+
+// -----------------------------------------------------------------------------
@@ -0,0 +1,80 @@
+package libc
+
+import (
+	"math"
+	"testing"
+	"unsafe"
+
+	c "github.com/goplus/c2go/clang"
+)
+
+// -----------------------------------------------------------------------------
+
+func TestMathErrno(t *testing.T) {
+	cases := []struct {
+		name  string
+		fn    func() c.Double
+		v     float64
+		errno c.Int
+	}{
+		{"sqrt(-1)", func() c.Double { return Sqrt(-1) }, dnan, EDOM},
+		{"acos(2)", func() c.Double { return Acos(2) }, math.NaN(), EDOM},
+		{"sin(inf)", func() c.Double { return Sin(math.Inf(1)) }, dnan, EDOM},
+		{"sin(nan)", func() c.Double { return Sin(math.NaN()) }, math.NaN(), 0},
+		{"log(0)", func() c.Double { return Log(0) }, math.Inf(-1), ERANGE},
+		{"exp(1000)", func() c.Double { return Exp(1000) }, math.Inf(1), ERANGE},
+		{"exp(-1000)", func() c.Double { return Exp(-1000) }, 0, ERANGE},
+		{"exp(-inf)", func() c.Double { return Exp(math.Inf(-1)) }, 0, 0},
+		{"pow(0, -1)", func() c.Double { return Pow(0, -1) }, math.Inf(1), ERANGE},
+		{"fmod(1, 0)", func() c.Double { return Fmod(1, 0) }, dnan, EDOM},
+		{"log(1e-310)", func() c.Double { return Log(1e-310) }, -713.80137882815416, 0},
+		{"hypot(0.5, 2.5)", func() c.Double { return Hypot(0.5, 2.5) }, 0x1.465655f122ff6p+1, 0}, // math.Hypot is off by one ulp
+	}
+	for _, tc := range cases {
+		*ErrnoLocation() = 0
+		v := tc.fn()
+		same := math.Float64bits(v) == math.Float64bits(tc.v) || (math.IsNaN(v) && math.IsNaN(tc.v) && tc.v != dnan)
+		if !same || *ErrnoLocation() != tc.errno {
+			t.Errorf("%s = %v, errno %d", tc.name, v, *ErrnoLocation())
+		}
+	}
+}
+
+func TestFrexp(t *testing.T) {
+	var exp c.Int
+	if v := Frexp(1e-310, &exp); v != 0.57526180315593933 || exp != -1029 {
+		t.Error("frexp:", v, exp)
+	}
+	var ip c.Double
+	if v := Modf(-2.5, &ip); v != -0.5 || ip != -2 {
+		t.Error("modf:", v, ip)
+	}
+	if v := Ldexp(1, -1075); v != 0 || *ErrnoLocation() != ERANGE {
+		t.Error("ldexp:", v)
+	}
+	*ErrnoLocation() = 0
+}
+
+func TestClassify(t *testing.T) {
+	if Isnan(Nan(CString(""))) == 0 || Isinf(-HugeVal()) != -1 || Finite(1e308) == 0 {
+		t.Error("isnan, isinf or finite")
+	}
+	if Signbit(math.Copysign(0, -1)) == 0 || Fpclassify(1e-310) != FP_SUBNORMAL || Fpclassifyf(0) != FP_ZERO {
+		t.Error("signbit or fpclassify")
+	}
+}
+
+func TestCtype(t *testing.T) {
+	if Isalpha('a') == 0 || Isdigit('a') != 0 || Isxdigit('F') == 0 || Isspace('\v') == 0 || Ispunct('_') == 0 {
+		t.Error("classification")
+	}
+	if Toupper('q') != 'Q' || Tolower('Q') != 'q' || Tolower(-56) != 200 || Tolower(-1) != -1 {
+		t.Error("case mapping")
+	}
+	b := *CtypeBLoc()
+	if *(*uint16)(add(unsafe.Pointer(b), 2*'A'))&ctypeUpper == 0 {
+		t.Error("__ctype_b_loc")
+	}
+}
+
+// -----------------------------------------------------------------------------
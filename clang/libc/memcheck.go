@@ -0,0 +1,165 @@
+package libc
+
+import (
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"unsafe"
+)
+
+// -----------------------------------------------------------------------------
+// Memory checking (see cl.Config.MemCheck) tracks blocks allocated by Malloc
+// and friends with the C call sites of malloc, calloc, realloc and free. A
+// double free, or a free or realloc of a pointer which isn't returned by
+// Malloc, is reported on stderr when it happens, and blocks which are still
+// allocated are reported as leaks by MemReport, which Exit calls.
+//
+// Freed blocks stay referenced in quarantine, so their addresses aren't reused
+// and a double free can be told from a free of a bad pointer. The oldest freed
+// blocks are forgotten once the quarantine exceeds its size (memQuarantine),
+// so that memory grows with live blocks, and double frees of them are no
+// longer detected.
+
+type memBlock struct {
+	p        unsafe.Pointer // keeps the block alive in quarantine
+	size     uintptr
+	site     string // where it is allocated
+	freeSite string // where it is freed
+	freed    bool
+}
+
+var (
+	memblocks map[uintptr]*memBlock // tracked blocks, or nil if memory checking is disabled
+	memerrs   int                   // errors reported by Free and Realloc
+	memout    io.Writer             = os.Stderr
+
+	memfreed  []*memBlock // freed blocks in quarantine, the oldest first
+	nmemfreed uintptr     // total size of freed blocks in quarantine
+)
+
+// memQuarantine is the maximum total size of freed blocks which are kept.
+var memQuarantine uintptr = 64 << 20
+
+// quarantine keeps the freed block b, and forgets the oldest freed blocks
+// beyond memQuarantine, except b itself. mutex must be held.
+func quarantine(b *memBlock) {
+	memfreed = append(memfreed, b)
+	nmemfreed += allocSize(b.size)
+	for nmemfreed > memQuarantine && len(memfreed) > 1 {
+		old := memfreed[0]
+		memfreed[0] = nil
+		memfreed = memfreed[1:]
+		nmemfreed -= allocSize(old.size)
+		delete(memblocks, uintptr(old.p))
+	}
+}
+
+// EnableMemcheck enables memory checking. Blocks allocated before are not
+// tracked.
+func EnableMemcheck() {
+	mutex.Lock()
+	if memblocks == nil {
+		memblocks = make(map[uintptr]*memBlock)
+	}
+	mutex.Unlock()
+}
+
+func memcheckEnabled() bool {
+	mutex.Lock()
+	defer mutex.Unlock()
+	return memblocks != nil
+}
+
+// where returns the description of a C call site.
+func where(site string) string {
+	if site == "" {
+		return "in the runtime"
+	}
+	return "at " + site
+}
+
+func sizeOf(n uintptr) string {
+	if n == 1 {
+		return "1 byte"
+	}
+	return strconv.FormatUint(uint64(n), 10) + " bytes"
+}
+
+func memReport(msg string) {
+	io.WriteString(memout, "c2go: "+msg+"\n")
+}
+
+// badFree reports a free (or realloc) at site of p, which isn't a block
+// allocated by Malloc.
+func badFree(fn string, p unsafe.Pointer, site string) {
+	addr := uintptr(p)
+	var msg string
+	mutex.Lock()
+	memerrs++
+	prefix := fn + " " + where(site) + ": "
+	if b := memblocks[addr]; b != nil && b.freed {
+		what := "double free of "
+		if fn == "realloc" {
+			what = "use after free of "
+		}
+		msg = prefix + what + sizeOf(b.size) + " allocated " + where(b.site) + " and freed " + where(b.freeSite)
+	} else {
+		msg = prefix + "pointer not returned by malloc"
+		for base, b := range memblocks {
+			if addr > base && addr < base+b.size {
+				msg = prefix + "pointer to offset " + strconv.FormatUint(uint64(addr-base), 10) + " of " +
+					sizeOf(b.size) + " allocated " + where(b.site)
+				break
+			}
+		}
+	}
+	mutex.Unlock()
+	memReport(msg)
+}
+
+// MemReport reports blocks which are still allocated on stderr, grouped by
+// their allocation sites. It returns the number of problems found: leaked
+// blocks and errors reported so far.
+func MemReport() int {
+	type leak struct {
+		site   string
+		size   uintptr
+		blocks int
+	}
+	mutex.Lock()
+	leaks := make(map[string]*leak)
+	nblocks := 0
+	for _, b := range memblocks {
+		if b.freed {
+			continue
+		}
+		l, ok := leaks[b.site]
+		if !ok {
+			l = &leak{site: b.site}
+			leaks[b.site] = l
+		}
+		l.size += b.size
+		l.blocks++
+		nblocks++
+	}
+	nerrs := memerrs
+	mutex.Unlock()
+	sorted := make([]*leak, 0, len(leaks))
+	for _, l := range leaks {
+		sorted = append(sorted, l)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].site < sorted[j].site
+	})
+	for _, l := range sorted {
+		blocks := " in 1 block"
+		if l.blocks > 1 {
+			blocks = " in " + strconv.Itoa(l.blocks) + " blocks"
+		}
+		memReport("leak: " + sizeOf(l.size) + blocks + " allocated " + where(l.site))
+	}
+	return nblocks + nerrs
+}
+
+// -----------------------------------------------------------------------------
@@ -0,0 +1,72 @@
+package libc
+
+import (
+	"bytes"
+	"os"
+	"testing"
+	"unsafe"
+)
+
+// -----------------------------------------------------------------------------
+
+func TestMemcheck(t *testing.T) {
+	var out bytes.Buffer
+	memout = &out
+	EnableMemcheck()
+	defer func() {
+		memblocks, memerrs, memout = nil, 0, os.Stderr
+		memfreed, nmemfreed = nil, 0
+	}()
+	a := MallocAt(16, "a.c:1:1")
+	b := CallocAt(4, 8, "a.c:2:1")
+	var x int
+	FreeAt(a, "a.c:3:1")
+	FreeAt(a, "a.c:4:1")
+	FreeAt(unsafe.Pointer(uintptr(b)+4), "a.c:5:1")
+	FreeAt(unsafe.Pointer(&x), "a.c:6:1")
+	if ReallocAt(a, 32, "a.c:7:1") != nil {
+		t.Fatal("realloc: freed block")
+	}
+	b = ReallocAt(b, 64, "a.c:8:1")
+	Free(Malloc(1))
+	if n := MemReport(); n != 5 {
+		t.Fatal("MemReport:", n)
+	}
+	expected := `c2go: free at a.c:4:1: double free of 16 bytes allocated at a.c:1:1 and freed at a.c:3:1
+c2go: free at a.c:5:1: pointer to offset 4 of 32 bytes allocated at a.c:2:1
+c2go: free at a.c:6:1: pointer not returned by malloc
+c2go: realloc at a.c:7:1: use after free of 16 bytes allocated at a.c:1:1 and freed at a.c:3:1
+c2go: leak: 64 bytes in 1 block allocated at a.c:8:1
+`
+	if s := out.String(); s != expected {
+		t.Fatal("report:\n" + s)
+	}
+}
+
+func TestMemcheckQuarantine(t *testing.T) {
+	var out bytes.Buffer
+	memout = &out
+	EnableMemcheck()
+	defer func(old uintptr) {
+		memblocks, memerrs, memout = nil, 0, os.Stderr
+		memfreed, nmemfreed, memQuarantine = nil, 0, old
+	}(memQuarantine)
+	memQuarantine = 64
+	var ps []unsafe.Pointer
+	for i := 0; i < 16; i++ {
+		ps = append(ps, MallocAt(16, "a.c:1:1"))
+	}
+	for _, p := range ps {
+		FreeAt(p, "a.c:2:1")
+	}
+	if len(memblocks) != 4 || len(memfreed) != 4 || nmemfreed != 64 {
+		t.Fatal("quarantine:", len(memblocks), len(memfreed), nmemfreed)
+	}
+	FreeAt(ps[15], "a.c:3:1")
+	expected := "c2go: free at a.c:3:1: double free of 16 bytes allocated at a.c:1:1 and freed at a.c:2:1\n"
+	if s := out.String(); s != expected {
+		t.Fatal("report:\n" + s)
+	}
+}
+
+// -----------------------------------------------------------------------------
@@ -0,0 +1,155 @@
+//go:build linux || darwin
+// +build linux darwin
+
+package libc
+
+import (
+	"os"
+	"syscall"
+	"time"
+	"unsafe"
+
+	c "github.com/goplus/c2go/clang"
+)
+
+// -----------------------------------------------------------------------------
+
+func result(n int, err error) c.Long {
+	if err != nil {
+		return c.Long(seterr(err))
+	}
+	return c.Long(n)
+}
+
+func status(err error) c.Int {
+	if err != nil {
+		return seterr(err)
+	}
+	return 0
+}
+
+// Open implements open(path, flags, ...). The optional argument is the mode
+// of a created file.
+func Open(path *c.Char, flags c.Int, args ...interface{}) c.Int {
+	var mode uint32
+	if len(args) > 0 {
+		mode = uint32(toInt64(args[0]))
+	}
+	fd, err := syscall.Open(GoString(path), int(flags)|syscall.O_CLOEXEC, mode)
+	if err != nil {
+		return seterr(err)
+	}
+	return c.Int(fd)
+}
+
+func Close(fd c.Int) c.Int {
+	return status(syscall.Close(int(fd)))
+}
+
+func Read(fd c.Int, buf unsafe.Pointer, n c.SizeT) c.Long {
+	return result(syscall.Read(int(fd), bytesOf(buf, uintptr(n))))
+}
+
+func Write(fd c.Int, buf unsafe.Pointer, n c.SizeT) c.Long {
+	return result(syscall.Write(int(fd), bytesOf(buf, uintptr(n))))
+}
+
+func Pread(fd c.Int, buf unsafe.Pointer, n c.SizeT, off int64) c.Long {
+	return result(syscall.Pread(int(fd), bytesOf(buf, uintptr(n)), off))
+}
+
+func Pwrite(fd c.Int, buf unsafe.Pointer, n c.SizeT, off int64) c.Long {
+	return result(syscall.Pwrite(int(fd), bytesOf(buf, uintptr(n)), off))
+}
+
+func Lseek(fd c.Int, off int64, whence c.Int) int64 {
+	ret, err := syscall.Seek(int(fd), off, int(whence))
+	if err != nil {
+		return int64(seterr(err))
+	}
+	return ret
+}
+
+func Fsync(fd c.Int) c.Int {
+	return status(syscall.Fsync(int(fd)))
+}
+
+func Ftruncate(fd c.Int, size int64) c.Int {
+	return status(syscall.Ftruncate(int(fd), size))
+}
+
+func Unlink(path *c.Char) c.Int {
+	return status(syscall.Unlink(GoString(path)))
+}
+
+func Access(path *c.Char, mode c.Int) c.Int {
+	return status(syscall.Access(GoString(path), uint32(mode)))
+}
+
+func Getpid() c.Int {
+	return c.Int(os.Getpid())
+}
+
+// -----------------------------------------------------------------------------
+
+// copyStat copies st to buf, which points to a C struct stat. Both of them
+// have the layout of the stat structure of the operating system.
+func copyStat(buf unsafe.Pointer, st *syscall.Stat_t, err error) c.Int {
+	if err != nil {
+		return seterr(err)
+	}
+	n := unsafe.Sizeof(*st)
+	copy(bytesOf(buf, n), bytesOf(unsafe.Pointer(st), n))
+	return 0
+}
+
+func Fstat(fd c.Int, buf unsafe.Pointer) c.Int {
+	var st syscall.Stat_t
+	err := syscall.Fstat(int(fd), &st)
+	return copyStat(buf, &st, err)
+}
+
+func Stat(path *c.Char, buf unsafe.Pointer) c.Int {
+	var st syscall.Stat_t
+	err := syscall.Stat(GoString(path), &st)
+	return copyStat(buf, &st, err)
+}
+
+func Lstat(path *c.Char, buf unsafe.Pointer) c.Int {
+	var st syscall.Stat_t
+	err := syscall.Lstat(GoString(path), &st)
+	return copyStat(buf, &st, err)
+}
+
+// Fcntl implements fcntl(fd, cmd, ...). Locking commands take a pointer to a
+// C struct flock, which has the layout of syscall.Flock_t; other commands
+// take an int.
+func Fcntl(fd c.Int, cmd c.Int, args ...interface{}) c.Int {
+	var arg interface{}
+	if len(args) > 0 {
+		arg = args[0]
+	}
+	switch cmd {
+	case syscall.F_GETLK, syscall.F_SETLK, syscall.F_SETLKW:
+		lk := (*syscall.Flock_t)(toPointer(arg))
+		return status(syscall.FcntlFlock(uintptr(fd), int(cmd), lk))
+	}
+	r, _, e := syscall.Syscall(syscall.SYS_FCNTL, uintptr(fd), uintptr(cmd), uintptr(toInt64(arg)))
+	if e != 0 {
+		return seterr(e)
+	}
+	return c.Int(r)
+}
+
+// -----------------------------------------------------------------------------
+
+// cputime returns the CPU time used by the process.
+func cputime() time.Duration {
+	var ru syscall.Rusage
+	if syscall.Getrusage(syscall.RUSAGE_SELF, &ru) != nil {
+		return 0
+	}
+	return time.Duration(ru.Utime.Nano() + ru.Stime.Nano())
+}
+
+// -----------------------------------------------------------------------------
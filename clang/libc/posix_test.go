@@ -0,0 +1,54 @@
+//go:build linux || darwin
+// +build linux darwin
+
+package libc
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"unsafe"
+
+	c "github.com/goplus/c2go/clang"
+)
+
+// -----------------------------------------------------------------------------
+
+func TestPosix(t *testing.T) {
+	path := CString(filepath.Join(t.TempDir(), "a.bin"))
+	fd := Open(path, syscall.O_RDWR|syscall.O_CREAT, uint32(0644))
+	if fd < 0 {
+		t.Fatal("Open:", *ErrnoLocation())
+	}
+	data := CString("hello world")
+	if Write(fd, unsafe.Pointer(data), 11) != 11 {
+		t.Fatal("Write")
+	}
+	var buf [8]c.Char
+	if Pread(fd, unsafe.Pointer(&buf[0]), 5, 6) != 5 || GoString(&buf[0]) != "world" {
+		t.Fatal("Pread:", GoString(&buf[0]))
+	}
+	var st syscall.Stat_t
+	if Ftruncate(fd, 4) != 0 || Fstat(fd, unsafe.Pointer(&st)) != 0 || st.Size != 4 {
+		t.Fatal("Ftruncate/Fstat:", st.Size)
+	}
+	if Lseek(fd, 0, SEEK_END) != 4 || Fsync(fd) != 0 {
+		t.Fatal("Lseek/Fsync")
+	}
+	lk := syscall.Flock_t{Type: syscall.F_WRLCK, Whence: SEEK_SET}
+	if Fcntl(fd, syscall.F_SETLK, &lk) != 0 || Fcntl(fd, syscall.F_GETFD)&syscall.FD_CLOEXEC == 0 {
+		t.Fatal("Fcntl:", *ErrnoLocation())
+	}
+	if Close(fd) != 0 || Read(fd, unsafe.Pointer(&buf[0]), 1) != -1 || *ErrnoLocation() != EBADF {
+		t.Fatal("Close/Read: errno =", *ErrnoLocation())
+	}
+	if Unlink(path) != 0 || Access(path, 0) != -1 || *ErrnoLocation() != ENOENT {
+		t.Fatal("Unlink/Access: errno =", *ErrnoLocation())
+	}
+	if Getpid() != c.Int(os.Getpid()) {
+		t.Fatal("Getpid")
+	}
+}
+
+// -----------------------------------------------------------------------------
@@ -0,0 +1,523 @@
+package libc
+
+import (
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"unsafe"
+
+	c "github.com/goplus/c2go/clang"
+)
+
+// -----------------------------------------------------------------------------
+
+// fmtSpec is a parsed C conversion specification:
+// %[flags][width][.precision][length]conversion
+type fmtSpec struct {
+	minus, plus, space, sharp, zero bool
+
+	width int
+	prec  int // -1 if omitted
+	size  string
+	verb  byte
+}
+
+type formatter struct {
+	buf  []byte
+	args []interface{}
+}
+
+func (p *formatter) arg() interface{} {
+	if len(p.args) == 0 {
+		return nil
+	}
+	v := p.args[0]
+	p.args = p.args[1:]
+	return v
+}
+
+// Format formats args by the C format string format as printf does.
+func Format(format *c.Char, args []interface{}) []byte {
+	p := &formatter{args: args}
+	f := bytesOf(unsafe.Pointer(format), strlen(format))
+	for i := 0; i < len(f); {
+		ch := f[i]
+		i++
+		if ch != '%' {
+			p.buf = append(p.buf, ch)
+			continue
+		}
+		start := i - 1
+		var spec fmtSpec
+		i = p.parseSpec(&spec, f, i)
+		if i > len(f) {
+			p.buf = append(p.buf, f[start:]...)
+			break
+		}
+		if !p.conv(&spec) { // unknown conversion: output as is
+			p.buf = append(p.buf, f[start:i]...)
+		}
+	}
+	return p.buf
+}
+
+func (p *formatter) parseSpec(spec *fmtSpec, f []byte, i int) int {
+	for ; i < len(f); i++ {
+		switch f[i] {
+		case '-':
+			spec.minus = true
+		case '+':
+			spec.plus = true
+		case ' ':
+			spec.space = true
+		case '#':
+			spec.sharp = true
+		case '0':
+			spec.zero = true
+		default:
+			goto width
+		}
+	}
+width:
+	if i < len(f) && f[i] == '*' {
+		i++
+		if spec.width = int(toInt64(p.arg())); spec.width < 0 {
+			spec.minus, spec.width = true, -spec.width
+		}
+	} else {
+		spec.width, i = atoiBytes(f, i)
+	}
+	spec.prec = -1
+	if i < len(f) && f[i] == '.' {
+		i++
+		if i < len(f) && f[i] == '*' {
+			i++
+			if spec.prec = int(toInt64(p.arg())); spec.prec < 0 {
+				spec.prec = -1
+			}
+		} else {
+			spec.prec, i = atoiBytes(f, i)
+		}
+	}
+	start := i
+	for i < len(f) && strings.IndexByte("hlLjztq", f[i]) >= 0 {
+		i++
+	}
+	spec.size = string(f[start:i])
+	if i >= len(f) {
+		return len(f) + 1
+	}
+	spec.verb = f[i]
+	return i + 1
+}
+
+func atoiBytes(f []byte, i int) (n, next int) {
+	for ; i < len(f) && f[i] >= '0' && f[i] <= '9'; i++ {
+		n = n*10 + int(f[i]-'0')
+	}
+	return n, i
+}
+
+func (p *formatter) conv(spec *fmtSpec) bool {
+	switch verb := spec.verb; verb {
+	case 'd', 'i':
+		v := signedOf(toInt64(p.arg()), spec.size)
+		var sign string
+		if v < 0 {
+			sign = "-"
+		}
+		p.integer(spec, sign, "", strconv.FormatUint(absOf(v), 10))
+	case 'u', 'o', 'x', 'X':
+		v := unsignedOf(uint64(toInt64(p.arg())), spec.size)
+		var prefix string
+		switch verb {
+		case 'u':
+			p.integer(spec, "", "", strconv.FormatUint(v, 10))
+			return true
+		case 'o':
+			if spec.sharp {
+				prefix = "0"
+			}
+			p.integer(spec, "", prefix, strconv.FormatUint(v, 8))
+			return true
+		}
+		digits := strconv.FormatUint(v, 16)
+		if verb == 'X' {
+			digits = strings.ToUpper(digits)
+		}
+		if spec.sharp && v != 0 {
+			prefix = "0" + string(verb)
+		}
+		p.integer(spec, "", prefix, digits)
+	case 'f', 'F', 'e', 'E', 'g', 'G', 'a', 'A':
+		p.float(spec, toFloat64(p.arg()))
+	case 'c':
+		p.pad(spec, []byte{byte(toInt64(p.arg()))})
+	case 's':
+		var s []byte
+		switch v := p.arg().(type) {
+		case string:
+			s = []byte(v)
+		default:
+			if ptr := toPointer(v); ptr != nil {
+				n := uintptr(0)
+				for (spec.prec < 0 || n < uintptr(spec.prec)) && *(*byte)(add(ptr, n)) != 0 {
+					n++
+				}
+				s = bytesOf(ptr, n)
+			} else {
+				s = []byte("(null)")
+			}
+		}
+		if spec.prec >= 0 && spec.prec < len(s) {
+			s = s[:spec.prec]
+		}
+		p.pad(spec, s)
+	case 'p':
+		ptr := uint64(toInt64(p.arg()))
+		if ptr == 0 {
+			p.pad(spec, []byte("(nil)"))
+			break
+		}
+		spec.sharp = true
+		p.integer(spec, "", "0x", strconv.FormatUint(ptr, 16))
+	case 'n':
+		ptr, n := toPointer(p.arg()), len(p.buf)
+		switch spec.size {
+		case "hh":
+			*(*int8)(ptr) = int8(n)
+		case "h":
+			*(*int16)(ptr) = int16(n)
+		case "":
+			*(*int32)(ptr) = int32(n)
+		default:
+			*(*int64)(ptr) = int64(n)
+		}
+	case '%':
+		p.buf = append(p.buf, '%')
+	default:
+		return false
+	}
+	return true
+}
+
+func (p *formatter) integer(spec *fmtSpec, sign, prefix, digits string) {
+	if spec.prec >= 0 {
+		if spec.prec == 0 && digits == "0" {
+			digits = ""
+		}
+		if n := spec.prec - len(digits); n > 0 {
+			digits = strings.Repeat("0", n) + digits
+		}
+	}
+	if prefix == "0" && strings.HasPrefix(digits, "0") { // %#o
+		prefix = ""
+	}
+	if sign == "" && (spec.verb == 'd' || spec.verb == 'i') {
+		sign = signFlag(spec)
+	}
+	p.number(spec, sign+prefix, digits, spec.prec < 0)
+}
+
+func signFlag(spec *fmtSpec) string {
+	if spec.plus {
+		return "+"
+	}
+	if spec.space {
+		return " "
+	}
+	return ""
+}
+
+// number outputs prefix and digits padded to the field width. Zeros are
+// inserted between them if the '0' flag is in effect.
+func (p *formatter) number(spec *fmtSpec, prefix, digits string, zeroPad bool) {
+	n := spec.width - len(prefix) - len(digits)
+	if n > 0 && spec.zero && !spec.minus && zeroPad {
+		p.buf = append(p.buf, prefix...)
+		p.buf = append(p.buf, strings.Repeat("0", n)...)
+		p.buf = append(p.buf, digits...)
+		return
+	}
+	p.pad(spec, []byte(prefix+digits))
+}
+
+func (p *formatter) pad(spec *fmtSpec, s []byte) {
+	n := spec.width - len(s)
+	if n > 0 && !spec.minus {
+		p.buf = append(p.buf, strings.Repeat(" ", n)...)
+	}
+	p.buf = append(p.buf, s...)
+	if n > 0 && spec.minus {
+		p.buf = append(p.buf, strings.Repeat(" ", n)...)
+	}
+}
+
+func (p *formatter) float(spec *fmtSpec, v float64) {
+	verb := spec.verb
+	upper := verb >= 'A' && verb <= 'Z'
+	sign := signFlag(spec)
+	if math.Signbit(v) {
+		sign, v = "-", -v
+	}
+	var prefix, s string
+	switch {
+	case math.IsInf(v, 0):
+		s = "inf"
+	case math.IsNaN(v):
+		s = "nan"
+	default:
+		prec := spec.prec
+		switch verb | 0x20 {
+		case 'f':
+			if prec < 0 {
+				prec = 6
+			}
+			s = strconv.FormatFloat(v, 'f', prec, 64)
+			if spec.sharp && prec == 0 {
+				s += "."
+			}
+		case 'e':
+			if prec < 0 {
+				prec = 6
+			}
+			s = strconv.FormatFloat(v, 'e', prec, 64)
+			if spec.sharp && prec == 0 {
+				s = s[:1] + "." + s[1:]
+			}
+		case 'g':
+			s = formatG(v, prec, spec.sharp)
+		case 'a':
+			prefix, s = "0x", formatA(v, prec, spec.sharp)
+		}
+	}
+	if upper {
+		prefix, s = strings.ToUpper(prefix), strings.ToUpper(s)
+	}
+	p.number(spec, sign+prefix, s, !math.IsInf(v, 0) && !math.IsNaN(v))
+}
+
+func formatG(v float64, prec int, sharp bool) string {
+	if prec < 0 {
+		prec = 6
+	} else if prec == 0 {
+		prec = 1
+	}
+	e := strconv.FormatFloat(v, 'e', prec-1, 64)
+	x, _ := strconv.Atoi(e[strings.IndexByte(e, 'e')+1:])
+	var s string
+	if prec > x && x >= -4 {
+		s = strconv.FormatFloat(v, 'f', prec-1-x, 64)
+	} else {
+		s = e
+	}
+	if sharp {
+		if strings.IndexByte(s, '.') < 0 {
+			if pos := strings.IndexByte(s, 'e'); pos >= 0 {
+				s = s[:pos] + "." + s[pos:]
+			} else {
+				s += "."
+			}
+		}
+		return s
+	}
+	mant, exp := s, ""
+	if pos := strings.IndexByte(s, 'e'); pos >= 0 {
+		mant, exp = s[:pos], s[pos:]
+	}
+	if strings.IndexByte(mant, '.') >= 0 {
+		mant = strings.TrimRight(strings.TrimRight(mant, "0"), ".")
+	}
+	return mant + exp
+}
+
+// formatA formats v in the style of %a without the 0x prefix.
+func formatA(v float64, prec int, sharp bool) string {
+	if v != 0 && v < 0x1p-1022 {
+		return formatSubnormalA(v, prec, sharp)
+	}
+	s := strconv.FormatFloat(v, 'x', prec, 64)[2:] // strip 0x
+	pos := strings.IndexByte(s, 'p')
+	mant, exp := s[:pos], s[pos+1:]
+	if sharp && strings.IndexByte(mant, '.') < 0 {
+		mant += "."
+	}
+	sign, digits := exp[:1], strings.TrimLeft(exp[1:], "0") // C uses the fewest exponent digits
+	if digits == "" {
+		digits = "0"
+	}
+	return mant + "p" + sign + digits
+}
+
+// formatSubnormalA formats a subnormal v as glibc does, with the leading
+// digit 0 and the exponent of the smallest normal number: 0x0.<fraction>p-1022.
+func formatSubnormalA(v float64, prec int, sharp bool) string {
+	const digits = 13 // of the 52 bits fraction
+	frac := math.Float64bits(v) & (1<<52 - 1)
+	lead := "0"
+	var hex string
+	switch {
+	case prec < 0:
+		hex = strings.TrimRight(padHex(frac, digits), "0")
+	case prec < digits:
+		shift := uint(4 * (digits - prec))
+		q, r, half := frac>>shift, frac&(1<<shift-1), uint64(1)<<(shift-1)
+		if r > half || (r == half && q&1 == 1) { // round half to even
+			q++
+		}
+		if q == 1<<uint(4*prec) {
+			lead, q = "1", 0
+		}
+		if prec > 0 {
+			hex = padHex(q, prec)
+		}
+	default:
+		hex = padHex(frac, digits) + strings.Repeat("0", prec-digits)
+	}
+	if hex != "" || sharp {
+		lead += "."
+	}
+	return lead + hex + "p-1022"
+}
+
+func padHex(v uint64, n int) string {
+	s := strconv.FormatUint(v, 16)
+	return strings.Repeat("0", n-len(s)) + s
+}
+
+// -----------------------------------------------------------------------------
+
+func signedOf(v int64, size string) int64 {
+	switch size {
+	case "hh":
+		return int64(int8(v))
+	case "h":
+		return int64(int16(v))
+	case "":
+		return int64(int32(v))
+	}
+	return v
+}
+
+func unsignedOf(v uint64, size string) uint64 {
+	switch size {
+	case "hh":
+		return uint64(uint8(v))
+	case "h":
+		return uint64(uint16(v))
+	case "":
+		return uint64(uint32(v))
+	}
+	return v
+}
+
+func absOf(v int64) uint64 {
+	if v < 0 {
+		return -uint64(v)
+	}
+	return uint64(v)
+}
+
+func toInt64(arg interface{}) int64 {
+	switch v := arg.(type) {
+	case int32:
+		return int64(v)
+	case int64:
+		return v
+	case uint32:
+		return int64(v)
+	case uint64:
+		return int64(v)
+	case int:
+		return int64(v)
+	case uint:
+		return int64(v)
+	case int8:
+		return int64(v)
+	case int16:
+		return int64(v)
+	case uint8:
+		return int64(v)
+	case uint16:
+		return int64(v)
+	case uintptr:
+		return int64(v)
+	case bool:
+		if v {
+			return 1
+		}
+		return 0
+	case float64:
+		return int64(v)
+	case float32:
+		return int64(v)
+	}
+	return int64(uintptr(toPointer(arg)))
+}
+
+func toFloat64(arg interface{}) float64 {
+	switch v := arg.(type) {
+	case float64:
+		return v
+	case float32:
+		return float64(v)
+	}
+	return float64(toInt64(arg))
+}
+
+func toPointer(arg interface{}) unsafe.Pointer {
+	switch v := arg.(type) {
+	case nil:
+		return nil
+	case unsafe.Pointer:
+		return v
+	case *c.Char:
+		return unsafe.Pointer(v)
+	}
+	if rv := reflect.ValueOf(arg); rv.Kind() == reflect.Ptr || rv.Kind() == reflect.UnsafePointer {
+		return unsafe.Pointer(rv.Pointer())
+	}
+	return nil
+}
+
+// -----------------------------------------------------------------------------
+
+func Printf(format *c.Char, args ...interface{}) c.Int {
+	return Fprintf(Stdout, format, args...)
+}
+
+func Sprintf(buf *c.Char, format *c.Char, args ...interface{}) c.Int {
+	b := Format(format, args)
+	dst := bytesOf(unsafe.Pointer(buf), uintptr(len(b)+1))
+	copy(dst, b)
+	dst[len(b)] = 0
+	return c.Int(len(b))
+}
+
+func Snprintf(buf *c.Char, n c.SizeT, format *c.Char, args ...interface{}) c.Int {
+	b := Format(format, args)
+	if n > 0 {
+		m := len(b)
+		if uintptr(m) >= uintptr(n) {
+			m = int(n - 1)
+		}
+		dst := bytesOf(unsafe.Pointer(buf), uintptr(m+1))
+		copy(dst, b[:m])
+		dst[m] = 0
+	}
+	return c.Int(len(b))
+}
+
+func Puts(s *c.Char) c.Int {
+	if Fputs(s, Stdout) == EOF || Fputc('\n', Stdout) == EOF {
+		return EOF
+	}
+	return 0
+}
+
+func Putchar(ch c.Int) c.Int {
+	return Fputc(ch, Stdout)
+}
+
+// -----------------------------------------------------------------------------
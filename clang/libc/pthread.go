@@ -0,0 +1,699 @@
+package libc
+
+import (
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unsafe"
+
+	c "github.com/goplus/c2go/clang"
+)
+
+// -----------------------------------------------------------------------------
+// POSIX threads run on goroutines: pthread_t is the goroutine id. Mutexes,
+// condition variables and rwlocks live in C memory which may be initialized
+// statically with zeros (PTHREAD_MUTEX_INITIALIZER), so their Go state is kept
+// in a table and created on first use. It is keyed by a handle stored in the
+// C object itself rather than by its address, which changes when the object
+// is a local on a goroutine stack which grows. Destroying an object releases
+// its state, but the state of an object which is never destroyed is kept.
+// Pointers to these C types are taken as unsafe.Pointer, and timeouts as
+// pointers to an absolute struct timespec { time_t tv_sec; long tv_nsec; }.
+
+const (
+	PTHREAD_CREATE_JOINABLE = 0
+	PTHREAD_CREATE_DETACHED = 1
+)
+
+const (
+	PTHREAD_MUTEX_NORMAL     = 0
+	PTHREAD_MUTEX_RECURSIVE  = 1
+	PTHREAD_MUTEX_ERRORCHECK = 2
+)
+
+// offset of __kind in glibc pthread_mutex_t on 64-bit targets, which static
+// initializers such as PTHREAD_RECURSIVE_MUTEX_INITIALIZER_NP set. Static
+// initializers of recursive mutexes of other C libraries aren't recognized.
+const mutexKindOffset = 16
+
+var (
+	objMutex sync.Mutex
+	objs     = make(map[uint32]interface{}) // handle => Go state
+	lastObj  uint32
+)
+
+// The handle of a C synchronization object is kept in its first 4 bytes,
+// which are zero in glibc static initializers (__lock of pthread_mutex_t, for
+// example). A handle which isn't in the table, such as the one of a copy of a
+// destroyed object, is replaced.
+
+// object returns the Go state of a C synchronization object at p, creating
+// it by alloc on first use.
+func object(p unsafe.Pointer, alloc func() interface{}) interface{} {
+	objMutex.Lock()
+	defer objMutex.Unlock()
+	o, ok := objs[*(*uint32)(p)]
+	if !ok {
+		o = alloc()
+		newObject(p, o)
+	}
+	return o
+}
+
+// newObject sets the Go state of the object at p under a new handle. objMutex
+// must be held.
+func newObject(p unsafe.Pointer, o interface{}) {
+	for {
+		if lastObj++; lastObj != 0 {
+			if _, ok := objs[lastObj]; !ok {
+				break
+			}
+		}
+	}
+	objs[lastObj] = o
+	*(*uint32)(p) = lastObj
+}
+
+// setObject sets the Go state of the object at p, or releases it if o is nil.
+func setObject(p unsafe.Pointer, o interface{}) {
+	objMutex.Lock()
+	if o == nil {
+		delete(objs, *(*uint32)(p))
+		*(*uint32)(p) = 0
+	} else {
+		newObject(p, o)
+	}
+	objMutex.Unlock()
+}
+
+// until returns the duration until the absolute time of a struct timespec.
+func until(abstime unsafe.Pointer) time.Duration {
+	ts := (*[2]int64)(abstime)
+	return time.Until(time.Unix(ts[0], ts[1]))
+}
+
+// -----------------------------------------------------------------------------
+
+type thread struct {
+	done     chan struct{}
+	ret      unsafe.Pointer
+	code     c.Int // result of a C11 thread
+	detached int32
+}
+
+var threads sync.Map // goroutine id => *thread
+
+func startThread(detached bool, run func(t *thread)) c.Ulong {
+	t := &thread{done: make(chan struct{})}
+	if detached {
+		t.detached = 1
+	}
+	ids := make(chan uint64)
+	go func() {
+		id := goid()
+		threads.Store(id, t)
+		ids <- id
+		defer t.exit(id)
+		run(t)
+	}()
+	return c.Ulong(<-ids)
+}
+
+func (t *thread) exit(id uint64) {
+	if l, ok := locals.Load(id); ok {
+		runKeyDtors(l.(*threadLocal))
+		releaseLocal(id)
+	}
+	close(t.done)
+	if atomic.LoadInt32(&t.detached) != 0 {
+		threads.Delete(id)
+	}
+}
+
+func self() *thread {
+	if t, ok := threads.Load(goid()); ok {
+		return t.(*thread)
+	}
+	return nil
+}
+
+// join waits for thread th to exit. It reports false if th isn't joinable.
+func join(th c.Ulong) (*thread, bool) {
+	v, ok := threads.Load(uint64(th))
+	if !ok {
+		return nil, false
+	}
+	t := v.(*thread)
+	if atomic.LoadInt32(&t.detached) != 0 {
+		return nil, false
+	}
+	<-t.done
+	threads.Delete(uint64(th))
+	return t, true
+}
+
+func detach(th c.Ulong) bool {
+	v, ok := threads.Load(uint64(th))
+	if !ok {
+		return false
+	}
+	t := v.(*thread)
+	atomic.StoreInt32(&t.detached, 1)
+	select {
+	case <-t.done:
+		threads.Delete(uint64(th))
+	default:
+	}
+	return true
+}
+
+// PthreadCreate implements pthread_create. Only the detach state of attr is
+// honored.
+func PthreadCreate(th *c.Ulong, attr unsafe.Pointer, start func(arg unsafe.Pointer) unsafe.Pointer, arg unsafe.Pointer) c.Int {
+	detached := attr != nil && *(*c.Int)(attr) == PTHREAD_CREATE_DETACHED
+	*th = startThread(detached, func(t *thread) {
+		t.ret = start(arg)
+	})
+	return 0
+}
+
+func PthreadJoin(th c.Ulong, ret *unsafe.Pointer) c.Int {
+	t, ok := join(th)
+	if !ok {
+		return ESRCH
+	}
+	if ret != nil {
+		*ret = t.ret
+	}
+	return 0
+}
+
+func PthreadDetach(th c.Ulong) c.Int {
+	if !detach(th) {
+		return ESRCH
+	}
+	return 0
+}
+
+// PthreadExit implements pthread_exit. Deferred calls of the goroutine run,
+// so does the cleanup of its thread-local storage.
+func PthreadExit(ret unsafe.Pointer) {
+	if t := self(); t != nil {
+		t.ret = ret
+	}
+	runtime.Goexit()
+}
+
+func PthreadSelf() c.Ulong {
+	return c.Ulong(goid())
+}
+
+func PthreadEqual(t1, t2 c.Ulong) c.Int {
+	if t1 == t2 {
+		return 1
+	}
+	return 0
+}
+
+func SchedYield() c.Int {
+	runtime.Gosched()
+	return 0
+}
+
+// pthread_attr_t stores the detach state in its first int.
+
+func PthreadAttrInit(attr unsafe.Pointer) c.Int {
+	*(*c.Int)(attr) = PTHREAD_CREATE_JOINABLE
+	return 0
+}
+
+func PthreadAttrDestroy(attr unsafe.Pointer) c.Int {
+	return 0
+}
+
+func PthreadAttrSetdetachstate(attr unsafe.Pointer, state c.Int) c.Int {
+	if state != PTHREAD_CREATE_JOINABLE && state != PTHREAD_CREATE_DETACHED {
+		return EINVAL
+	}
+	*(*c.Int)(attr) = state
+	return 0
+}
+
+func PthreadAttrGetdetachstate(attr unsafe.Pointer, state *c.Int) c.Int {
+	*state = *(*c.Int)(attr)
+	return 0
+}
+
+// PthreadAttrSetstacksize implements pthread_attr_setstacksize. Goroutine
+// stacks grow on demand, so it does nothing.
+func PthreadAttrSetstacksize(attr unsafe.Pointer, size c.SizeT) c.Int {
+	return 0
+}
+
+// -----------------------------------------------------------------------------
+
+type cmutex struct {
+	ch    chan struct{} // holds a token while locked
+	kind  c.Int
+	owner uint64 // goroutine id of the owner, for recursive and errorcheck mutexes
+	count int
+}
+
+func newMutex(kind c.Int) *cmutex {
+	return &cmutex{ch: make(chan struct{}, 1), kind: kind}
+}
+
+func (m *cmutex) lock(try bool, abstime unsafe.Pointer) c.Int {
+	var id uint64
+	if m.kind != PTHREAD_MUTEX_NORMAL {
+		id = goid()
+		if atomic.LoadUint64(&m.owner) == id {
+			if m.kind != PTHREAD_MUTEX_RECURSIVE {
+				return EDEADLK
+			}
+			m.count++
+			return 0
+		}
+	}
+	switch {
+	case try:
+		select {
+		case m.ch <- struct{}{}:
+		default:
+			return EBUSY
+		}
+	case abstime != nil:
+		timer := time.NewTimer(until(abstime))
+		defer timer.Stop()
+		select {
+		case m.ch <- struct{}{}:
+		case <-timer.C:
+			return ETIMEDOUT
+		}
+	default:
+		m.ch <- struct{}{}
+	}
+	atomic.StoreUint64(&m.owner, id)
+	m.count = 1
+	return 0
+}
+
+func (m *cmutex) unlock() c.Int {
+	if m.kind != PTHREAD_MUTEX_NORMAL {
+		if atomic.LoadUint64(&m.owner) != goid() {
+			return EPERM
+		}
+		if m.count--; m.count > 0 {
+			return 0
+		}
+		atomic.StoreUint64(&m.owner, 0)
+	}
+	select {
+	case <-m.ch:
+		return 0
+	default:
+		return EPERM
+	}
+}
+
+func pthreadMutex(p unsafe.Pointer) *cmutex {
+	return object(p, func() interface{} {
+		return newMutex(*(*c.Int)(add(p, mutexKindOffset)))
+	}).(*cmutex)
+}
+
+// PthreadMutexInit implements pthread_mutex_init. Only the type of attr is
+// honored.
+func PthreadMutexInit(m, attr unsafe.Pointer) c.Int {
+	kind := c.Int(PTHREAD_MUTEX_NORMAL)
+	if attr != nil {
+		kind = *(*c.Int)(attr)
+	}
+	setObject(m, newMutex(kind))
+	return 0
+}
+
+func PthreadMutexDestroy(m unsafe.Pointer) c.Int {
+	setObject(m, nil)
+	return 0
+}
+
+func PthreadMutexLock(m unsafe.Pointer) c.Int {
+	return pthreadMutex(m).lock(false, nil)
+}
+
+func PthreadMutexTrylock(m unsafe.Pointer) c.Int {
+	return pthreadMutex(m).lock(true, nil)
+}
+
+func PthreadMutexTimedlock(m, abstime unsafe.Pointer) c.Int {
+	return pthreadMutex(m).lock(false, abstime)
+}
+
+func PthreadMutexUnlock(m unsafe.Pointer) c.Int {
+	return pthreadMutex(m).unlock()
+}
+
+// pthread_mutexattr_t stores the mutex type in its first int.
+
+func PthreadMutexattrInit(attr unsafe.Pointer) c.Int {
+	*(*c.Int)(attr) = PTHREAD_MUTEX_NORMAL
+	return 0
+}
+
+func PthreadMutexattrDestroy(attr unsafe.Pointer) c.Int {
+	return 0
+}
+
+func PthreadMutexattrSettype(attr unsafe.Pointer, kind c.Int) c.Int {
+	if kind < PTHREAD_MUTEX_NORMAL || kind > PTHREAD_MUTEX_ERRORCHECK {
+		return EINVAL
+	}
+	*(*c.Int)(attr) = kind
+	return 0
+}
+
+func PthreadMutexattrGettype(attr unsafe.Pointer, kind *c.Int) c.Int {
+	*kind = *(*c.Int)(attr)
+	return 0
+}
+
+// -----------------------------------------------------------------------------
+
+type cond struct {
+	mu      sync.Mutex
+	waiters []chan struct{}
+}
+
+func newCond() interface{} {
+	return new(cond)
+}
+
+func (cv *cond) wait(m *cmutex, abstime unsafe.Pointer) c.Int {
+	ch := make(chan struct{})
+	cv.mu.Lock()
+	cv.waiters = append(cv.waiters, ch)
+	cv.mu.Unlock()
+	count := m.count
+	m.count = 1
+	if ret := m.unlock(); ret != 0 {
+		cv.remove(ch)
+		m.count = count
+		return ret
+	}
+	ret := c.Int(0)
+	if abstime == nil {
+		<-ch
+	} else {
+		timer := time.NewTimer(until(abstime))
+		select {
+		case <-ch:
+		case <-timer.C:
+			if cv.remove(ch) {
+				ret = ETIMEDOUT
+			}
+		}
+		timer.Stop()
+	}
+	m.lock(false, nil)
+	m.count = count
+	return ret
+}
+
+// remove removes a waiter which timed out. It reports false if the waiter
+// has been signaled.
+func (cv *cond) remove(ch chan struct{}) bool {
+	cv.mu.Lock()
+	defer cv.mu.Unlock()
+	for i, w := range cv.waiters {
+		if w == ch {
+			cv.waiters = append(cv.waiters[:i], cv.waiters[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+func (cv *cond) signal(all bool) {
+	cv.mu.Lock()
+	n := len(cv.waiters)
+	if !all && n > 1 {
+		n = 1
+	}
+	for _, w := range cv.waiters[:n] {
+		close(w)
+	}
+	cv.waiters = cv.waiters[n:]
+	cv.mu.Unlock()
+}
+
+func pthreadCond(p unsafe.Pointer) *cond {
+	return object(p, newCond).(*cond)
+}
+
+func PthreadCondInit(cv, attr unsafe.Pointer) c.Int {
+	setObject(cv, newCond())
+	return 0
+}
+
+func PthreadCondDestroy(cv unsafe.Pointer) c.Int {
+	setObject(cv, nil)
+	return 0
+}
+
+func PthreadCondWait(cv, m unsafe.Pointer) c.Int {
+	return pthreadCond(cv).wait(pthreadMutex(m), nil)
+}
+
+func PthreadCondTimedwait(cv, m, abstime unsafe.Pointer) c.Int {
+	return pthreadCond(cv).wait(pthreadMutex(m), abstime)
+}
+
+func PthreadCondSignal(cv unsafe.Pointer) c.Int {
+	pthreadCond(cv).signal(false)
+	return 0
+}
+
+func PthreadCondBroadcast(cv unsafe.Pointer) c.Int {
+	pthreadCond(cv).signal(true)
+	return 0
+}
+
+// -----------------------------------------------------------------------------
+
+// rwlock is a readers-writer lock which prefers writers.
+type rwlock struct {
+	mu      sync.Mutex
+	cv      *sync.Cond
+	readers int
+	writer  bool
+	waiting int // writers waiting for the lock
+}
+
+func newRWLock() interface{} {
+	l := new(rwlock)
+	l.cv = sync.NewCond(&l.mu)
+	return l
+}
+
+func (l *rwlock) rdlock(try bool) c.Int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for l.writer || l.waiting > 0 {
+		if try {
+			return EBUSY
+		}
+		l.cv.Wait()
+	}
+	l.readers++
+	return 0
+}
+
+func (l *rwlock) wrlock(try bool) c.Int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.writer || l.readers > 0 {
+		if try {
+			return EBUSY
+		}
+		l.waiting++
+		for l.writer || l.readers > 0 {
+			l.cv.Wait()
+		}
+		l.waiting--
+	}
+	l.writer = true
+	return 0
+}
+
+func (l *rwlock) unlock() c.Int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	switch {
+	case l.writer:
+		l.writer = false
+	case l.readers > 0:
+		l.readers--
+	default:
+		return EPERM
+	}
+	l.cv.Broadcast()
+	return 0
+}
+
+func pthreadRWLock(p unsafe.Pointer) *rwlock {
+	return object(p, newRWLock).(*rwlock)
+}
+
+func PthreadRwlockInit(l, attr unsafe.Pointer) c.Int {
+	setObject(l, newRWLock())
+	return 0
+}
+
+func PthreadRwlockDestroy(l unsafe.Pointer) c.Int {
+	setObject(l, nil)
+	return 0
+}
+
+func PthreadRwlockRdlock(l unsafe.Pointer) c.Int {
+	return pthreadRWLock(l).rdlock(false)
+}
+
+func PthreadRwlockTryrdlock(l unsafe.Pointer) c.Int {
+	return pthreadRWLock(l).rdlock(true)
+}
+
+func PthreadRwlockWrlock(l unsafe.Pointer) c.Int {
+	return pthreadRWLock(l).wrlock(false)
+}
+
+func PthreadRwlockTrywrlock(l unsafe.Pointer) c.Int {
+	return pthreadRWLock(l).wrlock(true)
+}
+
+func PthreadRwlockUnlock(l unsafe.Pointer) c.Int {
+	return pthreadRWLock(l).unlock()
+}
+
+// -----------------------------------------------------------------------------
+
+const (
+	onceInit = iota
+	onceRunning
+	onceDone
+)
+
+// once runs fn once for the pthread_once_t or once_flag (an int) at p.
+func once(p unsafe.Pointer, fn func()) {
+	state := (*int32)(p)
+	if atomic.LoadInt32(state) == onceDone {
+		return
+	}
+	if atomic.CompareAndSwapInt32(state, onceInit, onceRunning) {
+		defer atomic.StoreInt32(state, onceDone)
+		fn()
+		return
+	}
+	for atomic.LoadInt32(state) != onceDone {
+		runtime.Gosched()
+	}
+}
+
+func PthreadOnce(p unsafe.Pointer, fn func()) c.Int {
+	once(p, fn)
+	return 0
+}
+
+// -----------------------------------------------------------------------------
+
+// Key is pthread_key_t and tss_t.
+type Key = c.Uint
+
+// PTHREAD_DESTRUCTOR_ITERATIONS is the number of times destructors of keys
+// run when a thread exits, while values are set again by destructors.
+const PTHREAD_DESTRUCTOR_ITERATIONS = 4
+
+var (
+	keyMutex sync.Mutex
+	keyDtors []func(unsafe.Pointer) // nil for keys without destructors
+	keyUsed  []bool
+)
+
+func keyCreate(key *Key, dtor func(unsafe.Pointer)) {
+	keyMutex.Lock()
+	defer keyMutex.Unlock()
+	for i, used := range keyUsed {
+		if !used {
+			keyDtors[i], keyUsed[i] = dtor, true
+			*key = Key(i)
+			return
+		}
+	}
+	*key = Key(len(keyUsed))
+	keyDtors = append(keyDtors, dtor)
+	keyUsed = append(keyUsed, true)
+}
+
+func keyDelete(key Key) bool {
+	keyMutex.Lock()
+	defer keyMutex.Unlock()
+	if int(key) >= len(keyUsed) || !keyUsed[key] {
+		return false
+	}
+	keyDtors[key], keyUsed[key] = nil, false
+	return true
+}
+
+func getspecific(key Key) unsafe.Pointer {
+	return local().keys[key]
+}
+
+func setspecific(key Key, v unsafe.Pointer) {
+	l := local()
+	if l.keys == nil {
+		l.keys = make(map[Key]unsafe.Pointer)
+	}
+	l.keys[key] = v
+}
+
+func runKeyDtors(l *threadLocal) {
+	for i := 0; i < PTHREAD_DESTRUCTOR_ITERATIONS && len(l.keys) > 0; i++ {
+		keys := l.keys
+		l.keys = nil
+		for key, v := range keys {
+			keyMutex.Lock()
+			var dtor func(unsafe.Pointer)
+			if int(key) < len(keyDtors) {
+				dtor = keyDtors[key]
+			}
+			keyMutex.Unlock()
+			if v != nil && dtor != nil {
+				dtor(v)
+			}
+		}
+	}
+}
+
+func PthreadKeyCreate(key *Key, dtor func(unsafe.Pointer)) c.Int {
+	keyCreate(key, dtor)
+	return 0
+}
+
+func PthreadKeyDelete(key Key) c.Int {
+	if !keyDelete(key) {
+		return EINVAL
+	}
+	return 0
+}
+
+func PthreadGetspecific(key Key) unsafe.Pointer {
+	return getspecific(key)
+}
+
+func PthreadSetspecific(key Key, v unsafe.Pointer) c.Int {
+	setspecific(key, v)
+	return 0
+}
+
+// -----------------------------------------------------------------------------
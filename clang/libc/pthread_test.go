@@ -0,0 +1,193 @@
+package libc
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+	"unsafe"
+
+	c "github.com/goplus/c2go/clang"
+)
+
+// -----------------------------------------------------------------------------
+
+func TestThread(t *testing.T) {
+	var mutex [40]byte // statically initialized
+	var n int
+	start := func(arg unsafe.Pointer) unsafe.Pointer {
+		for i := 0; i < 1000; i++ {
+			PthreadMutexLock(unsafe.Pointer(&mutex))
+			n++
+			PthreadMutexUnlock(unsafe.Pointer(&mutex))
+		}
+		return arg
+	}
+	var ths [4]c.Ulong
+	for i := range ths {
+		PthreadCreate(&ths[i], nil, start, unsafe.Pointer(&ths[i]))
+	}
+	for i, th := range ths {
+		var ret unsafe.Pointer
+		if PthreadJoin(th, &ret) != 0 || ret != unsafe.Pointer(&ths[i]) {
+			t.Fatal("PthreadJoin:", ret)
+		}
+	}
+	if n != 4000 {
+		t.Fatal("n =", n)
+	}
+	if PthreadJoin(ths[0], nil) != ESRCH {
+		t.Fatal("PthreadJoin: joined twice")
+	}
+}
+
+func TestMutex(t *testing.T) {
+	var m, attr [40]byte
+	PthreadMutexattrInit(unsafe.Pointer(&attr))
+	PthreadMutexattrSettype(unsafe.Pointer(&attr), PTHREAD_MUTEX_RECURSIVE)
+	PthreadMutexInit(unsafe.Pointer(&m), unsafe.Pointer(&attr))
+	defer PthreadMutexDestroy(unsafe.Pointer(&m))
+	if PthreadMutexLock(unsafe.Pointer(&m)) != 0 || PthreadMutexLock(unsafe.Pointer(&m)) != 0 {
+		t.Fatal("PthreadMutexLock: recursive")
+	}
+	var th c.Ulong
+	PthreadCreate(&th, nil, func(unsafe.Pointer) unsafe.Pointer {
+		if PthreadMutexTrylock(unsafe.Pointer(&m)) != EBUSY || PthreadMutexUnlock(unsafe.Pointer(&m)) != EPERM {
+			t.Error("PthreadMutexTrylock: not busy")
+		}
+		return nil
+	}, nil)
+	PthreadJoin(th, nil)
+	PthreadMutexUnlock(unsafe.Pointer(&m))
+	PthreadMutexUnlock(unsafe.Pointer(&m))
+	if PthreadMutexTrylock(unsafe.Pointer(&m)) != 0 {
+		t.Fatal("PthreadMutexTrylock: busy")
+	}
+}
+
+func TestMovedMutex(t *testing.T) {
+	var m [40]byte
+	*(*c.Int)(unsafe.Pointer(&m[mutexKindOffset])) = PTHREAD_MUTEX_ERRORCHECK
+	n := len(objs)
+	if PthreadMutexLock(unsafe.Pointer(&m)) != 0 {
+		t.Fatal("PthreadMutexLock")
+	}
+	moved := m // as a goroutine stack which grows
+	m = [40]byte{}
+	if ret := PthreadMutexUnlock(unsafe.Pointer(&moved)); ret != 0 {
+		t.Fatal("PthreadMutexUnlock:", ret)
+	}
+	PthreadMutexDestroy(unsafe.Pointer(&moved))
+	if len(objs) != n {
+		t.Fatal("PthreadMutexDestroy: state isn't released")
+	}
+}
+
+func TestCond(t *testing.T) {
+	var m, cv [48]byte
+	ready := 0
+	var th c.Ulong
+	PthreadCreate(&th, nil, func(unsafe.Pointer) unsafe.Pointer {
+		PthreadMutexLock(unsafe.Pointer(&m))
+		ready = 1
+		PthreadCondSignal(unsafe.Pointer(&cv))
+		PthreadMutexUnlock(unsafe.Pointer(&m))
+		return nil
+	}, nil)
+	PthreadMutexLock(unsafe.Pointer(&m))
+	for ready == 0 {
+		PthreadCondWait(unsafe.Pointer(&cv), unsafe.Pointer(&m))
+	}
+	deadline := [2]int64{time.Now().Unix() - 1, 0}
+	if ret := PthreadCondTimedwait(unsafe.Pointer(&cv), unsafe.Pointer(&m), unsafe.Pointer(&deadline)); ret != ETIMEDOUT {
+		t.Fatal("PthreadCondTimedwait:", ret)
+	}
+	PthreadMutexUnlock(unsafe.Pointer(&m))
+	PthreadJoin(th, nil)
+}
+
+func TestRWLock(t *testing.T) {
+	var l [56]byte
+	p := unsafe.Pointer(&l)
+	if PthreadRwlockRdlock(p) != 0 || PthreadRwlockTryrdlock(p) != 0 || PthreadRwlockTrywrlock(p) != EBUSY {
+		t.Fatal("PthreadRwlockRdlock")
+	}
+	PthreadRwlockUnlock(p)
+	PthreadRwlockUnlock(p)
+	if PthreadRwlockWrlock(p) != 0 || PthreadRwlockTryrdlock(p) != EBUSY {
+		t.Fatal("PthreadRwlockWrlock")
+	}
+	PthreadRwlockUnlock(p)
+}
+
+func TestOnceAndKeys(t *testing.T) {
+	var flag c.Int
+	n := 0
+	var key Key
+	var freed []unsafe.Pointer
+	PthreadKeyCreate(&key, func(v unsafe.Pointer) {
+		freed = append(freed, v)
+	})
+	var ths [4]c.Ulong
+	for i := range ths {
+		ThrdCreate(&ths[i], func(arg unsafe.Pointer) c.Int {
+			CallOnce(unsafe.Pointer(&flag), func() { n++ })
+			PthreadSetspecific(key, arg)
+			if PthreadGetspecific(key) != arg {
+				return 1
+			}
+			return 2
+		}, unsafe.Pointer(&ths[i]))
+	}
+	for _, th := range ths {
+		var res c.Int
+		if ThrdJoin(th, &res) != thrd_success || res != 2 {
+			t.Fatal("ThrdJoin:", res)
+		}
+	}
+	if n != 1 || len(freed) != 4 {
+		t.Fatal("CallOnce:", n, "freed:", len(freed))
+	}
+	if PthreadGetspecific(key) != nil || PthreadKeyDelete(key) != 0 {
+		t.Fatal("PthreadGetspecific: not thread-local")
+	}
+}
+
+func TestTLS(t *testing.T) {
+	init := c.Int(7)
+	x := NewTLS(&init)
+	*(*c.Int)(x.Get()) = 1
+	*ErrnoLocation() = EINVAL
+	var th c.Ulong
+	ThrdCreate(&th, func(unsafe.Pointer) c.Int {
+		if *ErrnoLocation() != 0 {
+			return -1
+		}
+		return *(*c.Int)(x.Get())
+	}, nil)
+	var res c.Int
+	ThrdJoin(th, &res)
+	if res != 7 || *(*c.Int)(x.Get()) != 1 || *ErrnoLocation() != EINVAL {
+		t.Fatal("TLS:", res)
+	}
+}
+
+func TestTLSSweep(t *testing.T) {
+	var wg sync.WaitGroup
+	for i := 0; i < 4*minSweep; i++ { // goroutines which aren't C threads
+		wg.Add(1)
+		go func() {
+			*ErrnoLocation() = EINVAL
+			wg.Done()
+		}()
+		wg.Wait()
+	}
+	if n := atomic.LoadInt64(&nlocals); n >= 2*minSweep {
+		t.Fatal("TLS of exited goroutines isn't released:", n)
+	}
+	if *ErrnoLocation() = EDOM; *ErrnoLocation() != EDOM {
+		t.Fatal("TLS: errno lost")
+	}
+}
+
+// -----------------------------------------------------------------------------
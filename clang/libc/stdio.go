@@ -0,0 +1,381 @@
+package libc
+
+import (
+	"io"
+	"math/bits"
+	"os"
+	"sync"
+	"unsafe"
+
+	c "github.com/goplus/c2go/clang"
+)
+
+// -----------------------------------------------------------------------------
+
+// FILE is the Go implementation of C FILE. Reads are buffered, while writes
+// go to the underlying file immediately, so that nothing is lost if the
+// process exits without closing or flushing the stream. Like glibc streams,
+// a FILE is locked by each call of the functions below, so that threads can
+// share it.
+type FILE struct {
+	mu    sync.Mutex // guards the fields below
+	f     *os.File
+	rbuf  []byte // buffered input which isn't consumed yet
+	unget []byte // pushed back by ungetc (in reverse order)
+	eof   bool
+	err   bool
+}
+
+var (
+	Stdin  = &FILE{f: os.Stdin}
+	Stdout = &FILE{f: os.Stdout}
+	Stderr = &FILE{f: os.Stderr}
+)
+
+const (
+	EOF = -1
+)
+
+func newFILE(f *os.File) *FILE {
+	return &FILE{f: f}
+}
+
+func (fp *FILE) fill() bool {
+	if len(fp.rbuf) > 0 {
+		return true
+	}
+	buf := make([]byte, 4096)
+	n, err := fp.f.Read(buf)
+	fp.rbuf = buf[:n]
+	if n > 0 {
+		return true
+	}
+	if err == io.EOF || err == nil {
+		fp.eof = true
+	} else {
+		fp.err = true
+		seterr(err)
+	}
+	return false
+}
+
+func (fp *FILE) getc() int {
+	if n := len(fp.unget); n > 0 {
+		ch := fp.unget[n-1]
+		fp.unget = fp.unget[:n-1]
+		return int(ch)
+	}
+	if !fp.fill() {
+		return EOF
+	}
+	ch := fp.rbuf[0]
+	fp.rbuf = fp.rbuf[1:]
+	return int(ch)
+}
+
+func (fp *FILE) read(b []byte) int {
+	n := 0
+	for n < len(b) && len(fp.unget) > 0 {
+		b[n] = byte(fp.getc())
+		n++
+	}
+	for n < len(b) && fp.fill() {
+		m := copy(b[n:], fp.rbuf)
+		fp.rbuf = fp.rbuf[m:]
+		n += m
+	}
+	return n
+}
+
+// discard drops buffered input and moves the file offset back to the
+// position of the stream.
+func (fp *FILE) discard() {
+	if n := len(fp.rbuf) + len(fp.unget); n > 0 {
+		fp.f.Seek(int64(-n), io.SeekCurrent) // fails on pipes and terminals
+		fp.rbuf, fp.unget = nil, nil
+	}
+}
+
+func (fp *FILE) write(b []byte) int {
+	fp.discard()
+	n, err := fp.f.Write(b)
+	if err != nil {
+		fp.err = true
+		seterr(err)
+	}
+	return n
+}
+
+// -----------------------------------------------------------------------------
+
+// openFlags converts a fopen mode to os.OpenFile flags.
+func openFlags(mode string) (flag int, ok bool) {
+	if mode == "" {
+		return
+	}
+	plus := false
+	for _, ch := range mode[1:] {
+		if ch == '+' {
+			plus = true
+		}
+	}
+	switch mode[0] {
+	case 'r':
+		flag = os.O_RDONLY
+		if plus {
+			flag = os.O_RDWR
+		}
+	case 'w':
+		flag = os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+		if plus {
+			flag = os.O_RDWR | os.O_CREATE | os.O_TRUNC
+		}
+	case 'a':
+		flag = os.O_WRONLY | os.O_CREATE | os.O_APPEND
+		if plus {
+			flag = os.O_RDWR | os.O_CREATE | os.O_APPEND
+		}
+	default:
+		return
+	}
+	return flag, true
+}
+
+func Fopen(path, mode *c.Char) *FILE {
+	flag, ok := openFlags(GoString(mode))
+	if !ok {
+		*ErrnoLocation() = EINVAL
+		return nil
+	}
+	f, err := os.OpenFile(GoString(path), flag, 0666)
+	if err != nil {
+		seterr(err)
+		return nil
+	}
+	return newFILE(f)
+}
+
+func Fdopen(fd c.Int, mode *c.Char) *FILE {
+	if _, ok := openFlags(GoString(mode)); !ok {
+		*ErrnoLocation() = EINVAL
+		return nil
+	}
+	return newFILE(os.NewFile(uintptr(fd), ""))
+}
+
+func Fclose(fp *FILE) c.Int {
+	if err := fp.f.Close(); err != nil {
+		return seterr(err)
+	}
+	return 0
+}
+
+func Fflush(fp *FILE) c.Int {
+	if fp == nil {
+		return 0
+	}
+	fp.mu.Lock()
+	defer fp.mu.Unlock()
+	if fp.err {
+		return EOF
+	}
+	return 0 // writes are never buffered
+}
+
+func Setvbuf(fp *FILE, buf *c.Char, mode c.Int, size c.SizeT) c.Int {
+	return 0
+}
+
+// Fread implements fread. It reads nothing and sets errno to EINVAL if
+// size*n overflows.
+func Fread(p unsafe.Pointer, size, n c.SizeT, fp *FILE) c.SizeT {
+	total, ok := streamSize(size, n)
+	if !ok {
+		return 0
+	}
+	fp.mu.Lock()
+	defer fp.mu.Unlock()
+	return c.SizeT(fp.read(bytesOf(p, total))) / size
+}
+
+// Fwrite implements fwrite. It writes nothing and sets errno to EINVAL if
+// size*n overflows.
+func Fwrite(p unsafe.Pointer, size, n c.SizeT, fp *FILE) c.SizeT {
+	total, ok := streamSize(size, n)
+	if !ok {
+		return 0
+	}
+	fp.mu.Lock()
+	defer fp.mu.Unlock()
+	return c.SizeT(fp.write(bytesOf(p, total))) / size
+}
+
+// streamSize returns size*n, the bytes of a fread or fwrite. It reports false
+// if there's nothing to transfer, or if size*n overflows.
+func streamSize(size, n c.SizeT) (uintptr, bool) {
+	if size == 0 || n == 0 {
+		return 0, false
+	}
+	hi, lo := bits.Mul64(uint64(size), uint64(n))
+	if hi != 0 || uint64(uintptr(lo)) != lo {
+		*ErrnoLocation() = EINVAL
+		return 0, false
+	}
+	return uintptr(lo), true
+}
+
+func Fseek(fp *FILE, off c.Long, whence c.Int) c.Int {
+	fp.mu.Lock()
+	defer fp.mu.Unlock()
+	return fp.seek(off, whence)
+}
+
+func (fp *FILE) seek(off c.Long, whence c.Int) c.Int {
+	if whence == SEEK_CUR {
+		off -= c.Long(len(fp.rbuf) + len(fp.unget))
+	}
+	fp.rbuf, fp.unget = nil, nil
+	if _, err := fp.f.Seek(int64(off), int(whence)); err != nil {
+		return seterr(err)
+	}
+	fp.eof = false
+	return 0
+}
+
+func Ftell(fp *FILE) c.Long {
+	fp.mu.Lock()
+	defer fp.mu.Unlock()
+	off, err := fp.f.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return c.Long(seterr(err))
+	}
+	return c.Long(off) - c.Long(len(fp.rbuf)+len(fp.unget))
+}
+
+func Rewind(fp *FILE) {
+	fp.mu.Lock()
+	fp.seek(0, SEEK_SET)
+	fp.err = false
+	fp.mu.Unlock()
+}
+
+func Fgetc(fp *FILE) c.Int {
+	fp.mu.Lock()
+	defer fp.mu.Unlock()
+	return c.Int(fp.getc())
+}
+
+func Getchar() c.Int {
+	return Fgetc(Stdin)
+}
+
+func Ungetc(ch c.Int, fp *FILE) c.Int {
+	if ch == EOF {
+		return EOF
+	}
+	fp.mu.Lock()
+	defer fp.mu.Unlock()
+	fp.unget = append(fp.unget, byte(ch))
+	fp.eof = false
+	return ch & 0xff
+}
+
+func Fgets(s *c.Char, n c.Int, fp *FILE) *c.Char {
+	if n <= 0 {
+		return nil
+	}
+	b := bytesOf(unsafe.Pointer(s), uintptr(n))
+	fp.mu.Lock()
+	defer fp.mu.Unlock()
+	i := 0
+	for i < int(n)-1 {
+		ch := fp.getc()
+		if ch == EOF {
+			break
+		}
+		b[i] = byte(ch)
+		i++
+		if ch == '\n' {
+			break
+		}
+	}
+	if i == 0 {
+		return nil
+	}
+	b[i] = 0
+	return s
+}
+
+func Fputc(ch c.Int, fp *FILE) c.Int {
+	fp.mu.Lock()
+	defer fp.mu.Unlock()
+	if fp.write([]byte{byte(ch)}) != 1 {
+		return EOF
+	}
+	return ch & 0xff
+}
+
+func Fputs(s *c.Char, fp *FILE) c.Int {
+	b := bytesOf(unsafe.Pointer(s), strlen(s))
+	fp.mu.Lock()
+	defer fp.mu.Unlock()
+	if fp.write(b) != len(b) {
+		return EOF
+	}
+	return 0
+}
+
+func Feof(fp *FILE) c.Int {
+	fp.mu.Lock()
+	defer fp.mu.Unlock()
+	return boolToInt(fp.eof)
+}
+
+func Ferror(fp *FILE) c.Int {
+	fp.mu.Lock()
+	defer fp.mu.Unlock()
+	return boolToInt(fp.err)
+}
+
+func Clearerr(fp *FILE) {
+	fp.mu.Lock()
+	fp.eof, fp.err = false, false
+	fp.mu.Unlock()
+}
+
+func Fileno(fp *FILE) c.Int {
+	return c.Int(fp.f.Fd())
+}
+
+func Fprintf(fp *FILE, format *c.Char, args ...interface{}) c.Int {
+	b := Format(format, args)
+	fp.mu.Lock()
+	defer fp.mu.Unlock()
+	if fp.write(b) != len(b) {
+		return -1
+	}
+	return c.Int(len(b))
+}
+
+func Remove(path *c.Char) c.Int {
+	if err := os.Remove(GoString(path)); err != nil {
+		return seterr(err)
+	}
+	return 0
+}
+
+func Rename(from, to *c.Char) c.Int {
+	if err := os.Rename(GoString(from), GoString(to)); err != nil {
+		return seterr(err)
+	}
+	return 0
+}
+
+func boolToInt(v bool) c.Int {
+	if v {
+		return 1
+	}
+	return 0
+}
+
+// -----------------------------------------------------------------------------
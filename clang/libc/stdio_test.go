@@ -0,0 +1,100 @@
+package libc
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"unsafe"
+
+	c "github.com/goplus/c2go/clang"
+)
+
+// -----------------------------------------------------------------------------
+
+func TestFILE(t *testing.T) {
+	path := CString(filepath.Join(t.TempDir(), "a.txt"))
+	fp := Fopen(path, CString("w+"))
+	if fp == nil {
+		t.Fatal("Fopen:", *ErrnoLocation())
+	}
+	Fprintf(fp, CString("line %d\nsecond\n"), int32(1))
+	Fputs(CString("x"), fp)
+	if pos := Ftell(fp); pos != 15 {
+		t.Fatal("Ftell:", pos)
+	}
+	Rewind(fp)
+	var buf [16]c.Char
+	if Fgets(&buf[0], 16, fp) == nil || GoString(&buf[0]) != "line 1\n" {
+		t.Fatal("Fgets:", GoString(&buf[0]))
+	}
+	ch := Fgetc(fp)
+	Ungetc(ch, fp)
+	if pos := Ftell(fp); ch != 's' || pos != 7 {
+		t.Fatal("Ungetc:", ch, pos)
+	}
+	if n := Fread(unsafe.Pointer(&buf[0]), 1, 16, fp); n != 8 || Feof(fp) == 0 {
+		t.Fatal("Fread:", n)
+	}
+	Fseek(fp, -1, SEEK_END)
+	Fputc('y', fp)
+	Fseek(fp, 0, SEEK_SET)
+	if n := Fread(unsafe.Pointer(&buf[0]), 2, 8, fp); n != 7 || string(bytesOf(unsafe.Pointer(&buf[0]), 14)) != "line 1\nsecond\n" {
+		t.Fatal("Fwrite:", n)
+	}
+	if buf[14] != 'y' || Fgetc(fp) != EOF {
+		t.Fatal("Fputc")
+	}
+	if Fclose(fp) != 0 || Remove(path) != 0 {
+		t.Fatal("Fclose/Remove")
+	}
+	if Fopen(path, CString("r")) != nil || *ErrnoLocation() != ENOENT {
+		t.Fatal("Fopen: errno =", *ErrnoLocation())
+	}
+	if GoString(Strerror(ENOENT)) != "No such file or directory" {
+		t.Fatal("Strerror:", GoString(Strerror(ENOENT)))
+	}
+}
+
+func TestFILEThreads(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "a.txt")
+	lines := make([]byte, 0, 4000)
+	for i := 0; i < 1000; i++ {
+		lines = append(lines, "abc\n"...)
+	}
+	if err := os.WriteFile(path, lines, 0666); err != nil {
+		t.Fatal(err)
+	}
+	fp := Fopen(CString(path), CString("r"))
+	*ErrnoLocation() = 0
+	var buf [4]c.Char
+	if n := Fread(unsafe.Pointer(&buf[0]), 1<<32, 1<<32, fp); n != 0 || *ErrnoLocation() != EINVAL {
+		t.Fatal("Fread: overflow not detected -", n)
+	}
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	n := 0
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var line [8]c.Char
+			for Fgets(&line[0], 8, fp) != nil {
+				if GoString(&line[0]) != "abc\n" {
+					t.Error("Fgets:", GoString(&line[0]))
+					return
+				}
+				mu.Lock()
+				n++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if n != 1000 {
+		t.Fatal("Fgets: lines read -", n)
+	}
+	Fclose(fp)
+}
+
+// -----------------------------------------------------------------------------
@@ -0,0 +1,470 @@
+package libc
+
+import (
+	"math"
+	"math/big"
+	"math/bits"
+	"os"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"unsafe"
+
+	c "github.com/goplus/c2go/clang"
+)
+
+// -----------------------------------------------------------------------------
+
+var (
+	mutex sync.Mutex
+	sizes = make(map[uintptr]uintptr) // sizes of blocks allocated by Malloc
+)
+
+// Malloc allocates memory from the Go heap. It is garbage collected when it
+// is no longer referenced, so Free only forgets its size, which is forgotten
+// as well when a block which is never freed is collected.
+func Malloc(n c.SizeT) unsafe.Pointer {
+	return MallocAt(n, "")
+}
+
+// MallocAt is Malloc called at the C source position site, which is recorded
+// if memory checking is enabled (see EnableMemcheck).
+func MallocAt(n c.SizeT, site string) unsafe.Pointer {
+	data := make([]unsafe.Pointer, allocSize(uintptr(n))/8) // memory may hold Go pointers
+	p := unsafe.Pointer(&data[0])
+	mutex.Lock()
+	sizes[uintptr(p)] = uintptr(n)
+	if memblocks != nil {
+		memblocks[uintptr(p)] = &memBlock{p: p, size: uintptr(n), site: site}
+	}
+	mutex.Unlock()
+	runtime.SetFinalizer(&data[0], forgetSize) // the address isn't reused before it runs
+	return p
+}
+
+// allocSize returns the size of the memory which Malloc allocates for n bytes.
+func allocSize(n uintptr) uintptr {
+	if n == 0 { // malloc(0) returns a unique pointer
+		return 8
+	}
+	return (n + 7) &^ 7
+}
+
+func forgetSize(p *unsafe.Pointer) {
+	mutex.Lock()
+	delete(sizes, uintptr(unsafe.Pointer(p)))
+	mutex.Unlock()
+}
+
+func Calloc(n, size c.SizeT) unsafe.Pointer {
+	return CallocAt(n, size, "")
+}
+
+// CallocAt is Calloc called at the C source position site. It returns NULL
+// if n*size overflows.
+func CallocAt(n, size c.SizeT, site string) unsafe.Pointer {
+	hi, lo := bits.Mul64(uint64(n), uint64(size))
+	if hi != 0 {
+		return nil
+	}
+	return MallocAt(c.SizeT(lo), site)
+}
+
+func Realloc(p unsafe.Pointer, n c.SizeT) unsafe.Pointer {
+	return ReallocAt(p, n, "")
+}
+
+func ReallocAt(p unsafe.Pointer, n c.SizeT, site string) unsafe.Pointer {
+	if p == nil {
+		return MallocAt(n, site)
+	}
+	mutex.Lock()
+	old, ok := sizes[uintptr(p)]
+	checking := memblocks != nil
+	mutex.Unlock()
+	if !ok {
+		if checking {
+			badFree("realloc", p, site)
+			return nil
+		}
+		panic("realloc: invalid pointer")
+	}
+	if uintptr(n) <= old {
+		return p
+	}
+	ret := MallocAt(n, site)
+	copy(bytesOf(ret, old), bytesOf(p, old))
+	FreeAt(p, site)
+	return ret
+}
+
+func Free(p unsafe.Pointer) {
+	FreeAt(p, "")
+}
+
+// FreeAt is Free called at the C source position site. If memory checking is
+// enabled, it reports a double free or a free of a pointer which isn't
+// returned by Malloc.
+func FreeAt(p unsafe.Pointer, site string) {
+	if p == nil {
+		return
+	}
+	mutex.Lock()
+	_, ok := sizes[uintptr(p)]
+	delete(sizes, uintptr(p))
+	checking := memblocks != nil
+	if ok && checking {
+		if b := memblocks[uintptr(p)]; b != nil {
+			b.freed, b.freeSite = true, site
+			quarantine(b)
+		}
+	}
+	mutex.Unlock()
+	if !ok && checking {
+		badFree("free", p, site)
+	}
+}
+
+// -----------------------------------------------------------------------------
+
+type sorter struct {
+	base unsafe.Pointer
+	n    int
+	size uintptr
+	cmp  func(a, b unsafe.Pointer) c.Int
+	tmp  []byte
+}
+
+func (p *sorter) elem(i int) unsafe.Pointer {
+	return add(p.base, uintptr(i)*p.size)
+}
+
+func (p *sorter) Len() int           { return p.n }
+func (p *sorter) Less(i, j int) bool { return p.cmp(p.elem(i), p.elem(j)) < 0 }
+
+func (p *sorter) Swap(i, j int) {
+	a, b := bytesOf(p.elem(i), p.size), bytesOf(p.elem(j), p.size)
+	copy(p.tmp, a)
+	copy(a, b)
+	copy(b, p.tmp)
+}
+
+func Qsort(base unsafe.Pointer, n, size c.SizeT, cmp func(a, b unsafe.Pointer) c.Int) {
+	if n > 1 && size > 0 {
+		sort.Sort(&sorter{base: base, n: int(n), size: uintptr(size), cmp: cmp, tmp: make([]byte, size)})
+	}
+}
+
+func Bsearch(key, base unsafe.Pointer, n, size c.SizeT, cmp func(a, b unsafe.Pointer) c.Int) unsafe.Pointer {
+	lo, hi := uintptr(0), uintptr(n)
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+		elem := add(base, mid*uintptr(size))
+		switch r := cmp(key, elem); {
+		case r < 0:
+			hi = mid
+		case r > 0:
+			lo = mid + 1
+		default:
+			return elem
+		}
+	}
+	return nil
+}
+
+// -----------------------------------------------------------------------------
+
+func isspace(ch byte) bool {
+	return ch == ' ' || (ch >= '\t' && ch <= '\r')
+}
+
+func digitVal(ch byte) uint64 {
+	switch {
+	case ch >= '0' && ch <= '9':
+		return uint64(ch - '0')
+	case ch >= 'a' && ch <= 'z':
+		return uint64(ch-'a') + 10
+	case ch >= 'A' && ch <= 'Z':
+		return uint64(ch-'A') + 10
+	}
+	return 36
+}
+
+// strtoi parses an integer as strtoull does. The result is the magnitude of
+// the value and its sign; overflow reports if the magnitude exceeds uint64.
+// Like glibc it sets errno to EINVAL and leaves end alone if base is invalid.
+func strtoi(s *c.Char, end **c.Char, base c.Int) (v uint64, neg, overflow bool) {
+	if base < 0 || base == 1 || base > 36 {
+		*ErrnoLocation() = EINVAL
+		return
+	}
+	p := unsafe.Pointer(s)
+	at := func(i uintptr) byte { return *(*byte)(add(p, i)) }
+	i := uintptr(0)
+	for isspace(at(i)) {
+		i++
+	}
+	switch at(i) {
+	case '-':
+		neg = true
+		fallthrough
+	case '+':
+		i++
+	}
+	hexPrefix := at(i) == '0' && (at(i+1) == 'x' || at(i+1) == 'X') && digitVal(at(i+2)) < 16
+	switch {
+	case base == 0 && hexPrefix:
+		base, i = 16, i+2
+	case base == 0 && at(i) == '0':
+		base = 8
+	case base == 0:
+		base = 10
+	case base == 16 && hexPrefix:
+		i += 2
+	}
+	start := i
+	for ; ; i++ {
+		d := digitVal(at(i))
+		if d >= uint64(base) {
+			break
+		}
+		if v > (math.MaxUint64-d)/uint64(base) {
+			overflow = true
+		}
+		v = v*uint64(base) + d
+	}
+	if end != nil {
+		if i == start {
+			*end = s
+		} else {
+			*end = (*c.Char)(add(p, i))
+		}
+	}
+	return
+}
+
+// toSigned converts a result of strtoi to a signed integer of bits. Like
+// glibc it clamps the value and sets errno to ERANGE on overflow.
+func toSigned(v uint64, neg, overflow bool, bits uint) int64 {
+	max := uint64(1)<<(bits-1) - 1
+	if neg {
+		if overflow || v > max+1 {
+			*ErrnoLocation() = ERANGE
+			return -int64(max) - 1
+		}
+		return -int64(v)
+	}
+	if overflow || v > max {
+		*ErrnoLocation() = ERANGE
+		return int64(max)
+	}
+	return int64(v)
+}
+
+// toUnsigned converts a result of strtoi to an unsigned integer of bits. Like
+// glibc it clamps the value and sets errno to ERANGE on overflow.
+func toUnsigned(v uint64, neg, overflow bool, bits uint) uint64 {
+	max := ^uint64(0) >> (64 - bits)
+	if overflow || v > max {
+		*ErrnoLocation() = ERANGE
+		return max
+	}
+	if neg {
+		return -v & max
+	}
+	return v
+}
+
+func Strtol(s *c.Char, end **c.Char, base c.Int) c.Long {
+	v, neg, overflow := strtoi(s, end, base)
+	return c.Long(toSigned(v, neg, overflow, uint(unsafe.Sizeof(c.Long(0)))*8))
+}
+
+func Strtoul(s *c.Char, end **c.Char, base c.Int) c.Ulong {
+	v, neg, overflow := strtoi(s, end, base)
+	return c.Ulong(toUnsigned(v, neg, overflow, uint(unsafe.Sizeof(c.Ulong(0)))*8))
+}
+
+func Strtoll(s *c.Char, end **c.Char, base c.Int) int64 {
+	v, neg, overflow := strtoi(s, end, base)
+	return toSigned(v, neg, overflow, 64)
+}
+
+func Strtoull(s *c.Char, end **c.Char, base c.Int) uint64 {
+	v, neg, overflow := strtoi(s, end, base)
+	return toUnsigned(v, neg, overflow, 64)
+}
+
+func Atoi(s *c.Char) c.Int {
+	return c.Int(Strtol(s, nil, 10))
+}
+
+func Atol(s *c.Char) c.Long {
+	return Strtol(s, nil, 10)
+}
+
+func Atoll(s *c.Char) int64 {
+	return Strtoll(s, nil, 10)
+}
+
+// -----------------------------------------------------------------------------
+
+// scanFloat returns the length of the longest prefix of s which is a C
+// floating constant (after leading spaces), and the text to be parsed by
+// strconv.ParseFloat.
+func scanFloat(s string) (n int, text string) {
+	i := 0
+	for i < len(s) && isspace(s[i]) {
+		i++
+	}
+	start := i
+	if i < len(s) && (s[i] == '+' || s[i] == '-') {
+		i++
+	}
+	rest := strings.ToLower(s[i:])
+	switch {
+	case strings.HasPrefix(rest, "infinity"):
+		return i + 8, s[start:i] + "inf"
+	case strings.HasPrefix(rest, "inf"):
+		return i + 3, s[start:i] + "inf"
+	case strings.HasPrefix(rest, "nan"):
+		n = i + 3
+		if j := strings.IndexByte(s[n:], ')'); j > 0 && s[n] == '(' { // nan(n-char-sequence)
+			if strings.IndexFunc(s[n+1:n+j], func(r rune) bool { return digitVal(byte(r)) > 35 && r != '_' }) < 0 {
+				n += j + 1
+			}
+		}
+		return n, "nan"
+	}
+	digits, expChar, maxDigit := 0, byte('e'), uint64(10)
+	if len(rest) > 1 && rest[0] == '0' && rest[1] == 'x' {
+		j := 2
+		if j < len(rest) && rest[j] == '.' {
+			j++
+		}
+		if j < len(rest) && digitVal(rest[j]) < 16 {
+			i, expChar, maxDigit = i+2, 'p', 16
+		}
+	}
+	for i < len(s) && digitVal(s[i]) < maxDigit {
+		i, digits = i+1, digits+1
+	}
+	if i < len(s) && s[i] == '.' {
+		i++
+		for i < len(s) && digitVal(s[i]) < maxDigit {
+			i, digits = i+1, digits+1
+		}
+	}
+	if digits == 0 {
+		return 0, ""
+	}
+	hasExp := false
+	if i < len(s) && (s[i]|0x20) == expChar {
+		j := i + 1
+		if j < len(s) && (s[j] == '+' || s[j] == '-') {
+			j++
+		}
+		if j < len(s) && s[j] >= '0' && s[j] <= '9' {
+			for j < len(s) && s[j] >= '0' && s[j] <= '9' {
+				j++
+			}
+			i, hasExp = j, true
+		}
+	}
+	text = s[start:i]
+	if expChar == 'p' && !hasExp {
+		text += "p0"
+	}
+	return i, text
+}
+
+func Strtod(s *c.Char, end **c.Char) c.Double {
+	n, text := scanFloat(GoString(s))
+	if end != nil {
+		*end = (*c.Char)(add(unsafe.Pointer(s), uintptr(n)))
+	}
+	if n == 0 {
+		return 0
+	}
+	return parseFloat(text, 64)
+}
+
+func Strtof(s *c.Char, end **c.Char) c.Float {
+	n, text := scanFloat(GoString(s))
+	if end != nil {
+		*end = (*c.Char)(add(unsafe.Pointer(s), uintptr(n)))
+	}
+	if n == 0 {
+		return 0
+	}
+	return c.Float(parseFloat(text, 32))
+}
+
+func Strtold(s *c.Char, end **c.Char) c.Double { // long double is double
+	return Strtod(s, end)
+}
+
+// parseFloat parses text returned by scanFloat. Like glibc it sets errno to
+// ERANGE on overflow, and on underflow: a result of zero from a nonzero
+// number, or a subnormal result which is not exact.
+func parseFloat(text string, bitSize int) float64 {
+	v, err := strconv.ParseFloat(text, bitSize) // ±Inf on overflow
+	if err != nil {
+		*ErrnoLocation() = ERANGE
+		return v
+	}
+	minNormal := 0x1p-1022
+	if bitSize == 32 {
+		minNormal = 0x1p-126
+	}
+	if abs := math.Abs(v); abs < minNormal && !math.IsNaN(v) {
+		var exact big.Rat
+		if _, ok := exact.SetString(text); ok && exact.Cmp(new(big.Rat).SetFloat64(v)) != 0 {
+			*ErrnoLocation() = ERANGE
+		}
+	}
+	return v
+}
+
+func Atof(s *c.Char) c.Double {
+	return Strtod(s, nil)
+}
+
+// -----------------------------------------------------------------------------
+
+var (
+	exitMutex sync.Mutex
+	exitFns   []func()
+)
+
+func Atexit(fn func()) c.Int {
+	exitMutex.Lock()
+	exitFns = append(exitFns, fn)
+	exitMutex.Unlock()
+	return 0
+}
+
+// Exit calls functions registered by Atexit in the reverse order of their
+// registration, and then terminates the process.
+func Exit(status c.Int) {
+	for {
+		exitMutex.Lock()
+		n := len(exitFns)
+		if n == 0 {
+			exitMutex.Unlock()
+			break
+		}
+		fn := exitFns[n-1]
+		exitFns = exitFns[:n-1]
+		exitMutex.Unlock()
+		fn()
+	}
+	if memcheckEnabled() {
+		MemReport()
+	}
+	os.Exit(int(status))
+}
+
+// -----------------------------------------------------------------------------
@@ -0,0 +1,140 @@
+package libc
+
+import (
+	"unsafe"
+
+	c "github.com/goplus/c2go/clang"
+)
+
+// -----------------------------------------------------------------------------
+
+func Strlen(s *c.Char) c.SizeT {
+	return c.SizeT(strlen(s))
+}
+
+func Strcmp(a, b *c.Char) c.Int {
+	return Strncmp(a, b, ^c.SizeT(0))
+}
+
+func Strncmp(a, b *c.Char, n c.SizeT) c.Int {
+	p, q := unsafe.Pointer(a), unsafe.Pointer(b)
+	for i := uintptr(0); i < uintptr(n); i++ {
+		x, y := *(*byte)(add(p, i)), *(*byte)(add(q, i))
+		if x != y {
+			return c.Int(x) - c.Int(y)
+		}
+		if x == 0 {
+			break
+		}
+	}
+	return 0
+}
+
+func Strcpy(dst, src *c.Char) *c.Char {
+	n := strlen(src) + 1
+	copy(bytesOf(unsafe.Pointer(dst), n), bytesOf(unsafe.Pointer(src), n))
+	return dst
+}
+
+func Strncpy(dst, src *c.Char, n c.SizeT) *c.Char {
+	d := bytesOf(unsafe.Pointer(dst), uintptr(n))
+	p := unsafe.Pointer(src)
+	i := 0
+	for ; i < len(d); i++ {
+		if d[i] = *(*byte)(add(p, uintptr(i))); d[i] == 0 {
+			break
+		}
+	}
+	for ; i < len(d); i++ { // pad with NULs
+		d[i] = 0
+	}
+	return dst
+}
+
+func Strcat(dst, src *c.Char) *c.Char {
+	Strcpy((*c.Char)(add(unsafe.Pointer(dst), strlen(dst))), src)
+	return dst
+}
+
+func Strchr(s *c.Char, ch c.Int) *c.Char {
+	p := unsafe.Pointer(s)
+	for i := uintptr(0); ; i++ {
+		b := *(*byte)(add(p, i))
+		if b == byte(ch) {
+			return (*c.Char)(add(p, i))
+		}
+		if b == 0 {
+			return nil
+		}
+	}
+}
+
+func Strrchr(s *c.Char, ch c.Int) *c.Char {
+	p := unsafe.Pointer(s)
+	for i := strlen(s) + 1; i > 0; i-- {
+		if *(*byte)(add(p, i-1)) == byte(ch) {
+			return (*c.Char)(add(p, i-1))
+		}
+	}
+	return nil
+}
+
+func Strstr(s, sub *c.Char) *c.Char {
+	n := strlen(sub)
+	for p := unsafe.Pointer(s); ; p = add(p, 1) {
+		if Strncmp((*c.Char)(p), sub, c.SizeT(n)) == 0 {
+			return (*c.Char)(p)
+		}
+		if *(*byte)(p) == 0 {
+			return nil
+		}
+	}
+}
+
+func Strdup(s *c.Char) *c.Char {
+	n := strlen(s) + 1
+	p := Malloc(c.SizeT(n))
+	copy(bytesOf(p, n), bytesOf(unsafe.Pointer(s), n))
+	return (*c.Char)(p)
+}
+
+// -----------------------------------------------------------------------------
+
+func Memcpy(dst, src unsafe.Pointer, n c.SizeT) unsafe.Pointer {
+	copy(bytesOf(dst, uintptr(n)), bytesOf(src, uintptr(n)))
+	return dst
+}
+
+func Memmove(dst, src unsafe.Pointer, n c.SizeT) unsafe.Pointer {
+	copy(bytesOf(dst, uintptr(n)), bytesOf(src, uintptr(n)))
+	return dst
+}
+
+func Memset(dst unsafe.Pointer, ch c.Int, n c.SizeT) unsafe.Pointer {
+	b := bytesOf(dst, uintptr(n))
+	for i := range b {
+		b[i] = byte(ch)
+	}
+	return dst
+}
+
+func Memcmp(a, b unsafe.Pointer, n c.SizeT) c.Int {
+	x, y := bytesOf(a, uintptr(n)), bytesOf(b, uintptr(n))
+	for i := range x {
+		if x[i] != y[i] {
+			return c.Int(x[i]) - c.Int(y[i])
+		}
+	}
+	return 0
+}
+
+func Memchr(s unsafe.Pointer, ch c.Int, n c.SizeT) unsafe.Pointer {
+	for i, b := range bytesOf(s, uintptr(n)) {
+		if b == byte(ch) {
+			return add(s, uintptr(i))
+		}
+	}
+	return nil
+}
+
+// -----------------------------------------------------------------------------
@@ -0,0 +1,177 @@
+package libc
+
+import (
+	"runtime"
+	"time"
+	"unsafe"
+
+	c "github.com/goplus/c2go/clang"
+)
+
+// -----------------------------------------------------------------------------
+// C11 threads (threads.h) share the implementation of POSIX threads: thrd_t is
+// the goroutine id, and the Go state of mtx_t and cnd_t is kept as the one of
+// pthread_mutex_t and pthread_cond_t.
+
+const (
+	thrd_success  = 0
+	thrd_busy     = 1
+	thrd_error    = 2
+	thrd_nomem    = 3
+	thrd_timedout = 4
+)
+
+const (
+	mtx_plain     = 0
+	mtx_recursive = 1
+	mtx_timed     = 2
+)
+
+// thrdResult converts a result of POSIX threads to the C11 one.
+func thrdResult(ret c.Int) c.Int {
+	switch ret {
+	case 0:
+		return thrd_success
+	case EBUSY:
+		return thrd_busy
+	case ETIMEDOUT:
+		return thrd_timedout
+	}
+	return thrd_error
+}
+
+func ThrdCreate(th *c.Ulong, start func(arg unsafe.Pointer) c.Int, arg unsafe.Pointer) c.Int {
+	*th = startThread(false, func(t *thread) {
+		t.code = start(arg)
+	})
+	return thrd_success
+}
+
+func ThrdJoin(th c.Ulong, res *c.Int) c.Int {
+	t, ok := join(th)
+	if !ok {
+		return thrd_error
+	}
+	if res != nil {
+		*res = t.code
+	}
+	return thrd_success
+}
+
+func ThrdDetach(th c.Ulong) c.Int {
+	if !detach(th) {
+		return thrd_error
+	}
+	return thrd_success
+}
+
+func ThrdExit(res c.Int) {
+	if t := self(); t != nil {
+		t.code = res
+	}
+	runtime.Goexit()
+}
+
+func ThrdCurrent() c.Ulong {
+	return c.Ulong(goid())
+}
+
+func ThrdEqual(t1, t2 c.Ulong) c.Int {
+	return PthreadEqual(t1, t2)
+}
+
+func ThrdYield() {
+	runtime.Gosched()
+}
+
+// ThrdSleep implements thrd_sleep. It is never interrupted, so rem is left
+// unchanged.
+func ThrdSleep(duration, rem unsafe.Pointer) c.Int {
+	ts := (*[2]int64)(duration)
+	time.Sleep(time.Duration(ts[0])*time.Second + time.Duration(ts[1]))
+	return 0
+}
+
+// -----------------------------------------------------------------------------
+
+func MtxInit(m unsafe.Pointer, typ c.Int) c.Int {
+	kind := c.Int(PTHREAD_MUTEX_NORMAL)
+	if typ&mtx_recursive != 0 {
+		kind = PTHREAD_MUTEX_RECURSIVE
+	}
+	setObject(m, newMutex(kind))
+	return thrd_success
+}
+
+func MtxDestroy(m unsafe.Pointer) {
+	setObject(m, nil)
+}
+
+func MtxLock(m unsafe.Pointer) c.Int {
+	return thrdResult(PthreadMutexLock(m))
+}
+
+func MtxTrylock(m unsafe.Pointer) c.Int {
+	return thrdResult(PthreadMutexTrylock(m))
+}
+
+func MtxTimedlock(m, abstime unsafe.Pointer) c.Int {
+	return thrdResult(PthreadMutexTimedlock(m, abstime))
+}
+
+func MtxUnlock(m unsafe.Pointer) c.Int {
+	return thrdResult(PthreadMutexUnlock(m))
+}
+
+// -----------------------------------------------------------------------------
+
+func CndInit(cv unsafe.Pointer) c.Int {
+	setObject(cv, newCond())
+	return thrd_success
+}
+
+func CndDestroy(cv unsafe.Pointer) {
+	setObject(cv, nil)
+}
+
+func CndWait(cv, m unsafe.Pointer) c.Int {
+	return thrdResult(PthreadCondWait(cv, m))
+}
+
+func CndTimedwait(cv, m, abstime unsafe.Pointer) c.Int {
+	return thrdResult(PthreadCondTimedwait(cv, m, abstime))
+}
+
+func CndSignal(cv unsafe.Pointer) c.Int {
+	return thrdResult(PthreadCondSignal(cv))
+}
+
+func CndBroadcast(cv unsafe.Pointer) c.Int {
+	return thrdResult(PthreadCondBroadcast(cv))
+}
+
+// -----------------------------------------------------------------------------
+
+func CallOnce(flag unsafe.Pointer, fn func()) {
+	once(flag, fn)
+}
+
+func TssCreate(key *Key, dtor func(unsafe.Pointer)) c.Int {
+	keyCreate(key, dtor)
+	return thrd_success
+}
+
+func TssDelete(key Key) {
+	keyDelete(key)
+}
+
+func TssGet(key Key) unsafe.Pointer {
+	return getspecific(key)
+}
+
+func TssSet(key Key, v unsafe.Pointer) c.Int {
+	setspecific(key, v)
+	return thrd_success
+}
+
+// -----------------------------------------------------------------------------
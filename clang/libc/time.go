@@ -0,0 +1,389 @@
+package libc
+
+import (
+	"strconv"
+	"sync"
+	"time"
+	"unsafe"
+
+	c "github.com/goplus/c2go/clang"
+)
+
+// -----------------------------------------------------------------------------
+// time.h in the C locale. Pointers to struct tm, struct timespec and struct
+// timeval are taken and returned as unsafe.Pointer. time_t is long.
+
+// tm is struct tm of glibc.
+type tm struct {
+	sec, min, hour, mday, mon, year, wday, yday, isdst c.Int
+
+	gmtoff c.Long
+	zone   *c.Char
+}
+
+var (
+	tmbuf   tm // result of gmtime and localtime
+	zoneMu  sync.Mutex
+	zones   = make(map[string]*c.Char)
+	ascbuf  [26]c.Char // result of asctime and ctime
+	started = time.Now()
+)
+
+func zoneName(name string) *c.Char {
+	zoneMu.Lock()
+	defer zoneMu.Unlock()
+	s, ok := zones[name]
+	if !ok {
+		s = CString(name)
+		zones[name] = s
+	}
+	return s
+}
+
+func (p *tm) set(t time.Time) {
+	name, off := t.Zone()
+	p.sec, p.min, p.hour = c.Int(t.Second()), c.Int(t.Minute()), c.Int(t.Hour())
+	p.mday, p.mon, p.year = c.Int(t.Day()), c.Int(t.Month()-1), c.Int(t.Year()-1900)
+	p.wday, p.yday = c.Int(t.Weekday()), c.Int(t.YearDay()-1)
+	p.isdst = 0
+	if t.IsDST() {
+		p.isdst = 1
+	}
+	p.gmtoff, p.zone = c.Long(off), zoneName(name)
+}
+
+func (p *tm) time(loc *time.Location) time.Time {
+	return time.Date(int(p.year)+1900, time.Month(p.mon+1), int(p.mday),
+		int(p.hour), int(p.min), int(p.sec), 0, loc)
+}
+
+func Time(t *c.Long) c.Long {
+	now := c.Long(time.Now().Unix())
+	if t != nil {
+		*t = now
+	}
+	return now
+}
+
+func Difftime(t1, t0 c.Long) c.Double {
+	return c.Double(t1 - t0)
+}
+
+func Gmtime(t *c.Long) unsafe.Pointer {
+	return GmtimeR(t, unsafe.Pointer(&tmbuf))
+}
+
+func GmtimeR(t *c.Long, result unsafe.Pointer) unsafe.Pointer {
+	(*tm)(result).set(time.Unix(int64(*t), 0).UTC())
+	return result
+}
+
+func Localtime(t *c.Long) unsafe.Pointer {
+	return LocaltimeR(t, unsafe.Pointer(&tmbuf))
+}
+
+func LocaltimeR(t *c.Long, result unsafe.Pointer) unsafe.Pointer {
+	(*tm)(result).set(time.Unix(int64(*t), 0).Local())
+	return result
+}
+
+// Mktime implements mktime. It normalizes the fields of the struct tm, whose
+// tm_isdst is ignored.
+func Mktime(p unsafe.Pointer) c.Long {
+	t := (*tm)(p).time(time.Local)
+	(*tm)(p).set(t)
+	return c.Long(t.Unix())
+}
+
+func Timegm(p unsafe.Pointer) c.Long {
+	t := (*tm)(p).time(time.UTC)
+	(*tm)(p).set(t)
+	return c.Long(t.Unix())
+}
+
+// Tzset implements tzset. The local time zone is loaded once by package time.
+func Tzset() {
+}
+
+func Asctime(p unsafe.Pointer) *c.Char {
+	return AsctimeR(p, &ascbuf[0])
+}
+
+func AsctimeR(p unsafe.Pointer, buf *c.Char) *c.Char {
+	t := (*tm)(p)
+	s := weekdays[t.wday%7][:3] + " " + months[t.mon%12][:3] + " " + pad(int(t.mday), 2, ' ') + " " +
+		pad(int(t.hour), 2, '0') + ":" + pad(int(t.min), 2, '0') + ":" + pad(int(t.sec), 2, '0') + " " +
+		strconv.Itoa(int(t.year)+1900) + "\n"
+	b := bytesOf(unsafe.Pointer(buf), uintptr(len(s)+1))
+	copy(b, s)
+	b[len(s)] = 0
+	return buf
+}
+
+func Ctime(t *c.Long) *c.Char {
+	return Asctime(Localtime(t))
+}
+
+// -----------------------------------------------------------------------------
+
+var weekdays = [...]string{
+	"Sunday", "Monday", "Tuesday", "Wednesday", "Thursday", "Friday", "Saturday",
+}
+
+var months = [...]string{
+	"January", "February", "March", "April", "May", "June",
+	"July", "August", "September", "October", "November", "December",
+}
+
+func pad(v, width int, ch byte) string {
+	s := strconv.Itoa(v)
+	if v < 0 {
+		return s
+	}
+	for len(s) < width {
+		s = string(ch) + s
+	}
+	return s
+}
+
+func isLeap(year int) bool {
+	return year%4 == 0 && (year%100 != 0 || year%400 == 0)
+}
+
+// isoWeekDays returns the number of days from the first day of the first ISO
+// week of the year to the day yday, which is a weekday wday.
+func isoWeekDays(yday, wday int) int {
+	const bigEnoughMultipleOf7 = (366/7 + 2) * 7
+	return yday - (yday-wday+4+bigEnoughMultipleOf7)%7 + 3
+}
+
+// isoWeek returns the ISO 8601 year and week of t.
+func (t *tm) isoWeek() (year, week int) {
+	year = int(t.year) + 1900
+	yday, wday := int(t.yday), int(t.wday)
+	days := isoWeekDays(yday, wday)
+	if days < 0 {
+		year--
+		days = isoWeekDays(yday+365+int(bool2int(isLeap(year))), wday)
+	} else if d := isoWeekDays(yday-365-int(bool2int(isLeap(year))), wday); d >= 0 {
+		year++
+		days = d
+	}
+	return year, days/7 + 1
+}
+
+// strftime appends t formatted by format to b.
+func (t *tm) strftime(b []byte, format string) []byte {
+	for i := 0; i < len(format); i++ {
+		ch := format[i]
+		if ch != '%' || i+1 == len(format) {
+			b = append(b, ch)
+			continue
+		}
+		i++
+		if ch = format[i]; (ch == 'E' || ch == 'O') && i+1 < len(format) { // alternative representations
+			i++
+			ch = format[i]
+		}
+		hour12 := int(t.hour) % 12
+		if hour12 == 0 {
+			hour12 = 12
+		}
+		switch ch {
+		case 'a':
+			b = append(b, weekdays[t.wday%7][:3]...)
+		case 'A':
+			b = append(b, weekdays[t.wday%7]...)
+		case 'b', 'h':
+			b = append(b, months[t.mon%12][:3]...)
+		case 'B':
+			b = append(b, months[t.mon%12]...)
+		case 'c':
+			b = t.strftime(b, "%a %b %e %H:%M:%S %Y")
+		case 'C':
+			b = append(b, pad((int(t.year)+1900)/100, 2, '0')...)
+		case 'd':
+			b = append(b, pad(int(t.mday), 2, '0')...)
+		case 'D', 'x':
+			b = t.strftime(b, "%m/%d/%y")
+		case 'e':
+			b = append(b, pad(int(t.mday), 2, ' ')...)
+		case 'F':
+			b = t.strftime(b, "%Y-%m-%d")
+		case 'g':
+			year, _ := t.isoWeek()
+			b = append(b, pad((year%100+100)%100, 2, '0')...)
+		case 'G':
+			year, _ := t.isoWeek()
+			b = strconv.AppendInt(b, int64(year), 10)
+		case 'H':
+			b = append(b, pad(int(t.hour), 2, '0')...)
+		case 'I':
+			b = append(b, pad(hour12, 2, '0')...)
+		case 'j':
+			b = append(b, pad(int(t.yday)+1, 3, '0')...)
+		case 'k':
+			b = append(b, pad(int(t.hour), 2, ' ')...)
+		case 'l':
+			b = append(b, pad(hour12, 2, ' ')...)
+		case 'm':
+			b = append(b, pad(int(t.mon)+1, 2, '0')...)
+		case 'M':
+			b = append(b, pad(int(t.min), 2, '0')...)
+		case 'n':
+			b = append(b, '\n')
+		case 'p':
+			if t.hour < 12 {
+				b = append(b, "AM"...)
+			} else {
+				b = append(b, "PM"...)
+			}
+		case 'P':
+			if t.hour < 12 {
+				b = append(b, "am"...)
+			} else {
+				b = append(b, "pm"...)
+			}
+		case 'r':
+			b = t.strftime(b, "%I:%M:%S %p")
+		case 'R':
+			b = t.strftime(b, "%H:%M")
+		case 's':
+			b = strconv.AppendInt(b, t.time(time.Local).Unix(), 10)
+		case 'S':
+			b = append(b, pad(int(t.sec), 2, '0')...)
+		case 't':
+			b = append(b, '\t')
+		case 'T', 'X':
+			b = t.strftime(b, "%H:%M:%S")
+		case 'u':
+			b = strconv.AppendInt(b, int64((t.wday+6)%7+1), 10)
+		case 'U':
+			b = append(b, pad(int(t.yday+7-t.wday)/7, 2, '0')...)
+		case 'V':
+			_, week := t.isoWeek()
+			b = append(b, pad(week, 2, '0')...)
+		case 'w':
+			b = strconv.AppendInt(b, int64(t.wday), 10)
+		case 'W':
+			b = append(b, pad(int(t.yday+7-(t.wday+6)%7)/7, 2, '0')...)
+		case 'y':
+			b = append(b, pad((int(t.year)%100+100)%100, 2, '0')...)
+		case 'Y':
+			b = strconv.AppendInt(b, int64(t.year)+1900, 10)
+		case 'z':
+			off, sign := int(t.gmtoff)/60, byte('+')
+			if off < 0 {
+				off, sign = -off, '-'
+			}
+			b = append(append(b, sign), pad(off/60*100+off%60, 4, '0')...)
+		case 'Z':
+			if t.zone != nil {
+				b = append(b, GoString(t.zone)...)
+			}
+		case '%':
+			b = append(b, '%')
+		default:
+			b = append(b, '%', ch)
+		}
+	}
+	return b
+}
+
+// Strftime implements strftime in the C locale. It returns 0 if the result
+// and its terminating NUL don't fit in max bytes.
+func Strftime(s *c.Char, max c.SizeT, format *c.Char, p unsafe.Pointer) c.SizeT {
+	b := (*tm)(p).strftime(nil, GoString(format))
+	if uintptr(len(b)) >= uintptr(max) {
+		return 0
+	}
+	dst := bytesOf(unsafe.Pointer(s), uintptr(len(b)+1))
+	copy(dst, b)
+	dst[len(b)] = 0
+	return c.SizeT(len(b))
+}
+
+// -----------------------------------------------------------------------------
+
+const (
+	CLOCK_REALTIME           = 0
+	CLOCK_MONOTONIC          = 1
+	CLOCK_PROCESS_CPUTIME_ID = 2
+	CLOCK_THREAD_CPUTIME_ID  = 3
+)
+
+// setTimespec stores d in a struct timespec { time_t tv_sec; long tv_nsec; }.
+func setTimespec(ts unsafe.Pointer, d time.Duration) {
+	v := (*[2]int64)(ts)
+	v[0], v[1] = int64(d/time.Second), int64(d%time.Second)
+}
+
+// ClockGettime implements clock_gettime. CLOCK_MONOTONIC counts from the start
+// of the process, and the CPU time clocks are of the process.
+func ClockGettime(clk c.Int, ts unsafe.Pointer) c.Int {
+	var d time.Duration
+	switch clk {
+	case CLOCK_REALTIME:
+		d = time.Duration(time.Now().UnixNano())
+	case CLOCK_MONOTONIC:
+		d = time.Since(started)
+	case CLOCK_PROCESS_CPUTIME_ID, CLOCK_THREAD_CPUTIME_ID:
+		d = cputime()
+	default:
+		*ErrnoLocation() = EINVAL
+		return -1
+	}
+	setTimespec(ts, d)
+	return 0
+}
+
+func ClockGetres(clk c.Int, res unsafe.Pointer) c.Int {
+	if clk < CLOCK_REALTIME || clk > CLOCK_THREAD_CPUTIME_ID {
+		*ErrnoLocation() = EINVAL
+		return -1
+	}
+	if res != nil {
+		setTimespec(res, time.Nanosecond)
+	}
+	return 0
+}
+
+// CLOCKS_PER_SEC is the unit of Clock.
+const CLOCKS_PER_SEC = 1000000
+
+// Clock implements clock: the CPU time used by the process.
+func Clock() c.Long {
+	return c.Long(cputime() / time.Microsecond)
+}
+
+// Gettimeofday implements gettimeofday. The time zone is never set.
+func Gettimeofday(tv, tz unsafe.Pointer) c.Int {
+	now := time.Now()
+	v := (*[2]int64)(tv)
+	v[0], v[1] = now.Unix(), int64(now.Nanosecond()/1000)
+	return 0
+}
+
+// Nanosleep implements nanosleep. It is never interrupted, so rem is left
+// unchanged.
+func Nanosleep(req, rem unsafe.Pointer) c.Int {
+	v := (*[2]int64)(req)
+	if v[1] < 0 || v[1] >= 1e9 || v[0] < 0 {
+		*ErrnoLocation() = EINVAL
+		return -1
+	}
+	time.Sleep(time.Duration(v[0])*time.Second + time.Duration(v[1]))
+	return 0
+}
+
+func Sleep(sec c.Uint) c.Uint {
+	time.Sleep(time.Duration(sec) * time.Second)
+	return 0
+}
+
+func Usleep(usec c.Uint) c.Int {
+	time.Sleep(time.Duration(usec) * time.Microsecond)
+	return 0
+}
+
+// -----------------------------------------------------------------------------
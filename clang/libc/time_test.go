@@ -0,0 +1,54 @@
+package libc
+
+import (
+	"testing"
+	"unsafe"
+
+	c "github.com/goplus/c2go/clang"
+)
+
+// -----------------------------------------------------------------------------
+
+func TestGmtime(t *testing.T) {
+	sec := c.Long(1234567890)
+	p := (*tm)(Gmtime(&sec))
+	if p.year != 109 || p.mon != 1 || p.mday != 13 || p.hour != 23 || p.min != 31 || p.sec != 30 || p.wday != 5 || p.yday != 43 {
+		t.Fatal("gmtime:", *p)
+	}
+	if s := GoString(Asctime(unsafe.Pointer(p))); s != "Fri Feb 13 23:31:30 2009\n" {
+		t.Fatal("asctime:", s)
+	}
+	v := *p
+	v.mday += 20
+	if ret := Timegm(unsafe.Pointer(&v)); ret != sec+20*86400 || v.mon != 2 || v.mday != 5 {
+		t.Fatal("timegm:", ret, v)
+	}
+}
+
+func TestStrftime(t *testing.T) {
+	sec := c.Long(1104537600) // Sat Jan 1 2005, in week 53 of 2004
+	var buf [64]c.Char
+	n := Strftime(&buf[0], 64, CString("%F %T %a %j %G-W%V-%u %U %W %I%p %%"), Gmtime(&sec))
+	if s := GoString(&buf[0]); s != "2005-01-01 00:00:00 Sat 001 2004-W53-6 00 00 12AM %" || int(n) != len(s) {
+		t.Fatal("strftime:", s, n)
+	}
+	if n := Strftime(&buf[0], 4, CString("%Y"), Gmtime(&sec)); n != 0 {
+		t.Fatal("strftime: overflow", n)
+	}
+}
+
+func TestClock(t *testing.T) {
+	var ts0, ts1 [2]c.Long
+	ClockGettime(CLOCK_MONOTONIC, unsafe.Pointer(&ts0))
+	Usleep(1000)
+	ClockGettime(CLOCK_MONOTONIC, unsafe.Pointer(&ts1))
+	if d := (ts1[0]-ts0[0])*1e9 + ts1[1] - ts0[1]; d < 1e6 {
+		t.Fatal("clock_gettime:", d)
+	}
+	if ClockGettime(-100, unsafe.Pointer(&ts0)) != -1 || *ErrnoLocation() != EINVAL {
+		t.Fatal("clock_gettime: invalid clock")
+	}
+	*ErrnoLocation() = 0
+}
+
+// -----------------------------------------------------------------------------
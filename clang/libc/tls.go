@@ -0,0 +1,168 @@
+package libc
+
+import (
+	"bytes"
+	"reflect"
+	"runtime"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"unsafe"
+)
+
+// -----------------------------------------------------------------------------
+
+// A C thread is a goroutine. Thread-local storage (__thread and _Thread_local
+// variables, errno, pthread keys) is kept per goroutine, keyed by the goroutine
+// id, which Go doesn't expose but in the header of runtime.Stack. So every
+// access of errno or of a thread-local variable costs a runtime.Stack call of
+// about a microsecond: code which accesses them in hot loops should copy them
+// to local variables.
+//
+// Storage of a thread started by PthreadCreate or ThrdCreate is released when
+// it exits. Storage of other goroutines, such as the ones of go statements of
+// hand-written Go code, is released by a sweep of exited goroutines, which runs
+// when the number of goroutines with storage doubles, so it doesn't grow
+// unbounded. Destructors of pthread keys don't run for them.
+
+type threadLocal struct {
+	vars map[*TLS]unsafe.Pointer
+	keys map[Key]unsafe.Pointer
+}
+
+const minSweep = 256
+
+var (
+	locals     sync.Map          // goroutine id => *threadLocal
+	nlocals    int64             // number of entries of locals
+	nsweep     = int64(minSweep) // nlocals which triggers the next sweep
+	sweepMutex sync.Mutex
+)
+
+// goid returns the id of the current goroutine.
+func goid() uint64 {
+	var buf [64]byte
+	id, ok := parseGoid(buf[:runtime.Stack(buf[:], false)])
+	if !ok {
+		panic("goid: unexpected stack header")
+	}
+	return id
+}
+
+// parseGoid parses the id of a goroutine header of runtime.Stack, such as
+// `goroutine 1 [running]:`.
+func parseGoid(b []byte) (uint64, bool) {
+	if !bytes.HasPrefix(b, []byte("goroutine ")) {
+		return 0, false
+	}
+	b = b[len("goroutine "):]
+	if i := bytes.IndexByte(b, ' '); i >= 0 {
+		b = b[:i]
+	}
+	id, err := strconv.ParseUint(string(b), 10, 64)
+	return id, err == nil
+}
+
+// local returns storage of the current goroutine. Only the goroutine itself
+// accesses it.
+func local() *threadLocal {
+	id := goid()
+	if l, ok := locals.Load(id); ok {
+		return l.(*threadLocal)
+	}
+	l := &threadLocal{vars: make(map[*TLS]unsafe.Pointer)}
+	locals.Store(id, l)
+	if atomic.AddInt64(&nlocals, 1) >= atomic.LoadInt64(&nsweep) {
+		sweepLocals()
+	}
+	return l
+}
+
+// releaseLocal removes storage of the goroutine id and returns it.
+func releaseLocal(id uint64) *threadLocal {
+	if l, ok := locals.LoadAndDelete(id); ok {
+		atomic.AddInt64(&nlocals, -1)
+		return l.(*threadLocal)
+	}
+	return nil
+}
+
+// sweepLocals releases storage of the goroutines which have exited.
+func sweepLocals() {
+	sweepMutex.Lock()
+	defer sweepMutex.Unlock()
+	if atomic.LoadInt64(&nlocals) < atomic.LoadInt64(&nsweep) { // swept already
+		return
+	}
+	live := liveGoroutines()
+	locals.Range(func(k, _ interface{}) bool {
+		if id := k.(uint64); !live[id] {
+			releaseLocal(id)
+		}
+		return true
+	})
+	n := 2 * atomic.LoadInt64(&nlocals)
+	if n < minSweep {
+		n = minSweep
+	}
+	atomic.StoreInt64(&nsweep, n)
+}
+
+// liveGoroutines returns the ids of all goroutines. It stops the world, as
+// runtime.Stack does to dump all goroutines.
+func liveGoroutines() map[uint64]bool {
+	buf := make([]byte, 64<<10)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			buf = buf[:n]
+			break
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+	live := make(map[uint64]bool)
+	for _, line := range bytes.Split(buf, []byte("\n")) {
+		if id, ok := parseGoid(line); ok {
+			live[id] = true
+		}
+	}
+	return live
+}
+
+// -----------------------------------------------------------------------------
+
+// TLS is a variable with thread storage duration. The translator declares
+// `__thread T x = init;` as
+//
+//	var _cgo_tls_x T = init
+//	var x = libc.NewTLS(&_cgo_tls_x)
+//
+// and accesses x as *(*T)(x.Get()).
+type TLS struct {
+	init reflect.Value // pointer to the initial value
+}
+
+// NewTLS creates a thread-local variable. init points to its initial value,
+// which every thread gets a copy of.
+func NewTLS(init interface{}) *TLS {
+	v := reflect.ValueOf(init)
+	if v.Kind() != reflect.Ptr {
+		panic("NewTLS: init isn't a pointer")
+	}
+	return &TLS{init: v}
+}
+
+// Get returns the address of the variable in the current thread.
+func (p *TLS) Get() unsafe.Pointer {
+	l := local()
+	if v, ok := l.vars[p]; ok {
+		return v
+	}
+	v := reflect.New(p.init.Type().Elem())
+	v.Elem().Set(p.init.Elem())
+	ptr := unsafe.Pointer(v.Pointer())
+	l.vars[p] = ptr
+	return ptr
+}
+
+// -----------------------------------------------------------------------------
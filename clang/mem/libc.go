@@ -0,0 +1,95 @@
+package mem
+
+import (
+	"math/bits"
+
+	c "github.com/goplus/c2go/clang"
+)
+
+// -----------------------------------------------------------------------------
+
+func Malloc(n c.SizeT) uintptr {
+	return Alloc(uintptr(n))
+}
+
+// Calloc returns 0 if n*size overflows.
+func Calloc(n, size c.SizeT) uintptr {
+	hi, lo := bits.Mul64(uint64(n), uint64(size))
+	if hi != 0 {
+		return 0
+	}
+	return Alloc(uintptr(lo))
+}
+
+func Realloc(addr uintptr, n c.SizeT) uintptr {
+	if addr == 0 {
+		return Alloc(uintptr(n))
+	}
+	if old := sizeOf(addr); uintptr(n) <= old {
+		return addr
+	}
+	ret := Alloc(uintptr(n))
+	copy(Bytes(ret, uintptr(n)), Bytes(addr, sizeOf(addr)))
+	Free(addr)
+	return ret
+}
+
+func Memcpy(dst, src uintptr, n c.SizeT) uintptr {
+	copy(Bytes(dst, uintptr(n)), Bytes(src, uintptr(n)))
+	return dst
+}
+
+func Memmove(dst, src uintptr, n c.SizeT) uintptr {
+	copy(Bytes(dst, uintptr(n)), Bytes(src, uintptr(n)))
+	return dst
+}
+
+func Memset(dst uintptr, ch c.Int, n c.SizeT) uintptr {
+	b := Bytes(dst, uintptr(n))
+	for i := range b {
+		b[i] = byte(ch)
+	}
+	return dst
+}
+
+func Memcmp(a, b uintptr, n c.SizeT) c.Int {
+	x, y := Bytes(a, uintptr(n)), Bytes(b, uintptr(n))
+	for i := range x {
+		if x[i] != y[i] {
+			return c.Int(x[i]) - c.Int(y[i])
+		}
+	}
+	return 0
+}
+
+func Strlen(s uintptr) c.SizeT {
+	return c.SizeT(strlen(s))
+}
+
+// -----------------------------------------------------------------------------
+
+func LoadInt8(addr uintptr) int8       { return *(*int8)(Ptr(addr)) }
+func LoadInt16(addr uintptr) int16     { return *(*int16)(Ptr(addr)) }
+func LoadInt32(addr uintptr) int32     { return *(*int32)(Ptr(addr)) }
+func LoadInt64(addr uintptr) int64     { return *(*int64)(Ptr(addr)) }
+func LoadUint8(addr uintptr) uint8     { return *(*uint8)(Ptr(addr)) }
+func LoadUint16(addr uintptr) uint16   { return *(*uint16)(Ptr(addr)) }
+func LoadUint32(addr uintptr) uint32   { return *(*uint32)(Ptr(addr)) }
+func LoadUint64(addr uintptr) uint64   { return *(*uint64)(Ptr(addr)) }
+func LoadUintptr(addr uintptr) uintptr { return *(*uintptr)(Ptr(addr)) }
+func LoadFloat32(addr uintptr) float32 { return *(*float32)(Ptr(addr)) }
+func LoadFloat64(addr uintptr) float64 { return *(*float64)(Ptr(addr)) }
+
+func StoreInt8(addr uintptr, v int8)       { *(*int8)(Ptr(addr)) = v }
+func StoreInt16(addr uintptr, v int16)     { *(*int16)(Ptr(addr)) = v }
+func StoreInt32(addr uintptr, v int32)     { *(*int32)(Ptr(addr)) = v }
+func StoreInt64(addr uintptr, v int64)     { *(*int64)(Ptr(addr)) = v }
+func StoreUint8(addr uintptr, v uint8)     { *(*uint8)(Ptr(addr)) = v }
+func StoreUint16(addr uintptr, v uint16)   { *(*uint16)(Ptr(addr)) = v }
+func StoreUint32(addr uintptr, v uint32)   { *(*uint32)(Ptr(addr)) = v }
+func StoreUint64(addr uintptr, v uint64)   { *(*uint64)(Ptr(addr)) = v }
+func StoreUintptr(addr uintptr, v uintptr) { *(*uintptr)(Ptr(addr)) = v }
+func StoreFloat32(addr uintptr, v float32) { *(*float32)(Ptr(addr)) = v }
+func StoreFloat64(addr uintptr, v float64) { *(*float64)(Ptr(addr)) = v }
+
+// -----------------------------------------------------------------------------
@@ -0,0 +1,205 @@
+// Package mem implements the flat memory model used by code translated with
+// cl.Config.FlatMemory. All C objects whose address is taken live in a managed
+// arena and are addressed by uintptr values, so pointers can be freely stored
+// in integers or copied by memcpy without confusing the Go garbage collector.
+//
+// An address is a segment index in its high bits and an offset into that
+// segment in its low bits. Segment 0 is never allocated, so address 0 is NULL.
+// Small blocks are carved from chunks and kept in free lists by size class
+// when freed. A large block has a segment of its own, which is released when
+// the block is freed, and whose index is reused by later segments.
+package mem
+
+import (
+	"sync"
+	"sync/atomic"
+	"unsafe"
+)
+
+const (
+	is64     = ^uintptr(0) >> 63
+	segShift = 24 + 8*is64 // 16MB segments on 32-bit, 4GB on 64-bit
+	segMask  = 1<<segShift - 1
+	maxSegs  = 1 << (8 + 8*is64)
+
+	chunkSize = 1 << 20 // size of a segment used for small blocks
+	align     = 16
+	hdrSize   = align // size of the block header which stores the block size
+)
+
+var (
+	segs [maxSegs]unsafe.Pointer
+
+	mutex  sync.Mutex
+	nsegs  uintptr = 1 // segment 0 is reserved for NULL
+	keep   = make(map[uintptr][]uint64) // segment index => memory of the segment
+	idles  []uintptr                    // indexes of released segments
+	cur    uintptr // next free address in the current chunk
+	end    uintptr // end of the current chunk
+	frees  = make(map[uintptr][]uintptr)
+	strs   = make(map[string]uintptr)
+	nalloc uintptr
+)
+
+// Ptr converts an arena address to a Go pointer. The result is only valid
+// until the block containing addr is freed.
+func Ptr(addr uintptr) unsafe.Pointer {
+	base := atomic.LoadPointer(&segs[addr>>segShift])
+	if base == nil {
+		return nil
+	}
+	return unsafe.Pointer(uintptr(base) + addr&segMask)
+}
+
+// Alloc allocates a zeroed block of n bytes and returns its address.
+func Alloc(n uintptr) uintptr {
+	size := blockSize(n)
+	mutex.Lock()
+	defer mutex.Unlock()
+	var addr uintptr
+	if isLarge(size) {
+		addr = newSeg(size+hdrSize) + hdrSize
+	} else if l := frees[size]; len(l) > 0 {
+		addr, frees[size] = l[len(l)-1], l[:len(l)-1]
+		clear(addr, size)
+	} else {
+		if cur+size+hdrSize > end {
+			cur = newSeg(chunkSize)
+			end = cur + chunkSize
+		}
+		addr, cur = cur+hdrSize, cur+size+hdrSize
+	}
+	*(*uintptr)(Ptr(addr - hdrSize)) = size
+	nalloc++
+	return addr
+}
+
+// Free releases a block allocated by Alloc. Free(0) is a no-op.
+func Free(addr uintptr) {
+	if addr == 0 {
+		return
+	}
+	mutex.Lock()
+	defer mutex.Unlock()
+	if size := sizeOf(addr); isLarge(size) {
+		releaseSeg(addr >> segShift)
+	} else {
+		frees[size] = append(frees[size], addr)
+	}
+	nalloc--
+}
+
+// Size returns the usable size of a block allocated by Alloc.
+func Size(addr uintptr) uintptr {
+	return sizeOf(addr)
+}
+
+// Inuse returns the number of blocks allocated and not freed yet.
+func Inuse() int {
+	mutex.Lock()
+	defer mutex.Unlock()
+	return int(nalloc)
+}
+
+// Str returns the address of a NUL-terminated copy of s. Copies are shared
+// between calls with the same s and are never freed, like C string literals.
+func Str(s string) uintptr {
+	mutex.Lock()
+	addr, ok := strs[s]
+	mutex.Unlock()
+	if !ok {
+		addr = CStr(s)
+		mutex.Lock()
+		if old, ok := strs[s]; ok {
+			mutex.Unlock()
+			Free(addr)
+			return old
+		}
+		strs[s] = addr
+		mutex.Unlock()
+	}
+	return addr
+}
+
+// CStr returns the address of a newly allocated NUL-terminated copy of s.
+func CStr(s string) uintptr {
+	n := uintptr(len(s))
+	addr := Alloc(n + 1)
+	copy(Bytes(addr, n), s)
+	return addr
+}
+
+// GoStr returns the Go string of the NUL-terminated string at addr.
+func GoStr(addr uintptr) string {
+	return string(Bytes(addr, strlen(addr)))
+}
+
+// Bytes returns the n bytes at addr as a slice sharing memory with the arena.
+func Bytes(addr uintptr, n uintptr) []byte {
+	if n == 0 {
+		return nil
+	}
+	return (*[segMask + 1]byte)(Ptr(addr))[:n:n] // a block never spans segments
+}
+
+func newSeg(size uintptr) uintptr {
+	if size > segMask {
+		panic("mem: block too large")
+	}
+	var idx uintptr
+	if n := len(idles); n > 0 {
+		idx, idles = idles[n-1], idles[:n-1]
+	} else if nsegs < maxSegs {
+		idx = nsegs
+		nsegs++
+	} else {
+		panic("mem: out of address space")
+	}
+	buf := make([]uint64, (size+7)/8)
+	keep[idx] = buf
+	atomic.StorePointer(&segs[idx], unsafe.Pointer(&buf[0]))
+	return idx << segShift
+}
+
+// releaseSeg releases the segment idx of a large block, so that its memory is
+// garbage collected and its index can be reused.
+func releaseSeg(idx uintptr) {
+	atomic.StorePointer(&segs[idx], nil)
+	delete(keep, idx)
+	idles = append(idles, idx)
+}
+
+// isLarge checks if a block of size has a segment of its own.
+func isLarge(size uintptr) bool {
+	return size+hdrSize > chunkSize
+}
+
+func blockSize(n uintptr) uintptr {
+	if n <= 1024 {
+		return (n + align - 1) &^ (align - 1)
+	}
+	size := uintptr(2048)
+	for size < n {
+		size <<= 1
+	}
+	return size
+}
+
+func sizeOf(addr uintptr) uintptr {
+	return *(*uintptr)(Ptr(addr - hdrSize))
+}
+
+func clear(addr, n uintptr) {
+	b := Bytes(addr, n)
+	for i := range b {
+		b[i] = 0
+	}
+}
+
+func strlen(addr uintptr) uintptr {
+	n := uintptr(0)
+	for *(*byte)(Ptr(addr + n)) != 0 {
+		n++
+	}
+	return n
+}
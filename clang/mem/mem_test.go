@@ -0,0 +1,105 @@
+package mem
+
+import (
+	"testing"
+)
+
+// -----------------------------------------------------------------------------
+
+func TestAlloc(t *testing.T) {
+	n := Inuse()
+	a := Alloc(10)
+	b := Alloc(10)
+	if a == 0 || b == 0 || a == b {
+		t.Fatal("Alloc:", a, b)
+	}
+	if a%align != 0 || Size(a) != 16 {
+		t.Fatal("Alloc: bad alignment or size -", a, Size(a))
+	}
+	StoreInt64(a, -1)
+	StoreInt64(a+8, 2)
+	if LoadInt64(a) != -1 || LoadInt32(a+8) != 2 || LoadInt64(b) != 0 {
+		t.Fatal("Load/Store failed")
+	}
+	Free(a)
+	if c := Alloc(16); c != a || LoadInt64(c) != 0 {
+		t.Fatal("Alloc: freed block not reused or not zeroed -", c, a)
+	}
+	Free(a)
+	Free(b)
+	Free(0)
+	if Inuse() != n {
+		t.Fatal("Inuse:", Inuse(), n)
+	}
+}
+
+func TestLargeAlloc(t *testing.T) {
+	a := Alloc(3 << 20)
+	if a>>segShift == 0 || Size(a) != 4<<20 {
+		t.Fatal("Alloc large:", a, Size(a))
+	}
+	StoreUint8(a+(3<<20)-1, 0xff)
+	if LoadUint8(a+(3<<20)-1) != 0xff {
+		t.Fatal("Load/Store large failed")
+	}
+	Free(a)
+	if Ptr(a) != nil {
+		t.Fatal("Free large: segment not released")
+	}
+	n := nsegs
+	for i := uintptr(1); i <= 16; i++ { // sizes of different classes
+		Free(Alloc(i << 20))
+	}
+	if nsegs > n+1 {
+		t.Fatal("Alloc large: segments not reused -", nsegs-n)
+	}
+}
+
+func TestNull(t *testing.T) {
+	if Ptr(0) != nil {
+		t.Fatal("Ptr(0) != nil")
+	}
+}
+
+func TestLibc(t *testing.T) {
+	s := CStr("hello")
+	if Strlen(s) != 5 || GoStr(s) != "hello" {
+		t.Fatal("CStr:", Strlen(s), GoStr(s))
+	}
+	p := Malloc(8)
+	Memcpy(p, s, 6)
+	if Memcmp(p, s, 6) != 0 || GoStr(p) != "hello" {
+		t.Fatal("Memcpy:", GoStr(p))
+	}
+	Memset(p, 'x', 2)
+	if GoStr(p) != "xxllo" || Memcmp(p, s, 6) <= 0 {
+		t.Fatal("Memset:", GoStr(p))
+	}
+	Memmove(p+1, p, 4)
+	if GoStr(p) != "xxxll" {
+		t.Fatal("Memmove:", GoStr(p))
+	}
+	q := Realloc(p, 100)
+	if GoStr(q) != "xxxll" {
+		t.Fatal("Realloc:", GoStr(q))
+	}
+	Free(q)
+	Free(s)
+	if z := Calloc(4, 4); LoadInt64(z) != 0 || LoadInt64(z+8) != 0 {
+		t.Fatal("Calloc: not zeroed")
+	} else {
+		Free(z)
+	}
+	if Calloc(1<<32, 1<<32) != 0 {
+		t.Fatal("Calloc: overflow not detected")
+	}
+}
+
+func TestStr(t *testing.T) {
+	a, b := Str("abc"), Str("abc")
+	if a != b || GoStr(a) != "abc" {
+		t.Fatal("Str:", a, b, GoStr(a))
+	}
+}
+
+// -----------------------------------------------------------------------------
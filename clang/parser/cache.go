@@ -0,0 +1,213 @@
+package parser
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/goplus/c2go/clang/ast"
+)
+
+// -----------------------------------------------------------------------------
+
+// ParseASTFile parses a saved AST dump astfile, such as the output of
+// clang -Xclang -ast-dump=json or clangast -dump, which may be compressed by
+// gzip. srcfile is the file which was dumped, which PruneSystemDecls of mode
+// needs unless the dump records it (see RecordAST). Other modes have effect
+// only when dumping.
+func ParseASTFile(astfile, srcfile string, mode Mode) (file *ast.Node, err error) {
+	file, _, err = ParseASTFileEx(astfile, srcfile, mode)
+	return
+}
+
+// ParseASTFileEx is ParseASTFile, which also returns the source of srcfile
+// recorded in the dump by RecordAST, or nil if the dump doesn't record it.
+func ParseASTFileEx(astfile, srcfile string, mode Mode) (file *ast.Node, src []byte, err error) {
+	f, err := os.Open(astfile)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	r := bufio.NewReader(f)
+	var in io.Reader = r
+	if magic, _ := r.Peek(2); len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		zr, e := gzip.NewReader(r)
+		if e != nil {
+			return nil, nil, &ParseError{Err: e}
+		}
+		defer zr.Close()
+		in = zr
+	}
+	var dump struct {
+		*ast.Node
+		Src *string `json:"c2goSrc"`
+	}
+	if err = json.NewDecoder(in).Decode(&dump); err != nil {
+		return nil, nil, &ParseError{Err: err}
+	}
+	file = dump.Node
+	if file == nil {
+		file = new(ast.Node)
+	}
+	if dump.Src != nil {
+		src = []byte(*dump.Src)
+	}
+	if mode&PruneSystemDecls != 0 {
+		if err = PruneDeclsEx(file, srcfile, src, nil); err != nil {
+			return nil, nil, &ParseError{Err: err}
+		}
+	}
+	return
+}
+
+// RecordAST parses the AST of filename as ParseFile does, and saves the dump
+// to astfile with the source of filename recorded in it, so that the file can
+// be compiled from the dump alone. The dump is compressed by gzip if astfile
+// ends with .gz.
+func RecordAST(filename, astfile string, mode Mode) (file *ast.Node, warning []byte, err error) {
+	src, err := os.ReadFile(filename)
+	if err != nil {
+		return
+	}
+	f, err := os.Create(astfile)
+	if err != nil {
+		return
+	}
+	var w io.Writer = f
+	var zw *gzip.Writer
+	if strings.HasSuffix(astfile, ".gz") {
+		zw = gzip.NewWriter(f)
+		w = zw
+	}
+	file, warning, err = parseFile(filename, mode, &srcWriter{w: w, src: src})
+	if err == nil && zw != nil {
+		err = zw.Close()
+	}
+	if e := f.Close(); err == nil {
+		err = e
+	}
+	if err != nil {
+		os.Remove(astfile)
+		return nil, nil, err
+	}
+	return
+}
+
+// srcWriter writes a JSON dump with src recorded as the first member of its
+// top-level object.
+type srcWriter struct {
+	w    io.Writer
+	src  []byte
+	done bool
+}
+
+func (p *srcWriter) Write(b []byte) (n int, err error) {
+	if p.done {
+		return p.w.Write(b)
+	}
+	i := bytes.IndexByte(b, '{')
+	if i < 0 { // leading spaces
+		return len(b), nil
+	}
+	quoted, err := json.Marshal(string(p.src))
+	if err != nil {
+		return
+	}
+	if _, err = io.WriteString(p.w, `{"c2goSrc":`+string(quoted)+","); err != nil {
+		return
+	}
+	p.done = true
+	if _, err = p.w.Write(b[i+1:]); err != nil {
+		return
+	}
+	return len(b), nil
+}
+
+// -----------------------------------------------------------------------------
+
+// Cache is a content-addressed cache of AST dumps, which are keyed by the
+// contents of the dumped files, the clang version and the clang arguments, so
+// that unchanged files aren't dumped again. Dumps are compressed by gzip.
+// Warnings of clang aren't cached.
+type Cache struct {
+	Dir string
+
+	// ClangVersion is the output of clang --version, which keys the dumps. If
+	// it's empty, clang --version runs on the first lookup of the cache.
+	ClangVersion string
+
+	versionOnce sync.Once
+	versionErr  error
+}
+
+// ParseFile parses the AST of filename as ParseFile does, and dumps it only if
+// it isn't in the cache.
+func (p *Cache) ParseFile(filename string, mode Mode) (file *ast.Node, warning []byte, err error) {
+	key, err := p.cacheKey(filename, mode)
+	if err != nil {
+		return nil, nil, &ParseError{Err: err}
+	}
+	astfile := filepath.Join(p.Dir, key[:2], key[2:]+".json.gz")
+	if file, err = ParseASTFile(astfile, filename, mode); err == nil {
+		return
+	}
+	dir := filepath.Dir(astfile)
+	if err = os.MkdirAll(dir, 0755); err != nil {
+		return ParseFile(filename, mode)
+	}
+	tmp, err := ioutil.TempFile(dir, "ast-*.tmp")
+	if err != nil {
+		return ParseFile(filename, mode)
+	}
+	zw := gzip.NewWriter(tmp)
+	file, warning, err = parseFile(filename, mode, zw)
+	errCache := zw.Close()
+	if e := tmp.Close(); errCache == nil {
+		errCache = e
+	}
+	if err == nil && errCache == nil {
+		errCache = os.Rename(tmp.Name(), astfile)
+	}
+	if err != nil || errCache != nil { // the dump isn't cached
+		os.Remove(tmp.Name())
+	}
+	return
+}
+
+// cacheKey returns the key of the AST dump of filename.
+func (p *Cache) cacheKey(filename string, mode Mode) (string, error) {
+	p.versionOnce.Do(func() {
+		if p.ClangVersion == "" {
+			var version []byte
+			version, p.versionErr = exec.Command("clang", "--version").Output()
+			p.ClangVersion = string(bytes.TrimSpace(version))
+		}
+	})
+	if p.versionErr != nil {
+		return "", p.versionErr
+	}
+	f, err := os.Open(filename)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	args := dumpCmd(filename, mode).Args
+	h.Write([]byte(p.ClangVersion))
+	h.Write([]byte(strings.Join(args[1:len(args)-1], "\x00") + "\x00"))
+	if _, err = io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// -----------------------------------------------------------------------------
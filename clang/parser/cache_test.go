@@ -0,0 +1,132 @@
+package parser
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/goplus/c2go/clang/ast"
+)
+
+// -----------------------------------------------------------------------------
+
+func requireClang(t *testing.T) {
+	if _, err := exec.LookPath("clang"); err != nil {
+		t.Skip("clang not found:", err)
+	}
+}
+
+const testSrc = `
+struct point { int x, y; };
+
+int sum(struct point *p) {
+	return p->x + p->y;
+}
+`
+
+func writeTestSrc(t *testing.T) string {
+	srcfile := filepath.Join(t.TempDir(), "test.c")
+	if err := os.WriteFile(srcfile, []byte(testSrc), 0666); err != nil {
+		t.Fatal(err)
+	}
+	return srcfile
+}
+
+func TestParseASTFile(t *testing.T) {
+	// testdata/point.c.json.gz is recorded by
+	//	clang -Xclang -ast-dump=json -fsyntax-only point.c | gzip -9n
+	for _, mode := range []Mode{0, PruneSystemDecls} {
+		file, err := ParseASTFile("testdata/point.c.json.gz", "testdata/point.c", mode)
+		if err != nil {
+			t.Fatal("ParseASTFile:", err)
+		}
+		var decls []string
+		for _, decl := range file.Inner {
+			if !decl.IsImplicit {
+				decls = append(decls, string(decl.Kind)+" "+decl.Name)
+			} else if mode&PruneSystemDecls != 0 {
+				t.Fatal("ParseASTFile: implicit declaration isn't pruned -", decl.Name)
+			}
+		}
+		if expected := []string{"RecordDecl point", "FunctionDecl sum"}; !reflect.DeepEqual(decls, expected) {
+			t.Fatal("ParseASTFile:", decls)
+		}
+		if fn := file.Inner[len(file.Inner)-1]; fn.Kind != ast.FunctionDecl || fn.Type.QualType != "int (struct point *)" {
+			t.Fatal("ParseASTFile: unexpected AST of sum")
+		}
+	}
+}
+
+func TestParseASTFileDump(t *testing.T) {
+	requireClang(t)
+	srcfile := writeTestSrc(t)
+	var out []byte
+	expected, _, err := ParseFileEx(srcfile, 0, &out)
+	if err != nil {
+		t.Fatal("ParseFileEx:", err)
+	}
+	astfile := srcfile + ".json"
+	if err = os.WriteFile(astfile, out, 0666); err != nil {
+		t.Fatal(err)
+	}
+	file, err := ParseASTFile(astfile, srcfile, 0)
+	if err != nil {
+		t.Fatal("ParseASTFile:", err)
+	}
+	if !reflect.DeepEqual(file, expected) {
+		t.Fatal("ParseASTFile: unexpected AST")
+	}
+}
+
+func TestRecordAST(t *testing.T) {
+	requireClang(t)
+	srcfile := writeTestSrc(t)
+	astfile := srcfile + ".json.gz"
+	expected, _, err := RecordAST(srcfile, astfile, 0)
+	if err != nil {
+		t.Fatal("RecordAST:", err)
+	}
+	os.Remove(srcfile)
+	file, src, err := ParseASTFileEx(astfile, srcfile, PruneSystemDecls)
+	if err != nil {
+		t.Fatal("ParseASTFileEx:", err)
+	}
+	if string(src) != testSrc {
+		t.Fatal("ParseASTFileEx: unexpected source -", string(src))
+	}
+	if len(file.Inner) != 2 || !reflect.DeepEqual(file.Inner, expected.Inner[len(expected.Inner)-2:]) {
+		t.Fatal("ParseASTFileEx: unexpected AST")
+	}
+}
+
+func TestCache(t *testing.T) {
+	requireClang(t)
+	srcfile := writeTestSrc(t)
+	cache := &Cache{Dir: filepath.Join(t.TempDir(), "cache"), ClangVersion: "clang version 14"}
+	expected, _, err := cache.ParseFile(srcfile, 0)
+	if err != nil {
+		t.Fatal("Cache.ParseFile:", err)
+	}
+	dumps, _ := filepath.Glob(filepath.Join(cache.Dir, "*", "*.json.gz"))
+	if len(dumps) != 1 {
+		t.Fatal("dumps:", dumps)
+	}
+
+	path := os.Getenv("PATH")
+	defer os.Setenv("PATH", path)
+	os.Setenv("PATH", "") // clang isn't run for a cached dump
+	file, _, err := cache.ParseFile(srcfile, 0)
+	if err != nil {
+		t.Fatal("Cache.ParseFile:", err)
+	}
+	if !reflect.DeepEqual(file, expected) {
+		t.Fatal("Cache.ParseFile: unexpected AST")
+	}
+	if _, _, err = cache.ParseFile(srcfile, ParseComments); err == nil { // another key
+		t.Fatal("Cache.ParseFile: no clang")
+	}
+}
+
+// -----------------------------------------------------------------------------
@@ -2,6 +2,8 @@ package parser
 
 import (
 	"bytes"
+	"io"
+	"io/ioutil"
 	"os/exec"
 
 	"github.com/goplus/c2go/clang/ast"
@@ -10,6 +12,18 @@ import (
 
 type Mode uint
 
+const (
+	// ParseComments parses comments, which become FullComment nodes of the
+	// declarations they document. Comments must be kept by preprocessing (see
+	// preprocessor.Config.KeepComments).
+	ParseComments Mode = 1 << iota
+
+	// PruneSystemDecls drops unreferenced declarations of system headers and
+	// implicit ones, which most of a translation unit usually consists of.
+	// The JSON kept by ParseFileEx isn't pruned.
+	PruneSystemDecls
+)
+
 // -----------------------------------------------------------------------------
 
 type ParseError struct {
@@ -27,10 +41,21 @@ func (p *ParseError) Error() string {
 // -----------------------------------------------------------------------------
 
 func DumpAST(filename string) (result []byte, warning []byte, err error) {
+	return DumpASTEx(filename, 0)
+}
+
+func dumpCmd(filename string, mode Mode) *exec.Cmd {
+	args := []string{"-Xclang", "-ast-dump=json", "-fsyntax-only"}
+	if mode&ParseComments != 0 {
+		args = append(args, "-fparse-all-comments")
+	}
+	return exec.Command("clang", append(args, filename)...)
+}
+
+func DumpASTEx(filename string, mode Mode) (result []byte, warning []byte, err error) {
 	stdout := NewPagedWriter()
 	stderr := new(bytes.Buffer)
-	cmd := exec.Command(
-		"clang", "-Xclang", "-ast-dump=json", "-fsyntax-only", filename)
+	cmd := dumpCmd(filename, mode)
 	cmd.Stdout = stdout
 	cmd.Stderr = stderr
 	err = cmd.Run()
@@ -45,19 +70,58 @@ func DumpAST(filename string) (result []byte, warning []byte, err error) {
 
 var json = jsoniter.ConfigCompatibleWithStandardLibrary
 
+// ParseFileEx parses the AST of filename, which is decoded as it is read from
+// the output of clang, so the JSON of a large file is never held in memory as
+// a whole. The JSON is kept in ret only if ret isn't nil.
 func ParseFileEx(filename string, mode Mode, ret *[]byte) (file *ast.Node, warning []byte, err error) {
-	out, warning, err := DumpAST(filename)
+	var out *PagedWriter
+	var w io.Writer
+	if ret != nil {
+		out = NewPagedWriter()
+		w = out
+	}
+	if file, warning, err = parseFile(filename, mode, w); err == nil && ret != nil {
+		*ret = out.Bytes()
+	}
+	return
+}
+
+// parseFile parses the AST of filename, and writes the JSON to w if w isn't
+// nil.
+func parseFile(filename string, mode Mode, w io.Writer) (file *ast.Node, warning []byte, err error) {
+	stderr := new(bytes.Buffer)
+	cmd := dumpCmd(filename, mode)
+	cmd.Stderr = stderr
+	stdout, err := cmd.StdoutPipe()
 	if err != nil {
 		return
 	}
-	if ret != nil {
-		*ret = out
+	if err = cmd.Start(); err != nil {
+		return nil, nil, &ParseError{Err: err}
 	}
-	file = new(ast.Node)
-	err = json.Unmarshal(out, file)
-	if err != nil {
-		err = &ParseError{Err: err}
+	var r io.Reader = stdout
+	if w != nil {
+		r = io.TeeReader(stdout, w)
 	}
+	file, errDecode := decodeAST(r)
+	io.Copy(ioutil.Discard, r) // clang may block on writing if decoding fails
+	if err = cmd.Wait(); err != nil {
+		return nil, nil, &ParseError{Err: err, Stderr: stderr.Bytes()}
+	}
+	if errDecode != nil {
+		return nil, nil, &ParseError{Err: errDecode}
+	}
+	if mode&PruneSystemDecls != 0 {
+		if err = PruneDecls(file, filename, nil); err != nil {
+			return nil, nil, &ParseError{Err: err}
+		}
+	}
+	return file, stderr.Bytes(), nil
+}
+
+func decodeAST(r io.Reader) (file *ast.Node, err error) {
+	file = new(ast.Node)
+	err = json.NewDecoder(r).Decode(file)
 	return
 }
 
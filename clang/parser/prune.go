@@ -0,0 +1,236 @@
+package parser
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+
+	"github.com/goplus/c2go/clang/ast"
+)
+
+// -----------------------------------------------------------------------------
+// PruneSystemDecls drops the top-level declarations of system headers which the
+// rest of the translation unit doesn't refer to, directly or not, and implicit
+// declarations such as __int128_t which aren't referred to either. Declarations
+// refer to each other by IDs (such as referencedDecl and ownedTagDecl) and by
+// names in types (such as struct _IO_FILE). System headers are known by line
+// markers of preprocessed files, such as `# 1 "/usr/include/stdio.h" 1 3 4`, so
+// nothing but implicit declarations is pruned from other files.
+
+type marker struct {
+	off    int64 // offset of the line after the marker
+	system bool
+}
+
+// systemMarkers returns the line markers of the preprocessed file filename,
+// whose content is src, or is read from the file if src is nil.
+func systemMarkers(filename string, src []byte) (markers []marker, err error) {
+	var in io.Reader = bytes.NewReader(src)
+	if src == nil {
+		f, err := os.Open(filename)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		in = f
+	}
+	r := bufio.NewReaderSize(in, 64*1024)
+	var off int64
+	for {
+		line, err := r.ReadSlice('\n')
+		if err == bufio.ErrBufferFull { // a long line can't be a marker
+			off += int64(len(line))
+			for err == bufio.ErrBufferFull {
+				line, err = r.ReadSlice('\n')
+				off += int64(len(line))
+			}
+			continue
+		}
+		off += int64(len(line))
+		if len(line) > 2 && line[0] == '#' {
+			if system, ok := parseMarker(line); ok {
+				markers = append(markers, marker{off: off, system: system})
+			}
+		}
+		if err != nil {
+			break
+		}
+	}
+	return markers, nil
+}
+
+// parseMarker parses a line marker, such as `# 1 "/usr/include/stdio.h" 1 3 4`
+// or `#line 1 "foo.c"`, and reports whether it enters a system header.
+func parseMarker(line []byte) (system, ok bool) {
+	line = bytes.TrimPrefix(line[1:], []byte("line"))
+	fields := bytes.Fields(line)
+	if len(fields) < 2 || fields[1][0] != '"' {
+		return
+	}
+	if _, err := strconv.Atoi(string(fields[0])); err != nil {
+		return
+	}
+	for _, flag := range fields[2:] {
+		if string(flag) == "3" {
+			system = true
+		}
+	}
+	return system, true
+}
+
+func inSystemHeader(markers []marker, decl *ast.Node) bool {
+	if decl.Range == nil {
+		return false
+	}
+	off := decl.Range.Begin.Offset
+	if loc := decl.Range.Begin.ExpansionLoc; loc != nil { // begins with a macro
+		off = loc.Offset
+	}
+	i := sort.Search(len(markers), func(i int) bool {
+		return markers[i].off > off
+	})
+	return i > 0 && markers[i-1].system
+}
+
+// -----------------------------------------------------------------------------
+
+type pruner struct {
+	decls []*ast.Node
+	ids   map[ast.ID]int   // top-level declarations and enum constants
+	names map[string][]int // top-level declarations and enum constants
+	keep  []bool
+	queue []int
+}
+
+// PruneDecls prunes the top-level declarations of file, which is parsed from
+// filename, as PruneSystemDecls does. Declarations named by roots are kept as
+// well, such as the ones which hand-written Go files of the package refer to.
+func PruneDecls(file *ast.Node, filename string, roots []string) error {
+	return PruneDeclsEx(file, filename, nil, roots)
+}
+
+// PruneDeclsEx is PruneDecls, where src is the content of filename, which is
+// read from the file if src is nil.
+func PruneDeclsEx(file *ast.Node, filename string, src []byte, roots []string) error {
+	markers, err := systemMarkers(filename, src)
+	if err != nil {
+		return err
+	}
+	decls := file.Inner
+	p := &pruner{
+		decls: decls, ids: make(map[ast.ID]int), names: make(map[string][]int), keep: make([]bool, len(decls)),
+	}
+	for i, decl := range decls {
+		p.index(i, decl)
+		if decl.Kind == ast.EnumDecl {
+			for _, item := range decl.Inner {
+				p.index(i, item)
+			}
+		}
+	}
+	for i, decl := range decls {
+		if !decl.IsImplicit && !inSystemHeader(markers, decl) {
+			p.use(i)
+		}
+	}
+	for _, name := range roots {
+		for _, j := range p.names[name] {
+			p.use(j)
+		}
+	}
+	for len(p.queue) > 0 {
+		i := p.queue[len(p.queue)-1]
+		p.queue = p.queue[:len(p.queue)-1]
+		p.walk(decls[i])
+	}
+	inner := decls[:0]
+	for i, decl := range decls {
+		if p.keep[i] {
+			inner = append(inner, decl)
+		}
+	}
+	file.Inner = inner
+	return nil
+}
+
+func (p *pruner) index(i int, decl *ast.Node) {
+	if decl.ID != "" {
+		p.ids[decl.ID] = i
+	}
+	if decl.Name != "" {
+		p.names[decl.Name] = append(p.names[decl.Name], i)
+	}
+}
+
+// use keeps the i-th declaration, its redeclarations, and the unnamed structs,
+// unions and enums right before it, such as struct { ... } of
+// `struct { ... } foo;`.
+func (p *pruner) use(i int) {
+	if p.keep[i] {
+		return
+	}
+	p.keep[i] = true
+	p.queue = append(p.queue, i)
+	if name := p.decls[i].Name; name != "" {
+		for _, j := range p.names[name] {
+			p.use(j)
+		}
+	}
+	if j := i - 1; j >= 0 && p.decls[j].Name == "" {
+		switch p.decls[j].Kind {
+		case ast.RecordDecl, ast.EnumDecl:
+			p.use(j)
+		}
+	}
+}
+
+func (p *pruner) useID(id ast.ID) {
+	if i, ok := p.ids[id]; ok {
+		p.use(i)
+	}
+}
+
+// useNames keeps the declarations of the identifiers of the type qualType.
+func (p *pruner) useNames(qualType string) {
+	for i := 0; i < len(qualType); {
+		if !isIdentStart(qualType[i]) {
+			i++
+			continue
+		}
+		start := i
+		for i++; i < len(qualType) && (isIdentStart(qualType[i]) || qualType[i] >= '0' && qualType[i] <= '9'); i++ {
+		}
+		for _, j := range p.names[qualType[start:i]] {
+			p.use(j)
+		}
+	}
+}
+
+func isIdentStart(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '_'
+}
+
+func (p *pruner) walk(node *ast.Node) {
+	if t := node.Type; t != nil {
+		p.useNames(t.QualType)
+		if t.TypeAliasDeclID != "" {
+			p.useID(t.TypeAliasDeclID)
+		}
+	}
+	for _, ref := range []*ast.Node{node.Decl, node.OwnedTagDecl, node.ReferencedDecl} {
+		if ref != nil {
+			p.useID(ref.ID)
+		}
+	}
+	for _, item := range node.Inner {
+		p.walk(item)
+	}
+	for _, item := range node.ArrayFiller {
+		p.walk(item)
+	}
+}
+
+// -----------------------------------------------------------------------------
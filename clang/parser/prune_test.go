@@ -0,0 +1,74 @@
+package parser
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/goplus/c2go/clang/ast"
+)
+
+// -----------------------------------------------------------------------------
+
+func TestPruneSystemDecls(t *testing.T) {
+	requireClang(t)
+	dir := t.TempDir()
+	header := filepath.Join(dir, "prune_sys.h")
+	err := os.WriteFile(header, []byte(`
+#pragma GCC system_header
+typedef unsigned long size_t;
+typedef long off_t;
+struct stat { off_t st_size; };
+struct used { size_t n; };
+typedef struct used used_t;
+enum { SYS_A, SYS_B };
+int stat(const char *path, struct stat *buf);
+size_t strlen(const char *s);
+static inline int unused_inline(void) { return SYS_A; }
+`), 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srcfile := filepath.Join(dir, "test.c")
+	err = os.WriteFile(srcfile, []byte(`#include "prune_sys.h"
+int test(used_t *u, const char *s) {
+	return strlen(s) + u->n + SYS_B;
+}
+`), 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ifile := srcfile + ".i" // system headers are known by line markers of preprocessed files
+	if out, err := exec.Command("clang", "-E", "-o", ifile, srcfile).CombinedOutput(); err != nil {
+		t.Fatalf("clang -E: %v\n%s", err, out)
+	}
+	file, _, err := ParseFile(ifile, PruneSystemDecls)
+	if err != nil {
+		t.Fatal("ParseFile:", err)
+	}
+	decls := make(map[string]bool)
+	for _, decl := range file.Inner {
+		decls[string(decl.Kind)+" "+decl.Name] = true
+		if decl.Kind == ast.EnumDecl {
+			for _, item := range decl.Inner {
+				decls[string(item.Kind)+" "+item.Name] = true
+			}
+		}
+	}
+	for _, name := range []string{"TypedefDecl off_t", "RecordDecl stat", "FunctionDecl stat", "FunctionDecl unused_inline"} {
+		if decls[name] {
+			t.Fatal(name, "isn't pruned")
+		}
+	}
+	for _, name := range []string{
+		"TypedefDecl size_t", "RecordDecl used", "TypedefDecl used_t", "EnumConstantDecl SYS_B",
+		"FunctionDecl strlen", "FunctionDecl test",
+	} {
+		if !decls[name] {
+			t.Fatal(name, "is pruned")
+		}
+	}
+}
+
+// -----------------------------------------------------------------------------
@@ -0,0 +1,191 @@
+package preprocessor
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// -----------------------------------------------------------------------------
+
+// Macro is a macro definition dumped by `clang -dM -E` or `clang -dD -E`.
+type Macro struct {
+	Name     string
+	Params   []string // parameters of a function-like macro
+	Body     string
+	FuncLike bool
+	System   bool // defined in a system header
+}
+
+// Macros returns macros defined by infile and the headers it includes, except
+// the predefined ones (such as __clang__ or __x86_64__).
+func Macros(infile string, conf *Config) (macros []*Macro, err error) {
+	return dumpDefines(infile, conf, nil)
+}
+
+// DoWithMacros preprocesses infile into outfile as Do does, and returns the
+// macros as Macros does, by a single run of the preprocessor.
+func DoWithMacros(infile, outfile string, conf *Config) (macros []*Macro, err error) {
+	f, err := os.Create(outfile)
+	if err != nil {
+		return
+	}
+	w := bufio.NewWriter(f)
+	macros, err = dumpDefines(infile, conf, w)
+	if e := w.Flush(); err == nil {
+		err = e
+	}
+	if e := f.Close(); err == nil {
+		err = e
+	}
+	return
+}
+
+// dumpDefines preprocesses infile by `clang -dD -E`, which keeps #define and
+// #undef directives in its output, and returns the macros defined at the end.
+// The output is written to w without the directives (as blank lines, so that
+// line numbers are kept) if w isn't nil.
+func dumpDefines(infile string, conf *Config, w io.Writer) (macros []*Macro, err error) {
+	if conf == nil {
+		conf = new(Config)
+	}
+	args := append([]string{conf.ppflag(), "-dD"}, conf.args()...)
+	cmd := exec.Command(conf.compiler(), append(args, infile)...)
+	cmd.Stderr = os.Stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return
+	}
+	if err = cmd.Start(); err != nil {
+		return
+	}
+	macros, err = scanDefines(stdout, w)
+	if err != nil {
+		io.Copy(io.Discard, stdout)
+	}
+	if e := cmd.Wait(); err == nil {
+		err = e
+	}
+	return
+}
+
+func scanDefines(r io.Reader, w io.Writer) ([]*Macro, error) {
+	var macros []*Macro
+	index := make(map[string]int) // name => index in macros
+	system, builtin := false, false
+	br := bufio.NewReaderSize(r, 64*1024)
+	for {
+		line, err := br.ReadString('\n')
+		switch {
+		case strings.HasPrefix(line, "#define "):
+			if m := parseDefine(strings.TrimRight(line[8:], "\r\n")); m != nil && !builtin {
+				m.System = system
+				if i, ok := index[m.Name]; ok {
+					macros[i] = m
+				} else {
+					index[m.Name] = len(macros)
+					macros = append(macros, m)
+				}
+			}
+			line = "\n"
+		case strings.HasPrefix(line, "#undef "):
+			if i, ok := index[strings.TrimSpace(line[7:])]; ok {
+				delete(index, macros[i].Name)
+				macros[i] = nil
+			}
+			line = "\n"
+		case strings.HasPrefix(line, "# "):
+			if sys, bi, ok := parseMarker(line); ok {
+				system, builtin = sys, bi
+			}
+		}
+		if w != nil && line != "" {
+			if _, e := io.WriteString(w, line); e != nil {
+				return nil, e
+			}
+		}
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+	}
+	ret := macros[:0]
+	for _, m := range macros {
+		if m != nil {
+			ret = append(ret, m)
+		}
+	}
+	return ret, nil
+}
+
+// parseMarker parses a line marker, such as `# 1 "/usr/include/stdio.h" 1 3 4`,
+// and reports whether it enters a system header, or predefined macros or ones
+// of the command line (such as `# 0 "<built-in>"`).
+func parseMarker(line string) (system, builtin, ok bool) {
+	fields := strings.SplitN(line[2:], " ", 2)
+	if len(fields) < 2 || !strings.HasPrefix(fields[1], "\"") {
+		return
+	}
+	if _, err := strconv.Atoi(fields[0]); err != nil {
+		return
+	}
+	rest := fields[1]
+	end := strings.LastIndexByte(rest, '"')
+	if end <= 0 {
+		return
+	}
+	for _, flag := range strings.Fields(rest[end+1:]) {
+		if flag == "3" {
+			system = true
+		}
+	}
+	return system, strings.HasPrefix(rest, "\"<"), true
+}
+
+// ParseMacros parses output of `clang -dM -E`.
+func ParseMacros(data []byte) (macros []*Macro) {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "#define ") {
+			continue
+		}
+		if m := parseDefine(line[8:]); m != nil {
+			macros = append(macros, m)
+		}
+	}
+	return
+}
+
+// parseDefine parses a macro definition after #define.
+func parseDefine(line string) *Macro {
+	pos := strings.IndexAny(line, " (")
+	if pos < 0 { // #define NAME
+		return &Macro{Name: line}
+	}
+	m := &Macro{Name: line[:pos]}
+	if line[pos] == '(' { // #define NAME(params) body
+		end := strings.IndexByte(line, ')')
+		if end < 0 {
+			return nil
+		}
+		m.FuncLike = true
+		if params := strings.TrimSpace(line[pos+1 : end]); params != "" {
+			m.Params = strings.Split(params, ",")
+			for i, param := range m.Params {
+				m.Params[i] = strings.TrimSpace(param)
+			}
+		}
+		pos = end + 1
+	}
+	m.Body = strings.TrimSpace(line[pos:])
+	return m
+}
+
+// -----------------------------------------------------------------------------
@@ -0,0 +1,65 @@
+package preprocessor
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// -----------------------------------------------------------------------------
+
+func TestParseMacros(t *testing.T) {
+	macros := ParseMacros([]byte(`#define FOO 42
+#define EMPTY
+#define MAX(a, b) ((a) > (b) ? (a) : (b))
+#define NOARGS() 1
+#define STR "a b"
+`))
+	expected := []*Macro{
+		{Name: "FOO", Body: "42"},
+		{Name: "EMPTY"},
+		{Name: "MAX", Params: []string{"a", "b"}, Body: "((a) > (b) ? (a) : (b))", FuncLike: true},
+		{Name: "NOARGS", Body: "1", FuncLike: true},
+		{Name: "STR", Body: `"a b"`},
+	}
+	if !reflect.DeepEqual(macros, expected) {
+		for _, m := range macros {
+			t.Logf("%+v\n", m)
+		}
+		t.Fatal("ParseMacros failed")
+	}
+}
+
+func TestScanDefines(t *testing.T) {
+	var out strings.Builder
+	macros, err := scanDefines(strings.NewReader(`# 0 "foo.c"
+# 0 "<built-in>"
+#define __STDC__ 1
+# 1 "foo.c"
+# 1 "/usr/include/limits.h" 1 3 4
+#define INT_MAX 2147483647
+#define OLD 1
+# 2 "foo.c" 2
+#undef OLD
+#define N (INT_MAX - 1)
+int a[N];
+`), &out)
+	if err != nil {
+		t.Fatal("scanDefines:", err)
+	}
+	expected := []*Macro{
+		{Name: "INT_MAX", Body: "2147483647", System: true},
+		{Name: "N", Body: "(INT_MAX - 1)"},
+	}
+	if !reflect.DeepEqual(macros, expected) {
+		for _, m := range macros {
+			t.Logf("%+v\n", m)
+		}
+		t.Fatal("scanDefines failed")
+	}
+	if pp := out.String(); pp != "# 0 \"foo.c\"\n# 0 \"<built-in>\"\n\n# 1 \"foo.c\"\n# 1 \"/usr/include/limits.h\" 1 3 4\n\n\n# 2 \"foo.c\" 2\n\n\nint a[N];\n" {
+		t.Fatalf("scanDefines:\n%s", pp)
+	}
+}
+
+// -----------------------------------------------------------------------------
@@ -13,33 +13,48 @@ type Config struct {
 	IncludeDirs []string
 	Defines     []string
 	Flags       []string
+
+	// KeepComments keeps comments in the output (-C), so that they can be
+	// parsed as documentation (see parser.ParseComments).
+	KeepComments bool
 }
 
-func Do(infile, outfile string, conf *Config) (err error) {
-	if conf == nil {
-		conf = new(Config)
+func (p *Config) compiler() string {
+	if p.Compiler == "" {
+		return "clang"
 	}
-	compiler := conf.Compiler
-	if compiler == "" {
-		compiler = "clang"
+	return p.Compiler
+}
+
+func (p *Config) ppflag() string {
+	if p.PPFlag == "" {
+		return "-E"
 	}
-	ppflag := conf.PPFlag
-	if ppflag == "" {
-		ppflag = "-E"
+	return p.PPFlag
+}
+
+// args returns the arguments of the preprocessor but the input file.
+func (p *Config) args() []string {
+	args := make([]string, 0, 1+len(p.Flags)+len(p.IncludeDirs)+len(p.Defines))
+	if p.KeepComments {
+		args = append(args, "-C")
 	}
-	n := 4 + len(conf.Flags) + len(conf.IncludeDirs) + len(conf.Defines)
-	args := make([]string, 3, n)
-	args[0] = ppflag
-	args[1], args[2] = "-o", outfile
-	args = append(args, conf.Flags...)
-	for _, def := range conf.Defines {
+	args = append(args, p.Flags...)
+	for _, def := range p.Defines {
 		args = append(args, "-D"+def)
 	}
-	for _, inc := range conf.IncludeDirs {
+	for _, inc := range p.IncludeDirs {
 		args = append(args, "-I"+inc)
 	}
-	args = append(args, infile)
-	cmd := exec.Command(compiler, args...)
+	return args
+}
+
+func Do(infile, outfile string, conf *Config) (err error) {
+	if conf == nil {
+		conf = new(Config)
+	}
+	args := append([]string{conf.ppflag(), "-o", outfile}, conf.args()...)
+	cmd := exec.Command(conf.compiler(), append(args, infile)...)
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
 	return cmd.Run()
@@ -57,6 +57,10 @@ type Config struct {
 	TyInt128  types.Type
 	TyUint128 types.Type
 	Flags     int
+
+	// Ident maps a type name to its Go identifier if it's not nil, such as a
+	// typedef name renamed since it's a Go predeclared identifier.
+	Ident func(name string) string
 }
 
 const (
@@ -176,6 +180,9 @@ const (
 
 func (p *parser) lookupType(tylit string, flags int) (t types.Type, err error) {
 	structOrUnion := (flags & flagStructOrUnion) != 0
+	if p.conf.Ident != nil && !structOrUnion {
+		tylit = p.conf.Ident(tylit)
+	}
 	_, o := p.scope.LookupParent(tylit, token.NoPos)
 	if o == nil {
 		return nil, &TypeNotFound{Literal: tylit, StructOrUnion: structOrUnion}
@@ -0,0 +1,179 @@
+package clang
+
+import (
+	"fmt"
+	"reflect"
+	"unsafe"
+)
+
+// -----------------------------------------------------------------------------
+
+// VaList is the Go representation of C va_list: the variadic arguments of a
+// call and a cursor to the next argument to be fetched by va_arg.
+type VaList struct {
+	args  []interface{}
+	next  int
+	ended bool
+}
+
+// NewVaList implements va_start.
+func NewVaList(args []interface{}) *VaList {
+	return &VaList{args: args}
+}
+
+// Copy implements va_copy.
+func (p *VaList) Copy() *VaList {
+	p.check("")
+	return &VaList{args: p.args, next: p.next}
+}
+
+// End implements va_end.
+func (p *VaList) End() {
+	if p != nil {
+		p.ended = true
+	}
+}
+
+// Args returns the arguments which aren't fetched yet, so that p can be
+// forwarded to a function which takes a va_list.
+func (p *VaList) Args() []interface{} {
+	p.check("")
+	return p.args[p.next:]
+}
+
+// VaArgError is the panic value of a va_arg failure.
+type VaArgError struct {
+	Pos  string // C source position: file:line:col
+	Want string // C type passed to va_arg
+	Got  interface{}
+	Msg  string
+}
+
+func (p *VaArgError) Error() string {
+	msg := p.Msg
+	if msg == "" {
+		msg = fmt.Sprintf("va_arg: %s expected, got %T", p.Want, p.Got)
+	}
+	if p.Pos == "" {
+		return msg
+	}
+	return p.Pos + ": " + msg
+}
+
+func (p *VaList) check(pos string) {
+	if p == nil {
+		panic(&VaArgError{Pos: pos, Msg: "va_list used before va_start"})
+	}
+	if p.ended {
+		panic(&VaArgError{Pos: pos, Msg: "va_list used after va_end"})
+	}
+}
+
+func (p *VaList) arg(pos string) interface{} {
+	p.check(pos)
+	if p.next >= len(p.args) {
+		panic(&VaArgError{Pos: pos, Msg: "va_arg: no more arguments"})
+	}
+	v := p.args[p.next]
+	p.next++
+	return v
+}
+
+func (p *VaList) mismatch(pos, want string, got interface{}) {
+	p.next--
+	panic(&VaArgError{Pos: pos, Want: want, Got: got})
+}
+
+// -----------------------------------------------------------------------------
+
+// Arg fetches the next argument as is.
+func (p *VaList) Arg(pos string) interface{} {
+	return p.arg(pos)
+}
+
+// Int32 fetches the next argument as an int (or a type promoted to int).
+func (p *VaList) Int32(pos string) int32 {
+	switch v := p.arg(pos).(type) {
+	case int32:
+		return v
+	case uint32:
+		return int32(v)
+	case int:
+		return int32(v)
+	case int8:
+		return int32(v)
+	case int16:
+		return int32(v)
+	case uint8:
+		return int32(v)
+	case uint16:
+		return int32(v)
+	case bool:
+		if v {
+			return 1
+		}
+		return 0
+	default:
+		p.mismatch(pos, "int", v)
+	}
+	return 0
+}
+
+// Uint32 fetches the next argument as an unsigned int.
+func (p *VaList) Uint32(pos string) uint32 {
+	return uint32(p.Int32(pos))
+}
+
+// Int64 fetches the next argument as a long long.
+func (p *VaList) Int64(pos string) int64 {
+	switch v := p.arg(pos).(type) {
+	case int64:
+		return v
+	case uint64:
+		return int64(v)
+	case int:
+		return int64(v)
+	case uintptr:
+		return int64(v)
+	default:
+		p.mismatch(pos, "long long", v)
+	}
+	return 0
+}
+
+// Uint64 fetches the next argument as an unsigned long long.
+func (p *VaList) Uint64(pos string) uint64 {
+	return uint64(p.Int64(pos))
+}
+
+// Float64 fetches the next argument as a double (or a float promoted to
+// double).
+func (p *VaList) Float64(pos string) float64 {
+	switch v := p.arg(pos).(type) {
+	case float64:
+		return v
+	case float32:
+		return float64(v)
+	default:
+		p.mismatch(pos, "double", v)
+	}
+	return 0
+}
+
+// Pointer fetches the next argument as a pointer of any type.
+func (p *VaList) Pointer(pos string) unsafe.Pointer {
+	switch v := p.arg(pos).(type) {
+	case nil:
+		return nil
+	case unsafe.Pointer:
+		return v
+	default:
+		if rv := reflect.ValueOf(v); rv.Kind() == reflect.Ptr {
+			return unsafe.Pointer(rv.Pointer())
+		}
+		p.mismatch(pos, "pointer", v)
+	}
+	return nil
+}
+
+// -----------------------------------------------------------------------------
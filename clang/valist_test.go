@@ -0,0 +1,70 @@
+package clang
+
+import (
+	"testing"
+	"unsafe"
+)
+
+// -----------------------------------------------------------------------------
+
+func expectVaError(t *testing.T, msg string, fn func()) {
+	t.Helper()
+	defer func() {
+		e, ok := recover().(*VaArgError)
+		if !ok || e.Error() != msg {
+			t.Fatalf("expect error %q, got %v", msg, e)
+		}
+	}()
+	fn()
+}
+
+func TestVaArg(t *testing.T) {
+	var x int8
+	ap := NewVaList([]interface{}{int32(-1), 2, int64(3), 1.5, &x, nil, "s"})
+	if v := ap.Uint32(""); v != 0xffffffff {
+		t.Fatal("Uint32:", v)
+	}
+	if v := ap.Int32(""); v != 2 {
+		t.Fatal("Int32:", v)
+	}
+	if v := ap.Int64(""); v != 3 {
+		t.Fatal("Int64:", v)
+	}
+	if v := ap.Float64(""); v != 1.5 {
+		t.Fatal("Float64:", v)
+	}
+	if v := ap.Pointer(""); v != unsafe.Pointer(&x) {
+		t.Fatal("Pointer:", v)
+	}
+	if v := ap.Pointer(""); v != nil {
+		t.Fatal("Pointer:", v)
+	}
+	expectVaError(t, "a.c:1:1: va_arg: int expected, got string", func() {
+		ap.Int32("a.c:1:1")
+	})
+	if v := ap.Arg(""); v != "s" {
+		t.Fatal("Arg:", v)
+	}
+	expectVaError(t, "a.c:1:2: va_arg: no more arguments", func() {
+		ap.Arg("a.c:1:2")
+	})
+}
+
+func TestVaCopy(t *testing.T) {
+	ap := NewVaList([]interface{}{int32(1), int32(2), int32(3)})
+	ap.Int32("")
+	aq := ap.Copy()
+	if ap.Int32("") != 2 || aq.Int32("") != 2 || len(aq.Args()) != 1 {
+		t.Fatal("Copy")
+	}
+	ap.End()
+	expectVaError(t, "a.c:2:1: va_list used after va_end", func() {
+		ap.Int32("a.c:2:1")
+	})
+	var nilap *VaList
+	expectVaError(t, "a.c:2:2: va_list used before va_start", func() {
+		nilap.Int32("a.c:2:2")
+	})
+}
+
+// -----------------------------------------------------------------------------
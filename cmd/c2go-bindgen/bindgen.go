@@ -0,0 +1,94 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/goplus/c2go/cl"
+	"github.com/goplus/c2go/clang/parser"
+	"github.com/goplus/c2go/clang/preprocessor"
+)
+
+var (
+	output   = flag.String("o", "", "output Go file (default: header.go)")
+	pkgname  = flag.String("pkg", "main", "package name of the output")
+	filter   = flag.String("filter", "", "regexp of C functions, variables and macros to bind (default: all)")
+	stubs    = flag.String("stubs", "panic", "how to generate functions: none, panic or linkname")
+	linkpkg  = flag.String("linkpkg", "", "package which implements the functions (required by -stubs=linkname)")
+	comments = flag.Bool("comments", false, "carry comments of C declarations to the output")
+)
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: c2go-bindgen [-o output.go -pkg name -filter regexp -stubs kind -linkpkg pkgpath -comments] header.h\n")
+	flag.PrintDefaults()
+}
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+	if flag.NArg() != 1 {
+		usage()
+		return
+	}
+	if err := bindgen(flag.Arg(0)); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func bindgen(infile string) error {
+	bind := &cl.BindConfig{LinkPkg: *linkpkg}
+	switch *stubs {
+	case "none":
+		bind.Stubs = cl.StubNone
+	case "panic":
+		bind.Stubs = cl.StubPanic
+	case "linkname":
+		if *linkpkg == "" {
+			return fmt.Errorf("c2go-bindgen: -linkpkg is required by -stubs=linkname")
+		}
+		bind.Stubs = cl.StubLinkname
+	default:
+		return fmt.Errorf("c2go-bindgen: unknown stub kind %q", *stubs)
+	}
+	if *filter != "" {
+		re, err := regexp.Compile(*filter)
+		if err != nil {
+			return err
+		}
+		bind.Filter = re.MatchString
+	}
+
+	outfile := infile + ".i"
+	macros, err := preprocessor.DoWithMacros(infile, outfile, &preprocessor.Config{KeepComments: *comments})
+	defer os.Remove(outfile)
+	if err != nil {
+		return err
+	}
+
+	var mode parser.Mode
+	if *comments {
+		mode = parser.ParseComments
+	}
+	doc, _, err := parser.ParseFile(outfile, mode)
+	if err != nil {
+		return err
+	}
+	pkg, err := cl.NewPackage("", *pkgname, doc, &cl.Config{
+		SrcFile: outfile,
+		Macros:  macros,
+		Bind:    bind,
+	})
+	if err != nil {
+		return err
+	}
+
+	gofile := *output
+	if gofile == "" {
+		gofile = strings.TrimSuffix(infile, ".h") + ".go"
+	}
+	return pkg.WritePkgFile(gofile)
+}
@@ -11,14 +11,27 @@ import (
 )
 
 var (
-	verbose  = flag.Bool("v", false, "print verbose information")
-	failfast = flag.Bool("ff", false, "fail fast (stop if an error is encountered)")
-	gendeps  = flag.Bool("gendeps", false, "generate dependencies automatically")
-	test     = flag.Bool("test", false, "run test")
+	verbose   = flag.Bool("v", false, "print verbose information")
+	failfast  = flag.Bool("ff", false, "fail fast (stop if an error is encountered)")
+	gendeps   = flag.Bool("gendeps", false, "generate dependencies automatically")
+	test      = flag.Bool("test", false, "run test")
+	gotostat  = flag.Bool("gotostat", false, "report functions which still need gotos")
+	unsafeadd = flag.Bool("unsafeadd", false, "use unsafe.Add for pointer arithmetic (requires Go 1.17+)")
+	flatmem   = flag.Bool("flatmem", false, "place C memory in a managed arena addressed by uintptr")
+	checkptr  = flag.Bool("checkptr", false, "check pointer arithmetic, dereferences and array indexes at runtime")
+	memcheck  = flag.Bool("memcheck", false, "report memory leaks, double frees and invalid frees with their C call sites (double frees of blocks freed long before aren't detected)")
+	nonnull   = flag.Bool("nonnull", false, "check that parameters declared nonnull aren't NULL at runtime (implied by -checkptr)")
+	pkginfo   = flag.Bool("pkginfo", false, "write package information (undefined symbols, used headers) as JSON")
+	split     = flag.Bool("split", false, "split the generated code into files by C source file")
+	comments  = flag.Bool("comments", false, "carry comments of C declarations to the generated code")
+	prune     = flag.Bool("prune", false, "drop declarations of system headers which aren't referenced")
+	cache     = flag.Bool("cache", false, "cache AST dumps of clang in ~/.c2go/cache")
+	record    = flag.Bool("record", false, "record the AST dump of clang with the preprocessed source in source.i.json.gz")
+	naming    = flag.Bool("naming", false, "apply naming rules of c2go_naming.json and write the Go names of C symbols to c2go_symbols.json")
 )
 
 func usage() {
-	fmt.Fprintf(os.Stderr, "Usage: c2go [-test -ff -gendeps -v] [pkgname] source.c\n")
+	fmt.Fprintf(os.Stderr, "Usage: c2go [-test -ff -gendeps -gotostat -unsafeadd -flatmem -checkptr -memcheck -nonnull -split -comments -prune -cache -record -naming -v] [pkgname] source.c|source.i|source.i.json[.gz]\n")
 	flag.PrintDefaults()
 }
 
@@ -56,5 +69,44 @@ func main() {
 	if *gendeps {
 		flags |= c2go.FlagDepsAutoGen
 	}
+	if *gotostat {
+		flags |= c2go.FlagGotoStat
+	}
+	if *unsafeadd {
+		flags |= c2go.FlagUnsafeAdd
+	}
+	if *flatmem {
+		flags |= c2go.FlagFlatMemory
+	}
+	if *checkptr {
+		flags |= c2go.FlagCheckedPointers
+	}
+	if *memcheck {
+		flags |= c2go.FlagMemCheck
+	}
+	if *nonnull {
+		flags |= c2go.FlagNonNullChecks
+	}
+	if *pkginfo {
+		flags |= c2go.FlagPkgInfo
+	}
+	if *split {
+		flags |= c2go.FlagSplitFiles
+	}
+	if *comments {
+		flags |= c2go.FlagComments
+	}
+	if *prune {
+		flags |= c2go.FlagPruneDecls
+	}
+	if *cache {
+		flags |= c2go.FlagCacheAST
+	}
+	if *record {
+		flags |= c2go.FlagRecordAST
+	}
+	if *naming {
+		flags |= c2go.FlagNaming
+	}
 	c2go.Run(pkgname, infile, flags)
 }
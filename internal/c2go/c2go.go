@@ -2,8 +2,10 @@ package c2go
 
 import (
 	"bytes"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"go/token"
 	"io"
 	"log"
 	"os"
@@ -13,10 +15,13 @@ import (
 	"runtime"
 	"strings"
 
+	goast "go/ast"
+	goparser "go/parser"
+
 	"github.com/goplus/c2go/cl"
+	"github.com/goplus/c2go/clang/ast"
 	"github.com/goplus/c2go/clang/parser"
 	"github.com/goplus/c2go/clang/preprocessor"
-	"github.com/goplus/gox"
 )
 
 const (
@@ -24,10 +29,32 @@ const (
 	FlagRunTest
 	FlagFailFast
 	FlagDepsAutoGen
+	FlagGotoStat
+	FlagUnsafeAdd
+	FlagFlatMemory
+	FlagCheckedPointers
+	FlagMemCheck
+	FlagNonNullChecks
+	FlagPkgInfo
+	FlagSplitFiles
+	FlagComments
+	FlagPruneDecls
+	FlagCacheAST
+	FlagNaming
+	FlagRecordAST
 
 	flagChdir
 )
 
+// splitMaxLines is the maximum lines of a file of FlagSplitFiles, which keeps
+// files of large translation units workable for editors and gopls.
+const splitMaxLines = 20000
+
+func fileExists(name string) bool {
+	_, err := os.Stat(name)
+	return err == nil
+}
+
 func isDir(name string) bool {
 	if fi, err := os.Lstat(name); err == nil {
 		return fi.IsDir()
@@ -37,12 +64,17 @@ func isDir(name string) bool {
 
 func Run(pkgname, infile string, flags int) {
 	outfile := infile
+	var astfile string
+	var macros []*preprocessor.Macro
+	if name := strings.TrimSuffix(infile, ".gz"); strings.HasSuffix(name, ".json") { // AST dump of foo.i
+		astfile, outfile = infile, strings.TrimSuffix(name, ".json")
+		infile = outfile
+	}
 	switch filepath.Ext(infile) {
 	case ".i":
 	case ".c":
 		outfile = infile + ".i"
-		err := preprocessor.Do(infile, outfile, nil)
-		check(err)
+		macros = preprocess(infile, outfile, flags)
 	default:
 		if strings.HasSuffix(infile, "/...") {
 			infile = strings.TrimSuffix(infile, "/...")
@@ -63,10 +95,17 @@ func Run(pkgname, infile string, flags int) {
 		}
 		return
 	}
-	execFile(pkgname, outfile, flags|flagChdir)
+	execFile(pkgname, outfile, astfile, macros, flags|flagChdir)
 	return
 }
 
+func preprocess(infile, outfile string, flags int) []*preprocessor.Macro {
+	conf := &preprocessor.Config{KeepComments: (flags & FlagComments) != 0}
+	macros, err := preprocessor.DoWithMacros(infile, outfile, conf)
+	check(err)
+	return macros
+}
+
 func execDirRecursively(dir string, flags int) (last error) {
 	if strings.HasPrefix(dir, "_") {
 		return
@@ -124,30 +163,107 @@ func execDir(pkgname string, dir string, flags int) (n int, err error) {
 	case 1:
 		infile = files[0]
 		outfile = infile + ".i"
-		err = preprocessor.Do(infile, outfile, nil)
-		check(err)
-		execFile(pkgname, outfile, flags)
+		macros := preprocess(infile, outfile, flags)
+		execFile(pkgname, outfile, "", macros, flags)
 	}
 	return
 }
 
-func execFile(pkgname string, outfile string, flags int) {
-	doc, _, err := parser.ParseFile(outfile, 0)
+// execFile translates the preprocessed file outfile, whose AST is parsed from
+// astfile if it isn't empty.
+func execFile(pkgname string, outfile, astfile string, macros []*preprocessor.Macro, flags int) {
+	var mode parser.Mode
+	if (flags & FlagComments) != 0 {
+		mode |= parser.ParseComments
+	}
+	var src []byte
+	parse := parser.ParseFile
+	if astfile != "" {
+		parse = func(filename string, mode parser.Mode) (file *ast.Node, _ []byte, err error) {
+			file, src, err = parser.ParseASTFileEx(astfile, filename, mode)
+			if err == nil && src == nil && !fileExists(filename) {
+				fatalf("%s: the AST dump doesn't record its source, and %s is not found.\n", astfile, filename)
+			}
+			return
+		}
+	} else if (flags & FlagRecordAST) != 0 {
+		parse = func(filename string, mode parser.Mode) (*ast.Node, []byte, error) {
+			return parser.RecordAST(filename, filename+".json.gz", mode)
+		}
+	} else if (flags & FlagCacheAST) != 0 {
+		home, err := os.UserHomeDir()
+		check(err)
+		cache := &parser.Cache{Dir: filepath.Join(home, ".c2go", "cache")}
+		parse = cache.ParseFile
+	}
+	doc, _, err := parse(outfile, mode)
 	check(err)
 
-	pkg, err := cl.NewPackage("", pkgname, doc, &cl.Config{SrcFile: outfile})
+	gofile := outfile + ".go"
+	dir, _ := filepath.Split(gofile)
+	if (flags & FlagSplitFiles) != 0 {
+		removeSplitFiles(gofile)
+	}
+	fns, refs := goFuncs(dir, gofile)
+	useMacros(macros, refs)
+	if (flags & FlagPruneDecls) != 0 {
+		err = parser.PruneDeclsEx(doc, outfile, src, refs)
+		check(err)
+	}
+
+	var split *cl.SplitConfig
+	if (flags & FlagSplitFiles) != 0 {
+		split = &cl.SplitConfig{ByFile: true, MaxLines: splitMaxLines}
+	}
+	var naming *cl.NamingConfig
+	if (flags & FlagNaming) != 0 {
+		naming = loadNaming(filepath.Join(dir, "c2go_naming.json"), append(fns, refs...))
+	}
+	pkg, err := cl.NewPackage("", pkgname, doc, &cl.Config{
+		SrcFile:         outfile,
+		Src:             src,
+		UnsafeAdd:       (flags & FlagUnsafeAdd) != 0,
+		FlatMemory:      (flags & FlagFlatMemory) != 0,
+		CheckedPointers: (flags & FlagCheckedPointers) != 0,
+		MemCheck:        (flags & FlagMemCheck) != 0,
+		NonNullChecks:   (flags & FlagNonNullChecks) != 0,
+		Macros:          macros,
+		Providers:       []*cl.Provider{cl.LibcProvider()},
+		Overrides:       fns,
+		Split:           split,
+		Naming:          naming,
+	})
 	check(err)
+	for _, diag := range pkg.Diagnostics {
+		fmt.Fprintln(os.Stderr, diag)
+	}
 
-	gofile := outfile + ".go"
-	err = gox.WriteFile(gofile, pkg.Package, false)
+	_, err = pkg.WritePkgFiles(gofile)
 	check(err)
 
-	dir, _ := filepath.Split(gofile)
+	if naming != nil {
+		symfile := filepath.Join(dir, "c2go_symbols.json")
+		err = pkg.WriteSymbolFile(symfile)
+		check(err)
+	}
+
+	if (flags & FlagGotoStat) != 0 {
+		printGotoStat(outfile, pkg.GotoFuncs)
+	}
 
 	if (flags & FlagDepsAutoGen) != 0 {
 		depfile := filepath.Join(dir, "c2go_autogen.go")
 		err = pkg.WriteDepFile(depfile)
 		check(err)
+		if missing := pkg.Unimplemented(); len(missing) > 0 {
+			fmt.Fprintf(os.Stderr, "%s: unimplemented: %s\n", depfile, strings.Join(missing, ", "))
+		}
+	}
+
+	if (flags & FlagPkgInfo) != 0 {
+		infofile := filepath.Join(dir, "c2go_pkginfo.json")
+		err = pkg.PkgInfo.WriteJSONFile(infofile)
+		check(err)
 	}
 
 	if (flags & flagChdir) != 0 {
@@ -164,6 +280,109 @@ func execFile(pkgname string, outfile string, flags int) {
 	}
 }
 
+// useMacros marks the macros of system headers which hand-written Go files
+// refer to as used, so that they become Go consts too.
+func useMacros(macros []*preprocessor.Macro, refs []string) {
+	used := make(map[string]bool, len(refs))
+	for _, name := range refs {
+		used[name] = true
+	}
+	for _, m := range macros {
+		if m.System && used[m.Name] {
+			m.System = false
+		}
+	}
+}
+
+// loadNaming loads the naming rules of FlagNaming from file. The C names of
+// keep, which hand-written Go files declare or refer to, keep their generated
+// names.
+func loadNaming(file string, keep []string) *cl.NamingConfig {
+	b, err := os.ReadFile(file)
+	check(err)
+	naming := new(cl.NamingConfig)
+	err = json.Unmarshal(b, naming)
+	check(err)
+	if naming.Renames == nil {
+		naming.Renames = make(map[string]string)
+	}
+	for _, name := range keep {
+		naming.Renames[name] = name
+		for _, tag := range []string{"struct", "union", "enum"} {
+			naming.Renames[tag+" "+name] = tag + "_" + name
+		}
+	}
+	return naming
+}
+
+// goFuncs returns the functions declared by hand-written Go files in dir (such
+// as libc.go of testdata), which override the C functions of the same names,
+// and the C names which the files refer to but don't declare.
+func goFuncs(dir, gofile string) (fns, refs []string) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.go"))
+	check(err)
+	fset := token.NewFileSet()
+	for _, file := range files {
+		fname := filepath.Base(file)
+		if fname == filepath.Base(gofile) || isSplitFile(file, gofile) || fname == "c2go_autogen.go" || strings.HasSuffix(fname, "_test.go") {
+			continue
+		}
+		if pos := strings.LastIndex(fname, "_"); pos >= 0 {
+			switch os := fname[pos+1 : len(fname)-3]; os {
+			case "darwin", "linux", "windows":
+				if os != runtime.GOOS {
+					continue
+				}
+			}
+		}
+		f, err := goparser.ParseFile(fset, file, nil, 0)
+		check(err)
+		for _, decl := range f.Decls {
+			if fn, ok := decl.(*goast.FuncDecl); ok && fn.Recv == nil {
+				fns = append(fns, fn.Name.Name)
+			}
+		}
+		for _, ident := range f.Unresolved { // such as FILE and struct__IO_FILE
+			refs = append(refs, cName(ident.Name))
+		}
+	}
+	return
+}
+
+// cName returns the C name of a generated name, such as _IO_FILE of
+// struct__IO_FILE.
+func cName(name string) string {
+	for _, prefix := range []string{"struct_", "union_", "enum_"} {
+		if strings.HasPrefix(name, prefix) {
+			return name[len(prefix):]
+		}
+	}
+	return name
+}
+
+// isSplitFile reports whether file is a part of gofile split by FlagSplitFiles,
+// such as foo.c.i.stdio.go of foo.c.i.go.
+func isSplitFile(file, gofile string) bool {
+	return strings.HasPrefix(filepath.Base(file), strings.TrimSuffix(filepath.Base(gofile), ".go")+".")
+}
+
+// removeSplitFiles removes the parts of gofile written by a previous run, which
+// would otherwise redeclare its symbols.
+func removeSplitFiles(gofile string) {
+	files, err := filepath.Glob(strings.TrimSuffix(gofile, ".go") + ".*.go")
+	check(err)
+	for _, file := range files {
+		os.Remove(file)
+	}
+}
+
+func printGotoStat(file string, gotofns []string) {
+	fmt.Fprintf(os.Stderr, "==> %s: %d functions still need gotos\n", file, len(gotofns))
+	for _, fn := range gotofns {
+		fmt.Fprintln(os.Stderr, "   ", fn)
+	}
+}
+
 func checkEqual(prompt string, a, expected []byte) {
 	if bytes.Equal(a, expected) {
 		return
@@ -1,30 +1,5 @@
 package main
 
-import (
-	"fmt"
-	"strings"
-	"unsafe"
-)
-
-func gostring(s *int8) string {
-	n, arr := 0, (*[1 << 20]byte)(unsafe.Pointer(s))
-	for arr[n] != 0 {
-		n++
-	}
-	return string(arr[:n])
-}
-
-func printf(format *int8, args ...interface{}) int32 {
-	goformat := strings.ReplaceAll(gostring(format), "%lld", "%d")
-	for i, arg := range args {
-		if v, ok := arg.(*int8); ok {
-			args[i] = gostring(v)
-		}
-	}
-	fmt.Printf(goformat, args...)
-	return 0
-}
-
 func __atomic_store_n_i32(p *int32, memorder int32, v int32) {
 	*p = v
 }
@@ -1,10 +1,5 @@
 package main
 
-import (
-	"fmt"
-	"unsafe"
-)
-
 func creal(v complex128) float64 {
 	return real(v)
 }
@@ -13,25 +8,6 @@ func cimag(v complex128) float64 {
 	return imag(v)
 }
 
-func gostring(s *int8) string {
-	n, arr := 0, (*[1 << 20]byte)(unsafe.Pointer(s))
-	for arr[n] != 0 {
-		n++
-	}
-	return string(arr[:n])
-}
-
-func printf(format *int8, args ...interface{}) int32 {
-	goformat := gostring(format)
-	for i, arg := range args {
-		if v, ok := arg.(*int8); ok {
-			args[i] = gostring(v)
-		}
-	}
-	fmt.Printf(goformat, args...)
-	return 0
-}
-
 func __swbuf(_c int32, _p *FILE) int32 {
 	return _c
 }
@@ -0,0 +1,15 @@
+#include <stdio.h>
+#include <ctype.h>
+
+int main() {
+    int c;
+    for (c = -128; c < 256; c++) {
+        printf("%4d: %d%d%d%d%d%d%d%d%d%d%d%d %4d %4d\n", c,
+            isalnum(c) != 0, isalpha(c) != 0, isblank(c) != 0, iscntrl(c) != 0,
+            isdigit(c) != 0, isgraph(c) != 0, islower(c) != 0, isprint(c) != 0,
+            ispunct(c) != 0, isspace(c) != 0, isupper(c) != 0, isxdigit(c) != 0,
+            tolower(c), toupper(c));
+    }
+    printf("%d %d %d\n", isalpha(EOF) != 0, tolower(EOF), toupper(EOF));
+    return 0;
+}
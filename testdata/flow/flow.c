@@ -33,6 +33,29 @@ two:        printf("multiple shots\n");
     }
 }
 
+int check(int n) {
+    int i;
+    if (n < 0)
+        goto out;
+    if (n == 0) {
+        goto fail;
+    }
+    for (i = 0; i < n; i++) {
+        if (i == 3)
+            goto fail;
+        switch (i) {
+        case 1:
+            continue;
+        }
+        printf("check %d: %d\n", n, i);
+    }
+    return 0;
+fail:
+    printf("check %d: fail\n", n);
+out:
+    return -1;
+}
+
 int main() {
     int a = sizeof(int);
     int *b = &a;
@@ -68,5 +91,9 @@ done:
     f(1);
     f(-1);
     g(2);
+    printf("check = %d\n", check(-1));
+    printf("check = %d\n", check(0));
+    printf("check = %d\n", check(2));
+    printf("check = %d\n", check(5));
     return 0;
 }
@@ -0,0 +1,101 @@
+#include <stdio.h>
+#include <math.h>
+#include <errno.h>
+
+#define N 14
+
+double args[N] = {
+    0.0, 0.0, 0.5, -0.75, 1.0, 2.5, -3.0, 100.0, 1e300, -1e300, 1e-310, 800.0, -800.0, 0.0
+};
+
+void show(const char *name, double x, double v) {
+    int e = errno;
+    errno = 0;
+    printf("%s(%g) = %.14g, errno %d\n", name, x, v, e);
+}
+
+void showExact(const char *name, double x, double v) {
+    int e = errno;
+    errno = 0;
+    printf("%s(%g) = %a, errno %d\n", name, x, v, e);
+}
+
+#define TEST(fn)                            \
+    for (i = 0; i < N; i++) {               \
+        show(#fn, args[i], fn(args[i]));    \
+    }
+
+#define TEST_EXACT(fn)                              \
+    for (i = 0; i < N; i++) {                       \
+        showExact(#fn, args[i], fn(args[i]));       \
+    }
+
+void classify(double x) {
+    printf("%g: isnan %d, isinf %d, isfinite %d, signbit %d, fpclassify %d\n",
+        x, isnan(x) != 0, isinf(x), isfinite(x) != 0, signbit(x) != 0, fpclassify(x));
+}
+
+int main() {
+    int i, e2;
+    double ip;
+    args[1] = -args[0]; /* -0.0 */
+    args[N - 1] = NAN;
+    args[N - 2] = -HUGE_VAL;
+    args[N - 3] = INFINITY;
+    TEST(sin)
+    TEST(cos)
+    TEST(tan)
+    TEST(asin)
+    TEST(acos)
+    TEST(atan)
+    TEST(sinh)
+    TEST(cosh)
+    TEST(tanh)
+    TEST(acosh)
+    TEST(atanh)
+    TEST(exp)
+    TEST(exp2)
+    TEST(expm1)
+    TEST(log)
+    TEST(log10)
+    TEST(log2)
+    TEST(log1p)
+    TEST(cbrt)
+    TEST(erf)
+    TEST(erfc)
+    TEST(tgamma)
+    TEST_EXACT(sqrt)
+    TEST_EXACT(fabs)
+    TEST_EXACT(floor)
+    TEST_EXACT(ceil)
+    TEST_EXACT(trunc)
+    TEST_EXACT(round)
+    TEST_EXACT(rint)
+    TEST_EXACT(logb)
+    for (i = 0; i < N; i++) {
+        double y = args[(i + 3) % N];
+        show("pow", args[i], pow(args[i], y));
+        show("atan2", args[i], atan2(args[i], y));
+        showExact("fmod", args[i], fmod(args[i], y));
+        showExact("remainder", args[i], remainder(args[i], y));
+        showExact("hypot", args[i], hypot(args[i], y));
+        showExact("fmin", args[i], fmin(args[i], y));
+        showExact("fdim", args[i], fdim(args[i], y));
+        showExact("copysign", args[i], copysign(args[i], y));
+        showExact("ldexp", args[i], ldexp(args[i], 1000 - 300 * i));
+        showExact("frexp", args[i], frexp(args[i], &e2));
+        printf("exp %d\n", e2);
+        showExact("modf", args[i], modf(args[i], &ip));
+        printf("ip %a\n", ip);
+        printf("ilogb %d, lround %ld, errno %d\n", ilogb(args[i]), lround(args[i]), errno);
+        errno = 0;
+        classify(args[i]);
+    }
+    show("pow", -8, pow(-8, 1.0 / 3));
+    show("pow", 0, pow(0, -1));
+    show("pow", 10, pow(10, -400));
+    show("fma", 2, fma(2, 3, 4));
+    showExact("nan", 0, nan(""));
+    printf("%f %e %g %a\n", sinf(0.5f), expf(-1.0f), sqrtf(2.0f), fmodf(7.5f, 2.0f));
+    return 0;
+}
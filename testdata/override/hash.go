@@ -0,0 +1,11 @@
+package main
+
+import "unsafe"
+
+func hash(s *int8) uint32 {
+	h := uint32(5381)
+	for p := uintptr(unsafe.Pointer(s)); *(*uint8)(unsafe.Pointer(p)) != 0; p++ {
+		h = h<<5 + h + uint32(*(*uint8)(unsafe.Pointer(p)))
+	}
+	return h
+}
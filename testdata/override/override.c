@@ -0,0 +1,17 @@
+#include <stdio.h>
+
+/* hash is overridden by hash.go */
+unsigned hash(const char *s) {
+	unsigned h = 5381;
+	while (*s)
+		h = h * 33 + (unsigned char)*s++;
+	return h;
+}
+
+int main() {
+	const char *words[] = {"", "a", "hello", "override"};
+	int i;
+	for (i = 0; i < 4; i++)
+		printf("%s: %u\n", words[i], hash(words[i]));
+	return 0;
+}
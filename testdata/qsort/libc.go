@@ -1,7 +1,6 @@
 package main
 
 import (
-	"fmt"
 	"log"
 	"unsafe"
 
@@ -21,25 +20,6 @@ func C(s string) *int8 {
 	return (*int8)(unsafe.Pointer(&ret[0]))
 }
 
-func gostring(s *int8) string {
-	n, arr := 0, (*[1 << 20]byte)(unsafe.Pointer(s))
-	for arr[n] != 0 {
-		n++
-	}
-	return string(arr[:n])
-}
-
-func printf(format *int8, args ...interface{}) int32 {
-	goformat := gostring(format)
-	for i, arg := range args {
-		if v, ok := arg.(*int8); ok {
-			args[i] = gostring(v)
-		}
-	}
-	fmt.Printf(goformat, args...)
-	return 0
-}
-
 func sliceOf(v unsafe.Pointer, bytes c.SizeT) []byte {
 	return (*[1 << 20]byte)(v)[:bytes]
 }
@@ -0,0 +1,92 @@
+#include <stdio.h>
+#include <stdlib.h>
+#include <errno.h>
+
+const char *inputs[] = {
+    "0", "-0", "1.5", "  +3.25e2xyz", ".5", "5.", "1e", "0x1.8p1", "0x.8", "0X1P-1074",
+    "inf", "-Infinity", "nan", "nan(123)", "NaN(", "1e308", "1e309", "-1e400",
+    "1e-320", "4.9e-324", "2.4703282292062328e-324", "2.4703282292062327e-324",
+    "2.2250738585072011e-308", "2.2250738585072014e-308", "1e-400",
+    "0.1", "0.30000000000000004", "123456789012345678901234567890",
+    "9007199254740993", "1.7976931348623157e308", "1.7976931348623159e308",
+    "abc", "", "-", "1e-40", "3.4028235e38", "3.5e38", "1e-46",
+};
+
+#define N (sizeof(inputs) / sizeof(inputs[0]))
+
+double values[] = {
+    0.1, 1.0 / 3, 2.0 / 3, 1e21, 1e-5, 123456.789, 0.5, 1.5, 2.5, 1e100, 5e-324,
+    0.000123456789, 99999.95, 9999995.0, 1e15, 1.7976931348623157e308, 100, 0.3,
+};
+
+#define M (sizeof(values) / sizeof(values[0]))
+
+const char *ints[] = {
+    "123", "-123", "0x7fffffffffffffff", "9223372036854775807", "9223372036854775808",
+    "-9223372036854775808", "-9223372036854775809", "18446744073709551615",
+    "18446744073709551616", "-18446744073709551616", "-1", "99999999999999999999999",
+};
+
+const char *hex = "0x1f";
+int bases[] = {10, 0, 16, 1, 37, -2};
+
+#define K (sizeof(ints) / sizeof(ints[0]))
+
+int main() {
+    unsigned i;
+    char *end;
+    char buf[64];
+    for (i = 0; i < N; i++) {
+        double d;
+        float f;
+        int e;
+        errno = 0;
+        d = strtod(inputs[i], &end);
+        e = errno;
+        printf("strtod(\"%s\") = %.17g %a, end %d, errno %d\n", inputs[i], d, d, (int)(end - inputs[i]), e);
+        errno = 0;
+        f = strtof(inputs[i], &end);
+        e = errno;
+        printf("strtof(\"%s\") = %.9g %a, end %d, errno %d\n", inputs[i], f, f, (int)(end - inputs[i]), e);
+    }
+    for (i = 0; i < M; i++) {
+        double v = values[i];
+        snprintf(buf, sizeof(buf), "%g|%.0g|%.3g|%.10g|%.17g|%#g", v, v, v, v, v, v);
+        printf("%s\n", buf);
+        snprintf(buf, sizeof(buf), "%e|%.0e|%.3E|%f|%.0f|%.2f", v, v, v, v, v, v);
+        printf("%.60s\n", buf);
+    }
+    printf("%.0f %.0f %.0f %.1f %.1f %.2f\n", 0.5, 1.5, 2.5, 0.25, 0.35, 1.005);
+    for (i = 0; i < K; i++) {
+        long l;
+        unsigned long ul;
+        long long ll;
+        unsigned long long ull;
+        int e;
+        errno = 0;
+        l = strtol(ints[i], &end, 0);
+        e = errno;
+        printf("strtol(\"%s\") = %ld, end %d, errno %d\n", ints[i], l, (int)(end - ints[i]), e);
+        errno = 0;
+        ul = strtoul(ints[i], &end, 0);
+        e = errno;
+        printf("strtoul(\"%s\") = %lu, end %d, errno %d\n", ints[i], ul, (int)(end - ints[i]), e);
+        errno = 0;
+        ll = strtoll(ints[i], &end, 10);
+        e = errno;
+        printf("strtoll(\"%s\") = %lld, end %d, errno %d\n", ints[i], ll, (int)(end - ints[i]), e);
+        errno = 0;
+        ull = strtoull(ints[i], &end, 10);
+        e = errno;
+        printf("strtoull(\"%s\") = %llu, end %d, errno %d\n", ints[i], ull, (int)(end - ints[i]), e);
+    }
+    for (i = 0; i < sizeof(bases) / sizeof(bases[0]); i++) {
+        long l;
+        int e;
+        errno = 0;
+        l = strtol(hex, &end, bases[i]);
+        e = errno;
+        printf("strtol(\"%s\", %d) = %ld, end %d, errno %d\n", hex, bases[i], l, (int)(end - hex), e);
+    }
+    return 0;
+}
@@ -0,0 +1,40 @@
+#include <stdio.h>
+#include <time.h>
+#include <errno.h>
+
+long times[] = {0, 951782400, 1000000000, 1234567890, 1700000000, -86400, 4102444799, 1104537600};
+
+#define N (sizeof(times) / sizeof(times[0]))
+
+int main() {
+    unsigned i;
+    char buf[256];
+    struct tm tmv;
+    struct timespec ts, ts2;
+    for (i = 0; i < N; i++) {
+        time_t t = times[i];
+        struct tm *tm = gmtime(&t);
+        size_t n = strftime(buf, sizeof(buf),
+            "%a %A %b %B %c|%C %d %D %e %F %g %G %h %H %I %j %m %M %n%p %r %R %S %t%T %u %U %V %w %W %x %X %y %Y %%", tm);
+        printf("%ld: %s (%d)\n", (long)t, buf, (int)n);
+        printf("  %d-%d-%d %d:%d:%d wday %d yday %d\n", tm->tm_year, tm->tm_mon, tm->tm_mday,
+            tm->tm_hour, tm->tm_min, tm->tm_sec, tm->tm_wday, tm->tm_yday);
+        printf("  %s", asctime(tm));
+        tmv = *tm;
+        printf("  timegm %ld\n", (long)timegm(&tmv));
+        tmv.tm_mday += 40;
+        tmv.tm_sec -= 3600;
+        printf("  normalized %ld %d-%d-%d\n", (long)timegm(&tmv), tmv.tm_year, tmv.tm_mon, tmv.tm_mday);
+    }
+    printf("strftime(small) = %d\n", (int)strftime(buf, 5, "%Y-%m-%d", gmtime(&times[2])));
+    printf("difftime = %g\n", difftime(times[3], times[2]));
+    clock_gettime(CLOCK_MONOTONIC, &ts);
+    clock_gettime(CLOCK_MONOTONIC, &ts2);
+    printf("monotonic %d\n", ts2.tv_sec > ts.tv_sec || (ts2.tv_sec == ts.tv_sec && ts2.tv_nsec >= ts.tv_nsec));
+    clock_gettime(CLOCK_REALTIME, &ts);
+    printf("realtime %d\n", ts.tv_sec > 1600000000 && ts.tv_nsec >= 0 && ts.tv_nsec < 1000000000);
+    printf("time %d\n", time(NULL) >= ts.tv_sec);
+    printf("clock %d\n", clock() >= 0);
+    printf("invalid %d %d\n", clock_gettime(-100, &ts), errno);
+    return 0;
+}
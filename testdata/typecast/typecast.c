@@ -11,7 +11,18 @@ void call(void (*f)()) {
     printf("n: %d\n", ((int(*)(int))f)(3));
 }
 
+int tbl[400];
+
+int lookup(int *p, unsigned char c, short s, int n) {
+    return p[c] + p[s] + *(p - n);
+}
+
 int main() {
+    int i;
+    for (i = 0; i < 400; i++) {
+        tbl[i] = i;
+    }
+    printf("lookup: %d\n", lookup(tbl + 100, 200, 150, 60));
     call((void(*)())-1);
     call((void*)f);
     return 0;